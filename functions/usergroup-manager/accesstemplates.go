@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// An accessTemplate is a named, versioned access string for a common access
+// pattern. Published versions never change, so a user pinned to one keeps the
+// same access when new versions are added.
+type accessTemplate struct {
+	Name         string
+	Version      string
+	AccessString string
+}
+
+// Ref returns the template's fully qualified reference, e.g.
+// cache-aside-app@v1.
+func (t accessTemplate) Ref() string {
+	return t.Name + "@" + t.Version
+}
+
+// accessTemplates are the shipped templates, by name, oldest version first.
+// Only ever append versions.
+var accessTemplates = map[string][]accessTemplate{
+	"cache-aside-app": {
+		{Version: "v1", AccessString: "on ~* +@read +@write -@dangerous"},
+	},
+	"pubsub-worker": {
+		{Version: "v1", AccessString: "on &* -@all +@pubsub +@connection"},
+	},
+	"stream-consumer": {
+		{Version: "v1", AccessString: "on ~* -@all +@stream +@connection"},
+	},
+	"admin-break-glass": {
+		{Version: "v1", AccessString: "on ~* &* +@all"},
+	},
+}
+
+// resolveAccessTemplate returns the template a reference selects. A reference
+// is a template name, selecting its latest version, or name@version.
+func resolveAccessTemplate(ref string) (accessTemplate, error) {
+	name, version, pinned := strings.Cut(ref, "@")
+	versions, ok := accessTemplates[name]
+	if !ok {
+		return accessTemplate{}, fmt.Errorf("unknown access template %q, want one of %s", name, strings.Join(slices.Sorted(maps.Keys(accessTemplates)), ", "))
+	}
+	t := versions[len(versions)-1]
+	if pinned {
+		i := slices.IndexFunc(versions, func(t accessTemplate) bool { return t.Version == version })
+		if i < 0 {
+			return accessTemplate{}, fmt.Errorf("access template %q has no version %q", name, version)
+		}
+		t = versions[i]
+	}
+	t.Name = name
+	return t, nil
+}
+
+// CheckAuthentication returns an error if t grants every command, e.g.
+// admin-break-glass, to a user that doesn't authenticate with a password or
+// IAM.
+func (t accessTemplate) CheckAuthentication(a userAuthentication) error {
+	if !slices.Contains(strings.Fields(t.AccessString), "+@all") {
+		return nil
+	}
+	if a.Type != authenticationIAM && a.Type != authenticationPassword {
+		return fmt.Errorf("access template %q grants +@all, so it requires iam or password authentication", t.Ref())
+	}
+	return nil
+}
+
+// accessTemplatesStatus returns the access string of every template the
+// supplied users use, by reference, for audit.
+func accessTemplatesStatus(users ...[]managedUser) map[string]any {
+	out := map[string]any{}
+	for _, us := range users {
+		for _, u := range us {
+			if u.AccessTemplate != "" {
+				out[u.AccessTemplate] = u.AccessString
+			}
+		}
+	}
+	return out
+}
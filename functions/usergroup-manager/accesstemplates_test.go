@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAccessTemplatesStatus(t *testing.T) {
+	identity := []managedUser{
+		{ID: "sso-alice", AccessString: "on ~* &* +@all", AccessTemplate: "admin-break-glass@v1"},
+		{ID: "sso-bob", AccessString: "on ~* +@read"},
+	}
+	bundle := []managedUser{
+		{ID: "app1", AccessString: "on ~* +@read +@write -@dangerous", AccessTemplate: "cache-aside-app@v1"},
+		{ID: "app2", AccessString: "on ~* +@read +@write -@dangerous", AccessTemplate: "cache-aside-app@v1"},
+	}
+
+	want := map[string]any{
+		"admin-break-glass@v1": "on ~* &* +@all",
+		"cache-aside-app@v1":   "on ~* +@read +@write -@dangerous",
+	}
+	if diff := cmp.Diff(want, accessTemplatesStatus(identity, bundle)); diff != "" {
+		t.Errorf("Each template in use should be recorded once with its access string.\naccessTemplatesStatus(...): -want, +got:\n%s", diff)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// stsClient returns a client that calls STS with cfg's credentials, or the
+// function's client if it has one.
+func (f *Function) stsClient(cfg aws.Config) awsclient.STS {
+	if f.sts != nil {
+		return f.sts
+	}
+	return sts.NewFromConfig(cfg, func(o *sts.Options) {
+		o.BaseEndpoint = f.endpoint("sts")
+	})
+}
+
+// expectedAccountID returns the account the discovered users must belong to:
+// that of the assumed role, if any, or else the account the credentials
+// resolve to. GetCallerIdentity needs no IAM permissions.
+func expectedAccountID(ctx context.Context, client awsclient.STS, roleARN string) (string, error) {
+	if roleARN != "" {
+		return discovery.ARNAccount(roleARN), nil
+	}
+	out, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	return aws.ToString(out.Account), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// fakeSTS resolves every caller to account.
+type fakeSTS struct {
+	account string
+	err     error
+}
+
+func (c *fakeSTS) GetCallerIdentity(_ context.Context, _ *sts.GetCallerIdentityInput, _ ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &sts.GetCallerIdentityOutput{Account: aws.String(c.account)}, nil
+}
+
+func TestExpectedAccountID(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	type want struct {
+		account string
+		err     error
+	}
+
+	cases := map[string]struct {
+		reason  string
+		client  *fakeSTS
+		roleARN string
+		want    want
+	}{
+		"CallerIdentity": {
+			reason: "The account the credentials resolve to should be expected.",
+			client: &fakeSTS{account: "123456789012"},
+			want:   want{account: "123456789012"},
+		},
+		"AssumedRole": {
+			reason:  "The account of the assumed role should be expected, without calling STS.",
+			client:  &fakeSTS{err: errBoom},
+			roleARN: "arn:aws:iam::210987654321:role/cache-admin",
+			want:    want{account: "210987654321"},
+		},
+		"Error": {
+			reason: "Failing to get the caller identity should return an error.",
+			client: &fakeSTS{err: errBoom},
+			want:   want{err: errBoom},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			account, err := expectedAccountID(context.Background(), tc.client, tc.roleARN)
+			if diff := cmp.Diff(tc.want, want{account: account, err: err}, cmp.AllowUnexported(want{}), cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nexpectedAccountID(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+type adoptionReportParameters struct {
+	Enabled bool
+	// Interval is how often the report is regenerated.
+	Interval time.Duration
+	// Notify emits a warning event each time a report with unmanaged users
+	// is generated.
+	Notify bool
+}
+
+// An adoptionReport lists the users that match this XR's user groups but
+// aren't declared by SSO group mapping or the user bundle.
+type adoptionReport struct {
+	GeneratedTime time.Time
+	UserIDs       []string
+}
+
+// unmanagedUsers returns the matched user IDs that aren't declared, sorted.
+func unmanagedUsers(matched []string, declared ...[]managedUser) []string {
+	// The default user is never reported as unmanaged
+	known := map[string]bool{discovery.DefaultUserID: true}
+	for _, users := range declared {
+		for _, u := range users {
+			known[u.ID] = true
+		}
+	}
+
+	out := []string{}
+	for _, id := range matched {
+		if !known[id] && !slices.Contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// matchedUserIDs returns the IDs of the users in any of the supplied user
+// groups or, if there are none, every discovered user.
+func matchedUserIDs(groups []userGroupMembership, userIDs []string) []string {
+	if len(groups) == 0 {
+		return userIDs
+	}
+	var out []string
+	for _, g := range groups {
+		out = append(out, g.UserIDs...)
+	}
+	return out
+}
+
+// observedAdoptionReport returns the report recorded in the observed XR's
+// status, if any.
+func observedAdoptionReport(oxr *resource.Composite) (*adoptionReport, bool) {
+	generated, _ := oxr.Resource.GetString(status.Path("adoptionReport.generatedTime"))
+	t, err := time.Parse(time.RFC3339, generated)
+	if err != nil {
+		return nil, false
+	}
+	ids, _ := oxr.Resource.GetStringArray(status.Path("adoptionReport.unmanagedUserIDs"))
+	return &adoptionReport{GeneratedTime: t, UserIDs: ids}, true
+}
+
+// Due returns true if the report is older than interval.
+func (r *adoptionReport) Due(interval time.Duration, now time.Time) bool {
+	return now.Sub(r.GeneratedTime) >= interval
+}
+
+// Status returns the report in the form written to the XR status.
+func (r *adoptionReport) Status() map[string]any {
+	ids := r.UserIDs
+	if ids == nil {
+		ids = []string{}
+	}
+	return map[string]any{
+		"generatedTime":    r.GeneratedTime.UTC().Format(time.RFC3339),
+		"unmanagedUserIDs": ids,
+		"unmanagedUsers":   len(ids),
+	}
+}
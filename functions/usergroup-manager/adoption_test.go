@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnmanagedUsers(t *testing.T) {
+	type args struct {
+		matched  []string
+		declared [][]managedUser
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   []string
+	}{
+		"NothingDeclared": {
+			reason: "Every matched user but the default user should be reported, sorted and without duplicates.",
+			args: args{
+				matched: []string{"ops-1", "default", "app-1", "ops-1"},
+			},
+			want: []string{"app-1", "ops-1"},
+		},
+		"Declared": {
+			reason: "Users declared by any source should not be reported.",
+			args: args{
+				matched: []string{"default", "app-1", "app-2", "sso-alice-example-com"},
+				declared: [][]managedUser{
+					{{ID: "sso-alice-example-com"}},
+					{{ID: "app-1"}},
+				},
+			},
+			want: []string{"app-2"},
+		},
+		"AllDeclared": {
+			reason: "An empty report should be an empty list.",
+			args: args{
+				matched:  []string{"app-1"},
+				declared: [][]managedUser{{{ID: "app-1"}}},
+			},
+			want: []string{},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := unmanagedUsers(tc.args.matched, tc.args.declared...)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nunmanagedUsers(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// roleARNPattern matches IAM role ARNs in any partition.
+var roleARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:role/.+$`)
+
+// roleSessionNamePattern matches valid STS role session names.
+var roleSessionNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// assumeRoleParameters wrap the base credentials in an assumed role, e.g. to
+// manage caches in a spoke account from a hub account.
+type assumeRoleParameters struct {
+	RoleARN    string
+	ExternalID string
+	// SessionName defaults to the XR's AWS app ID, so CloudTrail entries in
+	// the spoke account can be attributed to it.
+	SessionName string
+}
+
+// parseAssumeRole reads the role to assume. Its ARN must be in the partition
+// of region, since credentials are only valid in their own partition.
+func parseAssumeRole(r *paramReader, region string) assumeRoleParameters {
+	p := assumeRoleParameters{
+		RoleARN:     r.String("spec.parameters.assumeRoleArn", ""),
+		ExternalID:  r.String("spec.parameters.externalId", ""),
+		SessionName: r.String("spec.parameters.sessionName", ""),
+	}
+	if p.RoleARN != "" && !roleARNPattern.MatchString(p.RoleARN) {
+		r.errs = append(r.errs, fmt.Errorf("spec.parameters.assumeRoleArn: %q is not an IAM role ARN", p.RoleARN))
+		return assumeRoleParameters{}
+	}
+	if p.RoleARN != "" {
+		if partition := discovery.ARNPartition(p.RoleARN); partition != discovery.Partition(region) {
+			r.errs = append(r.errs, fmt.Errorf("spec.parameters.assumeRoleArn: %q is in partition %s, but region %s is in %s", p.RoleARN, partition, region, discovery.Partition(region)))
+			return assumeRoleParameters{}
+		}
+	}
+	if p.SessionName != "" && !roleSessionNamePattern.MatchString(p.SessionName) {
+		r.errs = append(r.errs, fmt.Errorf("spec.parameters.sessionName: %q must be 2 to 64 letters, digits or +=,.@_- characters", p.SessionName))
+		p.SessionName = ""
+	}
+	return p
+}
+
+// assumeRole returns credentials for the role, assumed with cfg's
+// credentials. They're cached and refreshed before they expire. STS is called
+// in cfg's region, so GovCloud and China roles are assumed in their own
+// partition.
+func (f *Function) assumeRole(cfg aws.Config, p assumeRoleParameters, defaultSessionName string) *aws.CredentialsCache {
+	client := sts.NewFromConfig(cfg, func(o *sts.Options) {
+		o.BaseEndpoint = f.endpoint("sts")
+	})
+	return aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(client, p.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = defaultSessionName
+		if p.SessionName != "" {
+			o.RoleSessionName = p.SessionName
+		}
+		if p.ExternalID != "" {
+			o.ExternalID = aws.String(p.ExternalID)
+		}
+	}))
+}
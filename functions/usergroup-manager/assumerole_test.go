@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseAssumeRole(t *testing.T) {
+	type want struct {
+		p    assumeRoleParameters
+		errs int
+	}
+
+	cases := map[string]struct {
+		reason string
+		region string
+		params map[string]any
+		want   want
+	}{
+		"Unset": {
+			reason: "No role should be assumed by default.",
+			params: map[string]any{},
+		},
+		"Valid": {
+			reason: "A role ARN, external ID and session name should be read.",
+			params: map[string]any{
+				"assumeRoleArn": "arn:aws:iam::123456789012:role/elasticache-users",
+				"externalId":    "hub",
+				"sessionName":   "orders-cache",
+			},
+			want: want{p: assumeRoleParameters{RoleARN: "arn:aws:iam::123456789012:role/elasticache-users", ExternalID: "hub", SessionName: "orders-cache"}},
+		},
+		"GovCloud": {
+			reason: "Role ARNs in the GovCloud partition should be accepted in its regions.",
+			region: "us-gov-west-1",
+			params: map[string]any{"assumeRoleArn": "arn:aws-us-gov:iam::123456789012:role/path/elasticache-users"},
+			want:   want{p: assumeRoleParameters{RoleARN: "arn:aws-us-gov:iam::123456789012:role/path/elasticache-users"}},
+		},
+		"OtherPartition": {
+			reason: "A role ARN in another partition than the region should be reported and no role assumed.",
+			region: "cn-north-1",
+			params: map[string]any{"assumeRoleArn": "arn:aws:iam::123456789012:role/elasticache-users"},
+			want:   want{errs: 1},
+		},
+		"InvalidARN": {
+			reason: "A user ARN should be reported and no role assumed.",
+			params: map[string]any{"assumeRoleArn": "arn:aws:iam::123456789012:user/admin", "externalId": "hub"},
+			want:   want{errs: 1},
+		},
+		"InvalidSessionName": {
+			reason: "An invalid session name should be reported and the default used.",
+			params: map[string]any{"assumeRoleArn": "arn:aws:iam::123456789012:role/elasticache-users", "sessionName": "no spaces"},
+			want:   want{p: assumeRoleParameters{RoleARN: "arn:aws:iam::123456789012:role/elasticache-users"}, errs: 1},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			region := tc.region
+			if region == "" {
+				region = defaultRegion
+			}
+			r := &paramReader{root: map[string]any{"spec": map[string]any{"parameters": tc.params}}}
+			got := want{p: parseAssumeRole(r, region), errs: len(r.errs)}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nparseAssumeRole(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// How the users the function asks later pipeline steps to compose
+// authenticate. There's deliberately no way to compose a user that doesn't
+// need a password: anyone who can reach the cache could connect as it.
+const (
+	// authenticationIAM users authenticate with IAM, and must be named
+	// after their user ID.
+	authenticationIAM = "iam"
+
+	// authenticationPassword users authenticate with a password read from a
+	// Secret in the XR's namespace.
+	authenticationPassword = "password"
+)
+
+// A userAuthentication is how a composed user authenticates.
+type userAuthentication struct {
+	Type              string        `yaml:"type"`
+	PasswordSecretRef *secretKeyRef `yaml:"passwordSecretRef"`
+}
+
+// A secretKeyRef selects a key of a Secret in the XR's namespace.
+type secretKeyRef struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+// Validate returns an error if a is missing, or incomplete for its type.
+func (a userAuthentication) Validate() error {
+	switch a.Type {
+	case authenticationIAM:
+		if a.PasswordSecretRef != nil {
+			return errors.New("authentication.passwordSecretRef can't be set with iam authentication")
+		}
+	case authenticationPassword:
+		if a.PasswordSecretRef == nil || a.PasswordSecretRef.Name == "" || a.PasswordSecretRef.Key == "" {
+			return errors.New("authentication.passwordSecretRef.name and key are required with password authentication")
+		}
+	case "":
+		return fmt.Errorf("authentication.type is required, one of %s, %s", authenticationIAM, authenticationPassword)
+	default:
+		return fmt.Errorf("authentication.type must be one of %s, %s, got %q", authenticationIAM, authenticationPassword, a.Type)
+	}
+	return nil
+}
+
+// Context returns a in a form that can be written to the pipeline context.
+func (a userAuthentication) Context() map[string]any {
+	m := map[string]any{"type": a.Type}
+	if ref := a.PasswordSecretRef; ref != nil {
+		m["passwordSecretRef"] = map[string]any{"name": ref.Name, "key": ref.Key}
+	}
+	return m
+}
+
+// parseAuthentication reads the authentication at path. It's required, so a
+// missing or invalid one is reported.
+func parseAuthentication(r *paramReader, path string) (userAuthentication, error) {
+	a := userAuthentication{Type: r.String(path+".type", "")}
+	if name, key := r.String(path+".passwordSecretRef.name", ""), r.String(path+".passwordSecretRef.key", ""); name != "" || key != "" {
+		a.PasswordSecretRef = &secretKeyRef{Name: name, Key: key}
+	}
+	return a, a.Validate()
+}
+
+// managedUserEngine returns the engine of a user granted the supplied user
+// groups: Redis OSS if any of them is, since Valkey user groups also accept
+// Redis OSS users, otherwise that of the user groups. fallback is used if
+// none of them is configured.
+func managedUserEngine(granted []string, groups []userGroupMembership, fallback string) string {
+	engine := ""
+	for _, g := range groups {
+		for _, name := range granted {
+			if g.Name == name && (engine == "" || g.Engine == engineRedis) {
+				engine = g.Engine
+			}
+		}
+	}
+	if engine == "" {
+		return fallback
+	}
+	return engine
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+
+	"github.com/crossplane/function-sdk-go/logging"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// An apiCall records a single AWS API operation, including all of its retry
+// attempts.
+type apiCall struct {
+	Service   string
+	Operation string
+	RequestID string
+	Attempts  int
+	Throttles int
+	Duration  time.Duration
+	Err       error
+
+	// Input and Output are only recorded when capturing calls for a support
+	// bundle.
+	Input  any
+	Output any
+}
+
+// An apiCallRecorder is installed as AWS SDK middleware and records every API
+// call made through the clients of one RunFunction invocation. Each call is
+// written to the debug log as it completes, so changes can be traced to the
+// AWS request IDs that made them, and counted in metrics. A large account
+// needs a call per user for some operations, so only a summary of each phase
+// of the run is written to the info log.
+type apiCallRecorder struct {
+	log logging.Logger
+
+	// Metrics counts calls in metrics. It's false for compositions that opted
+	// out of telemetry, or runs that weren't sampled.
+	Metrics bool
+
+	// Capture keeps every call, including its input and output, so it can be
+	// written to a support bundle.
+	Capture bool
+
+	mu     sync.Mutex
+	calls  []apiCall
+	totals apiCallTotals
+}
+
+// apiCallTotals are the totals of the calls a recorder recorded.
+type apiCallTotals struct {
+	Calls     int
+	Failed    int
+	Throttles int
+	Elapsed   time.Duration
+}
+
+// Install adds the recorder to an SDK middleware stack. Use it as an
+// aws.Config APIOptions entry.
+func (r *apiCallRecorder) Install(stack *middleware.Stack) error {
+	// Initialize runs once per operation, outside the retry loop, so the
+	// recorded duration and attempt results cover every attempt.
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("APICallRecorder",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			start := time.Now()
+			out, md, err := next.HandleInitialize(ctx, in)
+			r.record(ctx, md, time.Since(start), err, in.Parameters, out.Result)
+			return out, md, err
+		}), middleware.After)
+}
+
+func (r *apiCallRecorder) record(ctx context.Context, md middleware.Metadata, d time.Duration, err error, input, output any) {
+	c := apiCall{
+		Service:   awsmiddleware.GetServiceID(ctx),
+		Operation: awsmiddleware.GetOperationName(ctx),
+		Duration:  d,
+		Err:       err,
+	}
+	c.RequestID, _ = awsmiddleware.GetRequestIDMetadata(md)
+
+	throttles := retry.IsErrorThrottles(retry.DefaultThrottles)
+	if results, ok := retry.GetAttemptResults(md); ok {
+		c.Attempts = len(results.Results)
+		for _, a := range results.Results {
+			if a.Err != nil && throttles.IsErrorThrottle(a.Err) == aws.TrueTernary {
+				c.Throttles++
+			}
+		}
+	}
+
+	if r.Metrics {
+		awsAPICalls.WithLabelValues(c.Service, c.Operation, awsclient.Outcome(err)).Inc()
+		awsAPIRetries.WithLabelValues(c.Service, c.Operation).Add(float64(max(c.Attempts-1, 0)))
+		awsAPIThrottles.WithLabelValues(c.Service, c.Operation).Add(float64(c.Throttles))
+	}
+
+	kv := []any{
+		"service", c.Service,
+		"operation", c.Operation,
+		"requestId", c.RequestID,
+		"attempts", c.Attempts,
+		"throttles", c.Throttles,
+		"durationMs", c.Duration.Milliseconds(),
+	}
+	if err != nil {
+		kv = append(kv, "error", err)
+	}
+	r.log.Debug("AWS API call", kv...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.totals.Calls++
+	if err != nil {
+		r.totals.Failed++
+	}
+	r.totals.Throttles += c.Throttles
+	r.totals.Elapsed += c.Duration
+	if !r.Capture {
+		return
+	}
+	c.Input, c.Output = input, output
+	if len(r.calls) < maxCapturedCalls {
+		r.calls = append(r.calls, c)
+	}
+}
+
+// maxCapturedCalls bounds the number of calls kept for a support bundle.
+const maxCapturedCalls = 200
+
+// Calls returns the captured calls.
+func (r *apiCallRecorder) Calls() []apiCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.calls)
+}
+
+// Totals returns how many calls were made, how many of their attempts were
+// throttled, and how long they took in total. Concurrent calls are summed, so
+// the total can exceed the run's duration.
+func (r *apiCallRecorder) Totals() (calls, throttles int, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.totals.Calls, r.totals.Throttles, r.totals.Elapsed
+}
+
+// Mark returns the totals of the calls recorded so far, to summarize the calls
+// recorded after them.
+func (r *apiCallRecorder) Mark() apiCallTotals {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.totals
+}
+
+// Summarize logs a summary of the calls recorded since the supplied mark, e.g.
+// those of one phase of the run, if there were any.
+func (r *apiCallRecorder) Summarize(phase string, mark apiCallTotals) {
+	t := r.Mark()
+	if t.Calls == mark.Calls {
+		return
+	}
+	r.log.Info("AWS API calls",
+		"phase", phase,
+		"calls", t.Calls-mark.Calls,
+		"failed", t.Failed-mark.Failed,
+		"throttles", t.Throttles-mark.Throttles,
+		"durationMs", (t.Elapsed - mark.Elapsed).Milliseconds(),
+	)
+}
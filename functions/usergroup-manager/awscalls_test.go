@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/go-logr/logr/funcr"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/logging"
+)
+
+// A fakeHTTPClient returns each of its responses in turn, then keeps
+// returning the last one.
+type fakeHTTPClient struct {
+	responses []func() *http.Response
+	calls     int
+}
+
+func (c *fakeHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	rsp := c.responses[min(c.calls, len(c.responses)-1)]()
+	c.calls++
+	rsp.Request = r
+	return rsp, nil
+}
+
+func TestAPICallRecorder(t *testing.T) {
+	ok := func() *http.Response {
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"X-Amzn-Requestid": {"req-ok"}}, Body: io.NopCloser(strings.NewReader(
+			`<DescribeUserGroupsResponse><DescribeUserGroupsResult><UserGroups/></DescribeUserGroupsResult><ResponseMetadata><RequestId>req-ok</RequestId></ResponseMetadata></DescribeUserGroupsResponse>`))}
+	}
+	throttled := func() *http.Response {
+		return &http.Response{StatusCode: http.StatusBadRequest, Header: http.Header{"X-Amzn-Requestid": {"req-throttled"}}, Body: io.NopCloser(strings.NewReader(
+			`<ErrorResponse><Error><Type>Sender</Type><Code>Throttling</Code><Message>Rate exceeded</Message></Error><RequestId>req-throttled</RequestId></ErrorResponse>`))}
+	}
+
+	type want struct {
+		calls     []apiCall
+		err       bool
+		count     int
+		throttles int
+	}
+
+	cases := map[string]struct {
+		reason      string
+		responses   []func() *http.Response
+		maxAttempts int
+		want        want
+	}{
+		"Success": {
+			reason:      "A call that succeeds at once should be recorded with a single attempt.",
+			responses:   []func() *http.Response{ok},
+			maxAttempts: 3,
+			want: want{
+				calls: []apiCall{{Service: "ElastiCache", Operation: "DescribeUserGroups", RequestID: "req-ok", Attempts: 1}},
+				count: 1,
+			},
+		},
+		"Throttled": {
+			reason:      "Every attempt of a call, and the throttled ones, should be recorded.",
+			responses:   []func() *http.Response{throttled, throttled, ok},
+			maxAttempts: 3,
+			want: want{
+				calls:     []apiCall{{Service: "ElastiCache", Operation: "DescribeUserGroups", RequestID: "req-ok", Attempts: 3, Throttles: 2}},
+				count:     1,
+				throttles: 2,
+			},
+		},
+		"GaveUp": {
+			reason:      "A call that's throttled on every attempt should be recorded with its error.",
+			responses:   []func() *http.Response{throttled},
+			maxAttempts: 2,
+			want: want{
+				calls:     []apiCall{{Service: "ElastiCache", Operation: "DescribeUserGroups", RequestID: "req-throttled", Attempts: 2, Throttles: 2}},
+				err:       true,
+				count:     1,
+				throttles: 2,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &apiCallRecorder{log: logging.NewNopLogger(), Capture: true}
+			client := elasticache.New(elasticache.Options{
+				Region:      "us-east-1",
+				Credentials: aws.AnonymousCredentials{},
+				HTTPClient:  &fakeHTTPClient{responses: tc.responses},
+				Retryer: retry.NewStandard(func(o *retry.StandardOptions) {
+					o.MaxAttempts = tc.maxAttempts
+					o.RateLimiter = ratelimit.None
+					o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+				}),
+				APIOptions: []func(*middleware.Stack) error{r.Install},
+			})
+			_, err := client.DescribeUserGroups(context.Background(), &elasticache.DescribeUserGroupsInput{})
+
+			count, throttles, _ := r.Totals()
+			got := want{calls: r.Calls(), err: err != nil, count: count, throttles: throttles}
+			ignore := cmp.FilterPath(func(p cmp.Path) bool {
+				switch p.Last().String() {
+				case ".Duration", ".Err", ".Input", ".Output":
+					return true
+				}
+				return false
+			}, cmp.Ignore())
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{}), ignore); diff != "" {
+				t.Errorf("%s\nrecord(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestAPICallRecorderSummarize(t *testing.T) {
+	var lines []string
+	log := funcr.New(func(_, args string) { lines = append(lines, args) }, funcr.Options{Verbosity: 1})
+	r := &apiCallRecorder{log: logging.NewLogrLogger(log)}
+
+	mark := r.Mark()
+	r.Summarize("Filtering", mark)
+	r.record(context.Background(), middleware.Metadata{}, 0, nil, nil, nil)
+	r.record(context.Background(), middleware.Metadata{}, 0, errors.New("boom"), nil, nil)
+	r.Summarize("Discovery", mark)
+
+	want := []string{
+		`"level"=1 "msg"="AWS API call" "service"="" "operation"="" "requestId"="" "attempts"=0 "throttles"=0 "durationMs"=0`,
+		`"level"=1 "msg"="AWS API call" "service"="" "operation"="" "requestId"="" "attempts"=0 "throttles"=0 "durationMs"=0 "error"="boom"`,
+		`"level"=0 "msg"="AWS API calls" "phase"="Discovery" "calls"=2 "failed"=1 "throttles"=0 "durationMs"=0`,
+	}
+	if diff := cmp.Diff(want, lines); diff != "" {
+		t.Errorf("Summarize(...): each call should be logged at debug level, and a summary of the phases that made calls at info level: -want, +got:\n%s", diff)
+	}
+}
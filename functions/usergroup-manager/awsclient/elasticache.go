@@ -0,0 +1,24 @@
+// Package awsclient defines the AWS APIs the function calls, and classifies
+// the errors they return.
+package awsclient
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+)
+
+// ElastiCache is the subset of the ElastiCache API the function calls.
+type ElastiCache interface {
+	DescribeUsers(ctx context.Context, in *elasticache.DescribeUsersInput, o ...func(*elasticache.Options)) (*elasticache.DescribeUsersOutput, error)
+	DescribeUserGroups(ctx context.Context, in *elasticache.DescribeUserGroupsInput, o ...func(*elasticache.Options)) (*elasticache.DescribeUserGroupsOutput, error)
+	CreateUser(ctx context.Context, in *elasticache.CreateUserInput, o ...func(*elasticache.Options)) (*elasticache.CreateUserOutput, error)
+	ModifyUserGroup(ctx context.Context, in *elasticache.ModifyUserGroupInput, o ...func(*elasticache.Options)) (*elasticache.ModifyUserGroupOutput, error)
+	AddTagsToResource(ctx context.Context, in *elasticache.AddTagsToResourceInput, o ...func(*elasticache.Options)) (*elasticache.AddTagsToResourceOutput, error)
+	RemoveTagsFromResource(ctx context.Context, in *elasticache.RemoveTagsFromResourceInput, o ...func(*elasticache.Options)) (*elasticache.RemoveTagsFromResourceOutput, error)
+	ListTagsForResource(ctx context.Context, in *elasticache.ListTagsForResourceInput, o ...func(*elasticache.Options)) (*elasticache.ListTagsForResourceOutput, error)
+	DescribeServerlessCaches(ctx context.Context, in *elasticache.DescribeServerlessCachesInput, o ...func(*elasticache.Options)) (*elasticache.DescribeServerlessCachesOutput, error)
+	DescribeReplicationGroups(ctx context.Context, in *elasticache.DescribeReplicationGroupsInput, o ...func(*elasticache.Options)) (*elasticache.DescribeReplicationGroupsOutput, error)
+	DescribeCacheClusters(ctx context.Context, in *elasticache.DescribeCacheClustersInput, o ...func(*elasticache.Options)) (*elasticache.DescribeCacheClustersOutput, error)
+	ModifyReplicationGroup(ctx context.Context, in *elasticache.ModifyReplicationGroupInput, o ...func(*elasticache.Options)) (*elasticache.ModifyReplicationGroupOutput, error)
+}
@@ -0,0 +1,151 @@
+package awsclient
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Kinds of AWS error. Every AWS error a client with ClassifyErrors installed
+// returns wraps one of these if its kind is known, so callers can test errors
+// with errors.Is rather than matching AWS error codes.
+var (
+	// ErrThrottled means AWS refused the call because of its rate limits.
+	// The SDK already retried it.
+	ErrThrottled = errors.New("throttled")
+	// ErrNotFound means a resource the call names doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means a resource is in a state that doesn't allow the
+	// call, e.g. it's being modified, or already exists.
+	ErrConflict = errors.New("conflict")
+	// ErrValidation means AWS rejected the call's parameters.
+	ErrValidation = errors.New("invalid request")
+)
+
+// errorKindCodes maps the AWS error codes of the services the function calls
+// to their kind. Throttling codes are recognized by the SDK's retryer.
+var errorKindCodes = map[string]error{
+	"UserNotFound":                     ErrNotFound,
+	"UserGroupNotFound":                ErrNotFound,
+	"ReplicationGroupNotFoundFault":    ErrNotFound,
+	"CacheClusterNotFound":             ErrNotFound,
+	"ServerlessCacheNotFoundFault":     ErrNotFound,
+	"NoSuchEntity":                     ErrNotFound,
+	"NotFoundException":                ErrNotFound,
+	"EffectivePolicyNotFoundException": ErrNotFound,
+
+	"InvalidUserState":                 ErrConflict,
+	"InvalidUserGroupState":            ErrConflict,
+	"InvalidReplicationGroupState":     ErrConflict,
+	"DuplicateUserName":                ErrConflict,
+	"UserAlreadyExists":                ErrConflict,
+	"UserGroupAlreadyExists":           ErrConflict,
+	"DefaultUserAssociatedToUserGroup": ErrConflict,
+	"ConcurrentModification":           ErrConflict,
+
+	"InvalidParameterValue":       ErrValidation,
+	"InvalidParameterCombination": ErrValidation,
+	"InvalidARN":                  ErrValidation,
+	"DefaultUserRequired":         ErrValidation,
+	"ValidationError":             ErrValidation,
+	"ValidationException":         ErrValidation,
+}
+
+// accessDeniedCodes are the error codes AWS services return when the caller
+// lacks permission for an action.
+var accessDeniedCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AccessDeniedException": true,
+	"UnauthorizedOperation": true,
+}
+
+// IsAccessDenied returns true if AWS refused the call because the caller lacks
+// permission for it.
+func IsAccessDenied(err error) bool {
+	var ae smithy.APIError
+	return errors.As(err, &ae) && accessDeniedCodes[ae.ErrorCode()]
+}
+
+// A kindError is an AWS error annotated with its kind.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// Kind returns the kind of err, or nil if it isn't known.
+func Kind(err error) error {
+	for _, kind := range []error{ErrThrottled, ErrNotFound, ErrConflict, ErrValidation} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	var ae smithy.APIError
+	if !errors.As(err, &ae) {
+		return nil
+	}
+	if retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+		return ErrThrottled
+	}
+	return errorKindCodes[ae.ErrorCode()]
+}
+
+// Classify returns err wrapping its kind, if it's known.
+func Classify(err error) error {
+	kind := Kind(err)
+	if kind == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// ClassifyErrors adds the kind of every error an AWS client returns to it.
+// Install it with the client's API options.
+func ClassifyErrors(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ClassifyErrors",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			out, md, err := next.HandleInitialize(ctx, in)
+			if err != nil {
+				err = Classify(err)
+			}
+			return out, md, err
+		}), middleware.Before)
+}
+
+// Outcome returns the outcome label of an AWS API call's metrics.
+func Outcome(err error) string {
+	switch Kind(err) {
+	case nil:
+		if err == nil {
+			return "success"
+		}
+		return "error"
+	case ErrThrottled:
+		return "throttled"
+	case ErrNotFound:
+		return "not_found"
+	case ErrConflict:
+		return "conflict"
+	default:
+		return "validation"
+	}
+}
+
+// IsTransient returns true if err is likely to go away on its own, so the
+// call should be retried on the next reconcile rather than reported as a
+// failure.
+func IsTransient(err error) bool {
+	kind := Kind(err)
+	return kind == ErrThrottled || kind == ErrConflict
+}
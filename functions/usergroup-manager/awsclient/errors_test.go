@@ -0,0 +1,95 @@
+package awsclient
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestKind(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		err    error
+		want   error
+	}{
+		"Throttled": {
+			reason: "Throttling error codes should be recognized as the SDK's retryer does.",
+			err:    &smithy.GenericAPIError{Code: "Throttling"},
+			want:   ErrThrottled,
+		},
+		"NotFound": {
+			reason: "Typed ElastiCache faults should be classified by their error code.",
+			err:    fmt.Errorf("failed to describe user group %q: %w", "app", &types.UserGroupNotFoundFault{}),
+			want:   ErrNotFound,
+		},
+		"Conflict": {
+			reason: "A resource in the wrong state for the call should be a conflict.",
+			err:    &smithy.GenericAPIError{Code: "InvalidUserGroupState"},
+			want:   ErrConflict,
+		},
+		"Validation": {
+			reason: "Rejected parameters should be a validation error.",
+			err:    &smithy.GenericAPIError{Code: "InvalidParameterValue"},
+			want:   ErrValidation,
+		},
+		"UnknownCode": {
+			reason: "AWS errors of unknown kind should have no kind.",
+			err:    &smithy.GenericAPIError{Code: "AccessDenied"},
+			want:   nil,
+		},
+		"NotAWS": {
+			reason: "Errors that didn't come from AWS should have no kind.",
+			err:    errors.New("boom"),
+			want:   nil,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, Kind(tc.err), cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nKind(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	raw := &smithy.GenericAPIError{Code: "InvalidUserGroupState", Message: "user group is modifying"}
+	err := fmt.Errorf("failed to modify user group %q: %w", "app", Classify(raw))
+
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Classify(...): want errors.Is(err, ErrConflict)")
+	}
+	var ae smithy.APIError
+	if !errors.As(err, &ae) || ae.ErrorCode() != "InvalidUserGroupState" {
+		t.Errorf("Classify(...): want the AWS error to still be reachable with errors.As")
+	}
+	if diff := cmp.Diff(`failed to modify user group "app": api error InvalidUserGroupState: user group is modifying`, err.Error()); diff != "" {
+		t.Errorf("Classify(...): the message should be unchanged: -want, +got:\n%s", diff)
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	cases := map[string]struct {
+		err  error
+		want string
+	}{
+		"Success":   {err: nil, want: "success"},
+		"Throttled": {err: &smithy.GenericAPIError{Code: "ThrottlingException"}, want: "throttled"},
+		"NotFound":  {err: &types.UserNotFoundFault{}, want: "not_found"},
+		"Unknown":   {err: errors.New("boom"), want: "error"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, Outcome(tc.err)); diff != "" {
+				t.Errorf("Outcome(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// userBundleKey is the required resources key of the ConfigMap holding the
+// user bundle.
+const userBundleKey = "userBundle"
+
+// defaultUserBundleDataKey is the ConfigMap data key read by default.
+const defaultUserBundleDataKey = "users.yaml"
+
+type userBundleParameters struct {
+	// ConfigMapName is the ConfigMap, in the XR's namespace, holding the user
+	// bundle. The bundle is disabled if it's empty.
+	ConfigMapName string
+	Key           string
+}
+
+// A userBundle is a document of user definitions, typically maintained in git
+// and synced to a ConfigMap:
+//
+//	users:
+//	- userId: app1
+//	  userName: app1
+//	  engine: redis
+//	  accessString: on ~app1:* +@all
+//	  authentication:
+//	    type: password
+//	    passwordSecretRef: {name: app1-cache, key: password}
+//	  userGroups: [app]
+//	  observeOnly: false
+//	- userId: worker
+//	  accessTemplate: pubsub-worker
+//	  authentication:
+//	    type: iam@v1
+type userBundle struct {
+	Users []bundleUser `yaml:"users"`
+}
+
+type bundleUser struct {
+	UserID       string `yaml:"userId"`
+	UserName     string `yaml:"userName"`
+	Engine       string `yaml:"engine"`
+	AccessString string `yaml:"accessString"`
+	// AccessTemplate selects a shipped access string instead of AccessString.
+	AccessTemplate string             `yaml:"accessTemplate"`
+	Authentication userAuthentication `yaml:"authentication"`
+	UserGroups     []string           `yaml:"userGroups"`
+	ObserveOnly    bool               `yaml:"observeOnly"`
+}
+
+// A bundleError reports every problem found in a user bundle, each prefixed
+// with the YAML path and line of the offending user where known.
+type bundleError struct {
+	Problems []string
+}
+
+func (e *bundleError) Error() string {
+	return "invalid user bundle: " + strings.Join(e.Problems, "; ")
+}
+
+// parseUserBundle parses and validates a user bundle. Unknown fields are
+// rejected so typos don't silently drop settings. The bundle is all or
+// nothing: if any user is invalid a *bundleError listing every problem is
+// returned, and no users.
+func parseUserBundle(doc string) ([]managedUser, error) {
+	b := &userBundle{}
+	dec := yaml.NewDecoder(strings.NewReader(doc))
+	dec.KnownFields(true)
+	if err := dec.Decode(b); err != nil && !errors.Is(err, io.EOF) {
+		return nil, &bundleError{Problems: yamlProblems(err)}
+	}
+
+	// Decode again to a node tree, which records where each user is defined.
+	root := &yaml.Node{}
+	_ = yaml.Unmarshal([]byte(doc), root)
+	lines := userLines(root)
+
+	users := make([]managedUser, 0, len(b.Users))
+	seen := map[string]bool{}
+	var problems []string
+	for i, u := range b.Users {
+		if err := validateBundleUser(u, seen); err != nil {
+			path := fmt.Sprintf("users[%d]", i)
+			if i < len(lines) {
+				path = fmt.Sprintf("%s (line %d)", path, lines[i])
+			}
+			problems = append(problems, fmt.Sprintf("%s: %s", path, err))
+			continue
+		}
+		seen[u.UserID] = true
+
+		var template string
+		if u.AccessTemplate != "" {
+			// Validated above.
+			t, _ := resolveAccessTemplate(u.AccessTemplate)
+			u.AccessString, template = t.AccessString, t.Ref()
+		}
+
+		m := managedUser{
+			ID:             u.UserID,
+			Name:           u.UserName,
+			Engine:         strings.ToLower(u.Engine),
+			AccessString:   u.AccessString,
+			AccessTemplate: template,
+			Authentication: u.Authentication,
+			UserGroups:     u.UserGroups,
+			ObserveOnly:    u.ObserveOnly,
+		}
+		if m.Name == "" {
+			m.Name = m.ID
+		}
+		if m.Engine == "" {
+			m.Engine = engineRedis
+		}
+		if m.UserGroups == nil {
+			m.UserGroups = []string{}
+		}
+		users = append(users, m)
+	}
+	if len(problems) > 0 {
+		return nil, &bundleError{Problems: problems}
+	}
+	return users, nil
+}
+
+func validateBundleUser(u bundleUser, seen map[string]bool) error {
+	switch {
+	case u.UserID == "":
+		return errors.New("userId is required")
+	case len(u.UserID) > maxUserIDLength || !userGroupIDPattern.MatchString(u.UserID):
+		return fmt.Errorf("%q is not a valid user ID", u.UserID)
+	case strings.HasPrefix(u.UserID, identityUserIDPrefix):
+		return fmt.Errorf("user ID %q uses the %q prefix reserved for SSO users", u.UserID, identityUserIDPrefix)
+	case seen[u.UserID]:
+		return fmt.Errorf("duplicate user ID %q", u.UserID)
+	case u.AccessString == "" && u.AccessTemplate == "":
+		return fmt.Errorf("user %q: accessString or accessTemplate is required", u.UserID)
+	case u.AccessString != "" && u.AccessTemplate != "":
+		return fmt.Errorf("user %q: accessString and accessTemplate are mutually exclusive", u.UserID)
+	}
+	if u.AccessTemplate != "" {
+		t, err := resolveAccessTemplate(u.AccessTemplate)
+		if err == nil {
+			err = t.CheckAuthentication(u.Authentication)
+		}
+		if err != nil {
+			return fmt.Errorf("user %q: %w", u.UserID, err)
+		}
+	}
+	switch strings.ToLower(u.Engine) {
+	case "", engineRedis, engineValkey:
+	default:
+		return fmt.Errorf("user %q: engine must be one of %s, %s, got %q", u.UserID, engineRedis, engineValkey, u.Engine)
+	}
+	if err := u.Authentication.Validate(); err != nil {
+		return fmt.Errorf("user %q: %w", u.UserID, err)
+	}
+	if u.Authentication.Type == authenticationIAM && u.UserName != "" && u.UserName != u.UserID {
+		return fmt.Errorf("user %q: userName must be the user ID with iam authentication", u.UserID)
+	}
+	return nil
+}
+
+// yamlProblems splits a YAML decoding error into its individual problems,
+// which already reference their lines, e.g. "line 4: field accesString not
+// found in type main.bundleUser".
+func yamlProblems(err error) []string {
+	var te *yaml.TypeError
+	if errors.As(err, &te) {
+		return te.Errors
+	}
+	return []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+}
+
+// userLines returns the line on which each entry of the bundle's users list
+// starts.
+func userLines(root *yaml.Node) []int {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil
+	}
+	m := root.Content[0]
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value != "users" || m.Content[i+1].Kind != yaml.SequenceNode {
+			continue
+		}
+		lines := make([]int, len(m.Content[i+1].Content))
+		for j, n := range m.Content[i+1].Content {
+			lines[j] = n.Line
+		}
+		return lines
+	}
+	return nil
+}
+
+// bundleUsersFromConfigMap reads and validates the user bundle in the
+// supplied ConfigMap.
+func bundleUsersFromConfigMap(cm *unstructured.Unstructured, p userBundleParameters) ([]managedUser, error) {
+	doc, err := configMapValue(cm, p.Key)
+	if err != nil {
+		return nil, err
+	}
+	return parseUserBundle(doc)
+}
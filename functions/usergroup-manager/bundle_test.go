@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseUserBundle(t *testing.T) {
+	iam := userAuthentication{Type: authenticationIAM}
+	password := userAuthentication{Type: authenticationPassword, PasswordSecretRef: &secretKeyRef{Name: "analytics-cache", Key: "password"}}
+
+	type want struct {
+		users []managedUser
+		err   string
+	}
+
+	cases := map[string]struct {
+		reason string
+		doc    string
+		want   want
+	}{
+		"Valid": {
+			reason: "Valid users should be read in order, with defaults for optional fields.",
+			doc: `
+users:
+- userId: app1
+  accessString: on ~app1:* +@all
+  authentication:
+    type: iam
+  userGroups: [app]
+- userId: analytics
+  userName: analytics-reader
+  engine: Valkey
+  accessString: on ~* +@read
+  authentication:
+    type: password
+    passwordSecretRef: {name: analytics-cache, key: password}
+  observeOnly: true
+`,
+			want: want{users: []managedUser{
+				{ID: "app1", Name: "app1", Engine: engineRedis, AccessString: "on ~app1:* +@all", Authentication: iam, UserGroups: []string{"app"}},
+				{ID: "analytics", Name: "analytics-reader", Engine: engineValkey, AccessString: "on ~* +@read", Authentication: password, UserGroups: []string{}, ObserveOnly: true},
+			}},
+		},
+		"AccessTemplates": {
+			reason: "Access templates should resolve to their access string, and record which template they came from.",
+			doc: `
+users:
+- userId: worker
+  accessTemplate: pubsub-worker
+  authentication: {type: iam}
+- userId: admin
+  accessTemplate: admin-break-glass@v1
+  authentication: {type: iam}
+`,
+			want: want{users: []managedUser{
+				{ID: "worker", Name: "worker", Engine: engineRedis, AccessString: "on &* -@all +@pubsub +@connection", AccessTemplate: "pubsub-worker@v1", Authentication: iam, UserGroups: []string{}},
+				{ID: "admin", Name: "admin", Engine: engineRedis, AccessString: "on ~* &* +@all", AccessTemplate: "admin-break-glass@v1", Authentication: iam, UserGroups: []string{}},
+			}},
+		},
+		"InvalidAccessTemplates": {
+			reason: "Unknown templates or versions, and templates alongside access strings, should be reported.",
+			doc: `
+users:
+- userId: app1
+  accessTemplate: cache-aside
+- userId: app2
+  accessTemplate: cache-aside-app@v9
+- userId: app3
+  accessString: on ~* +@all
+  accessTemplate: cache-aside-app
+- userId: admin
+  accessTemplate: admin-break-glass
+`,
+			want: want{err: "invalid user bundle: " +
+				`users[0] (line 3): user "app1": unknown access template "cache-aside", want one of admin-break-glass, cache-aside-app, pubsub-worker, stream-consumer; ` +
+				`users[1] (line 5): user "app2": access template "cache-aside-app" has no version "v9"; ` +
+				`users[2] (line 7): user "app3": accessString and accessTemplate are mutually exclusive; ` +
+				`users[3] (line 10): user "admin": access template "admin-break-glass@v1" grants +@all, so it requires iam or password authentication`,
+			},
+		},
+		"UnknownField": {
+			reason: "Unknown fields should be rejected, with their line, so typos don't silently drop settings.",
+			doc: `
+users:
+- userId: app1
+  accesString: on ~app1:* +@all
+`,
+			want: want{err: "invalid user bundle: line 4: field accesString not found in type main.bundleUser"},
+		},
+		"InvalidUsers": {
+			reason: "Every invalid user should be reported with its path and line, and no users returned.",
+			doc: `
+users:
+- userId: app1
+  accessString: on ~app1:* +@all
+  authentication: {type: iam}
+- userId: app1
+  accessString: on ~* +@all
+- userId: 1app
+  accessString: on ~* +@all
+- userId: sso-alice
+  accessString: on ~* +@all
+- userId: app2
+- userId: app3
+  engine: memcached
+  accessString: on ~* +@all
+- userId: app4
+  accessString: on ~* +@all
+- userId: app5
+  accessString: on ~* +@all
+  authentication: {type: password}
+- userId: app6
+  userName: app6-reader
+  accessString: on ~* +@read
+  authentication: {type: iam}
+`,
+			want: want{err: "invalid user bundle: " +
+				`users[1] (line 6): duplicate user ID "app1"; ` +
+				`users[2] (line 8): "1app" is not a valid user ID; ` +
+				`users[3] (line 10): user ID "sso-alice" uses the "sso-" prefix reserved for SSO users; ` +
+				`users[4] (line 12): user "app2": accessString or accessTemplate is required; ` +
+				`users[5] (line 13): user "app3": engine must be one of redis, valkey, got "memcached"; ` +
+				`users[6] (line 16): user "app4": authentication.type is required, one of iam, password; ` +
+				`users[7] (line 18): user "app5": authentication.passwordSecretRef.name and key are required with password authentication; ` +
+				`users[8] (line 21): user "app6": userName must be the user ID with iam authentication`,
+			},
+		},
+		"Malformed": {
+			reason: "Malformed YAML should be reported with its line.",
+			doc: `
+users:
+- userId: app1
+  accessString: [
+`,
+			want: want{err: "invalid user bundle: line 4: did not find expected node content"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			users, err := parseUserBundle(tc.doc)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if diff := cmp.Diff(tc.want.users, users); diff != "" {
+				t.Errorf("%s\nparseUserBundle(...): -want users, +got users:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, got); diff != "" {
+				t.Errorf("%s\nparseUserBundle(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// Where users are discovered.
+const (
+	// discoverySourceAWS lists users with the ElastiCache DescribeUsers API.
+	discoverySourceAWS = "aws"
+	// discoverySourceCluster reads provider-aws's User MRs from the API
+	// server instead, avoiding AWS throttling.
+	discoverySourceCluster = "cluster"
+)
+
+// clusterUsersKey is the required resources key of the User MRs discovered
+// in cluster mode.
+const clusterUsersKey = "clusterUsers"
+
+// clusterUsersSelector selects the User MRs, in any namespace, labelled with
+// key and value.
+func clusterUsersSelector(key, value string) *fnv1.ResourceSelector {
+	return &fnv1.ResourceSelector{
+		ApiVersion: userMRAPIVersion,
+		Kind:       userMRKind,
+		Match: &fnv1.ResourceSelector_MatchLabels{MatchLabels: &fnv1.MatchLabels{
+			Labels: map[string]string{key: value},
+		}},
+	}
+}
+
+// clusterUsers returns the users managed by the supplied User MRs in region,
+// sorted by ID, always including the default user ElastiCache creates in
+// every account. Users whose MR isn't ready yet, i.e. that are still being
+// provisioned, or that are being deleted, are only returned by ID, as
+// provisioning.
+func clusterUsers(rs []resource.Required, region string) (users []discovery.User, provisioning []string) {
+	users = []discovery.User{{ID: discovery.DefaultUserID, Name: discovery.DefaultUserID, Engine: engineRedis}}
+	for _, r := range rs {
+		u := r.Resource
+		if u == nil {
+			continue
+		}
+		if rg, _, _ := unstructured.NestedString(u.Object, "spec", "forProvider", "region"); rg != region {
+			continue
+		}
+		id := u.GetAnnotations()[externalNameAnnotation]
+		if id == "" {
+			id = u.GetName()
+		}
+		if id == discovery.DefaultUserID {
+			continue
+		}
+		if u.GetDeletionTimestamp() != nil || !userMRReady(r) {
+			provisioning = append(provisioning, id)
+			continue
+		}
+		du := discovery.User{ID: id}
+		du.ARN, _, _ = unstructured.NestedString(u.Object, "status", "atProvider", "arn")
+		du.Name, _, _ = unstructured.NestedString(u.Object, "spec", "forProvider", "userName")
+		engine, _, _ := unstructured.NestedString(u.Object, "spec", "forProvider", "engine")
+		du.Engine = strings.ToLower(engine)
+		modes, _, _ := unstructured.NestedSlice(u.Object, "spec", "forProvider", "authenticationMode")
+		if len(modes) > 0 {
+			if m, ok := modes[0].(map[string]any); ok {
+				du.AuthenticationType, _ = m["type"].(string)
+			}
+		}
+		// User MRs take the input authentication type, which names
+		// no-password differently
+		if du.AuthenticationType == string(types.InputAuthenticationTypeNoPassword) {
+			du.AuthenticationType = string(types.AuthenticationTypeNoPassword)
+		}
+		users = append(users, du)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	sort.Strings(provisioning)
+	return users, provisioning
+}
+
+// userMRReady returns true if the MR's Ready condition is True.
+func userMRReady(r resource.Required) bool {
+	conditions, _, _ := unstructured.NestedSlice(r.Resource.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]any)
+		if ok && m["type"] == "Ready" {
+			return m["status"] == "True"
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestClusterUsers(t *testing.T) {
+	type mrOpts struct {
+		region   string
+		ready    bool
+		deleting bool
+		authType string
+	}
+	mr := func(name string, o mrOpts) resource.Required {
+		forProvider := map[string]any{"region": o.region, "userName": name, "engine": "Redis"}
+		if o.authType != "" {
+			forProvider["authenticationMode"] = []any{map[string]any{"type": o.authType}}
+		}
+		status := "False"
+		if o.ready {
+			status = "True"
+		}
+		u := &unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{"forProvider": forProvider},
+			"status": map[string]any{
+				"atProvider": map[string]any{"arn": "arn:aws:elasticache:us-east-1:123456789012:user:" + name},
+				"conditions": []any{map[string]any{"type": "Ready", "status": status}},
+			},
+		}}
+		u.SetName(name)
+		if o.deleting {
+			now := metav1.Now()
+			u.SetDeletionTimestamp(&now)
+		}
+		return resource.Required{Resource: u}
+	}
+
+	type want struct {
+		users        []discovery.User
+		provisioning []string
+	}
+
+	defaultUser := discovery.User{ID: discovery.DefaultUserID, Name: discovery.DefaultUserID, Engine: engineRedis}
+
+	cases := map[string]struct {
+		reason string
+		mrs    []resource.Required
+		want   want
+	}{
+		"None": {
+			reason: "The default user should always be discovered, since every user group must contain it.",
+			want:   want{users: []discovery.User{defaultUser}},
+		},
+		"Ready": {
+			reason: "Ready User MRs in the XR's region should be discovered, with their authentication type as the ElastiCache API reports it.",
+			mrs: []resource.Required{
+				mr("app2", mrOpts{region: "us-east-1", ready: true, authType: "iam"}),
+				mr("app1", mrOpts{region: "us-east-1", ready: true, authType: "no-password-required"}),
+				mr("other-region", mrOpts{region: "eu-west-1", ready: true}),
+			},
+			want: want{users: []discovery.User{
+				{ID: "app1", ARN: "arn:aws:elasticache:us-east-1:123456789012:user:app1", Name: "app1", Engine: "redis", AuthenticationType: "no-password"},
+				{ID: "app2", ARN: "arn:aws:elasticache:us-east-1:123456789012:user:app2", Name: "app2", Engine: "redis", AuthenticationType: authenticationTypeIAM},
+				defaultUser,
+			}},
+		},
+		"Provisioning": {
+			reason: "User MRs that aren't ready or are being deleted should only be reported as provisioning.",
+			mrs: []resource.Required{
+				mr("new", mrOpts{region: "us-east-1"}),
+				mr("gone", mrOpts{region: "us-east-1", ready: true, deleting: true}),
+			},
+			want: want{
+				users:        []discovery.User{defaultUser},
+				provisioning: []string{"gone", "new"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			users, provisioning := clusterUsers(tc.mrs, "us-east-1")
+			if diff := cmp.Diff(tc.want, want{users: users, provisioning: provisioning}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nclusterUsers(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"slices"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+)
+
+// Management modes select who changes user group membership.
+const (
+	// managementModeDiscover only discovers users, leaving later pipeline
+	// steps to compose user groups.
+	managementModeDiscover = "discover"
+
+	// managementModeDirect calls ModifyUserGroup on spec.parameters.userGroupId.
+	managementModeDirect = "direct"
+
+	// managementModeComposed composes UserGroup MRs, letting provider-aws
+	// own their lifecycle.
+	managementModeComposed = "composed"
+)
+
+// userGroupMRKind is the kind of provider-aws's namespaced UserGroup MR. It's
+// in the same API group as the User MR.
+const userGroupMRKind = "UserGroup"
+
+// composedUserGroups returns a UserGroup MR for each desired user group. They
+// have the composition resource names later steps use in discover mode, so
+// switching modes doesn't replace them. The implicit user group is named
+// userGroupID, if set. Every user group is tagged with the supplied tags.
+func composedUserGroups(groups []desiredUserGroup, region, userGroupID string, tags map[string]string) map[resource.Name]*resource.DesiredComposed {
+	out := make(map[resource.Name]*resource.DesiredComposed, len(groups))
+	for _, g := range groups {
+		name := g.Name
+		if name == "" {
+			name = userGroupID
+		}
+		out[resource.Name(g.Resource)] = &resource.DesiredComposed{Resource: composedUserGroup(name, g.Engine, region, g.UserIDs, tags)}
+	}
+	return out
+}
+
+func composedUserGroup(name, engine, region string, userIDs []string, tags map[string]string) *composed.Unstructured {
+	ids := make([]any, len(userIDs))
+	for i, id := range slices.Sorted(slices.Values(userIDs)) {
+		ids[i] = id
+	}
+	ug := &composed.Unstructured{Unstructured: unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": userMRAPIVersion,
+		"kind":       userGroupMRKind,
+		"spec": map[string]any{
+			"forProvider": map[string]any{
+				"engine":  engine,
+				"region":  region,
+				"userIds": ids,
+			},
+		},
+	}}}
+	if len(tags) > 0 {
+		_ = ug.SetValue("spec.forProvider.tags", composedTags(tags))
+	}
+	if name != "" {
+		ug.SetAnnotations(map[string]string{externalNameAnnotation: name})
+	}
+	return ug
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestComposedUserGroups(t *testing.T) {
+	tags := map[string]string{originTagManagedBy: functionName, originTagComposite: "default/prod"}
+	userGroup := func(externalName, engine string, ids ...any) map[string]any {
+		if ids == nil {
+			ids = []any{}
+		}
+		ug := map[string]any{
+			"apiVersion": userMRAPIVersion,
+			"kind":       userGroupMRKind,
+			"spec": map[string]any{
+				"forProvider": map[string]any{
+					"engine":  engine,
+					"region":  "eu-west-1",
+					"userIds": ids,
+					"tags":    map[string]any{originTagManagedBy: functionName, originTagComposite: "default/prod"},
+				},
+			},
+		}
+		if externalName != "" {
+			ug["metadata"] = map[string]any{"annotations": map[string]any{externalNameAnnotation: externalName}}
+		}
+		return ug
+	}
+
+	cases := map[string]struct {
+		reason      string
+		groups      []desiredUserGroup
+		userGroupID string
+		want        map[resource.Name]map[string]any
+	}{
+		"Implicit": {
+			reason:      "The implicit user group should be named after the user group ID.",
+			groups:      []desiredUserGroup{{Resource: "user-group", Engine: engineRedis, UserIDs: []string{"default", "app1"}}},
+			userGroupID: "app",
+			want: map[resource.Name]map[string]any{
+				"user-group": userGroup("app", engineRedis, "app1", "default"),
+			},
+		},
+		"ImplicitUnnamed": {
+			reason: "The implicit user group should be named by the provider without a user group ID.",
+			groups: []desiredUserGroup{{Resource: "user-group", Engine: engineRedis, UserIDs: []string{}}},
+			want: map[resource.Name]map[string]any{
+				"user-group": userGroup("", engineRedis),
+			},
+		},
+		"Configured": {
+			reason:      "Configured user groups should keep their names and engines.",
+			groups:      []desiredUserGroup{{Resource: "user-group-cache", Name: "cache", Engine: engineValkey, UserIDs: []string{"default"}}},
+			userGroupID: "ignored",
+			want: map[resource.Name]map[string]any{
+				"user-group-cache": userGroup("cache", engineValkey, "default"),
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := map[resource.Name]map[string]any{}
+			for n, dc := range composedUserGroups(tc.groups, "eu-west-1", tc.userGroupID, tags) {
+				got[n] = dc.Resource.Object
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\ncomposedUserGroups(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Versions of the composable output's schema. The gzip version has at least
+// one per-user list replaced by its compressed form.
+const (
+	outputSchemaVersion     = "v1"
+	outputSchemaVersionGzip = "v1+gzip"
+)
+
+// compressedKeySuffix is appended to the key of a compressed value.
+const compressedKeySuffix = "Compressed"
+
+// compressibleOutputKeys are the composable output's per-user lists, which
+// grow with the number of users. identityUsers and bundleUsers aren't among
+// them: the cacheinfra composition reads them to compose User MRs, and
+// couldn't compose any, thereby deleting the existing ones, if they moved.
+var compressibleOutputKeys = []string{"users", "iamPrincipals"}
+
+// compressOutput replaces each per-user list of the composable output whose
+// JSON encoding is larger than threshold bytes with the base64 encoding of its
+// gzipped JSON, under the same key suffixed with Compressed, and notes it in
+// the schema version. A threshold of zero compresses nothing. It returns the
+// keys it compressed.
+func compressOutput(out map[string]any, threshold int) ([]string, error) {
+	if threshold <= 0 {
+		return nil, nil
+	}
+	var compressed []string
+	for _, k := range compressibleOutputKeys {
+		v, ok := out[k]
+		if !ok {
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode %s: %w", k, err)
+		}
+		if len(b) <= threshold {
+			continue
+		}
+		z, err := gzipBase64(b)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compress %s: %w", k, err)
+		}
+		delete(out, k)
+		out[k+compressedKeySuffix] = z
+		compressed = append(compressed, k)
+	}
+	if len(compressed) > 0 {
+		out["schemaVersion"] = outputSchemaVersionGzip
+	}
+	return compressed, nil
+}
+
+// gzipBase64 returns the base64 encoding of b, gzipped. The gzip header holds
+// no timestamp, so the same input always gives the same output.
+func gzipBase64(b []byte) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompressOutput(t *testing.T) {
+	users := []any{
+		map[string]any{"userId": "app1", "engine": engineRedis},
+		map[string]any{"userId": "app2", "engine": engineRedis},
+	}
+	output := func() map[string]any {
+		return map[string]any{"schemaVersion": outputSchemaVersion, "userIDs": []any{"app1", "app2"}, "users": users}
+	}
+
+	type want struct {
+		compressed []string
+		keys       []string
+		version    string
+	}
+
+	cases := map[string]struct {
+		reason    string
+		threshold int
+		want      want
+	}{
+		"Disabled": {
+			reason: "Nothing should be compressed with a threshold of zero.",
+			want:   want{keys: []string{"schemaVersion", "userIDs", "users"}, version: outputSchemaVersion},
+		},
+		"Small": {
+			reason:    "Lists no larger than the threshold should be left alone.",
+			threshold: 1024,
+			want:      want{keys: []string{"schemaVersion", "userIDs", "users"}, version: outputSchemaVersion},
+		},
+		"Large": {
+			reason:    "Per-user lists larger than the threshold should be replaced by their compressed form, and other values left alone.",
+			threshold: 16,
+			want: want{
+				compressed: []string{"users"},
+				keys:       []string{"schemaVersion", "userIDs", "usersCompressed"},
+				version:    outputSchemaVersionGzip,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			out := output()
+			compressed, err := compressOutput(out, tc.threshold)
+			if err != nil {
+				t.Fatalf("%s\ncompressOutput(...): %v", tc.reason, err)
+			}
+			got := want{compressed: compressed, version: out["schemaVersion"].(string)}
+			for _, k := range []string{"schemaVersion", "userIDs", "users", "usersCompressed"} {
+				if _, ok := out[k]; ok {
+					got.keys = append(got.keys, k)
+				}
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\ncompressOutput(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCompressOutputKeepsComposedLists(t *testing.T) {
+	// The cacheinfra composition composes resources from these keys, so they
+	// must stay readable however large they grow.
+	k, err := os.ReadFile("../cacheinfra/main.k")
+	if err != nil {
+		t.Fatalf("os.ReadFile(...): %v", err)
+	}
+	read := map[string]bool{}
+	for _, m := range regexp.MustCompile(`usergroupManager\??\.(\w+)`).FindAllStringSubmatch(string(k), -1) {
+		read[m[1]] = true
+	}
+	for _, key := range []string{"identityUsers", "bundleUsers"} {
+		if !read[key] {
+			t.Fatalf("main.k doesn't read usergroupManager.%s; update this test", key)
+		}
+	}
+
+	users := []any{
+		map[string]any{"userId": "sso-alice", "engine": engineRedis, "accessString": "on ~* +@read"},
+		map[string]any{"userId": "sso-bob", "engine": engineRedis, "accessString": "on ~* +@read"},
+	}
+	out := map[string]any{"schemaVersion": outputSchemaVersion}
+	for key := range read {
+		out[key] = users
+	}
+	want := maps.Clone(out)
+
+	if _, err := compressOutput(out, 1); err != nil {
+		t.Fatalf("compressOutput(...): %v", err)
+	}
+	for key := range read {
+		if diff := cmp.Diff(want[key], out[key]); diff != "" {
+			t.Errorf("compressOutput(...): usergroupManager.%s read by main.k: -want, +got:\n%s", key, diff)
+		}
+	}
+}
+
+func TestGzipBase64RoundTrip(t *testing.T) {
+	in, _ := json.Marshal([]any{map[string]any{"userId": "app1"}})
+	z, err := gzipBase64(in)
+	if err != nil {
+		t.Fatalf("gzipBase64(...): %v", err)
+	}
+	again, _ := gzipBase64(in)
+	if again != z {
+		t.Errorf("gzipBase64(...): want the same output for the same input, got %q and %q", z, again)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(z)
+	if err != nil {
+		t.Fatalf("base64 decode: %v", err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("gzip.NewReader(...): %v", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("io.ReadAll(...): %v", err)
+	}
+	if diff := cmp.Diff(string(in), string(out)); diff != "" {
+		t.Errorf("gzipBase64(...): -want, +got decoded:\n%s", diff)
+	}
+}
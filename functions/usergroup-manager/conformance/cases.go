@@ -0,0 +1,218 @@
+package conformance
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// Cases returns the conformance cases, keyed by name. Each call returns new
+// cases, so they may be modified.
+func Cases() map[string]Case {
+	return map[string]Case{
+		"Discovery": {
+			Reason:  "Every user in the account but the default user should be discovered, sorted by ID, and published to the XR status and the pipeline context.",
+			Users:   []types.User{user("app2"), user("default"), user("app1")},
+			Request: request(`{"region": "us-east-1"}`),
+			Want: &fnv1.RunFunctionResponse{
+				Conditions: []*fnv1.Condition{
+					condition("UserDiscoverySuccess", fnv1.Status_STATUS_CONDITION_TRUE, "Discovered 2 ElastiCache users"),
+					condition("UsersInRegion", fnv1.Status_STATUS_CONDITION_TRUE, "UsersInRegion"),
+					condition("UsersInAccount", fnv1.Status_STATUS_CONDITION_TRUE, "UsersInAccount"),
+				},
+				Context: mustStruct(`{
+					"discoveredUserIDs": ["app1", "app2"],
+					"usergroupManager": {"userIDs": ["app1", "app2"], "userIDsCSV": "app1,app2", "userCount": 2}
+				}`),
+				Desired: desiredStatus(`{"discoveredUsers": 2, "userIDs": ["app1", "app2"], "syncMode": "full"}`),
+			},
+		},
+		"DefaultUserIncluded": {
+			Reason:  "The default user should be discovered if the XR doesn't exclude it.",
+			Users:   []types.User{user("app1"), user("default")},
+			Request: request(`{"region": "us-east-1", "excludeDefaultUser": false}`),
+			Want: &fnv1.RunFunctionResponse{
+				Context: mustStruct(`{"discoveredUserIDs": ["app1", "default"]}`),
+			},
+		},
+		"NameFilter": {
+			Reason:  "Only users whose name matches the name filter should be discovered.",
+			Users:   []types.User{user("app1-reader"), user("app1-writer"), user("app2-reader")},
+			Request: request(`{"region": "us-east-1", "userNamePrefix": "app1-"}`),
+			Want: &fnv1.RunFunctionResponse{
+				Context: mustStruct(`{"discoveredUserIDs": ["app1-reader", "app1-writer"]}`),
+			},
+		},
+		"EngineFilter": {
+			Reason:  "Only users of the XR's engine should be discovered.",
+			Users:   []types.User{user("app1"), valkeyUser("app2")},
+			Request: request(`{"region": "us-east-1", "engine": "valkey"}`),
+			Want: &fnv1.RunFunctionResponse{
+				Context: mustStruct(`{"discoveredUserIDs": ["app2"]}`),
+			},
+		},
+		"TagFilter": {
+			Reason: "Only users tagged with the tag filter should be discovered when tag filtering is enabled.",
+			Users:  []types.User{user("app1"), user("app2")},
+			Tags: map[string][]types.Tag{
+				userARN("app1"): {{Key: aws.String("cache-id"), Value: aws.String("orders")}},
+				userARN("app2"): {{Key: aws.String("cache-id"), Value: aws.String("payments")}},
+			},
+			Request: request(`{"region": "us-east-1", "cacheId": "orders", "features": {"tagFiltering": true}}`),
+			Want: &fnv1.RunFunctionResponse{
+				Context: mustStruct(`{"discoveredUserIDs": ["app1"]}`),
+			},
+		},
+		"CrossRegion": {
+			Reason:  "Users of another region should be refused, since they can't be added to the region's user groups.",
+			Users:   []types.User{user("app1"), remoteUser("app2", "eu-west-1")},
+			Request: request(`{"region": "us-east-1"}`),
+			Want: &fnv1.RunFunctionResponse{
+				Conditions: []*fnv1.Condition{
+					condition("UsersInRegion", fnv1.Status_STATUS_CONDITION_FALSE, "CrossRegionUsers"),
+				},
+				Context: mustStruct(`{"discoveredUserIDs": ["app1"]}`),
+				Desired: desiredStatus(`{"otherRegionUserIDs": ["app2"]}`),
+			},
+		},
+		"ApplyDisabled": {
+			Reason: "Direct mode shouldn't modify the user group unless the applyMode feature is enabled.",
+			Users:  []types.User{user("app1"), user("default")},
+			UserGroups: []types.UserGroup{
+				userGroup("app", "default"),
+			},
+			Request: request(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app"}`),
+			Want: &fnv1.RunFunctionResponse{
+				Context: mustStruct(`{"discoveredUserIDs": ["app1"]}`),
+			},
+		},
+		"Apply": {
+			Reason: "Direct mode should add discovered users to, and remove missing users from, the user group, and tag it with the XR it belongs to.",
+			Users:  []types.User{user("app1"), user("default")},
+			UserGroups: []types.UserGroup{
+				userGroup("app", "default", "gone"),
+			},
+			Request: request(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}}`),
+			Want: &fnv1.RunFunctionResponse{
+				Conditions: []*fnv1.Condition{
+					condition("UserGroupReady", fnv1.Status_STATUS_CONDITION_TRUE, "Active"),
+					condition("UserGroupReconciled", fnv1.Status_STATUS_CONDITION_TRUE, "Modified"),
+				},
+			},
+			WantModified: []*elasticache.ModifyUserGroupInput{{
+				UserGroupId:     aws.String("app"),
+				UserIdsToAdd:    []string{"app1"},
+				UserIdsToRemove: []string{"gone"},
+			}},
+			WantTagged: []*elasticache.AddTagsToResourceInput{{
+				ResourceName: aws.String(userGroupARN("app")),
+				Tags: []types.Tag{
+					{Key: aws.String("composite"), Value: aws.String("default/prod")},
+					{Key: aws.String("managed-by"), Value: aws.String("usergroup-manager")},
+				},
+			}},
+		},
+		"DryRun": {
+			Reason: "A dry run should report the user group's membership changes without modifying it.",
+			Users:  []types.User{user("app1"), user("default")},
+			UserGroups: []types.UserGroup{
+				userGroup("app", "default", "gone"),
+			},
+			Request: request(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "dryRun": true, "features": {"applyMode": true}}`),
+			Want: &fnv1.RunFunctionResponse{
+				Conditions: []*fnv1.Condition{
+					condition("UserGroupReconciled", fnv1.Status_STATUS_CONDITION_FALSE, "DryRun"),
+				},
+				Context: mustStruct(`{"plannedChanges": {"userGroupId": "app", "add": ["app1"], "remove": ["gone"]}}`),
+				Desired: desiredStatus(`{"plannedChanges": {"userGroupId": "app", "add": ["app1"], "remove": ["gone"]}}`),
+			},
+		},
+		"Rotation": {
+			Reason:  "The rotation feature flag should be accepted, and not change discovery.",
+			Users:   []types.User{user("app1")},
+			Request: request(`{"region": "us-east-1", "features": {"rotation": true}}`),
+			Want: &fnv1.RunFunctionResponse{
+				Context: mustStruct(`{"discoveredUserIDs": ["app1"]}`),
+			},
+		},
+	}
+}
+
+// request returns a request to reconcile an XR with the supplied parameters
+// and static AWS credentials.
+func request(parameters string) *fnv1.RunFunctionRequest {
+	return &fnv1.RunFunctionRequest{
+		Meta: &fnv1.RequestMeta{Tag: "conformance"},
+		Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+			"apiVersion": "customer.upbound.io/v1alpha1",
+			"kind": "XCacheInfra",
+			"metadata": {"name": "prod", "namespace": "default", "uid": "1234"},
+			"spec": {"parameters": ` + parameters + `}
+		}`)}},
+		Credentials: map[string]*fnv1.Credentials{
+			"aws": {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+				Data: map[string][]byte{"aws_access_key_id": []byte("AKIA"), "aws_secret_access_key": []byte("secret")},
+			}}},
+		},
+	}
+}
+
+// desiredStatus returns the desired state of an XR whose
+// status.userGroupManager contains the supplied JSON object.
+func desiredStatus(status string) *fnv1.State {
+	return &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+		"status": {"userGroupManager": ` + status + `}
+	}`)}}
+}
+
+func condition(typ string, status fnv1.Status, reason string) *fnv1.Condition {
+	return &fnv1.Condition{Type: typ, Status: status, Reason: reason, Target: fnv1.Target_TARGET_COMPOSITE_AND_CLAIM.Enum()}
+}
+
+func mustStruct(j string) *structpb.Struct {
+	return resource.MustStructJSON(j)
+}
+
+func user(id string) types.User {
+	return types.User{
+		UserId:   aws.String(id),
+		UserName: aws.String(id),
+		ARN:      aws.String(userARN(id)),
+		Engine:   aws.String("redis"),
+		Status:   aws.String("active"),
+	}
+}
+
+func valkeyUser(id string) types.User {
+	u := user(id)
+	u.Engine = aws.String("valkey")
+	return u
+}
+
+func remoteUser(id, region string) types.User {
+	u := user(id)
+	u.ARN = aws.String("arn:aws:elasticache:" + region + ":" + Account + ":user:" + id)
+	return u
+}
+
+func userGroup(id string, userIDs ...string) types.UserGroup {
+	return types.UserGroup{
+		UserGroupId: aws.String(id),
+		ARN:         aws.String(userGroupARN(id)),
+		Engine:      aws.String("redis"),
+		Status:      aws.String("active"),
+		UserIds:     userIDs,
+	}
+}
+
+func userARN(id string) string {
+	return "arn:aws:elasticache:us-east-1:" + Account + ":user:" + id
+}
+
+func userGroupARN(id string) string {
+	return "arn:aws:elasticache:us-east-1:" + Account + ":usergroup:" + id
+}
@@ -0,0 +1,89 @@
+// Package conformance holds end-to-end cases of the usergroup-manager
+// function's contract: canned RunFunctionRequests, the ElastiCache account
+// each runs against, and the parts of the RunFunctionResponse and the AWS
+// writes compositions rely on. Forks run them with Run to check they haven't
+// broken that contract.
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// A Runner runs the function, e.g. a *Function of package main.
+type Runner interface {
+	RunFunction(ctx context.Context, req *fnv1.RunFunctionRequest) (*fnv1.RunFunctionResponse, error)
+}
+
+// NewRunner returns the function under test, calling the supplied clients
+// rather than AWS.
+type NewRunner func(elastiCache awsclient.ElastiCache, sts awsclient.STS) Runner
+
+// A Case is a request the function must answer in a given way.
+type Case struct {
+	// Reason describes the contract the case checks.
+	Reason string
+
+	// Users, UserGroups and Tags make up the ElastiCache account the request
+	// runs against. The credentials resolve to Account.
+	Users      []types.User
+	UserGroups []types.UserGroup
+	Tags       map[string][]types.Tag
+
+	// Request is sent to the function.
+	Request *fnv1.RunFunctionRequest
+
+	// Want is what the response must contain. See Contains.
+	Want *fnv1.RunFunctionResponse
+
+	// WantModified and WantTagged are the ModifyUserGroup and
+	// AddTagsToResource calls the function must make, in order.
+	WantModified []*elasticache.ModifyUserGroupInput
+	WantTagged   []*elasticache.AddTagsToResourceInput
+}
+
+// Run runs every case of Cases against the functions newRunner returns, one
+// per case, each as a subtest.
+func Run(t *testing.T, newRunner NewRunner) {
+	t.Helper()
+	for name, tc := range Cases() {
+		t.Run(name, func(t *testing.T) {
+			tc.Run(t, newRunner)
+		})
+	}
+}
+
+// Run runs the case against the function newRunner returns.
+func (tc Case) Run(t *testing.T, newRunner NewRunner) {
+	t.Helper()
+	ec := &ElastiCache{Users: tc.Users, UserGroups: tc.UserGroups, Tags: tc.Tags}
+	rsp, err := newRunner(ec, STS{}).RunFunction(context.Background(), tc.Request)
+	if err != nil {
+		t.Fatalf("%s\nRunFunction(...): %v", tc.Reason, err)
+	}
+
+	diffs, err := Contains(tc.Want, rsp)
+	if err != nil {
+		t.Fatalf("%s\nContains(...): %v", tc.Reason, err)
+	}
+	for _, d := range diffs {
+		t.Errorf("%s\nRunFunction(...): %s", tc.Reason, d)
+	}
+
+	ignore := cmpopts.IgnoreUnexported(elasticache.ModifyUserGroupInput{}, elasticache.AddTagsToResourceInput{}, types.Tag{})
+	if diff := cmp.Diff(tc.WantModified, ec.Modified, ignore, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("%s\nModifyUserGroup(...): -want, +got:\n%s", tc.Reason, diff)
+	}
+	if diff := cmp.Diff(tc.WantTagged, ec.Tagged, ignore, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("%s\nAddTagsToResource(...): -want, +got:\n%s", tc.Reason, diff)
+	}
+}
@@ -0,0 +1,113 @@
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Contains returns the differences between want and the parts of got it
+// describes, or nothing if got contains want. Both are compared as JSON, so
+// fields want leaves unset, such as timestamps and durations that change with
+// every run, aren't compared. Objects match if got has every field of want,
+// with matching values. Lists of objects, such as conditions and results,
+// match if each object of want matches a different one of got, in any order,
+// so a case only lists those it's about. Other lists, such as user IDs, must
+// be equal.
+func Contains(want, got proto.Message) ([]string, error) {
+	w, err := asJSON(want)
+	if err != nil {
+		return nil, err
+	}
+	g, err := asJSON(got)
+	if err != nil {
+		return nil, err
+	}
+	return contains("", w, g), nil
+}
+
+func asJSON(m proto.Message) (any, error) {
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal %T: %w", m, err)
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal %T: %w", m, err)
+	}
+	return v, nil
+}
+
+func contains(path string, want, got any) []string {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: want an object, got %v", pathOrRoot(path), got)}
+		}
+		var diffs []string
+		for _, k := range slices.Sorted(maps.Keys(w)) {
+			wv := w[k]
+			gv, ok := g[k]
+			if !ok {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: missing", path, k))
+				continue
+			}
+			diffs = append(diffs, contains(path+"."+k, wv, gv)...)
+		}
+		return diffs
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: want a list, got %v", pathOrRoot(path), got)}
+		}
+		if !objects(w) {
+			if !reflect.DeepEqual(w, g) {
+				return []string{fmt.Sprintf("%s: want %v, got %v", path, w, g)}
+			}
+			return nil
+		}
+		var diffs []string
+		used := make([]bool, len(g))
+		for i, wv := range w {
+			matched := false
+			for j, gv := range g {
+				if !used[j] && len(contains("", wv, gv)) == 0 {
+					used[j], matched = true, true
+					break
+				}
+			}
+			if !matched {
+				diffs = append(diffs, fmt.Sprintf("%s[%d]: no match for %v", path, i, wv))
+			}
+		}
+		return diffs
+	default:
+		if !reflect.DeepEqual(want, got) {
+			return []string{fmt.Sprintf("%s: want %v, got %v", pathOrRoot(path), want, got)}
+		}
+		return nil
+	}
+}
+
+// objects returns true if l is a non-empty list of objects.
+func objects(l []any) bool {
+	for _, v := range l {
+		if _, ok := v.(map[string]any); !ok {
+			return false
+		}
+	}
+	return len(l) > 0
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
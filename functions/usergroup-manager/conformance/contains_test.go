@@ -0,0 +1,66 @@
+package conformance
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+func TestContains(t *testing.T) {
+	got := &fnv1.RunFunctionResponse{
+		Meta: &fnv1.ResponseMeta{Tag: "conformance"},
+		Conditions: []*fnv1.Condition{
+			condition("UsersInRegion", fnv1.Status_STATUS_CONDITION_TRUE, "UsersInRegion"),
+			condition("UsersInAccount", fnv1.Status_STATUS_CONDITION_TRUE, "UsersInAccount"),
+		},
+		Context: mustStruct(`{"discoveredUserIDs": ["app1", "app2"], "lastRun": "2026-01-01T00:00:00Z"}`),
+	}
+
+	cases := map[string]struct {
+		reason string
+		want   *fnv1.RunFunctionResponse
+		diffs  []string
+	}{
+		"Subset": {
+			reason: "Fields want leaves unset shouldn't be compared.",
+			want:   &fnv1.RunFunctionResponse{Context: mustStruct(`{"discoveredUserIDs": ["app1", "app2"]}`)},
+		},
+		"ObjectsInAnyOrder": {
+			reason: "Lists of objects should match in any order, ignoring objects want doesn't list.",
+			want: &fnv1.RunFunctionResponse{Conditions: []*fnv1.Condition{
+				condition("UsersInAccount", fnv1.Status_STATUS_CONDITION_TRUE, "UsersInAccount"),
+			}},
+		},
+		"UnmatchedObject": {
+			reason: "An object of want that none of got matches should be reported.",
+			want: &fnv1.RunFunctionResponse{Conditions: []*fnv1.Condition{
+				condition("UsersInRegion", fnv1.Status_STATUS_CONDITION_FALSE, "CrossRegionUsers"),
+			}},
+			diffs: []string{".conditions[0]: no match for map[reason:CrossRegionUsers status:STATUS_CONDITION_FALSE target:TARGET_COMPOSITE_AND_CLAIM type:UsersInRegion]"},
+		},
+		"UnequalList": {
+			reason: "Other lists should be equal, in order.",
+			want:   &fnv1.RunFunctionResponse{Context: mustStruct(`{"discoveredUserIDs": ["app2", "app1"]}`)},
+			diffs:  []string{".context.discoveredUserIDs: want [app2 app1], got [app1 app2]"},
+		},
+		"Missing": {
+			reason: "A field got doesn't have should be reported.",
+			want:   &fnv1.RunFunctionResponse{Context: mustStruct(`{"userCount": 2}`)},
+			diffs:  []string{".context.userCount: missing"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			diffs, err := Contains(tc.want, got)
+			if err != nil {
+				t.Fatalf("%s\nContains(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.diffs, diffs); diff != "" {
+				t.Errorf("%s\nContains(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
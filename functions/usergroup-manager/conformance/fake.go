@@ -0,0 +1,102 @@
+package conformance
+
+import (
+	"context"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// Account is the ID of the account the fake AWS credentials resolve to.
+const Account = "123456789012"
+
+// An ElastiCache is an in-memory ElastiCache account holding a case's users,
+// user groups and tags. It records the calls that would modify them rather
+// than applying them, so each case sees the same account however often the
+// function writes. Calling an API it doesn't fake panics, which fails the
+// case.
+type ElastiCache struct {
+	awsclient.ElastiCache
+
+	Users      []types.User
+	UserGroups []types.UserGroup
+	Tags       map[string][]types.Tag
+
+	// Modified records every ModifyUserGroup call, Tagged every
+	// AddTagsToResource call and Created every CreateUser call.
+	Modified []*elasticache.ModifyUserGroupInput
+	Tagged   []*elasticache.AddTagsToResourceInput
+	Created  []*elasticache.CreateUserInput
+}
+
+// DescribeUsers returns the users matching the user ID or user-id filter.
+func (c *ElastiCache) DescribeUsers(_ context.Context, in *elasticache.DescribeUsersInput, _ ...func(*elasticache.Options)) (*elasticache.DescribeUsersOutput, error) {
+	out := &elasticache.DescribeUsersOutput{}
+	for _, u := range c.Users {
+		if in.UserId != nil && aws.ToString(in.UserId) != aws.ToString(u.UserId) {
+			continue
+		}
+		if in.Engine != nil && aws.ToString(in.Engine) != aws.ToString(u.Engine) {
+			continue
+		}
+		if len(in.Filters) > 0 && !slices.Contains(in.Filters[0].Values, aws.ToString(u.UserId)) {
+			continue
+		}
+		out.Users = append(out.Users, u)
+	}
+	if in.UserId != nil && len(out.Users) == 0 {
+		return nil, &types.UserNotFoundFault{Message: aws.String("user not found")}
+	}
+	return out, nil
+}
+
+// DescribeUserGroups returns the user groups matching the user group ID.
+func (c *ElastiCache) DescribeUserGroups(_ context.Context, in *elasticache.DescribeUserGroupsInput, _ ...func(*elasticache.Options)) (*elasticache.DescribeUserGroupsOutput, error) {
+	out := &elasticache.DescribeUserGroupsOutput{}
+	for _, ug := range c.UserGroups {
+		if in.UserGroupId != nil && aws.ToString(in.UserGroupId) != aws.ToString(ug.UserGroupId) {
+			continue
+		}
+		out.UserGroups = append(out.UserGroups, ug)
+	}
+	if in.UserGroupId != nil && len(out.UserGroups) == 0 {
+		return nil, &types.UserGroupNotFoundFault{Message: aws.String("user group not found")}
+	}
+	return out, nil
+}
+
+// ModifyUserGroup records the call.
+func (c *ElastiCache) ModifyUserGroup(_ context.Context, in *elasticache.ModifyUserGroupInput, _ ...func(*elasticache.Options)) (*elasticache.ModifyUserGroupOutput, error) {
+	c.Modified = append(c.Modified, in)
+	return &elasticache.ModifyUserGroupOutput{UserGroupId: in.UserGroupId, Status: aws.String("modifying")}, nil
+}
+
+// CreateUser records the call.
+func (c *ElastiCache) CreateUser(_ context.Context, in *elasticache.CreateUserInput, _ ...func(*elasticache.Options)) (*elasticache.CreateUserOutput, error) {
+	c.Created = append(c.Created, in)
+	return &elasticache.CreateUserOutput{UserId: in.UserId, Status: aws.String("creating")}, nil
+}
+
+// AddTagsToResource records the call.
+func (c *ElastiCache) AddTagsToResource(_ context.Context, in *elasticache.AddTagsToResourceInput, _ ...func(*elasticache.Options)) (*elasticache.AddTagsToResourceOutput, error) {
+	c.Tagged = append(c.Tagged, in)
+	return &elasticache.AddTagsToResourceOutput{TagList: in.Tags}, nil
+}
+
+// ListTagsForResource returns the tags of the resource.
+func (c *ElastiCache) ListTagsForResource(_ context.Context, in *elasticache.ListTagsForResourceInput, _ ...func(*elasticache.Options)) (*elasticache.ListTagsForResourceOutput, error) {
+	return &elasticache.ListTagsForResourceOutput{TagList: c.Tags[aws.ToString(in.ResourceName)]}, nil
+}
+
+// An STS resolves every credential to Account.
+type STS struct{}
+
+// GetCallerIdentity returns Account.
+func (STS) GetCallerIdentity(_ context.Context, _ *sts.GetCallerIdentityInput, _ ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Account: aws.String(Account)}, nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/crossplane/function-sdk-go/logging"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(elastiCache awsclient.ElastiCache, sts awsclient.STS) conformance.Runner {
+		return &Function{log: logging.NewNopLogger(), elastiCache: elastiCache, sts: sts}
+	})
+}
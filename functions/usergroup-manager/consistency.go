@@ -0,0 +1,23 @@
+package main
+
+import (
+	"time"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+// observedAppliedMembership returns the membership of the target user group
+// of direct mode recorded in the observed XR's status, if any.
+func observedAppliedMembership(oxr *resource.Composite) *membership.Applied {
+	applied, _ := oxr.Resource.GetString(status.Path("appliedMembership.appliedTime"))
+	t, err := time.Parse(time.RFC3339, applied)
+	if err != nil {
+		return nil
+	}
+	id, _ := oxr.Resource.GetString(status.Path("appliedMembership.userGroupId"))
+	ids, _ := oxr.Resource.GetStringArray(status.Path("appliedMembership.userIDs"))
+	return &membership.Applied{UserGroupID: id, UserIDs: ids, AppliedTime: t}
+}
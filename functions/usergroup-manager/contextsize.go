@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+// discoveredUserIDsKey is the context key holding the discovered user IDs, as
+// read by the cacheinfra function.
+const discoveredUserIDsKey = "discoveredUserIDs"
+
+// discoveredUserIDsChunksKey is the context key describing how the discovered
+// user IDs were split across context keys, when they were.
+const discoveredUserIDsChunksKey = "discoveredUserIDsChunks"
+
+// discoveredUserIDsSummaryKey is the context key summarizing the discovered
+// user IDs, when they were truncated.
+const discoveredUserIDsSummaryKey = "discoveredUserIDsSummary"
+
+// defaultMaxContextUserIDs is the most user IDs written to a single context
+// key by default.
+const defaultMaxContextUserIDs = 1000
+
+// What happens to discovered user IDs that don't fit in a single context key.
+const (
+	// contextOverflowChunk splits them across several context keys, so the
+	// full list is still available.
+	contextOverflowChunk = "chunk"
+
+	// contextOverflowTruncate only keeps the first of them, and summarizes
+	// the full list.
+	contextOverflowTruncate = "truncate"
+)
+
+type contextSizeParameters struct {
+	// MaxUserIDs is the most user IDs written to a single context key. Zero
+	// writes them all to discoveredUserIDs.
+	MaxUserIDs int
+
+	// Overflow is what happens to longer lists; chunk or truncate.
+	Overflow string
+
+	// CompressAboveBytes is the largest JSON encoding of a per-user list of
+	// the composable output that isn't compressed. Zero disables compression.
+	CompressAboveBytes int
+}
+
+// chunkKey returns the context key of the i-th chunk of discovered user IDs,
+// counting from zero. The first chunk is written to discoveredUserIDs, so
+// consumers that only read it see the start of the list.
+func chunkKey(i int) string {
+	if i == 0 {
+		return discoveredUserIDsKey
+	}
+	return fmt.Sprintf("%s-%d", discoveredUserIDsKey, i+1)
+}
+
+// writeDiscoveredUserIDs writes ids to the pipeline context. Lists longer than
+// p.MaxUserIDs are either split into chunks of at most that many IDs, each
+// under its own key, listed in discoveredUserIDsChunks, or truncated to that
+// many IDs and summarized in discoveredUserIDsSummary. It returns true if the
+// list was truncated.
+func writeDiscoveredUserIDs(rsp *fnv1.RunFunctionResponse, ids []string, p contextSizeParameters) (bool, error) {
+	if p.MaxUserIDs <= 0 || len(ids) <= p.MaxUserIDs {
+		_, err := setContextValue(rsp, discoveredUserIDsKey, ids)
+		return false, err
+	}
+
+	if p.Overflow == contextOverflowTruncate {
+		if _, err := setContextValue(rsp, discoveredUserIDsKey, ids[:p.MaxUserIDs]); err != nil {
+			return false, err
+		}
+		s := summarizeUserIDs(ids, p.MaxUserIDs, "")
+		_, err := setContextValue(rsp, discoveredUserIDsSummaryKey, map[string]any{
+			"truncated": true,
+			"count":     s.Count,
+			"sha256":    s.SHA256,
+		})
+		return true, err
+	}
+
+	var keys []string
+	for start := 0; start < len(ids); start += p.MaxUserIDs {
+		key := chunkKey(len(keys))
+		if _, err := setContextValue(rsp, key, ids[start:min(start+p.MaxUserIDs, len(ids))]); err != nil {
+			return false, err
+		}
+		keys = append(keys, key)
+	}
+	_, err := setContextValue(rsp, discoveredUserIDsChunksKey, map[string]any{
+		"count": len(ids),
+		"keys":  keys,
+	})
+	return false, err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+func TestWriteDiscoveredUserIDs(t *testing.T) {
+	ids := []string{"app1", "app2", "app3", "app4", "app5"}
+
+	type want struct {
+		context   map[string]any
+		truncated bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		p      contextSizeParameters
+		want   want
+	}{
+		"Fits": {
+			reason: "A list no longer than the limit should be written to discoveredUserIDs.",
+			p:      contextSizeParameters{MaxUserIDs: 5, Overflow: contextOverflowChunk},
+			want: want{context: map[string]any{
+				discoveredUserIDsKey: []any{"app1", "app2", "app3", "app4", "app5"},
+			}},
+		},
+		"Unlimited": {
+			reason: "A limit of zero should write every user ID to discoveredUserIDs.",
+			p:      contextSizeParameters{Overflow: contextOverflowChunk},
+			want: want{context: map[string]any{
+				discoveredUserIDsKey: []any{"app1", "app2", "app3", "app4", "app5"},
+			}},
+		},
+		"Chunk": {
+			reason: "A longer list should be split across keys, listed in discoveredUserIDsChunks.",
+			p:      contextSizeParameters{MaxUserIDs: 2, Overflow: contextOverflowChunk},
+			want: want{context: map[string]any{
+				discoveredUserIDsKey:  []any{"app1", "app2"},
+				"discoveredUserIDs-2": []any{"app3", "app4"},
+				"discoveredUserIDs-3": []any{"app5"},
+				discoveredUserIDsChunksKey: map[string]any{
+					"count": float64(5),
+					"keys":  []any{"discoveredUserIDs", "discoveredUserIDs-2", "discoveredUserIDs-3"},
+				},
+			}},
+		},
+		"Truncate": {
+			reason: "A longer list should be truncated and summarized if the XR asks for it.",
+			p:      contextSizeParameters{MaxUserIDs: 2, Overflow: contextOverflowTruncate},
+			want: want{
+				context: map[string]any{
+					discoveredUserIDsKey: []any{"app1", "app2"},
+					discoveredUserIDsSummaryKey: map[string]any{
+						"truncated": true,
+						"count":     float64(5),
+						"sha256":    summarizeUserIDs(ids, 2, "").SHA256,
+					},
+				},
+				truncated: true,
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			rsp := &fnv1.RunFunctionResponse{}
+			truncated, err := writeDiscoveredUserIDs(rsp, ids, tc.p)
+			if err != nil {
+				t.Fatalf("%s\nwriteDiscoveredUserIDs(...): %v", tc.reason, err)
+			}
+			got := want{context: rsp.GetContext().AsMap(), truncated: truncated}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nwriteDiscoveredUserIDs(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
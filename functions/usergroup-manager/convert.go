@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// maxSafeInteger is the largest integer magnitude a float64, and therefore a
+// structpb number, can represent exactly.
+const maxSafeInteger = 1 << 53
+
+// A conversionError reports a value that could not be converted to a structpb
+// value at all.
+type conversionError struct {
+	Path   string
+	Reason string
+}
+
+func (e *conversionError) Error() string {
+	return fmt.Sprintf("cannot convert %s: %s", e.Path, e.Reason)
+}
+
+// toValue converts v into a structpb value. Unlike structpb.NewValue it never
+// silently loses data:
+//
+//   - NaN and infinite floats are rejected with an error naming their path.
+//   - Integers outside ±2^53 are encoded as decimal strings.
+//   - Strings that aren't valid UTF-8 have invalid bytes replaced with U+FFFD.
+//   - Unsupported types are rejected with an error naming their path.
+//
+// Each lossy but recoverable rewrite is reported in the returned notes so the
+// caller can surface it.
+func toValue(v any) (*structpb.Value, []string, error) {
+	c := &converter{}
+	out, err := c.convert("$", v)
+	return out, c.notes, err
+}
+
+// setContextValue converts v using toValue and writes it to the supplied
+// context key. Lossy rewrites are surfaced as warning results. The converted
+// value is returned so it can be written elsewhere too.
+func setContextValue(rsp *fnv1.RunFunctionResponse, key string, v any) (*structpb.Value, error) {
+	pv, notes, err := toValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("context key %q: %w", key, err)
+	}
+	for _, n := range notes {
+		response.Warning(rsp, fmt.Errorf("context key %q: %s", key, n)).TargetCompositeAndClaim()
+	}
+	response.SetContextKey(rsp, key, pv)
+	return pv, nil
+}
+
+type converter struct {
+	notes []string
+}
+
+func (c *converter) note(path, format string, a ...any) {
+	c.notes = append(c.notes, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, a...)))
+}
+
+func (c *converter) convert(path string, v any) (*structpb.Value, error) {
+	switch t := v.(type) {
+	case nil:
+		return structpb.NewNullValue(), nil
+	case bool:
+		return structpb.NewBoolValue(t), nil
+	case string:
+		return structpb.NewStringValue(c.str(path, t)), nil
+	case int:
+		return c.integer(path, int64(t)), nil
+	case int32:
+		return c.integer(path, int64(t)), nil
+	case int64:
+		return c.integer(path, t), nil
+	case uint32:
+		return c.integer(path, int64(t)), nil
+	case uint64:
+		if t > maxSafeInteger {
+			c.note(path, "integer %d exceeds 2^53 and was encoded as a string", t)
+			return structpb.NewStringValue(strconv.FormatUint(t, 10)), nil
+		}
+		return structpb.NewNumberValue(float64(t)), nil
+	case float32:
+		return c.float(path, float64(t))
+	case float64:
+		return c.float(path, t)
+	case []string:
+		l := &structpb.ListValue{Values: make([]*structpb.Value, len(t))}
+		for i, s := range t {
+			l.Values[i] = structpb.NewStringValue(c.str(fmt.Sprintf("%s[%d]", path, i), s))
+		}
+		return structpb.NewListValue(l), nil
+	case []any:
+		l := &structpb.ListValue{Values: make([]*structpb.Value, len(t))}
+		for i, e := range t {
+			ev, err := c.convert(fmt.Sprintf("%s[%d]", path, i), e)
+			if err != nil {
+				return nil, err
+			}
+			l.Values[i] = ev
+		}
+		return structpb.NewListValue(l), nil
+	case map[string]any:
+		s := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(t))}
+		// Convert in key order so the first error reported is deterministic.
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ev, err := c.convert(path+"."+k, t[k])
+			if err != nil {
+				return nil, err
+			}
+			s.Fields[c.str(path, k)] = ev
+		}
+		return structpb.NewStructValue(s), nil
+	default:
+		return nil, &conversionError{Path: path, Reason: fmt.Sprintf("unsupported type %T", v)}
+	}
+}
+
+func (c *converter) str(path, s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	c.note(path, "invalid UTF-8 was replaced")
+	return strings.ToValidUTF8(s, "�")
+}
+
+func (c *converter) integer(path string, i int64) *structpb.Value {
+	if i > maxSafeInteger || i < -maxSafeInteger {
+		c.note(path, "integer %d exceeds 2^53 and was encoded as a string", i)
+		return structpb.NewStringValue(strconv.FormatInt(i, 10))
+	}
+	return structpb.NewNumberValue(float64(i))
+}
+
+func (c *converter) float(path string, f float64) (*structpb.Value, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, &conversionError{Path: path, Reason: fmt.Sprintf("%v is not representable in JSON", f)}
+	}
+	return structpb.NewNumberValue(f), nil
+}
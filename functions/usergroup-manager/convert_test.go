@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+func TestToValue(t *testing.T) {
+	type want struct {
+		v     *structpb.Value
+		notes []string
+		err   error
+	}
+
+	cases := map[string]struct {
+		reason string
+		v      any
+		want   want
+	}{
+		"Nested": {
+			reason: "Supported nested types should convert without notes.",
+			v: map[string]any{
+				"ids":   []string{"default", "app1"},
+				"count": 2,
+				"extra": []any{true, nil, 1.5},
+			},
+			want: want{
+				v: structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+					"ids":   structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue("default"), structpb.NewStringValue("app1")}}),
+					"count": structpb.NewNumberValue(2),
+					"extra": structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewBoolValue(true), structpb.NewNullValue(), structpb.NewNumberValue(1.5)}}),
+				}}),
+			},
+		},
+		"LargeInteger": {
+			reason: "Integers that can't be represented exactly should be encoded as strings and reported.",
+			v:      map[string]any{"big": int64(1<<53 + 1)},
+			want: want{
+				v: structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+					"big": structpb.NewStringValue("9007199254740993"),
+				}}),
+				notes: []string{"$.big: integer 9007199254740993 exceeds 2^53 and was encoded as a string"},
+			},
+		},
+		"InvalidUTF8": {
+			reason: "Invalid UTF-8 should be replaced and reported.",
+			v:      []any{"a\xffb"},
+			want: want{
+				v:     structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewStringValue("a�b")}}),
+				notes: []string{"$[0]: invalid UTF-8 was replaced"},
+			},
+		},
+		"NaN": {
+			reason: "NaN should be rejected with its path.",
+			v:      map[string]any{"ratio": math.NaN()},
+			want: want{
+				err: &conversionError{Path: "$.ratio", Reason: "NaN is not representable in JSON"},
+			},
+		},
+		"UnsupportedType": {
+			reason: "Unsupported types should be rejected with their path.",
+			v:      map[string]any{"ch": make(chan int)},
+			want: want{
+				err: &conversionError{Path: "$.ch", Reason: "unsupported type chan int"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			v, notes, err := toValue(tc.v)
+
+			if diff := cmp.Diff(tc.want.v, v, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\ntoValue(...): -want value, +got value:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.notes, notes); diff != "" {
+				t.Errorf("%s\ntoValue(...): -want notes, +got notes:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err); diff != "" {
+				t.Errorf("%s\ntoValue(...): -want err, +got err:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// benchmarkStatus returns a status holding n discovered users, like the one
+// the function writes.
+func benchmarkStatus(n int) map[string]any {
+	users := benchmarkUsers(n)
+	ids := make([]string, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return map[string]any{
+		"discoveredUsers": len(users),
+		"userIDs":         ids,
+		"users":           status.Users(users),
+		"syncMode":        syncModeFull,
+	}
+}
+
+func BenchmarkToValue(b *testing.B) {
+	status := benchmarkStatus(10000)
+	b.ResetTimer()
+	for range b.N {
+		if _, _, err := toValue(status); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
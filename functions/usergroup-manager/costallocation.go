@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	taggingtypes "github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi/types"
+)
+
+// defaultCacheIDTagKey is the tag used to associate ElastiCache RBAC resources
+// with the cache they serve.
+const defaultCacheIDTagKey = "cache-id"
+
+// Resource type filters understood by the Resource Groups Tagging API.
+const (
+	resourceTypeUser      = "elasticache:user"
+	resourceTypeUserGroup = "elasticache:usergroup"
+)
+
+// cacheCost counts the RBAC resources attributed to a single cache-id.
+type cacheCost struct {
+	Users      int
+	UserGroups int
+}
+
+// taggedResource is a single result of the tagging API query.
+type taggedResource struct {
+	ARN     string
+	Type    string
+	CacheID string
+}
+
+// costAllocationReport summarizes ElastiCache users and user groups per
+// cache-id tag value.
+type costAllocationReport struct {
+	TagKey    string
+	Caches    map[string]*cacheCost
+	Resources []taggedResource
+}
+
+// reportCostAllocation queries the Resource Groups Tagging API for every
+// ElastiCache user and user group carrying tagKey and counts them per tag
+// value. Resources without the tag are not returned by the API and so are not
+// attributed to any cache.
+func reportCostAllocation(ctx context.Context, client *resourcegroupstaggingapi.Client, tagKey string) (*costAllocationReport, error) {
+	report := &costAllocationReport{
+		TagKey: tagKey,
+		Caches: map[string]*cacheCost{},
+	}
+
+	p := resourcegroupstaggingapi.NewGetResourcesPaginator(client, &resourcegroupstaggingapi.GetResourcesInput{
+		ResourceTypeFilters: []string{resourceTypeUser, resourceTypeUserGroup},
+		TagFilters:          []taggingtypes.TagFilter{{Key: aws.String(tagKey)}},
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get resources tagged %q: %w", tagKey, err)
+		}
+
+		for _, m := range page.ResourceTagMappingList {
+			arn := aws.ToString(m.ResourceARN)
+			r := taggedResource{ARN: arn, Type: resourceTypeFromARN(arn)}
+			for _, t := range m.Tags {
+				if aws.ToString(t.Key) == tagKey {
+					r.CacheID = aws.ToString(t.Value)
+				}
+			}
+
+			c, ok := report.Caches[r.CacheID]
+			if !ok {
+				c = &cacheCost{}
+				report.Caches[r.CacheID] = c
+			}
+			switch r.Type {
+			case resourceTypeUser:
+				c.Users++
+			case resourceTypeUserGroup:
+				c.UserGroups++
+			}
+			report.Resources = append(report.Resources, r)
+		}
+	}
+
+	// The tagging API doesn't guarantee an order.
+	sort.Slice(report.Resources, func(i, j int) bool { return report.Resources[i].ARN < report.Resources[j].ARN })
+
+	return report, nil
+}
+
+// resourceTypeFromARN returns the tagging API resource type of an ElastiCache
+// ARN, e.g. elasticache:user for arn:aws:elasticache:us-east-1:123:user:app1.
+func resourceTypeFromARN(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 7 {
+		return ""
+	}
+	return parts[2] + ":" + parts[5]
+}
+
+// Status returns the report in the form written to the XR status.
+func (r *costAllocationReport) Status() map[string]any {
+	caches := make(map[string]any, len(r.Caches))
+	for id, c := range r.Caches {
+		caches[id] = map[string]any{
+			"users":      c.Users,
+			"userGroups": c.UserGroups,
+		}
+	}
+	return map[string]any{
+		"tagKey":             r.TagKey,
+		"costAllocationTags": []any{r.TagKey},
+		"caches":             caches,
+	}
+}
+
+// Context returns the raw query result in a form that can be written to the
+// pipeline context.
+func (r *costAllocationReport) Context() []any {
+	out := make([]any, len(r.Resources))
+	for i, res := range r.Resources {
+		out[i] = map[string]any{
+			"arn":     res.ARN,
+			"type":    res.Type,
+			"cacheId": res.CacheID,
+		}
+	}
+	return out
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResourceTypeFromARN(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		arn    string
+		want   string
+	}{
+		"User": {
+			reason: "A user ARN should map to the elasticache:user resource type.",
+			arn:    "arn:aws:elasticache:us-east-1:123456789012:user:app1",
+			want:   resourceTypeUser,
+		},
+		"UserGroup": {
+			reason: "A user group ARN should map to the elasticache:usergroup resource type.",
+			arn:    "arn:aws:elasticache:us-east-1:123456789012:usergroup:prod-cache",
+			want:   resourceTypeUserGroup,
+		},
+		"Malformed": {
+			reason: "A malformed ARN should map to no resource type.",
+			arn:    "app1",
+			want:   "",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := resourceTypeFromARN(tc.arn)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nresourceTypeFromARN(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/function-sdk-go/logging"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// awsCredentialsName is the name of the composition credentials holding AWS
+// access keys.
+const awsCredentialsName = "aws"
+
+// Sources of the AWS credentials used for a request.
+const (
+	credentialsSourceSecret       = "secret"
+	credentialsSourceKMS          = "kms"
+	credentialsSourceDefaultChain = "default-chain"
+)
+
+// awsCredentialsKMSKey is the composition credentials key holding a
+// KMS-encrypted credentials document, as an alternative to plaintext access
+// keys.
+const awsCredentialsKMSKey = "kms_ciphertext"
+
+// kmsDecryptAPI is the subset of the KMS API used to decrypt credentials.
+type kmsDecryptAPI interface {
+	Decrypt(ctx context.Context, in *kms.DecryptInput, o ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// Credential sources an XR can select with spec.parameters.credentialSource.
+const (
+	// credentialSourceAuto prefers composition credentials, falling back to
+	// the default chain if enabled.
+	credentialSourceAuto = "auto"
+
+	// credentialSourceIRSA always uses the default chain, e.g. the pod's
+	// web identity on EKS, even if the composition supplies credentials.
+	credentialSourceIRSA = "irsa"
+)
+
+// credentialsOptions returns the AWS config load options that supply
+// credentials for req, and where the credentials come from. Credentials
+// supplied by the composition are preferred, unless the XR selected the irsa
+// credential source. Without them the SDK's default chain is used, if
+// enabled, which finds environment, web identity, ECS container and EC2
+// instance metadata (IMDS) credentials.
+func (f *Function) credentialsOptions(ctx context.Context, req *fnv1.RunFunctionRequest, region, credentialSource string) ([]func(*awsconfig.LoadOptions) error, string, error) {
+	if credentialSource == credentialSourceIRSA {
+		if !f.defaultCredentials {
+			return nil, "", errors.New("credential source irsa requires the function to run with --aws-default-credentials")
+		}
+		return nil, credentialsSourceDefaultChain, nil
+	}
+
+	creds, err := request.GetCredentials(req, awsCredentialsName)
+	if err != nil {
+		if !f.defaultCredentials {
+			return nil, "", fmt.Errorf("failed to get AWS credentials: %w", err)
+		}
+		return nil, credentialsSourceDefaultChain, nil
+	}
+
+	data := creds.Data
+	source := credentialsSourceSecret
+	if ciphertext, ok := data[awsCredentialsKMSKey]; ok {
+		if data, err = f.decryptCredentials(ctx, region, ciphertext); err != nil {
+			return nil, "", err
+		}
+		source = credentialsSourceKMS
+	}
+	return []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			string(data["aws_access_key_id"]),
+			string(data["aws_secret_access_key"]),
+			string(data["aws_session_token"]),
+		)),
+	}, source, nil
+}
+
+// decryptCredentials decrypts a KMS-encrypted credentials document using the
+// function's ambient identity, i.e. the SDK's default credential chain. The
+// document is a YAML or JSON object with the same keys as plaintext
+// composition credentials.
+func (f *Function) decryptCredentials(ctx context.Context, region string, ciphertext []byte) (map[string][]byte, error) {
+	client, err := f.kmsClient(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	out, err := client.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: ciphertext})
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt AWS credentials with KMS: %w", err)
+	}
+
+	data, err := parseCredentialsDocument(out.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("decrypted AWS credentials: %w", err)
+	}
+	return data, nil
+}
+
+// parseCredentialsDocument parses a YAML or JSON object with the same keys as
+// plaintext composition credentials.
+func parseCredentialsDocument(doc []byte) (map[string][]byte, error) {
+	m := map[string]string{}
+	if err := yaml.Unmarshal(doc, &m); err != nil {
+		return nil, fmt.Errorf("cannot parse credentials: %w", err)
+	}
+	for _, k := range []string{"aws_access_key_id", "aws_secret_access_key"} {
+		if m[k] == "" {
+			return nil, fmt.Errorf("credentials have no %q", k)
+		}
+	}
+	data := make(map[string][]byte, len(m))
+	for k, v := range m {
+		data[k] = []byte(v)
+	}
+	return data, nil
+}
+
+// kmsClient returns a KMS client that authenticates with the function's
+// ambient identity.
+func (f *Function) kmsClient(ctx context.Context, region string) (kmsDecryptAPI, error) {
+	if f.kms != nil {
+		return f.kms, nil
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithRegion(region),
+		awsconfig.WithAPIOptions([]func(*middleware.Stack) error{
+			awsclient.ClassifyErrors,
+			awsmiddleware.AddUserAgentKeyValue(functionName, functionVersion()),
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config for KMS: %w", err)
+	}
+	return kms.NewFromConfig(cfg, func(o *kms.Options) {
+		o.BaseEndpoint = f.endpoint("kms")
+	}), nil
+}
+
+// fingerprintLength is how many trailing characters of an access key ID or
+// role ARN a credentials fingerprint keeps.
+const fingerprintLength = 4
+
+// credentialsFingerprint returns a non-sensitive fingerprint of the
+// credentials used for a request, so operators can confirm which secret or
+// role took effect after rotation. Default chain credentials are identified by
+// the web identity role they assume, if any, since their temporary access keys
+// change with every refresh.
+func credentialsFingerprint(ctx context.Context, creds aws.CredentialsProvider, source, roleARN string) (string, error) {
+	if source == credentialsSourceDefaultChain && roleARN != "" {
+		return "role ..." + lastChars(roleARN, fingerprintLength), nil
+	}
+	if creds == nil {
+		return "", errors.New("no AWS credentials provider")
+	}
+	c, err := creds.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("cannot retrieve AWS credentials: %w", err)
+	}
+	return "key ..." + lastChars(c.AccessKeyID, fingerprintLength), nil
+}
+
+func lastChars(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[len(s)-n:]
+}
+
+// expiredTokenCodes are the error codes AWS returns for expired temporary
+// credentials.
+var expiredTokenCodes = map[string]bool{
+	"ExpiredToken":          true,
+	"ExpiredTokenException": true,
+}
+
+func isExpiredToken(err error) bool {
+	var ae smithy.APIError
+	return errors.As(err, &ae) && expiredTokenCodes[ae.ErrorCode()]
+}
+
+// An expiredTokenRetrier retries an API call once if it failed because the
+// temporary credentials it was signed with expired mid-reconcile, rather than
+// failing the pipeline until the next reconcile.
+type expiredTokenRetrier struct {
+	log logging.Logger
+
+	// creds is invalidated before retrying so fresh credentials are fetched,
+	// e.g. by re-assuming a web identity role or re-reading IMDS.
+	creds *aws.CredentialsCache
+
+	// refreshable is false for static credentials supplied by the
+	// composition. Retrying would only reuse them, so the error is explained
+	// instead.
+	refreshable bool
+}
+
+// Install adds the retrier to an SDK middleware stack. It wraps every other
+// initialize middleware so each attempt is recorded separately.
+func (r *expiredTokenRetrier) Install(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ExpiredTokenRetrier",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			out, md, err := next.HandleInitialize(ctx, in)
+			if err == nil || !isExpiredToken(err) {
+				return out, md, err
+			}
+			if !r.refreshable || r.creds == nil {
+				return out, md, fmt.Errorf("the AWS credentials supplied by the composition have expired; update the %q credentials secret: %w", awsCredentialsName, err)
+			}
+
+			r.log.Info("AWS credentials expired, refreshing them and retrying once", "error", err)
+			r.creds.Invalidate()
+			return next.HandleInitialize(ctx, in)
+		}), middleware.Before)
+}
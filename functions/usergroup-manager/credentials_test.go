@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+)
+
+func TestCredentialsOptions(t *testing.T) {
+	withSecret := &fnv1.RunFunctionRequest{
+		Credentials: map[string]*fnv1.Credentials{
+			awsCredentialsName: {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+				Data: map[string][]byte{"aws_access_key_id": []byte("AKIA"), "aws_secret_access_key": []byte("secret")},
+			}}},
+		},
+	}
+
+	withKMS := &fnv1.RunFunctionRequest{
+		Credentials: map[string]*fnv1.Credentials{
+			awsCredentialsName: {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+				Data: map[string][]byte{awsCredentialsKMSKey: []byte("ciphertext")},
+			}}},
+		},
+	}
+
+	type want struct {
+		opts   int
+		source string
+		err    bool
+	}
+
+	cases := map[string]struct {
+		reason             string
+		defaultCredentials bool
+		credentialSource   string
+		kms                kmsDecryptAPI
+		req                *fnv1.RunFunctionRequest
+		want               want
+	}{
+		"KMS": {
+			reason: "KMS-encrypted composition credentials should be decrypted.",
+			kms:    &fakeKMS{plaintext: "aws_access_key_id: AKIA\naws_secret_access_key: secret\n"},
+			req:    withKMS,
+			want:   want{opts: 1, source: credentialsSourceKMS},
+		},
+		"KMSError": {
+			reason: "Failing to decrypt composition credentials should be an error.",
+			kms:    &fakeKMS{err: errors.New("boom")},
+			req:    withKMS,
+			want:   want{err: true},
+		},
+		"Secret": {
+			reason: "Composition credentials should be used when supplied.",
+			req:    withSecret,
+			want:   want{opts: 1, source: credentialsSourceSecret},
+		},
+		"SecretPreferred": {
+			reason:             "Composition credentials should be preferred over the default chain.",
+			defaultCredentials: true,
+			req:                withSecret,
+			want:               want{opts: 1, source: credentialsSourceSecret},
+		},
+		"Missing": {
+			reason: "Missing composition credentials should be an error unless the default chain is enabled.",
+			req:    &fnv1.RunFunctionRequest{},
+			want:   want{err: true},
+		},
+		"IRSA": {
+			reason:             "The default chain should be used, ignoring composition credentials, when the XR selects irsa.",
+			defaultCredentials: true,
+			credentialSource:   credentialSourceIRSA,
+			req:                withSecret,
+			want:               want{source: credentialsSourceDefaultChain},
+		},
+		"IRSANotEnabled": {
+			reason:           "Selecting irsa should be an error unless the default chain is enabled.",
+			credentialSource: credentialSourceIRSA,
+			req:              &fnv1.RunFunctionRequest{},
+			want:             want{err: true},
+		},
+		"DefaultChain": {
+			reason:             "The default chain should be used when enabled and no credentials are supplied.",
+			defaultCredentials: true,
+			req:                &fnv1.RunFunctionRequest{},
+			want:               want{source: credentialsSourceDefaultChain},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), defaultCredentials: tc.defaultCredentials, kms: tc.kms}
+			opts, source, err := f.credentialsOptions(context.Background(), tc.req, "us-east-1", tc.credentialSource)
+			got := want{opts: len(opts), source: source, err: err != nil}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nf.credentialsOptions(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+type fakeKMS struct {
+	plaintext string
+	err       error
+}
+
+func (k *fakeKMS) Decrypt(_ context.Context, _ *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	if k.err != nil {
+		return nil, k.err
+	}
+	return &kms.DecryptOutput{Plaintext: []byte(k.plaintext)}, nil
+}
+
+func TestDecryptCredentials(t *testing.T) {
+	type want struct {
+		data map[string][]byte
+		err  string
+	}
+
+	cases := map[string]struct {
+		reason    string
+		plaintext string
+		want      want
+	}{
+		"YAML": {
+			reason:    "A YAML credentials document should be decrypted.",
+			plaintext: "aws_access_key_id: AKIA\naws_secret_access_key: secret\naws_session_token: token\n",
+			want: want{data: map[string][]byte{
+				"aws_access_key_id":     []byte("AKIA"),
+				"aws_secret_access_key": []byte("secret"),
+				"aws_session_token":     []byte("token"),
+			}},
+		},
+		"JSON": {
+			reason:    "A JSON credentials document should be decrypted.",
+			plaintext: `{"aws_access_key_id": "AKIA", "aws_secret_access_key": "secret"}`,
+			want: want{data: map[string][]byte{
+				"aws_access_key_id":     []byte("AKIA"),
+				"aws_secret_access_key": []byte("secret"),
+			}},
+		},
+		"MissingSecretKey": {
+			reason:    "A credentials document without a secret access key should be an error.",
+			plaintext: "aws_access_key_id: AKIA\n",
+			want:      want{err: `decrypted AWS credentials: credentials have no "aws_secret_access_key"`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), kms: &fakeKMS{plaintext: tc.plaintext}}
+			data, err := f.decryptCredentials(context.Background(), "us-east-1", []byte("ciphertext"))
+			got := want{data: data}
+			if err != nil {
+				got.err = err.Error()
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nf.decryptCredentials(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestExpiredTokenRetrier(t *testing.T) {
+	expired := &smithy.GenericAPIError{Code: "ExpiredToken", Message: "The security token included in the request is expired"}
+
+	type want struct {
+		calls int
+		err   bool
+	}
+
+	cases := map[string]struct {
+		reason      string
+		refreshable bool
+		errs        []error
+		want        want
+	}{
+		"Success": {
+			reason:      "Successful calls should not be retried.",
+			refreshable: true,
+			errs:        []error{nil},
+			want:        want{calls: 1},
+		},
+		"OtherError": {
+			reason:      "Errors other than expired credentials should not be retried.",
+			refreshable: true,
+			errs:        []error{errors.New("boom")},
+			want:        want{calls: 1, err: true},
+		},
+		"Refreshed": {
+			reason:      "A call failing with expired refreshable credentials should be retried once.",
+			refreshable: true,
+			errs:        []error{expired, nil},
+			want:        want{calls: 2},
+		},
+		"RetriedOnce": {
+			reason:      "A call should only be retried once.",
+			refreshable: true,
+			errs:        []error{expired, expired, nil},
+			want:        want{calls: 2, err: true},
+		},
+		"Static": {
+			reason: "Calls using static composition credentials should not be retried.",
+			errs:   []error{expired, nil},
+			want:   want{calls: 1, err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &expiredTokenRetrier{
+				log:         logging.NewNopLogger(),
+				creds:       aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider("AKIA", "secret", "")),
+				refreshable: tc.refreshable,
+			}
+			stack := middleware.NewStack("test", smithyhttp.NewStackRequest)
+			if err := r.Install(stack); err != nil {
+				t.Fatalf("Install(...): %v", err)
+			}
+
+			calls := 0
+			h := middleware.HandlerFunc(func(_ context.Context, _ interface{}) (interface{}, middleware.Metadata, error) {
+				err := tc.errs[calls]
+				calls++
+				return nil, middleware.Metadata{}, err
+			})
+			_, _, err := middleware.DecorateHandler(h, stack).Handle(context.Background(), nil)
+
+			if diff := cmp.Diff(tc.want, want{calls: calls, err: err != nil}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nHandle(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCredentialsFingerprint(t *testing.T) {
+	static := credentials.NewStaticCredentialsProvider("AKIAEXAMPLEKEY1234", "secret", "")
+
+	type want struct {
+		fingerprint string
+		err         bool
+	}
+
+	cases := map[string]struct {
+		reason  string
+		creds   aws.CredentialsProvider
+		source  string
+		roleARN string
+		want    want
+	}{
+		"Secret": {
+			reason: "Composition credentials should be identified by their access key ID.",
+			creds:  static,
+			source: credentialsSourceSecret,
+			want:   want{fingerprint: "key ...1234"},
+		},
+		"SecretIgnoresRole": {
+			reason:  "Composition credentials should be identified by their access key ID even if a web identity role is configured.",
+			creds:   static,
+			source:  credentialsSourceSecret,
+			roleARN: "arn:aws:iam::123456789012:role/usergroup-manager",
+			want:    want{fingerprint: "key ...1234"},
+		},
+		"WebIdentityRole": {
+			reason:  "Default chain credentials should be identified by the role they assume.",
+			creds:   static,
+			source:  credentialsSourceDefaultChain,
+			roleARN: "arn:aws:iam::123456789012:role/usergroup-manager",
+			want:    want{fingerprint: "role ...ager"},
+		},
+		"DefaultChain": {
+			reason: "Default chain credentials without a role should be identified by their access key ID.",
+			creds:  static,
+			source: credentialsSourceDefaultChain,
+			want:   want{fingerprint: "key ...1234"},
+		},
+		"NoProvider": {
+			reason: "A missing credentials provider should be an error.",
+			source: credentialsSourceDefaultChain,
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fp, err := credentialsFingerprint(context.Background(), tc.creds, tc.source, tc.roleARN)
+			if diff := cmp.Diff(tc.want, want{fingerprint: fp, err: err != nil}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\ncredentialsFingerprint(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+)
+
+// Phases of replacing the built-in default user in a user group, in order. A
+// replacement can become blocked in any phase before it's swapping.
+const (
+	// replacementPhasePending waits for the applyMode feature to create the
+	// replacement user.
+	replacementPhasePending = "Pending"
+
+	// replacementPhaseCreating waits for the replacement user to be active.
+	replacementPhaseCreating = "Creating"
+
+	// replacementPhaseWaiting waits for the user group to exist and be
+	// active.
+	replacementPhaseWaiting = "Waiting"
+
+	// replacementPhaseBlocked needs the replacement user or the user group
+	// to be fixed before they can be swapped.
+	replacementPhaseBlocked = "Blocked"
+
+	// replacementPhaseReady waits for the applyMode feature to swap the
+	// replacement user in and the built-in default user out.
+	replacementPhaseReady = "Ready"
+
+	// replacementPhaseSwapping waits for ElastiCache to modify the user
+	// group.
+	replacementPhaseSwapping = "Swapping"
+
+	// replacementPhaseComplete has the replacement user in the user group,
+	// and the built-in default user out of it.
+	replacementPhaseComplete = "Complete"
+)
+
+// replacementAccessString denies the replacement default user every command,
+// so clients that don't authenticate can't do anything.
+const replacementAccessString = "off -@all"
+
+// replacementPasswordBytes is how many random bytes the replacement default
+// user's password is made of. Its hex encoding must be between 16 and 128
+// characters long.
+const replacementPasswordBytes = 32
+
+// defaultUserReplacementParameters configure replacing the built-in default
+// user of a user group with a user named default that can't do anything.
+type defaultUserReplacementParameters struct {
+	// UserID is the ID of the replacement user. It's created if it doesn't
+	// exist.
+	UserID string
+
+	// UserGroupID is the user group whose default user is replaced. It
+	// defaults to spec.parameters.userGroupId.
+	UserGroupID string
+}
+
+// A defaultUserReplacement is the phase replacing a user group's built-in
+// default user is in.
+type defaultUserReplacement struct {
+	UserID      string
+	UserGroupID string
+	Engine      string
+	Phase       string
+	Message     string
+
+	// builtIn and member are true if the user group contains the built-in
+	// default user and the replacement user respectively.
+	builtIn bool
+	member  bool
+}
+
+// Status returns the replacement as written to the XR status.
+func (r *defaultUserReplacement) Status() map[string]any {
+	return map[string]any{
+		"userId":      r.UserID,
+		"userGroupId": r.UserGroupID,
+		"phase":       r.Phase,
+		"message":     r.Message,
+	}
+}
+
+// Settled returns false while the replacement waits for ElastiCache, so the
+// function should check it again soon.
+func (r *defaultUserReplacement) Settled() bool {
+	return r.Phase != replacementPhaseCreating && r.Phase != replacementPhaseSwapping
+}
+
+// describeDefaultUserReplacement returns the phase replacing the built-in
+// default user of a user group is in. Every phase is derived from what AWS
+// reports, so it's safe to call on every reconcile.
+func describeDefaultUserReplacement(ctx context.Context, client awsclient.ElastiCache, p defaultUserReplacementParameters) (*defaultUserReplacement, error) {
+	var user *types.User
+	uo, err := client.DescribeUsers(ctx, &elasticache.DescribeUsersInput{UserId: aws.String(p.UserID)})
+	switch {
+	case errors.Is(err, awsclient.ErrNotFound):
+	case err != nil:
+		return nil, fmt.Errorf("failed to describe user %q: %w", p.UserID, err)
+	case len(uo.Users) > 0:
+		user = &uo.Users[0]
+	}
+
+	var ug *types.UserGroup
+	gout, err := client.DescribeUserGroups(ctx, &elasticache.DescribeUserGroupsInput{UserGroupId: aws.String(p.UserGroupID)})
+	switch {
+	case errors.Is(err, awsclient.ErrNotFound):
+	case err != nil:
+		return nil, fmt.Errorf("failed to describe user group %q: %w", p.UserGroupID, err)
+	case len(gout.UserGroups) > 0:
+		ug = &gout.UserGroups[0]
+	}
+	return planDefaultUserReplacement(user, ug, p), nil
+}
+
+// planDefaultUserReplacement returns the phase a replacement is in, given the
+// replacement user and the user group, either of which is nil if it doesn't
+// exist yet.
+func planDefaultUserReplacement(user *types.User, ug *types.UserGroup, p defaultUserReplacementParameters) *defaultUserReplacement {
+	r := &defaultUserReplacement{UserID: p.UserID, UserGroupID: p.UserGroupID, Engine: engineRedis}
+	if ug != nil {
+		r.Engine = strings.ToLower(aws.ToString(ug.Engine))
+		r.builtIn = slices.Contains(ug.UserIds, discovery.DefaultUserID)
+		r.member = slices.Contains(ug.UserIds, p.UserID)
+	}
+
+	switch {
+	case user == nil:
+		r.Phase, r.Message = replacementPhasePending, fmt.Sprintf("Replacement default user %q doesn't exist; enable the applyMode feature to create it", p.UserID)
+		return r
+	case aws.ToString(user.UserName) != discovery.DefaultUserName:
+		r.Phase, r.Message = replacementPhaseBlocked, fmt.Sprintf("User %q is named %q, but a replacement default user must be named %s", p.UserID, aws.ToString(user.UserName), discovery.DefaultUserName)
+		return r
+	case ug == nil:
+		r.Phase, r.Message = replacementPhaseWaiting, fmt.Sprintf("Waiting for user group %q to be created", p.UserGroupID)
+		return r
+	}
+
+	engine := discovery.NewUser(*user).Engine
+	if !(userGroupTarget{Engine: r.Engine}).Accepts(engine) {
+		r.Phase, r.Message = replacementPhaseBlocked, fmt.Sprintf("User %q is a %s user, which %s user group %q doesn't accept", p.UserID, engine, r.Engine, p.UserGroupID)
+		return r
+	}
+
+	swapped := r.member && !r.builtIn
+	active := aws.ToString(ug.Status) == membership.StatusActive
+	switch {
+	case aws.ToString(user.Status) != membership.StatusActive:
+		r.Phase, r.Message = replacementPhaseCreating, fmt.Sprintf("Waiting for replacement default user %q to become active; it's %s", p.UserID, aws.ToString(user.Status))
+	case swapped && active:
+		r.Phase, r.Message = replacementPhaseComplete, fmt.Sprintf("User group %q uses replacement default user %q", p.UserGroupID, p.UserID)
+	case swapped:
+		r.Phase, r.Message = replacementPhaseSwapping, fmt.Sprintf("User group %q is %s", p.UserGroupID, aws.ToString(ug.Status))
+	case !active:
+		r.Phase, r.Message = replacementPhaseWaiting, fmt.Sprintf("Waiting for user group %q to become active; it's %s", p.UserGroupID, aws.ToString(ug.Status))
+	default:
+		r.Phase, r.Message = replacementPhaseReady, fmt.Sprintf("Ready to swap replacement default user %q into user group %q; enable the applyMode feature to proceed", p.UserID, p.UserGroupID)
+	}
+	return r
+}
+
+// Advance creates the replacement user of a Pending replacement, or swaps it
+// into the user group of a Ready one, removing the built-in default user in
+// the same call so the user group always has a user named default.
+func (r *defaultUserReplacement) Advance(ctx context.Context, client awsclient.ElastiCache, tags map[string]string) error {
+	switch r.Phase {
+	case replacementPhasePending:
+		password, err := replacementPassword()
+		if err != nil {
+			return err
+		}
+		// Nobody needs the password, since the user can't do anything. It's
+		// never stored.
+		_, err = client.CreateUser(ctx, &elasticache.CreateUserInput{
+			UserId:       aws.String(r.UserID),
+			UserName:     aws.String(discovery.DefaultUserName),
+			Engine:       aws.String(r.Engine),
+			AccessString: aws.String(replacementAccessString),
+			AuthenticationMode: &types.AuthenticationMode{
+				Type:      types.InputAuthenticationTypePassword,
+				Passwords: []string{password},
+			},
+			Tags: elastiCacheTags(tags),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create replacement default user %q: %w", r.UserID, err)
+		}
+		r.Phase, r.Message = replacementPhaseCreating, fmt.Sprintf("Creating replacement default user %q", r.UserID)
+	case replacementPhaseReady:
+		in := &elasticache.ModifyUserGroupInput{UserGroupId: aws.String(r.UserGroupID)}
+		if !r.member {
+			in.UserIdsToAdd = []string{r.UserID}
+		}
+		if r.builtIn {
+			in.UserIdsToRemove = []string{discovery.DefaultUserID}
+		}
+		if _, err := client.ModifyUserGroup(ctx, in); err != nil {
+			return fmt.Errorf("failed to swap replacement default user %q into user group %q: %w", r.UserID, r.UserGroupID, err)
+		}
+		r.Phase, r.Message = replacementPhaseSwapping, fmt.Sprintf("Swapping replacement default user %q into user group %q", r.UserID, r.UserGroupID)
+	}
+	return nil
+}
+
+// replacementPassword returns a random password for a replacement default
+// user.
+func replacementPassword() (string, error) {
+	b := make([]byte, replacementPasswordBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate a password: %w", err)
+	}
+	return fmt.Sprintf("%x", b), nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestPlanDefaultUserReplacement(t *testing.T) {
+	p := defaultUserReplacementParameters{UserID: "off-default", UserGroupID: "app"}
+	replacement := func(status string) *types.User {
+		return &types.User{UserId: aws.String("off-default"), UserName: aws.String(discovery.DefaultUserName), Engine: aws.String(engineRedis), Status: aws.String(status)}
+	}
+	group := func(status string, ids ...string) *types.UserGroup {
+		return &types.UserGroup{UserGroupId: aws.String("app"), Engine: aws.String(engineRedis), Status: aws.String(status), UserIds: ids}
+	}
+
+	type want struct {
+		phase   string
+		message string
+	}
+
+	cases := map[string]struct {
+		reason string
+		user   *types.User
+		ug     *types.UserGroup
+		want   want
+	}{
+		"Pending": {
+			reason: "A missing replacement user should wait for the applyMode feature to create it.",
+			ug:     group("active", discovery.DefaultUserID),
+			want:   want{phase: replacementPhasePending, message: `Replacement default user "off-default" doesn't exist; enable the applyMode feature to create it`},
+		},
+		"WrongName": {
+			reason: "A replacement user that isn't named default should block the replacement.",
+			user:   &types.User{UserId: aws.String("off-default"), UserName: aws.String("off"), Engine: aws.String(engineRedis), Status: aws.String("active")},
+			ug:     group("active", discovery.DefaultUserID),
+			want:   want{phase: replacementPhaseBlocked, message: `User "off-default" is named "off", but a replacement default user must be named default`},
+		},
+		"WrongEngine": {
+			reason: "A replacement user the user group doesn't accept should block the replacement.",
+			user:   &types.User{UserId: aws.String("off-default"), UserName: aws.String(discovery.DefaultUserName), Engine: aws.String(engineValkey), Status: aws.String("active")},
+			ug:     group("active", discovery.DefaultUserID),
+			want:   want{phase: replacementPhaseBlocked, message: `User "off-default" is a valkey user, which redis user group "app" doesn't accept`},
+		},
+		"WaitingForUserGroup": {
+			reason: "A missing user group should be waited for.",
+			user:   replacement("active"),
+			want:   want{phase: replacementPhaseWaiting, message: `Waiting for user group "app" to be created`},
+		},
+		"Creating": {
+			reason: "A replacement user that isn't active yet should be waited for.",
+			user:   replacement("creating"),
+			ug:     group("active", discovery.DefaultUserID),
+			want:   want{phase: replacementPhaseCreating, message: `Waiting for replacement default user "off-default" to become active; it's creating`},
+		},
+		"Ready": {
+			reason: "An active replacement user and user group should be ready to swap.",
+			user:   replacement("active"),
+			ug:     group("active", discovery.DefaultUserID, "app1"),
+			want:   want{phase: replacementPhaseReady, message: `Ready to swap replacement default user "off-default" into user group "app"; enable the applyMode feature to proceed`},
+		},
+		"Swapping": {
+			reason: "A user group still being modified after the swap should be waited for.",
+			user:   replacement("active"),
+			ug:     group("modifying", "off-default", "app1"),
+			want:   want{phase: replacementPhaseSwapping, message: `User group "app" is modifying`},
+		},
+		"Complete": {
+			reason: "An active user group with the replacement user and without the built-in one should be complete.",
+			user:   replacement("active"),
+			ug:     group("active", "off-default", "app1"),
+			want:   want{phase: replacementPhaseComplete, message: `User group "app" uses replacement default user "off-default"`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := planDefaultUserReplacement(tc.user, tc.ug, p)
+			if diff := cmp.Diff(tc.want, want{phase: r.Phase, message: r.Message}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nplanDefaultUserReplacement(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
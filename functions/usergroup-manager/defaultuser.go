@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// Which user named default a user group gets when there's more than one to
+// choose from.
+const (
+	// defaultUserPreferBuiltIn prefers the default user ElastiCache creates
+	// in every account.
+	defaultUserPreferBuiltIn = "builtIn"
+
+	// defaultUserPreferReplacement prefers a user created to replace it,
+	// i.e. named default with another ID, e.g. with access string off.
+	defaultUserPreferReplacement = "replacement"
+)
+
+// implicitUserGroupResource is the composition resource name of the user
+// group later pipeline steps compose without spec.parameters.userGroups.
+const implicitUserGroupResource = "user-group"
+
+// implicitUserGroup returns the user group all discovered users belong to
+// when they aren't assigned to user groups: the target user group of direct
+// mode, if the function converges it, or otherwise the implicit user group.
+// The implicit user group is named userGroupID, or its composition resource
+// name without one. It returns nil if there's no such user group.
+func implicitUserGroup(p *parameters, groups []userGroupMembership, userIDs []string) *userGroupMembership {
+	switch {
+	case p.ManagementMode == managementModeDirect:
+		if p.UserGroupID == "" || (!p.Features.Enabled(featureApplyMode) && !p.DryRun) {
+			return nil
+		}
+		engine := p.Engine
+		if engine == "" {
+			engine = engineRedis
+		}
+		return &userGroupMembership{Name: p.UserGroupID, Engine: engine, UserIDs: slices.Clone(userIDs)}
+	case len(groups) > 0:
+		return nil
+	}
+	name := p.UserGroupID
+	if name == "" {
+		name = implicitUserGroupResource
+	}
+	return &userGroupMembership{Name: name, Engine: engineRedis, UserIDs: slices.Clone(userIDs)}
+}
+
+// engineRequiresDefaultUser returns true if ElastiCache requires a user named
+// default in every user group of the supplied engine.
+func engineRequiresDefaultUser(engine string) bool {
+	return engine == engineRedis
+}
+
+// selectDefaultUser returns the user named default a user group of the
+// supplied engine should contain. Users of the group's own engine come first,
+// then those prefer selects, so the choice doesn't depend on discovery order.
+func selectDefaultUser(users []discovery.User, engine, prefer string) (discovery.User, bool) {
+	target := userGroupTarget{Engine: engine}
+	var candidates []discovery.User
+	for _, u := range users {
+		if u.Name == discovery.DefaultUserName && target.Accepts(u.Engine) {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		return discovery.User{}, false
+	}
+	rank := func(u discovery.User) int {
+		r := 0
+		if u.Engine != engine {
+			r += 2
+		}
+		if (u.ID == discovery.DefaultUserID) != (prefer == defaultUserPreferBuiltIn) {
+			r++
+		}
+		return r
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ri, rj := rank(candidates[i]), rank(candidates[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	return candidates[0], true
+}
+
+// ensureDefaultUsers replaces the users named default in each group with the
+// one selectDefaultUser picks for its engine, so each group contains exactly
+// one. It returns the default user of each group, keyed by group name, and the
+// names of the groups whose engine requires a default user but that can't have
+// one, since none was discovered.
+func ensureDefaultUsers(groups []userGroupMembership, users []discovery.User, prefer string) (defaults map[string]string, missing []string) {
+	named := map[string]bool{}
+	for _, u := range users {
+		if u.Name == discovery.DefaultUserName {
+			named[u.ID] = true
+		}
+	}
+
+	defaults = map[string]string{}
+	for i, g := range groups {
+		ids := make([]string, 0, len(g.UserIDs)+1)
+		for _, id := range g.UserIDs {
+			if !named[id] {
+				ids = append(ids, id)
+			}
+		}
+		if u, ok := selectDefaultUser(users, g.Engine, prefer); ok {
+			ids = append(ids, u.ID)
+			defaults[g.Name] = u.ID
+		} else if engineRequiresDefaultUser(g.Engine) {
+			missing = append(missing, g.Name)
+		}
+		groups[i].UserIDs = ids
+	}
+	return defaults, missing
+}
+
+// defaultUsersPresent sets the DefaultUsersPresent condition, given the user
+// groups that can't have a user named default.
+func defaultUsersPresent(rsp *fnv1.RunFunctionResponse, missing []string) {
+	if len(missing) > 0 {
+		response.ConditionFalse(rsp, "DefaultUsersPresent", "DefaultUserMissing").
+			WithMessage(fmt.Sprintf("No user named default was discovered for user groups %v, but ElastiCache requires one in every Redis OSS user group", missing)).
+			TargetCompositeAndClaim()
+		return
+	}
+	response.ConditionTrue(rsp, "DefaultUsersPresent", "DefaultUsersPresent").TargetCompositeAndClaim()
+}
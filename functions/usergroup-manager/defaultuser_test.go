@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestEnsureDefaultUsers(t *testing.T) {
+	builtIn := discovery.User{ID: discovery.DefaultUserID, Name: discovery.DefaultUserName, Engine: engineRedis}
+	replacement := discovery.User{ID: "off-default", Name: discovery.DefaultUserName, Engine: engineRedis}
+	valkey := discovery.User{ID: "valkey-default", Name: discovery.DefaultUserName, Engine: engineValkey}
+	app := discovery.User{ID: "app1", Name: "app1", Engine: engineRedis}
+
+	type want struct {
+		groups   []userGroupMembership
+		defaults map[string]string
+		missing  []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		groups []userGroupMembership
+		users  []discovery.User
+		prefer string
+		want   want
+	}{
+		"PreferBuiltIn": {
+			reason: "The built-in default user should replace any other user named default by default.",
+			groups: []userGroupMembership{{Name: "app", Engine: engineRedis, UserIDs: []string{"app1", "off-default"}}},
+			users:  []discovery.User{app, replacement, builtIn},
+			prefer: defaultUserPreferBuiltIn,
+			want: want{
+				groups:   []userGroupMembership{{Name: "app", Engine: engineRedis, UserIDs: []string{"app1", discovery.DefaultUserID}}},
+				defaults: map[string]string{"app": discovery.DefaultUserID},
+			},
+		},
+		"PreferReplacement": {
+			reason: "A user created to replace the built-in default user should be preferred if asked.",
+			groups: []userGroupMembership{{Name: "app", Engine: engineRedis, UserIDs: []string{"app1", discovery.DefaultUserID}}},
+			users:  []discovery.User{app, builtIn, replacement},
+			prefer: defaultUserPreferReplacement,
+			want: want{
+				groups:   []userGroupMembership{{Name: "app", Engine: engineRedis, UserIDs: []string{"app1", "off-default"}}},
+				defaults: map[string]string{"app": "off-default"},
+			},
+		},
+		"EngineDefault": {
+			reason: "Each user group should get the default user of its own engine, falling back to a Redis OSS one for Valkey user groups.",
+			groups: []userGroupMembership{
+				{Name: "redis", Engine: engineRedis, UserIDs: []string{"app1"}},
+				{Name: "valkey", Engine: engineValkey, UserIDs: []string{"app1"}},
+			},
+			users:  []discovery.User{app, replacement, valkey},
+			prefer: defaultUserPreferBuiltIn,
+			want: want{
+				groups: []userGroupMembership{
+					{Name: "redis", Engine: engineRedis, UserIDs: []string{"app1", "off-default"}},
+					{Name: "valkey", Engine: engineValkey, UserIDs: []string{"app1", "valkey-default"}},
+				},
+				defaults: map[string]string{"redis": "off-default", "valkey": "valkey-default"},
+			},
+		},
+		"Missing": {
+			reason: "Redis OSS user groups without a user named default should be reported, but Valkey ones don't need one.",
+			groups: []userGroupMembership{
+				{Name: "redis", Engine: engineRedis, UserIDs: []string{"app1"}},
+				{Name: "valkey", Engine: engineValkey, UserIDs: []string{"app1"}},
+			},
+			users:  []discovery.User{app},
+			prefer: defaultUserPreferBuiltIn,
+			want: want{
+				groups: []userGroupMembership{
+					{Name: "redis", Engine: engineRedis, UserIDs: []string{"app1"}},
+					{Name: "valkey", Engine: engineValkey, UserIDs: []string{"app1"}},
+				},
+				defaults: map[string]string{},
+				missing:  []string{"redis"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			defaults, missing := ensureDefaultUsers(tc.groups, tc.users, tc.prefer)
+			got := want{groups: tc.groups, defaults: defaults, missing: missing}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{}), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\nensureDefaultUsers(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestImplicitUserGroup(t *testing.T) {
+	ids := []string{"app1"}
+
+	cases := map[string]struct {
+		reason string
+		params *parameters
+		groups []userGroupMembership
+		want   *userGroupMembership
+	}{
+		"Implicit": {
+			reason: "Without user groups the discovered users should belong to the implicit user group.",
+			params: &parameters{ManagementMode: managementModeDiscover},
+			want:   &userGroupMembership{Name: implicitUserGroupResource, Engine: engineRedis, UserIDs: ids},
+		},
+		"ImplicitNamed": {
+			reason: "The implicit user group should be named after userGroupId, if set.",
+			params: &parameters{ManagementMode: managementModeComposed, UserGroupID: "app"},
+			want:   &userGroupMembership{Name: "app", Engine: engineRedis, UserIDs: ids},
+		},
+		"UserGroups": {
+			reason: "There's no implicit user group if users are assigned to user groups.",
+			params: &parameters{ManagementMode: managementModeDiscover},
+			groups: []userGroupMembership{{Name: "orders-users", Engine: engineRedis}},
+		},
+		"Direct": {
+			reason: "In direct mode the discovered users should belong to the target user group, whether or not there are user groups.",
+			params: &parameters{ManagementMode: managementModeDirect, UserGroupID: "app", Engine: engineValkey, Features: featureFlags{featureApplyMode: true}},
+			groups: []userGroupMembership{{Name: "orders-users", Engine: engineRedis}},
+			want:   &userGroupMembership{Name: "app", Engine: engineValkey, UserIDs: ids},
+		},
+		"DirectNotConverged": {
+			reason: "There's no target user group if direct mode doesn't converge it.",
+			params: &parameters{ManagementMode: managementModeDirect, UserGroupID: "app"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := implicitUserGroup(tc.params, tc.groups, ids)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nimplicitUserGroup(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
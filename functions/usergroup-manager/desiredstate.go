@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
+
+// desiredStateExportKey is the context key the desired state export is
+// written to.
+const desiredStateExportKey = "desiredStateExport"
+
+// desiredStateDataKey is the ConfigMap data key holding the export.
+const desiredStateDataKey = "desired-state.yaml"
+
+type desiredStateExportParameters struct {
+	Enabled bool
+	// ConfigMapName is the ConfigMap, in the XR's namespace, later pipeline
+	// steps compose to hold the export. The export is only written to the
+	// pipeline context if it's empty.
+	ConfigMapName string
+}
+
+// A desiredState is everything the function asks later pipeline steps to
+// compose, in a canonical form reviewers can diff, and the caches it attaches
+// a user group to.
+type desiredState struct {
+	UserGroups []desiredUserGroup `json:"userGroups"`
+	Users      []desiredUser      `json:"users"`
+	// Associations are only rendered if spec.parameters.userGroupInjection
+	// selects any caches, so the export doesn't change otherwise.
+	Associations []desiredAssociation `json:"associations,omitempty"`
+}
+
+type desiredUserGroup struct {
+	// Resource is the composition resource name of the UserGroup.
+	Resource string   `json:"resource"`
+	Name     string   `json:"name,omitempty"`
+	Engine   string   `json:"engine"`
+	UserIDs  []string `json:"userIds"`
+}
+
+type desiredUser struct {
+	Resource     string   `json:"resource"`
+	UserID       string   `json:"userId"`
+	UserName     string   `json:"userName"`
+	Engine       string   `json:"engine"`
+	AccessString string   `json:"accessString"`
+	UserGroups   []string `json:"userGroups"`
+	ObserveOnly  bool     `json:"observeOnly"`
+}
+
+// newDesiredState returns the desired state for the supplied user groups and
+// managed users. Without user groups, all discovered users belong to a single,
+// implicit user group.
+func newDesiredState(groups []userGroupMembership, userIDs []string, identityUsers, bundleUsers []managedUser) *desiredState {
+	s := &desiredState{UserGroups: []desiredUserGroup{}, Users: []desiredUser{}}
+	if len(groups) == 0 {
+		s.UserGroups = append(s.UserGroups, desiredUserGroup{Resource: implicitUserGroupResource, Engine: engineRedis, UserIDs: sorted(userIDs)})
+	}
+	for _, g := range groups {
+		s.UserGroups = append(s.UserGroups, desiredUserGroup{Resource: "user-group-" + g.Name, Name: g.Name, Engine: g.Engine, UserIDs: sorted(g.UserIDs)})
+	}
+	for _, u := range identityUsers {
+		s.Users = append(s.Users, newDesiredUser("identity-user-", u))
+	}
+	for _, u := range bundleUsers {
+		s.Users = append(s.Users, newDesiredUser("bundle-user-", u))
+	}
+	sort.Slice(s.UserGroups, func(i, j int) bool { return s.UserGroups[i].Resource < s.UserGroups[j].Resource })
+	sort.Slice(s.Users, func(i, j int) bool { return s.Users[i].Resource < s.Users[j].Resource })
+	return s
+}
+
+// A desiredAssociation is a desired ReplicationGroup or ServerlessCache,
+// composed by an earlier pipeline step, the function attaches a user group to.
+type desiredAssociation struct {
+	// Resource is the composition resource name of the cache.
+	Resource    string `json:"resource"`
+	Kind        string `json:"kind"`
+	UserGroupID string `json:"userGroupId"`
+}
+
+func newDesiredUser(prefix string, u managedUser) desiredUser {
+	return desiredUser{
+		Resource:     prefix + u.ID,
+		UserID:       u.ID,
+		UserName:     u.Name,
+		Engine:       u.Engine,
+		AccessString: u.AccessString,
+		UserGroups:   sorted(u.UserGroups),
+		ObserveOnly:  u.ObserveOnly,
+	}
+}
+
+func sorted(s []string) []string {
+	out := slices.Clone(s)
+	if out == nil {
+		out = []string{}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Memberships returns the desired user IDs of each user group, keyed by
+// composition resource name.
+func (s *desiredState) Memberships() map[string][]string {
+	m := make(map[string][]string, len(s.UserGroups))
+	for _, g := range s.UserGroups {
+		m[g.Resource] = g.UserIDs
+	}
+	return m
+}
+
+// YAML returns the desired state as canonical YAML: lists are sorted and
+// fields always appear in the same order, so unchanged state renders
+// identically.
+func (s *desiredState) YAML() (string, error) {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("cannot render desired state: %w", err)
+	}
+	return string(b), nil
+}
+
+// desiredStateExportContext returns the export in a form that can be written
+// to the pipeline context.
+func desiredStateExportContext(doc, configMapName string) map[string]any {
+	m := map[string]any{"yaml": doc}
+	if configMapName != "" {
+		m["configMapName"] = configMapName
+		m["dataKey"] = desiredStateDataKey
+	}
+	return m
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDesiredStateYAML(t *testing.T) {
+	cases := map[string]struct {
+		reason        string
+		groups        []userGroupMembership
+		userIDs       []string
+		identityUsers []managedUser
+		bundleUsers   []managedUser
+		associations  []desiredAssociation
+		want          string
+	}{
+		"ImplicitGroup": {
+			reason:  "Without user groups, all discovered users should belong to the implicit user group.",
+			userIDs: []string{"default", "app2", "app1"},
+			want: `userGroups:
+- engine: redis
+  resource: user-group
+  userIds:
+  - app1
+  - app2
+  - default
+users: []
+`,
+		},
+		"Associations": {
+			reason:  "The caches the user group is attached to should be rendered.",
+			userIDs: []string{"app1"},
+			associations: []desiredAssociation{
+				{Resource: "orders", Kind: replicationGroupMRKind, UserGroupID: "app"},
+				{Resource: "sessions", Kind: serverlessCacheMRKind, UserGroupID: "app"},
+			},
+			want: `associations:
+- kind: ReplicationGroup
+  resource: orders
+  userGroupId: app
+- kind: ServerlessCache
+  resource: sessions
+  userGroupId: app
+userGroups:
+- engine: redis
+  resource: user-group
+  userIds:
+  - app1
+users: []
+`,
+		},
+		"UserGroups": {
+			reason: "User groups and managed users should be rendered sorted.",
+			groups: []userGroupMembership{
+				{Name: "ops", Engine: engineValkey, UserIDs: []string{"ops1"}},
+				{Name: "app", Engine: engineRedis, UserIDs: []string{"sso-alice", "app1"}},
+			},
+			identityUsers: []managedUser{
+				{ID: "sso-alice", Name: "alice", Engine: engineRedis, AccessString: "on ~* +@read", UserGroups: []string{"app"}},
+			},
+			bundleUsers: []managedUser{
+				{ID: "app1", Name: "app1", Engine: engineRedis, AccessString: "on ~app1:* +@all", UserGroups: []string{"app"}, ObserveOnly: true},
+			},
+			want: `userGroups:
+- engine: redis
+  name: app
+  resource: user-group-app
+  userIds:
+  - app1
+  - sso-alice
+- engine: valkey
+  name: ops
+  resource: user-group-ops
+  userIds:
+  - ops1
+users:
+- accessString: on ~app1:* +@all
+  engine: redis
+  observeOnly: true
+  resource: bundle-user-app1
+  userGroups:
+  - app
+  userId: app1
+  userName: app1
+- accessString: on ~* +@read
+  engine: redis
+  observeOnly: false
+  resource: identity-user-sso-alice
+  userGroups:
+  - app
+  userId: sso-alice
+  userName: alice
+`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := newDesiredState(tc.groups, tc.userIDs, tc.identityUsers, tc.bundleUsers)
+			s.Associations = tc.associations
+			got, err := s.YAML()
+			if err != nil {
+				t.Fatalf("%s\nYAML(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nYAML(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
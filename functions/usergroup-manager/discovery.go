@@ -0,0 +1,24 @@
+package main
+
+import "time"
+
+// Sync modes recorded in status.
+const (
+	syncModeFull     = "full"
+	syncModeTargeted = "targeted"
+	syncModeCluster  = "cluster"
+
+	// syncModeDegraded derives users from user group membership, because
+	// the function isn't allowed to describe users.
+	syncModeDegraded = "degraded"
+)
+
+// useTargetedSync returns true if the previously discovered users can be
+// verified instead of listing every user: targeted verification must be
+// enabled, and the last full listing must be recent enough.
+func useTargetedSync(p verificationParameters, lastFull time.Time, previous []string, now time.Time) bool {
+	if p.Mode != syncModeTargeted || lastFull.IsZero() || len(previous) == 0 {
+		return false
+	}
+	return now.Sub(lastFull) < p.FullResyncInterval
+}
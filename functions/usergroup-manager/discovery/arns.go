@@ -0,0 +1,94 @@
+package discovery
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// AWS partitions the function supports.
+const (
+	PartitionAWS      = "aws"
+	PartitionGovCloud = "aws-us-gov"
+	PartitionChina    = "aws-cn"
+)
+
+// Partition returns the partition of region, e.g. aws-us-gov for
+// us-gov-west-1.
+func Partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "us-gov-"):
+		return PartitionGovCloud
+	case strings.HasPrefix(region, "cn-"):
+		return PartitionChina
+	default:
+		return PartitionAWS
+	}
+}
+
+// UserARN returns the ARN of a user in the partition of region, e.g. to list
+// its tags with ListTagsForResource when AWS didn't report its ARN.
+func UserARN(region, account, userID string) string {
+	return arn.ARN{Partition: Partition(region), Service: "elasticache", Region: region, AccountID: account, Resource: "user:" + userID}.String()
+}
+
+// FilterByRegion returns the users whose ARN is in region, and separately
+// those whose ARN is in another region. A user group can only contain users
+// of its own region, which ElastiCache otherwise only reports once the user
+// group is modified. Users without a valid ARN, such as those kept from a
+// previous discovery, are kept.
+func FilterByRegion(users []User, region string) (in, other []User) {
+	return partitionByARN(users, func(a arn.ARN) bool { return a.Region == "" || a.Region == region })
+}
+
+// FilterByAccount returns the users whose ARN is in account, and separately
+// those whose ARN is in another account, e.g. because the credentials of one
+// account were used with the settings of another. Users without a valid ARN
+// are kept.
+func FilterByAccount(users []User, account string) (in, other []User) {
+	return partitionByARN(users, func(a arn.ARN) bool { return a.AccountID == "" || a.AccountID == account })
+}
+
+// partitionByARN returns the users whose ARN keep accepts, or that don't have
+// a valid ARN, and separately the others.
+func partitionByARN(users []User, keep func(a arn.ARN) bool) (in, other []User) {
+	in = make([]User, 0, len(users))
+	for _, u := range users {
+		if a, err := arn.Parse(u.ARN); err == nil && !keep(a) {
+			other = append(other, u)
+			continue
+		}
+		in = append(in, u)
+	}
+	return in, other
+}
+
+// ARNRegion returns the region of an ARN, or an empty string if it isn't a
+// valid ARN.
+func ARNRegion(s string) string {
+	a, err := arn.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return a.Region
+}
+
+// ARNPartition returns the partition of an ARN, or an empty string if it
+// isn't a valid ARN.
+func ARNPartition(s string) string {
+	a, err := arn.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return a.Partition
+}
+
+// ARNAccount returns the account ID of an ARN, or an empty string if it isn't
+// a valid ARN.
+func ARNAccount(s string) string {
+	a, err := arn.Parse(s)
+	if err != nil {
+		return ""
+	}
+	return a.AccountID
+}
@@ -0,0 +1,131 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilterByRegion(t *testing.T) {
+	local := User{ID: "app1", ARN: "arn:aws:elasticache:us-east-1:123456789012:user:app1"}
+	remote := User{ID: "app2", ARN: "arn:aws:elasticache:eu-west-1:123456789012:user:app2"}
+	stale := User{ID: "app3"}
+
+	type want struct {
+		in    []User
+		other []User
+	}
+
+	cases := map[string]struct {
+		reason string
+		users  []User
+		want   want
+	}{
+		"SameRegion": {
+			reason: "Users in the region should be kept.",
+			users:  []User{local},
+			want:   want{in: []User{local}},
+		},
+		"OtherRegion": {
+			reason: "Users whose ARN is in another region should be returned separately.",
+			users:  []User{local, remote},
+			want:   want{in: []User{local}, other: []User{remote}},
+		},
+		"NoARN": {
+			reason: "Users without an ARN should be kept, since their region isn't known.",
+			users:  []User{stale},
+			want:   want{in: []User{stale}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			in, other := FilterByRegion(tc.users, "us-east-1")
+			if diff := cmp.Diff(tc.want, want{in: in, other: other}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nFilterByRegion(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestFilterByAccount(t *testing.T) {
+	local := User{ID: "app1", ARN: "arn:aws:elasticache:us-east-1:123456789012:user:app1"}
+	remote := User{ID: "app2", ARN: "arn:aws:elasticache:us-east-1:210987654321:user:app2"}
+	stale := User{ID: "app3"}
+
+	type want struct {
+		in    []User
+		other []User
+	}
+
+	cases := map[string]struct {
+		reason string
+		users  []User
+		want   want
+	}{
+		"SameAccount": {
+			reason: "Users in the account should be kept.",
+			users:  []User{local},
+			want:   want{in: []User{local}},
+		},
+		"OtherAccount": {
+			reason: "Users whose ARN is in another account should be returned separately.",
+			users:  []User{local, remote},
+			want:   want{in: []User{local}, other: []User{remote}},
+		},
+		"NoARN": {
+			reason: "Users without an ARN should be kept, since their account isn't known.",
+			users:  []User{stale},
+			want:   want{in: []User{stale}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			in, other := FilterByAccount(tc.users, "123456789012")
+			if diff := cmp.Diff(tc.want, want{in: in, other: other}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nFilterByAccount(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestUserARN(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		region string
+		want   string
+	}{
+		"Standard": {
+			reason: "Users in standard regions should be in the aws partition.",
+			region: "eu-west-1",
+			want:   "arn:aws:elasticache:eu-west-1:123456789012:user:app1",
+		},
+		"GovCloud": {
+			reason: "Users in GovCloud regions should be in the aws-us-gov partition.",
+			region: "us-gov-west-1",
+			want:   "arn:aws-us-gov:elasticache:us-gov-west-1:123456789012:user:app1",
+		},
+		"China": {
+			reason: "Users in China regions should be in the aws-cn partition.",
+			region: "cn-northwest-1",
+			want:   "arn:aws-cn:elasticache:cn-northwest-1:123456789012:user:app1",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := UserARN(tc.region, "123456789012", "app1"); got != tc.want {
+				t.Errorf("%s\nUserARN(...): want %q, got %q", tc.reason, tc.want, got)
+			}
+		})
+	}
+}
+
+func BenchmarkFilterByRegion(b *testing.B) {
+	users := benchmarkUsers(10000)
+	b.ResetTimer()
+	for range b.N {
+		FilterByRegion(users, "us-east-1")
+	}
+}
@@ -0,0 +1,45 @@
+package discovery
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A NameFilter selects users by naming convention, for accounts where users
+// aren't tagged. A user matches if its name or ID starts with Prefix, and its
+// name or ID matches Regex. The zero filter matches every user.
+type NameFilter struct {
+	Prefix string
+	Regex  *regexp.Regexp
+}
+
+// Empty returns true if the filter matches every user.
+func (f NameFilter) Empty() bool {
+	return f.Prefix == "" && f.Regex == nil
+}
+
+// Matches returns true if the user satisfies the filter.
+func (f NameFilter) Matches(u User) bool {
+	if f.Prefix != "" && !strings.HasPrefix(u.Name, f.Prefix) && !strings.HasPrefix(u.ID, f.Prefix) {
+		return false
+	}
+	if f.Regex != nil && !f.Regex.MatchString(u.Name) && !f.Regex.MatchString(u.ID) {
+		return false
+	}
+	return true
+}
+
+// FilterByName returns the users the filter matches. The default user is
+// always kept, since every user group must contain it.
+func FilterByName(users []User, f NameFilter) []User {
+	if f.Empty() {
+		return users
+	}
+	out := make([]User, 0, len(users))
+	for _, u := range users {
+		if u.ID == DefaultUserID || f.Matches(u) {
+			out = append(out, u)
+		}
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package discovery
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilterByName(t *testing.T) {
+	users := []User{
+		{ID: DefaultUserID, Name: DefaultUserID},
+		{ID: "app1-reader", Name: "reader"},
+		{ID: "u-1234", Name: "app1-writer"},
+		{ID: "app2-reader", Name: "reader"},
+	}
+
+	cases := map[string]struct {
+		reason string
+		filter NameFilter
+		want   []User
+	}{
+		"Empty": {
+			reason: "An empty filter should keep every user.",
+			want:   users,
+		},
+		"Prefix": {
+			reason: "A prefix should match either the user's name or ID, and the default user should always be kept.",
+			filter: NameFilter{Prefix: "app1-"},
+			want:   []User{users[0], users[1], users[2]},
+		},
+		"Regex": {
+			reason: "A regular expression should match either the user's name or ID.",
+			filter: NameFilter{Regex: regexp.MustCompile(`^app[12]-reader$`)},
+			want:   []User{users[0], users[1], users[3]},
+		},
+		"Both": {
+			reason: "A user should satisfy both the prefix and the regular expression.",
+			filter: NameFilter{Prefix: "app", Regex: regexp.MustCompile(`writer$`)},
+			want:   []User{users[0], users[2]},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, FilterByName(users, tc.filter)); diff != "" {
+				t.Errorf("%s\nFilterByName(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func BenchmarkFilterByName(b *testing.B) {
+	users := benchmarkUsers(10000)
+	f := NameFilter{Prefix: "app", Regex: regexp.MustCompile(`^app0[0-4]`)}
+	b.ResetTimer()
+	for range b.N {
+		FilterByName(users, f)
+	}
+}
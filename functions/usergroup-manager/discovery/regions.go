@@ -0,0 +1,71 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// A Region is the outcome of discovering the users of one region.
+type Region struct {
+	Region  string
+	UserIDs []string
+	Err     error
+}
+
+// Regions lists the users of the supplied engine, or of any engine if it's
+// empty, in every region concurrently, each with its own client, keeping only
+// those names selects, and those filter selects if it isn't nil. A region that
+// fails doesn't stop the others; its error is returned in its result. Results
+// are sorted by region, and each region's user IDs by ID.
+func Regions(ctx context.Context, clients map[string]awsclient.ElastiCache, filter *TagFilter, names NameFilter, engine string) []Region {
+	out := make([]Region, 0, len(clients))
+	results := make(chan Region, len(clients))
+	var wg sync.WaitGroup
+	for region, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- discoverRegion(ctx, region, client, filter, names, engine)
+		}()
+	}
+	wg.Wait()
+	close(results)
+	for rd := range results {
+		out = append(out, rd)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Region < out[j].Region })
+	return out
+}
+
+func discoverRegion(ctx context.Context, region string, client awsclient.ElastiCache, filter *TagFilter, names NameFilter, engine string) Region {
+	rd := Region{Region: region}
+	var users []User
+	if err := Users(ctx, client, engine, func(u types.User) {
+		if u.UserId != nil {
+			users = append(users, NewUser(u))
+		}
+	}); err != nil {
+		rd.Err = fmt.Errorf("region %s: %w", region, err)
+		return rd
+	}
+	users = FilterByName(users, names)
+	if filter != nil {
+		var err error
+		if users, err = FilterByTag(ctx, client, users, filter.Key, filter.Value); err != nil {
+			rd.Err = fmt.Errorf("region %s: %w", region, err)
+			return rd
+		}
+	}
+	SortByID(users)
+	rd.UserIDs = make([]string, len(users))
+	for i, u := range users {
+		rd.UserIDs[i] = u.ID
+	}
+	return rd
+}
@@ -0,0 +1,73 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// A TagFilter selects the users tagged with Key and Value.
+type TagFilter struct {
+	Key   string
+	Value string
+}
+
+// HasTag returns true if tags include key with value.
+func HasTag(tags []types.Tag, key, value string) bool {
+	for _, t := range tags {
+		if aws.ToString(t.Key) == key && aws.ToString(t.Value) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterByTag returns the users tagged with key and value, so compositions in
+// shared accounts don't pick up unrelated users. DescribeUsers doesn't return
+// tags, so each user's tags are read with ListTagsForResource. The default
+// user is always kept, since every user group must contain it.
+func FilterByTag(ctx context.Context, client awsclient.ElastiCache, users []User, key, value string) ([]User, error) {
+	out := make([]User, 0, len(users))
+	for _, u := range users {
+		if u.ID == DefaultUserID {
+			out = append(out, u)
+			continue
+		}
+		tags, err := client.ListTagsForResource(ctx, &elasticache.ListTagsForResourceInput{ResourceName: aws.String(u.ARN)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags for user %q: %w", u.ID, err)
+		}
+		if HasTag(tags.TagList, key, value) {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+// TagValues returns the value each user is tagged with under key, keyed by
+// user ID. Users without the tag are left out. Each user's tags are read with
+// ListTagsForResource.
+func TagValues(ctx context.Context, client awsclient.ElastiCache, users []User, key string) (map[string]string, error) {
+	out := make(map[string]string, len(users))
+	for _, u := range users {
+		if u.ARN == "" {
+			continue
+		}
+		tags, err := client.ListTagsForResource(ctx, &elasticache.ListTagsForResourceInput{ResourceName: aws.String(u.ARN)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags for user %q: %w", u.ID, err)
+		}
+		for _, t := range tags.TagList {
+			if aws.ToString(t.Key) == key {
+				out[u.ID] = aws.ToString(t.Value)
+				break
+			}
+		}
+	}
+	return out, nil
+}
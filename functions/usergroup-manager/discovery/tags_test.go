@@ -0,0 +1,49 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+)
+
+func TestHasTag(t *testing.T) {
+	tags := []types.Tag{
+		{Key: aws.String("team"), Value: aws.String("cache")},
+		{Key: aws.String("cache-id"), Value: aws.String("orders")},
+	}
+
+	cases := map[string]struct {
+		reason string
+		key    string
+		value  string
+		want   bool
+	}{
+		"Match": {
+			reason: "A tag with the key and value should match.",
+			key:    "cache-id",
+			value:  "orders",
+			want:   true,
+		},
+		"WrongValue": {
+			reason: "A tag with the key but another value should not match.",
+			key:    "cache-id",
+			value:  "payments",
+			want:   false,
+		},
+		"MissingKey": {
+			reason: "A missing tag should not match.",
+			key:    "owner",
+			value:  "orders",
+			want:   false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := HasTag(tags, tc.key, tc.value); got != tc.want {
+				t.Errorf("%s\nHasTag(...): want %t, got %t", tc.reason, tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// describeUserGroupsPageSize is the largest page DescribeUserGroups will
+// return.
+const describeUserGroupsPageSize = 100
+
+// UserGroupMembers derives the users of the supplied engine, or of any engine
+// if it's empty, from the membership of every user group, for roles that may
+// describe user groups but not users. Only what user groups reveal is known:
+// each user's ID, its engine, which is that of its user groups, and its ARN,
+// which is derived from theirs. Users that aren't in any user group aren't
+// found this way.
+func UserGroupMembers(ctx context.Context, client awsclient.ElastiCache, engine string) ([]User, error) {
+	var users []User
+	seen := map[string]bool{}
+	p := elasticache.NewDescribeUserGroupsPaginator(client, &elasticache.DescribeUserGroupsInput{
+		MaxRecords: aws.Int32(describeUserGroupsPageSize),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe ElastiCache user groups: %w", err)
+		}
+		for _, ug := range page.UserGroups {
+			e := strings.ToLower(aws.ToString(ug.Engine))
+			if engine != "" && e != engine {
+				continue
+			}
+			for _, id := range ug.UserIds {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				users = append(users, User{ID: id, ARN: memberARN(aws.ToString(ug.ARN), id), Engine: e})
+			}
+		}
+	}
+	return users, nil
+}
+
+// memberARN returns the ARN of the supplied user, in the region and account
+// of the user group ARN, or an empty string if it isn't a valid ARN.
+func memberARN(userGroupARN, userID string) string {
+	a, err := arn.Parse(userGroupARN)
+	if err != nil {
+		return ""
+	}
+	return UserARN(a.Region, a.AccountID, userID)
+}
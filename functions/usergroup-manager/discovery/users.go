@@ -0,0 +1,149 @@
+// Package discovery lists the ElastiCache users of an account.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+)
+
+// DefaultUserID is the ID of the user ElastiCache creates in every account.
+const DefaultUserID = "default"
+
+// DefaultUserName is the user name ElastiCache requires a member of every
+// Redis OSS user group to have. The default user has it, but so can a user
+// with another ID that replaces it.
+const DefaultUserName = "default"
+
+// A User is the part of an ElastiCache user that user group filters and
+// enrichment use. Only this is kept, rather than the whole user, to bound
+// memory use in accounts with many users.
+type User struct {
+	ID                 string
+	ARN                string
+	Name               string
+	Engine             string
+	AuthenticationType string
+	// Status is e.g. active, modifying or deleting.
+	Status string
+}
+
+// NewUser returns the part of u that's kept.
+func NewUser(u types.User) User {
+	du := User{
+		ID:     aws.ToString(u.UserId),
+		ARN:    aws.ToString(u.ARN),
+		Name:   aws.ToString(u.UserName),
+		Engine: strings.ToLower(aws.ToString(u.Engine)),
+		Status: aws.ToString(u.Status),
+	}
+	if u.Authentication != nil {
+		du.AuthenticationType = string(u.Authentication.Type)
+	}
+	return du
+}
+
+// describeUsersPageSize is the largest page DescribeUsers will return.
+const describeUsersPageSize = 100
+
+// Users pages through DescribeUsers, calling visit for each user of the
+// supplied engine, or of any engine if it's empty. Each page is dropped once
+// visited, so memory use is bounded by what visit keeps rather than by the
+// number of users in the account.
+func Users(ctx context.Context, client elasticache.DescribeUsersAPIClient, engine string, visit func(u types.User)) error {
+	in := &elasticache.DescribeUsersInput{MaxRecords: aws.Int32(describeUsersPageSize)}
+	if engine != "" {
+		in.Engine = aws.String(engine)
+	}
+	p := elasticache.NewDescribeUsersPaginator(client, in)
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to describe ElastiCache users: %w", err)
+		}
+		for _, u := range page.Users {
+			visit(u)
+		}
+	}
+	return nil
+}
+
+// userIDFilterBatchSize bounds how many user IDs are sent in a single
+// DescribeUsers user-id filter.
+const userIDFilterBatchSize = 100
+
+// Describe describes only the supplied user IDs using the user-id filter,
+// which is much cheaper than listing every user in a large account. Users that
+// don't exist are left out.
+func Describe(ctx context.Context, client elasticache.DescribeUsersAPIClient, ids []string) ([]types.User, error) {
+	var users []types.User
+	for start := 0; start < len(ids); start += userIDFilterBatchSize {
+		batch := ids[start:min(start+userIDFilterBatchSize, len(ids))]
+		p := elasticache.NewDescribeUsersPaginator(client, &elasticache.DescribeUsersInput{
+			Filters:    []types.Filter{{Name: aws.String("user-id"), Values: batch}},
+			MaxRecords: aws.Int32(describeUsersPageSize),
+		})
+		for p.HasMorePages() {
+			page, err := p.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, page.Users...)
+		}
+	}
+	return users, nil
+}
+
+// Verify describes only the supplied user IDs. It returns the users that
+// still exist and aren't being deleted, and the IDs of those that don't.
+// Users created since the last full listing are not found this way.
+func Verify(ctx context.Context, client elasticache.DescribeUsersAPIClient, ids []string) (present []User, gone []string, err error) {
+	users, err := Describe(ctx, client, ids)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to verify ElastiCache users: %w", err)
+	}
+	found := make(map[string]User, len(users))
+	for _, u := range users {
+		if aws.ToString(u.Status) != "deleting" {
+			found[aws.ToString(u.UserId)] = NewUser(u)
+		}
+	}
+
+	for _, id := range ids {
+		if u, ok := found[id]; ok {
+			present = append(present, u)
+			continue
+		}
+		gone = append(gone, id)
+	}
+	return present, gone, nil
+}
+
+// SortByID sorts users by ID. DescribeUsers doesn't return users in a stable
+// order, so anything written from them would otherwise change with every
+// discovery.
+func SortByID(users []User) {
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+}
+
+// FilterByEngine returns the users of the supplied engine, or every user if
+// it's empty, so users of another engine aren't added to user groups that
+// can't contain them. Users whose engine isn't known, such as those kept from
+// a previous discovery, are kept.
+func FilterByEngine(users []User, engine string) []User {
+	if engine == "" {
+		return users
+	}
+	out := make([]User, 0, len(users))
+	for _, u := range users {
+		if u.Engine == "" || u.Engine == engine {
+			out = append(out, u)
+		}
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package discovery
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilterByEngine(t *testing.T) {
+	users := []User{
+		{ID: "app1-redis", Engine: "redis"},
+		{ID: "app1-valkey", Engine: "valkey"},
+		{ID: "app1-stale"},
+	}
+
+	cases := map[string]struct {
+		reason string
+		engine string
+		want   []User
+	}{
+		"Empty": {
+			reason: "An empty engine should keep every user.",
+			want:   users,
+		},
+		"Redis": {
+			reason: "Users of another engine should be dropped, but users whose engine isn't known should be kept.",
+			engine: "redis",
+			want:   []User{users[0], users[2]},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, FilterByEngine(users, tc.engine)); diff != "" {
+				t.Errorf("%s\nFilterByEngine(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSortByID(t *testing.T) {
+	users := []User{{ID: "app2"}, {ID: "default"}, {ID: "app1"}}
+	SortByID(users)
+	want := []User{{ID: "app1"}, {ID: "app2"}, {ID: "default"}}
+	if diff := cmp.Diff(want, users); diff != "" {
+		t.Errorf("SortByID(...): -want, +got:\n%s", diff)
+	}
+}
+
+// benchmarkUsers returns n users of alternating engines, named like
+// app00042, a tenth of them in another region.
+func benchmarkUsers(n int) []User {
+	users := make([]User, n)
+	for i := range users {
+		id := fmt.Sprintf("app%05d", i)
+		region, engine := "us-east-1", "redis"
+		if i%10 == 0 {
+			region = "eu-west-1"
+		}
+		if i%2 == 0 {
+			engine = "valkey"
+		}
+		users[i] = User{ID: id, Name: id, Engine: engine, ARN: "arn:aws:elasticache:" + region + ":123456789012:user:" + id}
+	}
+	return users
+}
+
+func BenchmarkFilterByEngine(b *testing.B) {
+	users := benchmarkUsers(10000)
+	b.ResetTimer()
+	for range b.N {
+		FilterByEngine(users, "redis")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUseTargetedSync(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	targeted := verificationParameters{Mode: syncModeTargeted, FullResyncInterval: time.Hour}
+
+	type args struct {
+		p        verificationParameters
+		lastFull time.Time
+		previous []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   bool
+	}{
+		"FullMode": {
+			reason: "Users should always be listed in full mode.",
+			args:   args{p: verificationParameters{Mode: syncModeFull, FullResyncInterval: time.Hour}, lastFull: now.Add(-time.Minute), previous: []string{"app1"}},
+			want:   false,
+		},
+		"NeverListed": {
+			reason: "Users should be listed if they never were.",
+			args:   args{p: targeted, previous: []string{"app1"}},
+			want:   false,
+		},
+		"NothingToVerify": {
+			reason: "Users should be listed if none were discovered last time.",
+			args:   args{p: targeted, lastFull: now.Add(-time.Minute)},
+			want:   false,
+		},
+		"Stale": {
+			reason: "Users should be listed once the full resync interval has passed.",
+			args:   args{p: targeted, lastFull: now.Add(-time.Hour), previous: []string{"app1"}},
+			want:   false,
+		},
+		"Recent": {
+			reason: "Previously discovered users should be verified within the full resync interval.",
+			args:   args{p: targeted, lastFull: now.Add(-time.Minute), previous: []string{"app1"}},
+			want:   true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := useTargetedSync(tc.args.p, tc.args.lastFull, tc.args.previous, now)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nuseTargetedSync(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
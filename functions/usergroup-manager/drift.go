@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+)
+
+// membershipDrift returns the diff of every observed composed UserGroup whose
+// membership differs from the desired membership, keyed by composition
+// resource name. User groups that aren't observed yet have no drift.
+func membershipDrift(observed map[resource.Name]resource.ObservedComposed, desired map[string][]string) []membership.Diff {
+	names := make([]string, 0, len(desired))
+	for n := range desired {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var out []membership.Diff
+	for _, n := range names {
+		oc, ok := observed[resource.Name(n)]
+		if !ok || oc.Resource == nil {
+			continue
+		}
+		current, err := oc.Resource.GetStringArray("status.atProvider.userIds")
+		if err != nil {
+			continue
+		}
+		if d := membership.NewDiff(n, current, desired[n]); !d.Empty() {
+			out = append(out, d)
+		}
+	}
+	return out
+}
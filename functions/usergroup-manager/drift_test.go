@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+)
+
+func TestMembershipDrift(t *testing.T) {
+	userGroup := func(ids ...any) resource.ObservedComposed {
+		cd := composed.New()
+		cd.Object["status"] = map[string]any{"atProvider": map[string]any{"userIds": ids}}
+		return resource.ObservedComposed{Resource: cd}
+	}
+	observed := map[resource.Name]resource.ObservedComposed{
+		"user-group-app": userGroup("default", "app1"),
+		"user-group-ops": userGroup("default", "ops1"),
+	}
+	desired := map[string][]string{
+		"user-group-app": {"default", "app2"},
+		"user-group-ops": {"ops1", "default"},
+		"user-group-new": {"default"},
+	}
+
+	want := []membership.Diff{{Resource: "user-group-app", Added: []string{"app2"}, Removed: []string{"app1"}}}
+	got := membershipDrift(observed, desired)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("membershipDrift(...): -want, +got:\n%s", diff)
+	}
+}
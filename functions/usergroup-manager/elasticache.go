@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// elastiCacheClient returns a client that calls ElastiCache in region with
+// cfg's credentials, or the function's client if it has one. endpointURL, if
+// set, takes precedence over the function's endpoint override. Endpoint
+// overrides are regional, so they only apply to cfg's region.
+func (f *Function) elastiCacheClient(cfg aws.Config, region, endpointURL string) awsclient.ElastiCache {
+	if f.elastiCache != nil {
+		return f.elastiCache
+	}
+	return elasticache.NewFromConfig(cfg, func(o *elasticache.Options) {
+		o.Region = region
+		if region != cfg.Region {
+			return
+		}
+		o.BaseEndpoint = f.endpoint("elasticache")
+		if endpointURL != "" {
+			o.BaseEndpoint = aws.String(endpointURL)
+		}
+	})
+}
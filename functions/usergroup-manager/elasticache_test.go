@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// fakeElastiCache is an in-memory ElastiCache account. Calling an API it
+// doesn't fake panics, which fails the test. Modified user groups report
+// their new members right away.
+type fakeElastiCache struct {
+	awsclient.ElastiCache
+
+	users            []types.User
+	userGroups       []types.UserGroup
+	serverlessCaches []types.ServerlessCache
+	tags             map[string][]types.Tag
+	err              error
+	// usersErr is only returned by DescribeUsers.
+	usersErr error
+
+	// modified records every ModifyUserGroup call, tagged every
+	// AddTagsToResource call, untagged every RemoveTagsFromResource call,
+	// created every CreateUser call and listedTags the resource of every
+	// ListTagsForResource call. Tags added and removed apply to tags.
+	modified   []*elasticache.ModifyUserGroupInput
+	tagged     []*elasticache.AddTagsToResourceInput
+	untagged   []*elasticache.RemoveTagsFromResourceInput
+	created    []*elasticache.CreateUserInput
+	listedTags []string
+}
+
+func (c *fakeElastiCache) DescribeUsers(_ context.Context, in *elasticache.DescribeUsersInput, _ ...func(*elasticache.Options)) (*elasticache.DescribeUsersOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.usersErr != nil {
+		return nil, c.usersErr
+	}
+	out := &elasticache.DescribeUsersOutput{}
+	for _, u := range c.users {
+		if in.UserId != nil && aws.ToString(in.UserId) != aws.ToString(u.UserId) {
+			continue
+		}
+		if len(in.Filters) > 0 && !slices.Contains(in.Filters[0].Values, aws.ToString(u.UserId)) {
+			continue
+		}
+		out.Users = append(out.Users, u)
+	}
+	return out, nil
+}
+
+func (c *fakeElastiCache) DescribeUserGroups(_ context.Context, in *elasticache.DescribeUserGroupsInput, _ ...func(*elasticache.Options)) (*elasticache.DescribeUserGroupsOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	out := &elasticache.DescribeUserGroupsOutput{}
+	for _, ug := range c.userGroups {
+		if in.UserGroupId != nil && aws.ToString(in.UserGroupId) != aws.ToString(ug.UserGroupId) {
+			continue
+		}
+		out.UserGroups = append(out.UserGroups, ug)
+	}
+	if in.UserGroupId != nil && len(out.UserGroups) == 0 {
+		return nil, &types.UserGroupNotFoundFault{Message: aws.String("user group not found")}
+	}
+	return out, nil
+}
+
+func (c *fakeElastiCache) ModifyUserGroup(_ context.Context, in *elasticache.ModifyUserGroupInput, _ ...func(*elasticache.Options)) (*elasticache.ModifyUserGroupOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.modified = append(c.modified, in)
+	for i, ug := range c.userGroups {
+		if aws.ToString(ug.UserGroupId) != aws.ToString(in.UserGroupId) {
+			continue
+		}
+		ids := slices.DeleteFunc(slices.Clone(ug.UserIds), func(id string) bool { return slices.Contains(in.UserIdsToRemove, id) })
+		c.userGroups[i].UserIds = append(ids, in.UserIdsToAdd...)
+	}
+	return &elasticache.ModifyUserGroupOutput{UserGroupId: in.UserGroupId, Status: aws.String("modifying")}, nil
+}
+
+func (c *fakeElastiCache) CreateUser(_ context.Context, in *elasticache.CreateUserInput, _ ...func(*elasticache.Options)) (*elasticache.CreateUserOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.created = append(c.created, in)
+	return &elasticache.CreateUserOutput{UserId: in.UserId, Status: aws.String("creating")}, nil
+}
+
+func (c *fakeElastiCache) AddTagsToResource(_ context.Context, in *elasticache.AddTagsToResourceInput, _ ...func(*elasticache.Options)) (*elasticache.AddTagsToResourceOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.tagged = append(c.tagged, in)
+	if c.tags == nil {
+		c.tags = map[string][]types.Tag{}
+	}
+	arn := aws.ToString(in.ResourceName)
+	for _, t := range in.Tags {
+		c.tags[arn] = slices.DeleteFunc(c.tags[arn], func(e types.Tag) bool { return aws.ToString(e.Key) == aws.ToString(t.Key) })
+		c.tags[arn] = append(c.tags[arn], t)
+	}
+	return &elasticache.AddTagsToResourceOutput{TagList: c.tags[arn]}, nil
+}
+
+func (c *fakeElastiCache) RemoveTagsFromResource(_ context.Context, in *elasticache.RemoveTagsFromResourceInput, _ ...func(*elasticache.Options)) (*elasticache.RemoveTagsFromResourceOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.untagged = append(c.untagged, in)
+	arn := aws.ToString(in.ResourceName)
+	c.tags[arn] = slices.DeleteFunc(c.tags[arn], func(t types.Tag) bool { return slices.Contains(in.TagKeys, aws.ToString(t.Key)) })
+	return &elasticache.RemoveTagsFromResourceOutput{TagList: c.tags[arn]}, nil
+}
+
+func (c *fakeElastiCache) DescribeServerlessCaches(_ context.Context, _ *elasticache.DescribeServerlessCachesInput, _ ...func(*elasticache.Options)) (*elasticache.DescribeServerlessCachesOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &elasticache.DescribeServerlessCachesOutput{ServerlessCaches: c.serverlessCaches}, nil
+}
+
+func (c *fakeElastiCache) ListTagsForResource(_ context.Context, in *elasticache.ListTagsForResourceInput, _ ...func(*elasticache.Options)) (*elasticache.ListTagsForResourceOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.listedTags = append(c.listedTags, aws.ToString(in.ResourceName))
+	return &elasticache.ListTagsForResourceOutput{TagList: c.tags[aws.ToString(in.ResourceName)]}, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// endpointServices are the AWS services whose endpoint URL can be overridden,
+// e.g. to reach them through VPC interface endpoints with private DNS
+// disabled.
+var endpointServices = []string{"elasticache", "iam", "kms", "resourcegroupstaggingapi", "secretsmanager", "sts"}
+
+// validateEndpoints returns an error if endpoints names a service that can't
+// be overridden, or a URL that isn't absolute.
+func validateEndpoints(endpoints map[string]string) error {
+	services := make([]string, 0, len(endpoints))
+	for s := range endpoints {
+		services = append(services, s)
+	}
+	sort.Strings(services)
+
+	for _, s := range services {
+		if !slices.Contains(endpointServices, s) {
+			return fmt.Errorf("cannot override endpoint of unknown service %q: must be one of %s", s, strings.Join(endpointServices, ", "))
+		}
+		if !absoluteURL(endpoints[s]) {
+			return fmt.Errorf("endpoint of service %q must be an absolute URL such as https://vpce-123.elasticache.us-east-1.vpce.amazonaws.com, got %q", s, endpoints[s])
+		}
+	}
+	return nil
+}
+
+// absoluteURL returns true if s is an absolute URL, i.e. has a scheme and a
+// host.
+func absoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// endpoint returns the overridden endpoint URL of service, or nil to use the
+// SDK's default endpoint resolution.
+func (f *Function) endpoint(service string) *string {
+	if u, ok := f.endpoints[service]; ok {
+		return aws.String(u)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateEndpoints(t *testing.T) {
+	cases := map[string]struct {
+		reason    string
+		endpoints map[string]string
+		want      string
+	}{
+		"None": {
+			reason: "No overrides should be valid.",
+		},
+		"Valid": {
+			reason: "Absolute URLs of known services should be valid.",
+			endpoints: map[string]string{
+				"elasticache": "https://vpce-123.elasticache.us-east-1.vpce.amazonaws.com",
+				"sts":         "https://sts.us-east-1.amazonaws.com",
+			},
+		},
+		"UnknownService": {
+			reason:    "Services the function doesn't know should be rejected.",
+			endpoints: map[string]string{"s3": "https://s3.amazonaws.com"},
+			want:      `cannot override endpoint of unknown service "s3": must be one of elasticache, iam, kms, resourcegroupstaggingapi, secretsmanager, sts`,
+		},
+		"RelativeURL": {
+			reason:    "URLs without a scheme and host should be rejected.",
+			endpoints: map[string]string{"elasticache": "vpce-123.elasticache.us-east-1.vpce.amazonaws.com"},
+			want:      `endpoint of service "elasticache" must be an absolute URL such as https://vpce-123.elasticache.us-east-1.vpce.amazonaws.com, got "vpce-123.elasticache.us-east-1.vpce.amazonaws.com"`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := ""
+			if err := validateEndpoints(tc.endpoints); err != nil {
+				got = err.Error()
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nvalidateEndpoints(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"google.golang.org/protobuf/types/known/structpb"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+)
+
+// environmentKey is the well-known context key holding the composition
+// environment. Environment patches and most functions read from it.
+const environmentKey = "apiextensions.crossplane.io/environment"
+
+// mergeIntoEnvironment returns the request's composition environment with
+// value set at key. Everything else already in the environment is preserved.
+// A new environment is created if the request has none.
+func mergeIntoEnvironment(req *fnv1.RunFunctionRequest, key string, value *structpb.Value) *structpb.Value {
+	env := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"apiVersion": structpb.NewStringValue("internal.crossplane.io/v1alpha1"),
+		"kind":       structpb.NewStringValue("Environment"),
+	}}
+	if v, ok := request.GetContextKey(req, environmentKey); ok && v.GetStructValue() != nil {
+		env = v.GetStructValue()
+	}
+
+	merged := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(env.GetFields())+1)}
+	for k, v := range env.GetFields() {
+		merged.Fields[k] = v
+	}
+	merged.Fields[key] = value
+	return structpb.NewStructValue(merged)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestMergeIntoEnvironment(t *testing.T) {
+	type args struct {
+		req   *fnv1.RunFunctionRequest
+		key   string
+		value *structpb.Value
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   *structpb.Value
+	}{
+		"NoEnvironment": {
+			reason: "A new environment should be created if the request has none.",
+			args: args{
+				req:   &fnv1.RunFunctionRequest{},
+				key:   "usergroupManager",
+				value: structpb.NewNumberValue(2),
+			},
+			want: structpb.NewStructValue(resource.MustStructJSON(`{
+				"apiVersion": "internal.crossplane.io/v1alpha1",
+				"kind": "Environment",
+				"usergroupManager": 2
+			}`)),
+		},
+		"ExistingEnvironment": {
+			reason: "Existing environment data should be preserved.",
+			args: args{
+				req: &fnv1.RunFunctionRequest{
+					Context: resource.MustStructJSON(`{
+						"apiextensions.crossplane.io/environment": {
+							"apiVersion": "internal.crossplane.io/v1alpha1",
+							"kind": "Environment",
+							"team": "payments",
+							"usergroupManager": 1
+						}
+					}`),
+				},
+				key:   "usergroupManager",
+				value: structpb.NewNumberValue(2),
+			},
+			want: structpb.NewStructValue(resource.MustStructJSON(`{
+				"apiVersion": "internal.crossplane.io/v1alpha1",
+				"kind": "Environment",
+				"team": "payments",
+				"usergroupManager": 2
+			}`)),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := mergeIntoEnvironment(tc.args.req, tc.args.key, tc.args.value)
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nmergeIntoEnvironment(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
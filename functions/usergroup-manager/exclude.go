@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// excludeLabel opts the ElastiCache user managed by a User MR out of every
+// user group, so a team can pull its user from a shared group without editing
+// the XR.
+const excludeLabel = "elasticache-users.fn/exclude"
+
+// excludedUsersKey is the required resources key of the excluded User MRs.
+const excludedUsersKey = "excludedUsers"
+
+// User MRs are namespaced ElastiCache Users managed by provider-aws.
+const (
+	userMRAPIVersion = "elasticache.aws.m.upbound.io/v1beta1"
+	userMRKind       = "User"
+)
+
+// externalNameAnnotation holds the external name, i.e. user ID, of an MR.
+const externalNameAnnotation = "crossplane.io/external-name"
+
+// excludedUsersSelector selects the User MRs, in any namespace, that opted
+// out of user groups.
+func excludedUsersSelector() *fnv1.ResourceSelector {
+	return &fnv1.ResourceSelector{
+		ApiVersion: userMRAPIVersion,
+		Kind:       userMRKind,
+		Match: &fnv1.ResourceSelector_MatchLabels{MatchLabels: &fnv1.MatchLabels{
+			Labels: map[string]string{excludeLabel: "true"},
+		}},
+	}
+}
+
+// excludedUserIDs returns the user IDs of the supplied User MRs, sorted. The
+// user ID is the MR's external name, which defaults to its name.
+func excludedUserIDs(rs []resource.Required) []string {
+	ids := make([]string, 0, len(rs))
+	for _, r := range rs {
+		if r.Resource == nil {
+			continue
+		}
+		id := r.Resource.GetAnnotations()[externalNameAnnotation]
+		if id == "" {
+			id = r.Resource.GetName()
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// excludeUsers returns the users whose IDs aren't in ids, and the IDs of
+// those that were excluded.
+func excludeUsers(users []discovery.User, ids []string) (kept []discovery.User, excluded []string) {
+	exclude := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		exclude[id] = true
+	}
+	kept = make([]discovery.User, 0, len(users))
+	for _, u := range users {
+		if exclude[u.ID] {
+			excluded = append(excluded, u.ID)
+			continue
+		}
+		kept = append(kept, u)
+	}
+	return kept, excluded
+}
+
+// hasDefaultUserName returns true if one of users is named default.
+func hasDefaultUserName(users []discovery.User) bool {
+	for _, u := range users {
+		if u.Name == discovery.DefaultUserName {
+			return true
+		}
+	}
+	return false
+}
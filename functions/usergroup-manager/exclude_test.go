@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestExcludeUsers(t *testing.T) {
+	mr := func(name, externalName string) resource.Required {
+		u := &unstructured.Unstructured{}
+		u.SetName(name)
+		if externalName != "" {
+			u.SetAnnotations(map[string]string{externalNameAnnotation: externalName})
+		}
+		return resource.Required{Resource: u}
+	}
+	users := []discovery.User{{ID: "default"}, {ID: "app1"}, {ID: "app2"}, {ID: "app3"}}
+
+	type want struct {
+		kept     []discovery.User
+		excluded []string
+	}
+
+	cases := map[string]struct {
+		reason string
+		mrs    []resource.Required
+		want   want
+	}{
+		"None": {
+			reason: "All users should be kept when no User MR opted out.",
+			want:   want{kept: users},
+		},
+		"ExternalName": {
+			reason: "Users should be excluded by their MR's external name, or its name if it has none.",
+			mrs:    []resource.Required{mr("app3", ""), mr("team-a-user", "app1"), mr("gone", "")},
+			want: want{
+				kept:     []discovery.User{{ID: "default"}, {ID: "app2"}},
+				excluded: []string{"app1", "app3"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			kept, excluded := excludeUsers(users, excludedUserIDs(tc.mrs))
+			if diff := cmp.Diff(tc.want, want{kept: kept, excluded: excluded}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nexcludeUsers(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+// Feature flags gate large subsystems so they can ship dark and be enabled per
+// composition with spec.parameters.features. Every flag defaults to false.
+const (
+	featureTagFiltering  = "tagFiltering"
+	featureApplyMode     = "applyMode"
+	featureRotation      = "rotation"
+	featureNotifications = "notifications"
+	featureGC            = "gc"
+)
+
+// knownFeatures are the feature flags this version of the function
+// understands, in the order they're documented.
+var knownFeatures = []string{
+	featureTagFiltering,
+	featureApplyMode,
+	featureRotation,
+	featureNotifications,
+	featureGC,
+}
+
+// featureFlags are the features enabled for an XR.
+type featureFlags map[string]bool
+
+// Enabled returns true if the named feature is enabled.
+func (f featureFlags) Enabled(name string) bool {
+	return f[name]
+}
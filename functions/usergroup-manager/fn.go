@@ -3,16 +3,15 @@ package main
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/elasticache"
 	"github.com/crossplane/function-sdk-go/logging"
 	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
-	"github.com/crossplane/function-sdk-go/request"
 	"github.com/crossplane/function-sdk-go/response"
-	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
 )
 
 // Function is your composition function.
@@ -20,94 +19,157 @@ type Function struct {
 	fnv1.UnimplementedFunctionRunnerServiceServer
 
 	log logging.Logger
+
+	// defaultCredentials enables the AWS SDK's default credential chain for
+	// requests without composition credentials.
+	defaultCredentials bool
+
+	// telemetrySampleRate is the fraction of runs whose AWS API calls are
+	// counted in metrics.
+	telemetrySampleRate float64
+
+	// endpoints overrides the endpoint URL of AWS services, keyed by service.
+	endpoints map[string]string
+
+	// kms decrypts KMS-encrypted composition credentials. A client using the
+	// function's ambient identity is created if it's nil.
+	kms kmsDecryptAPI
+
+	// elastiCache is used instead of a client created from each request's
+	// credentials if it isn't nil, e.g. in tests.
+	elastiCache awsclient.ElastiCache
+
+	// sts is used instead of a client created from each request's
+	// credentials if it isn't nil, e.g. in tests.
+	sts awsclient.STS
+
+	// organizations is used instead of a client created from each
+	// request's credentials if it isn't nil, e.g. in tests.
+	organizations organizationsAPI
+
+	// replays holds recent responses to requests that may modify AWS
+	// resources. Duplicate deliveries aren't detected if it's nil.
+	replays *replayCache
+
+	// scheduler keeps the full discoveries of every XR within a budget.
+	// Every full discovery runs if it's nil. XRs whose users were last fully
+	// discovered more than maxStaleness ago are given priority.
+	scheduler    *discoveryScheduler
+	maxStaleness time.Duration
+
+	// verifier checks AWS reports the membership changes the function made
+	// to a user group. A default verifier is used if it's nil.
+	verifier *membership.Verifier
 }
 
 // RunFunction discovers ElastiCache Users with cache-id label and manages UserGroup membership.
-func (f *Function) RunFunction(ctx context.Context, req *fnv1.RunFunctionRequest) (*fnv1.RunFunctionResponse, error) {
-	f.log.Info("Running usergroup-manager function", "tag", req.GetMeta().GetTag())
-
-	rsp := response.To(req, response.DefaultTTL)
+//
+// A panic while handling the request is converted into a Fatal result rather
+// than crashing the pod, which is shared by every composition using this
+// function.
+//
+// Crossplane may deliver a request again after it times out. If the function
+// modified AWS resources for it, a duplicate delivery is answered with the
+// first response rather than applying the changes twice. A response that was
+// waiting, e.g. for AWS to settle, isn't replayed, so the retry it asked for
+// runs.
+func (f *Function) RunFunction(ctx context.Context, req *fnv1.RunFunctionRequest) (rsp *fnv1.RunFunctionResponse, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f.log.Info("Recovered from panic", "tag", req.GetMeta().GetTag(), "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			rsp = response.To(req, response.DefaultTTL)
+			response.Fatal(rsp, fmt.Errorf("usergroup-manager panicked: %v", r))
+			err = nil
+		}
+	}()
 
-	// Get the observed composite resource (XCacheInfra)
-	oxr, err := request.GetObservedCompositeResource(req)
-	if err != nil {
-		response.Fatal(rsp, err)
-		return rsp, nil
+	key, mutates := newReplayKey(req)
+	if mutates {
+		if cached, ok := f.replays.Get(key); ok {
+			f.log.Info("Replaying response to duplicate request", "tag", key.Tag)
+			return cached, nil
+		}
 	}
-
-	// Extract region from XR parameters
-	region, err := oxr.Resource.GetString("spec.parameters.region")
-	if err != nil {
-		f.log.Info("Region not specified, using default", "default", "us-east-1")
-		region = "us-east-1"
+	rsp, replayable := f.runFunction(ctx, req)
+	if mutates && replayable {
+		f.replays.Put(key, rsp)
 	}
+	return rsp, nil
+}
 
-	// Get AWS credentials from the request
-	creds, err := request.GetCredentials(req, "aws")
-	if err != nil {
-		response.Fatal(rsp, fmt.Errorf("failed to get AWS credentials: %w", err))
-		return rsp, nil
+// runFunction returns the response to the request, and whether it may be
+// replayed to duplicate deliveries of it.
+func (f *Function) runFunction(ctx context.Context, req *fnv1.RunFunctionRequest) (*fnv1.RunFunctionResponse, bool) {
+	f.log.Info("Running usergroup-manager function", "tag", req.GetMeta().GetTag())
+	r := &run{f: f, ctx: ctx, req: req, rsp: response.To(req, response.DefaultTTL), started: time.Now()}
+	if !r.setup() {
+		return r.rsp, false
 	}
 
-	// Initialize AWS SDK config
-	cfg, err := awsconfig.LoadDefaultConfig(ctx,
-		awsconfig.WithRegion(region),
-		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-			string(creds.Data["aws_access_key_id"]),
-			string(creds.Data["aws_secret_access_key"]),
-			string(creds.Data["aws_session_token"]),
-		)),
-	)
-	if err != nil {
-		response.Fatal(rsp, fmt.Errorf("failed to load AWS config: %w", err))
-		return rsp, nil
+	// Stop reconciling while the XR is being deleted, rather than adding
+	// users that keep its user groups from being deleted
+	if r.oxr.Resource.GetDeletionTimestamp() != nil {
+		mark := r.calls.Mark()
+		rsp := f.teardown(ctx, r.rsp, r.client, r.params, r.names, r.diagnose)
+		r.calls.Summarize("Teardown", mark)
+		return rsp, false
 	}
 
-	// Create ElastiCache client
-	client := elasticache.NewFromConfig(cfg)
+	r.all(
+		r.readObserved,
+		r.timed("Discovery", &r.durations.Discovery, r.discoverUsers),
+		r.timed("Filtering", &r.durations.Filtering, r.addSharedPoolUsers, r.filterUsers),
+		r.timed("Policy", &r.durations.Policy,
+			r.publishUsers, r.discoverRegions,
+			r.assignUserGroups, r.declareUsers, r.ensureDefaultUsers, r.reportAdoption,
+			r.discoverServerlessCaches, r.resolveIAMPrincipals, r.describeUserDetails, r.checkRBACSupport,
+			r.buildDesiredState, r.detectMembershipDrift,
+			r.describeMigration, r.describeReplacement, r.describeReconcile, r.approvePlan, r.checkTagPolicy,
+		),
+		r.timed("Apply", &r.durations.Apply, r.applyMigration, r.applyReplacement, r.applyReconcile),
+		r.requeue,
+		r.summarized("Output",
+			r.compose, r.export, r.publishOutput, r.reportCostAllocation,
+			r.writeStatus, r.reportDiscovery, r.reportRun,
+		),
+	)
+	return r.rsp, r.replayable()
+}
 
-	// Query all ElastiCache users
-	describeOutput, err := client.DescribeUsers(ctx, &elasticache.DescribeUsersInput{})
-	if err != nil {
-		response.Fatal(rsp, fmt.Errorf("failed to describe ElastiCache users: %w", err))
-		return rsp, nil
+// membershipVerifier returns the verifier of membership changes.
+func (f *Function) membershipVerifier() *membership.Verifier {
+	if f.verifier != nil {
+		return f.verifier
 	}
+	return membership.NewVerifier(sleep)
+}
 
-	// Filter users by cache-id tag (Note: ElastiCache Users don't support tags in the same way as other resources)
-	// Instead, we'll filter by a naming convention or collect all users
-	// For now, collecting all users as ElastiCache doesn't support user-level tags
-	var userIDs []string
-	for _, user := range describeOutput.Users {
-		if user.UserId != nil {
-			userIDs = append(userIDs, *user.UserId)
-			f.log.Info("Discovered user", "userId", *user.UserId, "userName", aws.ToString(user.UserName))
-		}
+// awsCallFailed reports an AWS call that failed without stopping the
+// function on the supplied condition. Transient failures, e.g. throttling,
+// are retried on the next reconcile, so they're logged rather than emitted as
+// warning events.
+func (f *Function) awsCallFailed(rsp *fnv1.RunFunctionResponse, conditionType, reason string, err error) {
+	response.ConditionFalse(rsp, conditionType, failureReason(err, reason)).WithMessage(err.Error()).TargetCompositeAndClaim()
+	if awsclient.IsTransient(err) {
+		f.log.Info("AWS call failed, retrying on the next reconcile", "condition", conditionType, "error", err)
+		return
 	}
+	response.Warning(rsp, err).TargetCompositeAndClaim()
+}
 
-	f.log.Info("Total users discovered", "count", len(userIDs))
-
-	// Store user IDs in pipeline context for other functions to access
-	response.SetContextKey(rsp, "discoveredUserIDs", structpb.NewListValue(&structpb.ListValue{
-		Values: func() []*structpb.Value {
-			values := make([]*structpb.Value, len(userIDs))
-			for i, id := range userIDs {
-				values[i] = structpb.NewStringValue(id)
-			}
-			return values
-		}(),
-	}))
-
-	// Update XR status with discovered user count
-	oxr.Resource.Object["status"] = map[string]any{
-		"discoveredUsers": len(userIDs),
-		"userIDs":         userIDs,
-	}
-	if err := response.SetDesiredCompositeResource(rsp, oxr); err != nil {
-		f.log.Info("Failed to update XR status", "error", err)
+// failureReason returns the condition reason for a failure caused by err:
+// its kind, if it's known, or fallback.
+func failureReason(err error, fallback string) string {
+	switch awsclient.Kind(err) {
+	case awsclient.ErrThrottled:
+		return "Throttled"
+	case awsclient.ErrNotFound:
+		return "NotFound"
+	case awsclient.ErrConflict:
+		return "Conflict"
+	case awsclient.ErrValidation:
+		return "InvalidRequest"
+	default:
+		return fallback
 	}
-
-	response.ConditionTrue(rsp, "UserDiscoverySuccess", fmt.Sprintf("Discovered %d ElastiCache users", len(userIDs))).
-		TargetCompositeAndClaim()
-
-	return rsp, nil
 }
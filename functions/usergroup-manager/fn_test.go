@@ -3,13 +3,24 @@ package main
 import (
 	"context"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/aws/smithy-go"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/crossplane/function-sdk-go/logging"
 	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
 )
 
 func TestRunFunction(t *testing.T) {
@@ -43,3 +54,789 @@ func TestRunFunction(t *testing.T) {
 		})
 	}
 }
+
+func TestRunFunctionWithFakeElastiCache(t *testing.T) {
+	req := func(parameters, status string) *fnv1.RunFunctionRequest {
+		return &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "hello"},
+			Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+				"apiVersion": "customer.upbound.io/v1alpha1",
+				"kind": "XCacheInfra",
+				"metadata": {"name": "prod", "namespace": "default", "uid": "1234"},
+				"spec": {"parameters": ` + parameters + `},
+				"status": ` + status + `
+			}`)}},
+			Credentials: map[string]*fnv1.Credentials{
+				awsCredentialsName: {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+					Data: map[string][]byte{"aws_access_key_id": []byte("AKIA"), "aws_secret_access_key": []byte("secret")},
+				}}},
+			},
+		}
+	}
+	user := func(id string) types.User {
+		return types.User{UserId: aws.String(id), UserName: aws.String(id), Engine: aws.String(engineRedis), Status: aws.String("active")}
+	}
+	// offDefault replaces the default user in user groups
+	offDefault := user("off-default")
+	offDefault.UserName = aws.String("default")
+	tagged := func(id string) types.User {
+		u := user(id)
+		u.ARN = aws.String("arn:" + id)
+		return u
+	}
+	modifying := user("app1")
+	modifying.Status = aws.String("modifying")
+	foreign := user("foreign")
+	foreign.ARN = aws.String("arn:aws:elasticache:us-east-1:210987654321:user:foreign")
+	remote := user("remote")
+	remote.ARN = aws.String("arn:aws:elasticache:eu-west-1:123456789012:user:remote")
+	// deleting marks the request's XR as being deleted
+	deleting := func(r *fnv1.RunFunctionRequest) *fnv1.RunFunctionRequest {
+		r.Observed.Composite.Resource.Fields["metadata"].GetStructValue().Fields["deletionTimestamp"] = structpb.NewStringValue("2026-01-01T00:00:00Z")
+		return r
+	}
+
+	type want struct {
+		userIDs    []any
+		userGroups map[string][]any
+		conditions map[string]string
+		modified   []*elasticache.ModifyUserGroupInput
+		tagged     []*elasticache.AddTagsToResourceInput
+		warnings   int
+
+		// plannedChanges is the plannedChanges context key.
+		plannedChanges map[string]any
+
+		// bypassed are the users status.userGroupManager.securityRemovalBypass
+		// records.
+		bypassed []any
+	}
+
+	cases := map[string]struct {
+		reason string
+		client *fakeElastiCache
+		req    *fnv1.RunFunctionRequest
+
+		// organizations is the tag policy the account is subject to, if any.
+		organizations *fakeOrganizations
+		want          want
+	}{
+		"Discover": {
+			reason: "Every user in the account but the default user should be discovered and published to the pipeline context.",
+			client: &fakeElastiCache{users: []types.User{user("app1"), user("app2"), user(discovery.DefaultUserID), offDefault}},
+			req:    req(`{"region": "us-east-1"}`, `{}`),
+			want: want{
+				userIDs: []any{"app1", "app2", "off-default"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"UserDiscoverySuccess": "Discovered 3 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+				},
+			},
+		},
+		"DefaultUserOnly": {
+			reason: "A warning should be emitted if the default user was excluded and no other user is named default, since ElastiCache requires one in Redis OSS user groups.",
+			client: &fakeElastiCache{users: []types.User{user("app1"), user(discovery.DefaultUserID)}},
+			req:    req(`{"region": "us-east-1"}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUserMissing",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+				},
+				warnings: 1,
+			},
+		},
+		"CrossRegion": {
+			reason: "Users whose ARN is in another region should be refused, since they can't be added to the region's user groups.",
+			client: &fakeElastiCache{users: []types.User{user("app1"), remote}},
+			req:    req(`{"region": "us-east-1"}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUserMissing",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "CrossRegionUsers",
+				},
+			},
+		},
+		"PerCache": {
+			reason: "Users should be grouped into a user group per cache they're tagged with.",
+			client: &fakeElastiCache{
+				users: []types.User{tagged("orders-app"), tagged("payments-app"), user("untagged"), offDefault},
+				tags: map[string][]types.Tag{
+					"arn:orders-app":   {{Key: aws.String(defaultCacheIDTagKey), Value: aws.String("orders")}},
+					"arn:payments-app": {{Key: aws.String(defaultCacheIDTagKey), Value: aws.String("payments")}},
+				},
+			},
+			req: req(`{"region": "us-east-1", "perCache": {"enabled": true}}`, `{}`),
+			want: want{
+				userIDs: []any{"off-default", "orders-app", "payments-app", "untagged"},
+				userGroups: map[string][]any{
+					"orders-users":   {"orders-app", "off-default"},
+					"payments-users": {"payments-app", "off-default"},
+				},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"UserDiscoverySuccess": "Discovered 4 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+				},
+			},
+		},
+		"CrossAccount": {
+			reason: "Users whose ARN is in another account than the credentials resolve to should be refused.",
+			client: &fakeElastiCache{users: []types.User{user("app1"), foreign}},
+			req:    req(`{"region": "us-east-1"}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUserMissing",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "CrossAccountUsers",
+					"UsersInRegion":        "UsersInRegion",
+				},
+			},
+		},
+		"Throttled": {
+			reason: "Failing to discover users because AWS throttled the function should set the condition's reason to the kind of error.",
+			client: &fakeElastiCache{err: &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"}},
+			req:    req(`{"region": "us-east-1", "retry": {"discoveryAttempts": 1}}`, `{}`),
+			want: want{
+				conditions: map[string]string{"UserDiscoverySuccess": "Throttled"},
+			},
+		},
+		"ThrottledWithPreviousUsers": {
+			reason: "The users discovered last time should be used, with a Warning rather than failing, if AWS throttled the function.",
+			client: &fakeElastiCache{err: &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"}},
+			req:    req(`{"region": "us-east-1", "retry": {"discoveryAttempts": 1}}`, `{"userGroupManager": {"userIDs": ["app1", "default"]}}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"UserDiscoverySuccess": "Throttled",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+				},
+				warnings: 1,
+			},
+		},
+		"DescribeUsersDenied": {
+			reason: "Users should be derived from user group membership, with a Warning, if the function isn't allowed to describe users.",
+			client: &fakeElastiCache{
+				usersErr: &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized to perform elasticache:DescribeUsers"},
+				userGroups: []types.UserGroup{
+					{UserGroupId: aws.String("app"), Engine: aws.String(engineRedis), ARN: aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"), UserIds: []string{"app1", "app2"}},
+					{UserGroupId: aws.String("other"), Engine: aws.String(engineRedis), ARN: aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:other"), UserIds: []string{"app2", "app3"}},
+				},
+			},
+			req: req(`{"region": "us-east-1"}`, `{}`),
+			want: want{
+				userIDs: []any{"app1", "app2", "app3"},
+				conditions: map[string]string{
+					"UserDiscoverySuccess": "Discovered 3 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+				},
+				warnings: 1,
+			},
+		},
+		"Direct": {
+			reason: "Direct mode should add discovered users to, and remove missing users from, the target user group, and tag it with the XR it belongs to.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					ARN:         aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID, "gone"},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"MembershipApplied":    "Applied",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "Modified",
+				},
+				modified: []*elasticache.ModifyUserGroupInput{{
+					UserGroupId:     aws.String("app"),
+					UserIdsToAdd:    []string{"app1"},
+					UserIdsToRemove: []string{"gone"},
+				}},
+				tagged: []*elasticache.AddTagsToResourceInput{{
+					ResourceName: aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"),
+					Tags: []types.Tag{
+						{Key: aws.String(originTagComposite), Value: aws.String("default/prod")},
+						{Key: aws.String(originTagManagedBy), Value: aws.String(functionName)},
+					},
+				}},
+			},
+		},
+		"DirectTagPolicyViolation": {
+			reason: "Direct mode shouldn't modify or tag the target user group if the tag policy rejects the tags it writes.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					ARN:         aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID, "gone"},
+				}},
+			},
+			organizations: &fakeOrganizations{content: `{"tags": {"managed-by": {"tag_key": "Managed-By", "enforced_for": ["elasticache:usergroup"]}}}`},
+			req:           req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}, "tagPolicy": {"enabled": true}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent": "DefaultUsersPresent",
+					"TagPolicyCompliant":  "TagPolicyViolation",
+					"UsersInAccount":      "UsersInAccount",
+					"UsersInRegion":       "UsersInRegion",
+				},
+			},
+		},
+		"DirectTagPolicyCompliant": {
+			reason: "Direct mode should modify and tag the target user group if its tags comply with the tag policy.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					ARN:         aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID},
+				}},
+			},
+			organizations: &fakeOrganizations{content: `{"tags": {"managed-by": {"tag_value": ["usergroup-*"], "enforced_for": ["elasticache:ALL_SUPPORTED"]}}}`},
+			req:           req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}, "tagPolicy": {"enabled": true}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"MembershipApplied":    "Applied",
+					"TagPolicyCompliant":   "Compliant",
+					"UserCountStable":      "UserCountStable",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "Modified",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+				},
+				modified: []*elasticache.ModifyUserGroupInput{{
+					UserGroupId:  aws.String("app"),
+					UserIdsToAdd: []string{"app1"},
+				}},
+				tagged: []*elasticache.AddTagsToResourceInput{{
+					ResourceName: aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"),
+					Tags: []types.Tag{
+						{Key: aws.String(originTagComposite), Value: aws.String("default/prod")},
+						{Key: aws.String(originTagManagedBy), Value: aws.String(functionName)},
+					},
+				}},
+			},
+		},
+		"DirectHeld": {
+			reason: "Direct mode shouldn't modify the target user group while the plan is held.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					ARN:         aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID, "gone", "leaked"},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}, "approval": {"writeThreshold": 1}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"PlanApproved":         "AwaitingApproval",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "AwaitingApproval",
+				},
+			},
+		},
+		"DirectSecurityRemovalBypass": {
+			reason: "Direct mode should remove security-critical users from the target user group while the plan is held, warning about and recording the bypass, but hold the plan's other changes.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					ARN:         aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID, "gone", "leaked"},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}, "approval": {"writeThreshold": 1, "securityRemovals": ["leaked"]}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"MembershipApplied":    "Applied",
+					"PlanApproved":         "AwaitingApproval",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "Modified",
+				},
+				modified: []*elasticache.ModifyUserGroupInput{{
+					UserGroupId:     aws.String("app"),
+					UserIdsToRemove: []string{"leaked"},
+				}},
+				tagged: []*elasticache.AddTagsToResourceInput{{
+					ResourceName: aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"),
+					Tags: []types.Tag{
+						{Key: aws.String(originTagComposite), Value: aws.String("default/prod")},
+						{Key: aws.String(originTagManagedBy), Value: aws.String(functionName)},
+					},
+				}},
+				warnings: 1,
+				bypassed: []any{"leaked"},
+			},
+		},
+		"DirectLocked": {
+			reason: "Direct mode shouldn't modify a target user group another function replica locked, retrying instead.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					ARN:         aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID, "gone"},
+				}},
+				tags: map[string][]types.Tag{"arn:aws:elasticache:us-east-1:123456789012:usergroup:app": {
+					{Key: aws.String(membership.LockTagKey), Value: aws.String("other-pod/5678 2099-01-01T00:00:00Z")},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}, "applyLock": {"enabled": true}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "Conflict",
+				},
+			},
+		},
+		"DirectTrustsAppliedMembership": {
+			reason: "Direct mode should trust the membership it recently applied over the one AWS reports, rather than modifying the target user group again.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID, "gone"},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}}`,
+				`{"userGroupManager": {"appliedMembership": {"userGroupId": "app", "userIDs": ["app1", "default"], "appliedTime": "`+time.Now().UTC().Format(time.RFC3339)+`"}}}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"MembershipApplied":    "Verifying",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "UpToDate",
+				},
+			},
+		},
+		"DirectDescribeUsersDenied": {
+			reason: "Direct mode shouldn't remove users it may not describe to check whether they're named default, warning that whether the target user group keeps one is unknown.",
+			client: &fakeElastiCache{
+				usersErr: &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized to perform elasticache:DescribeUsers"},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Engine:      aws.String(engineRedis),
+					ARN:         aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{"app1", "off-default"},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}}`,
+				`{"userGroupManager": {"appliedMembership": {"userGroupId": "app", "userIDs": ["app1", "gone", "off-default"], "appliedTime": "`+time.Now().UTC().Format(time.RFC3339)+`"}}}`),
+			want: want{
+				userIDs: []any{"app1", "off-default"},
+				conditions: map[string]string{
+					"MembershipApplied":    "Verifying",
+					"UserCountStable":      "UserCountStable",
+					"UserDiscoverySuccess": "Discovered 2 ElastiCache users",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "UpToDate",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+				},
+				warnings: 2,
+			},
+		},
+		"DirectKeepsDefaultUsers": {
+			reason: "Direct mode should never remove users named default from the target user group, even if they weren't discovered.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID), offDefault},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID, "off-default", "gone"},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "userNamePrefix": "app", "features": {"applyMode": true}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"MembershipApplied":    "Applied",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "Modified",
+				},
+				modified: []*elasticache.ModifyUserGroupInput{{
+					UserGroupId:     aws.String("app"),
+					UserIdsToAdd:    []string{"app1"},
+					UserIdsToRemove: []string{"gone"},
+				}},
+			},
+		},
+		"DirectAddsDefaultUser": {
+			reason: "Direct mode should add the selected user named default to a target user group that has none.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), offDefault},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{"gone"},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1", "off-default"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"MembershipApplied":    "Applied",
+					"UserDiscoverySuccess": "Discovered 2 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "Modified",
+				},
+				modified: []*elasticache.ModifyUserGroupInput{{
+					UserGroupId:     aws.String("app"),
+					UserIdsToAdd:    []string{"app1", "off-default"},
+					UserIdsToRemove: []string{"gone"},
+				}},
+			},
+		},
+		"DirectDefaultUserMissing": {
+			reason: "Direct mode should report a target user group that has no user named default and can't get one.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1")},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{"app1"},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUserMissing",
+					"MembershipApplied":    "Applied",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "UpToDate",
+				},
+			},
+		},
+		"ReplaceDefaultUser": {
+			reason: "The replacement default user should be swapped into the user group, and the built-in default user out of it, in a single call.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), offDefault},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Engine:      aws.String(engineRedis),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID, "app1"},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "userGroupId": "app", "defaultUserReplacement": {"userId": "off-default"}, "features": {"applyMode": true}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1", "off-default"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"UserDiscoverySuccess": "Discovered 2 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"DefaultUserReplaced":  replacementPhaseSwapping,
+				},
+				modified: []*elasticache.ModifyUserGroupInput{{
+					UserGroupId:     aws.String("app"),
+					UserIdsToAdd:    []string{"off-default"},
+					UserIdsToRemove: []string{discovery.DefaultUserID},
+				}},
+			},
+		},
+		"DirectDryRun": {
+			reason: "A dry run should plan the target user group's membership changes without modifying it, even without the applyMode feature.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID, "gone"},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "dryRun": true}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "DryRun",
+				},
+				plannedChanges: map[string]any{"userGroupId": "app", "add": []any{"app1"}, "remove": []any{"gone"}},
+			},
+		},
+		"MembershipDrift": {
+			reason: "Drift detection should report user groups whose membership AWS reports differs from the discovered users, without modifying them.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID, "manual"},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "userGroupId": "app", "excludeDefaultUser": false, "detectMembershipDrift": true}`, `{}`),
+			want: want{
+				userIDs: []any{"app1", discovery.DefaultUserID},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"UserDiscoverySuccess": "Discovered 2 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"MembershipInSync":     "MembershipDrift",
+				},
+			},
+		},
+		"MembershipInSync": {
+			reason: "Drift detection should report user groups whose membership matches the discovered users as in sync.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{"app1", discovery.DefaultUserID},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "userGroupId": "app", "excludeDefaultUser": false, "detectMembershipDrift": true}`, `{}`),
+			want: want{
+				userIDs: []any{"app1", discovery.DefaultUserID},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"UserDiscoverySuccess": "Discovered 2 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"MembershipInSync":     "InSync",
+				},
+			},
+		},
+		"MembershipInSyncDefaultUserExcluded": {
+			reason: "Drift detection shouldn't report the excluded built-in default user as drift, since it's never removed.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{"app1", discovery.DefaultUserID},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "userGroupId": "app", "detectMembershipDrift": true}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUserMissing",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"MembershipInSync":     "InSync",
+				},
+				warnings: 1,
+			},
+		},
+		"DirectMembershipInSync": {
+			reason: "Drift detection should agree with direct mode that a target user group keeping the excluded built-in default user is up to date.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{"app1", discovery.DefaultUserID},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "detectMembershipDrift": true, "features": {"applyMode": true}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"MembershipApplied":    "Applied",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+					"UserGroupReady":       "Active",
+					"UserGroupReconciled":  "UpToDate",
+					"MembershipInSync":     "InSync",
+				},
+			},
+		},
+		"Teardown": {
+			reason: "Users shouldn't be discovered or added to user groups while the XR is being deleted.",
+			client: &fakeElastiCache{users: []types.User{user("app1"), user(discovery.DefaultUserID)}},
+			req:    deleting(req(`{"region": "us-east-1", "userGroupId": "app"}`, `{}`)),
+			want: want{
+				conditions: map[string]string{"TeardownInProgress": "Deleting"},
+			},
+		},
+		"TeardownDrain": {
+			reason: "Direct mode should drain the target user group of every user but those named default while the XR is being deleted, if asked to.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID), offDefault},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{"app1", "off-default"},
+				}},
+			},
+			req: deleting(req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "teardown": {"drainUserGroup": true}, "features": {"applyMode": true}}`, `{}`)),
+			want: want{
+				conditions: map[string]string{"TeardownInProgress": "Draining"},
+				modified:   []*elasticache.ModifyUserGroupInput{{UserGroupId: aws.String("app"), UserIdsToRemove: []string{"app1"}}},
+			},
+		},
+		"TeardownDrainWithoutApplyMode": {
+			reason: "Draining the target user group should be planned but not made without the applyMode feature.",
+			client: &fakeElastiCache{
+				users: []types.User{user("app1"), user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{"app1", discovery.DefaultUserID},
+				}},
+			},
+			req: deleting(req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "teardown": {"drainUserGroup": true}}`, `{}`)),
+			want: want{
+				conditions: map[string]string{"TeardownInProgress": "DrainPlanned"},
+			},
+		},
+		"DirectUsersNotActive": {
+			reason: "Direct mode shouldn't modify the target user group while users to add to it aren't active.",
+			client: &fakeElastiCache{
+				users: []types.User{modifying, user(discovery.DefaultUserID)},
+				userGroups: []types.UserGroup{{
+					UserGroupId: aws.String("app"),
+					Status:      aws.String(membership.StatusActive),
+					UserIds:     []string{discovery.DefaultUserID},
+				}},
+			},
+			req: req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}}`, `{}`),
+			want: want{
+				userIDs: []any{"app1"},
+				conditions: map[string]string{
+					"DefaultUsersPresent":  "DefaultUsersPresent",
+					"UserDiscoverySuccess": "Discovered 1 ElastiCache users",
+					"UserCountStable":      "UserCountStable",
+					"UserGroupReady":       "UsersNotActive",
+					"UserGroupReconciled":  "WaitingToSettle",
+					"UsersInAccount":       "UsersInAccount",
+					"UsersInRegion":        "UsersInRegion",
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), elastiCache: tc.client, sts: &fakeSTS{account: "123456789012"}}
+			if tc.organizations != nil {
+				f.organizations = tc.organizations
+			}
+			rsp, err := f.RunFunction(context.Background(), tc.req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): %v", tc.reason, err)
+			}
+
+			got := want{conditions: map[string]string{}, modified: tc.client.modified, tagged: tc.client.tagged}
+			if ids, ok := rsp.GetContext().AsMap()["discoveredUserIDs"].([]any); ok {
+				got.userIDs = ids
+			}
+			if out, ok := rsp.GetContext().AsMap()[composableOutputKey].(map[string]any); ok {
+				if ugs, ok := out["userGroups"].([]any); ok {
+					got.userGroups = map[string][]any{}
+					for _, ug := range ugs {
+						ug := ug.(map[string]any)
+						got.userGroups[ug["name"].(string)] = ug["userIDs"].([]any)
+					}
+				}
+			}
+			for _, c := range rsp.GetConditions() {
+				got.conditions[c.GetType()] = c.GetReason()
+			}
+			got.warnings = countWarnings(rsp)
+			if pc, ok := rsp.GetContext().AsMap()[plannedChangesKey].(map[string]any); ok {
+				got.plannedChanges = pc
+			}
+			st := rsp.GetDesired().GetComposite().GetResource().GetFields()["status"].GetStructValue().GetFields()[status.Key].GetStructValue()
+			if b := st.GetFields()["securityRemovalBypass"].GetStructValue(); b != nil {
+				got.bypassed = b.GetFields()["userIDs"].GetListValue().AsSlice()
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{}), cmpopts.IgnoreUnexported(elasticache.ModifyUserGroupInput{}, elasticache.AddTagsToResourceInput{}, types.Tag{})); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// IAM principal types.
+const (
+	iamPrincipalRole = "role"
+	iamPrincipalUser = "user"
+)
+
+// An iamPrincipal is the IAM role or user an IAM-authenticated ElastiCache user
+// connects as.
+type iamPrincipal struct {
+	UserID string
+	Type   string
+	Name   string
+	ARN    string
+	Path   string
+	Tags   map[string]string
+}
+
+// resolveIAMPrincipals looks up the IAM principal of each IAM-authenticated
+// user. ElastiCache requires such users' names to match the IAM role or user
+// that connects, so a role with the user's name is looked for first, then a
+// user. The IDs of users with no matching principal are returned separately.
+func resolveIAMPrincipals(ctx context.Context, client *iam.Client, users []discovery.User) (principals []iamPrincipal, unresolved []string, err error) {
+	for _, u := range users {
+		if u.AuthenticationType != authenticationTypeIAM {
+			continue
+		}
+
+		p, err := getIAMPrincipal(ctx, client, u.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if p == nil {
+			unresolved = append(unresolved, u.ID)
+			continue
+		}
+		p.UserID = u.ID
+		principals = append(principals, *p)
+	}
+	return principals, unresolved, nil
+}
+
+// getIAMPrincipal returns the IAM role or user with the supplied name, or nil
+// if there is neither.
+func getIAMPrincipal(ctx context.Context, client *iam.Client, name string) (*iamPrincipal, error) {
+	var notFound *iamtypes.NoSuchEntityException
+
+	role, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(name)})
+	switch {
+	case err == nil:
+		return &iamPrincipal{
+			Type: iamPrincipalRole,
+			Name: aws.ToString(role.Role.RoleName),
+			ARN:  aws.ToString(role.Role.Arn),
+			Path: aws.ToString(role.Role.Path),
+			Tags: iamTags(role.Role.Tags),
+		}, nil
+	case !errors.As(err, &notFound):
+		return nil, fmt.Errorf("failed to get IAM role %q: %w", name, err)
+	}
+
+	user, err := client.GetUser(ctx, &iam.GetUserInput{UserName: aws.String(name)})
+	switch {
+	case err == nil:
+		return &iamPrincipal{
+			Type: iamPrincipalUser,
+			Name: aws.ToString(user.User.UserName),
+			ARN:  aws.ToString(user.User.Arn),
+			Path: aws.ToString(user.User.Path),
+			Tags: iamTags(user.User.Tags),
+		}, nil
+	case !errors.As(err, &notFound):
+		return nil, fmt.Errorf("failed to get IAM user %q: %w", name, err)
+	}
+
+	return nil, nil
+}
+
+func iamTags(tags []iamtypes.Tag) map[string]string {
+	out := make(map[string]string, len(tags))
+	for _, t := range tags {
+		out[aws.ToString(t.Key)] = aws.ToString(t.Value)
+	}
+	return out
+}
+
+// iamPrincipalsContext returns the principals in a form that can be written
+// to the pipeline context.
+func iamPrincipalsContext(principals []iamPrincipal) []any {
+	out := make([]any, len(principals))
+	for i, p := range principals {
+		tags := make(map[string]any, len(p.Tags))
+		for k, v := range p.Tags {
+			tags[k] = v
+		}
+		out[i] = map[string]any{
+			"userId": p.UserID,
+			"type":   p.Type,
+			"name":   p.Name,
+			"arn":    p.ARN,
+			"path":   p.Path,
+			"tags":   tags,
+		}
+	}
+	return out
+}
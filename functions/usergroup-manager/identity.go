@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// identitySourceKey is the required resources key of the ConfigMap holding
+// SSO group membership.
+const identitySourceKey = "identitySource"
+
+// defaultIdentitySourceDataKey is the ConfigMap data key read by default.
+const defaultIdentitySourceDataKey = "groups.yaml"
+
+// Formats of the SSO group membership document.
+const (
+	// identityFormatGroups is a YAML or JSON object of group names to lists
+	// of members, e.g. {payments-eng: [alice@example.com]}.
+	identityFormatGroups = "groups"
+	// identityFormatSCIM is a SCIM 2.0 ListResponse of Group resources, as
+	// exported from most identity providers.
+	identityFormatSCIM = "scim"
+)
+
+// maxUserIDLength is the longest user ID ElastiCache accepts.
+const maxUserIDLength = 40
+
+// identityUserIDPrefix prefixes the IDs of users derived from SSO group
+// membership, so they can't collide with users created by other means.
+const identityUserIDPrefix = "sso-"
+
+type identityMappingParameters struct {
+	// ConfigMapName is the ConfigMap, in the XR's namespace, holding SSO
+	// group membership. Identity mapping is disabled if it's empty.
+	ConfigMapName string
+	Key           string
+	Format        string
+
+	// Roles map SSO groups to cache roles, in precedence order.
+	Roles []identityRole
+}
+
+// An identityRole grants members of an SSO group an ElastiCache access string
+// and membership of user groups.
+type identityRole struct {
+	SSOGroup     string
+	AccessString string
+	// AccessTemplate is the reference of the template AccessString was
+	// resolved from, if any.
+	AccessTemplate string
+	UserGroups     []string
+	// Authentication is how members authenticate. It's required.
+	Authentication userAuthentication
+}
+
+// A managedUser is an ElastiCache user this function asks later pipeline
+// steps to compose, e.g. one derived from SSO group membership.
+type managedUser struct {
+	ID           string
+	Name         string
+	Engine       string
+	AccessString string
+	UserGroups   []string
+
+	// AccessTemplate is the reference of the template AccessString was
+	// resolved from, if any.
+	AccessTemplate string
+
+	// Authentication is how the user authenticates. Users are never composed
+	// without one.
+	Authentication userAuthentication
+
+	// ObserveOnly users are added to user groups, but their ElastiCache user
+	// is never modified or deleted. This lets existing, hand-created users be
+	// adopted gradually.
+	ObserveOnly bool
+
+	// SSOGroups are the mapped SSO groups the member of an SSO group belongs
+	// to, in precedence order. AccessString is that of the first.
+	SSOGroups []string
+}
+
+// identityUsersFromConfigMap reads SSO group membership from the supplied
+// ConfigMap and maps it to ElastiCache users.
+func identityUsersFromConfigMap(cm *unstructured.Unstructured, p identityMappingParameters) ([]managedUser, error) {
+	doc, err := configMapValue(cm, p.Key)
+	if err != nil {
+		return nil, err
+	}
+	members, err := parseGroupMembers(doc, p.Format)
+	if err != nil {
+		return nil, fmt.Errorf("ConfigMap %s/%s key %q: %w", cm.GetNamespace(), cm.GetName(), p.Key, err)
+	}
+	return mapIdentities(p.Roles, members), nil
+}
+
+// parseGroupMembers parses an SSO group membership document, returning the
+// members of each group.
+func parseGroupMembers(doc, format string) (map[string][]string, error) {
+	switch format {
+	case identityFormatSCIM:
+		list := struct {
+			Resources []struct {
+				DisplayName string `json:"displayName"`
+				Members     []struct {
+					Value   string `json:"value"`
+					Display string `json:"display"`
+				} `json:"members"`
+			} `json:"Resources"`
+		}{}
+		if err := yaml.Unmarshal([]byte(doc), &list); err != nil {
+			return nil, fmt.Errorf("cannot parse SCIM groups: %w", err)
+		}
+		out := make(map[string][]string, len(list.Resources))
+		for _, g := range list.Resources {
+			for _, m := range g.Members {
+				// Prefer the display name, usually the user name or
+				// email, over the IdP's opaque ID.
+				name := m.Display
+				if name == "" {
+					name = m.Value
+				}
+				if name != "" {
+					out[g.DisplayName] = append(out[g.DisplayName], name)
+				}
+			}
+		}
+		return out, nil
+	default:
+		out := map[string][]string{}
+		if err := yaml.Unmarshal([]byte(doc), &out); err != nil {
+			return nil, fmt.Errorf("cannot parse groups: %w", err)
+		}
+		return out, nil
+	}
+}
+
+// mapIdentities returns one ElastiCache user per member of a mapped SSO
+// group, sorted by ID. A member of several mapped groups gets the access
+// string and authentication of the first role and the user groups of all of
+// them. IAM-authenticated users are named after their ID, as ElastiCache
+// requires.
+func mapIdentities(roles []identityRole, members map[string][]string) []managedUser {
+	users := map[string]*managedUser{}
+	for _, r := range roles {
+		for _, m := range members[r.SSOGroup] {
+			u, ok := users[m]
+			if !ok {
+				u = &managedUser{ID: identityUserID(m), Name: m, Engine: engineRedis, AccessString: r.AccessString, AccessTemplate: r.AccessTemplate, Authentication: r.Authentication, UserGroups: []string{}}
+				if r.Authentication.Type == authenticationIAM {
+					u.Name = u.ID
+				}
+				users[m] = u
+			}
+			if !slices.Contains(u.SSOGroups, r.SSOGroup) {
+				u.SSOGroups = append(u.SSOGroups, r.SSOGroup)
+			}
+			for _, g := range r.UserGroups {
+				if !slices.Contains(u.UserGroups, g) {
+					u.UserGroups = append(u.UserGroups, g)
+				}
+			}
+		}
+	}
+
+	out := make([]managedUser, 0, len(users))
+	for _, u := range users {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// identityUserID derives a valid ElastiCache user ID from an SSO member name,
+// e.g. sso-alice-example-com for alice@example.com. Names that don't fit are
+// truncated and suffixed with a hash of the full name so IDs remain unique.
+func identityUserID(member string) string {
+	var b strings.Builder
+	b.WriteString(identityUserIDPrefix)
+	hyphen := true
+	for _, r := range strings.ToLower(member) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			hyphen = false
+			continue
+		}
+		if !hyphen {
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+	id := strings.TrimSuffix(b.String(), "-")
+	if len(id) <= maxUserIDLength {
+		return id
+	}
+	sum := sha256.Sum256([]byte(member))
+	hash := hex.EncodeToString(sum[:4])
+	return strings.TrimSuffix(id[:maxUserIDLength-len(hash)-1], "-") + "-" + hash
+}
+
+// addManagedMembers adds each managed user that already exists to the user
+// groups it's granted. Users that don't exist yet are added once they're
+// discovered, so user groups never reference missing users. It returns the
+// granted user groups that aren't configured.
+func addManagedMembers(groups []userGroupMembership, users []managedUser, existing []discovery.User) []string {
+	exists := make(map[string]bool, len(existing))
+	for _, u := range existing {
+		exists[u.ID] = true
+	}
+	idx := make(map[string]int, len(groups))
+	for i, g := range groups {
+		idx[g.Name] = i
+	}
+
+	var unknown []string
+	for _, u := range users {
+		for _, name := range u.UserGroups {
+			i, ok := idx[name]
+			if !ok {
+				if !slices.Contains(unknown, name) {
+					unknown = append(unknown, name)
+				}
+				continue
+			}
+			if exists[u.ID] && !slices.Contains(groups[i].UserIDs, u.ID) {
+				groups[i].UserIDs = append(groups[i].UserIDs, u.ID)
+			}
+		}
+	}
+	return unknown
+}
+
+// observeOnly marks the users whose IDs are in ids as observe-only.
+func observeOnly(users []managedUser, ids []string) {
+	for i := range users {
+		if slices.Contains(ids, users[i].ID) {
+			users[i].ObserveOnly = true
+		}
+	}
+}
+
+// managedUsersContext returns the users in a form that can be written to the
+// pipeline context. SSO groups are only rendered for users that have them.
+func managedUsersContext(users []managedUser) []any {
+	out := make([]any, len(users))
+	for i, u := range users {
+		userGroups := make([]any, len(u.UserGroups))
+		for j, g := range u.UserGroups {
+			userGroups[j] = g
+		}
+		m := map[string]any{
+			"userId":       u.ID,
+			"userName":     u.Name,
+			"engine":       u.Engine,
+			"accessString": u.AccessString,
+			"userGroups":   userGroups,
+			"observeOnly":  u.ObserveOnly,
+		}
+		if u.Authentication.Type != "" {
+			m["authentication"] = u.Authentication.Context()
+		}
+		if len(u.SSOGroups) > 0 {
+			ssoGroups := make([]any, len(u.SSOGroups))
+			for j, g := range u.SSOGroups {
+				ssoGroups[j] = g
+			}
+			m["ssoGroups"] = ssoGroups
+		}
+		out[i] = m
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseGroupMembers(t *testing.T) {
+	type args struct {
+		doc    string
+		format string
+	}
+	type want struct {
+		members map[string][]string
+		err     bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"Groups": {
+			reason: "A YAML object of groups to members should be parsed as is.",
+			args: args{
+				doc: `
+payments-eng:
+- alice@example.com
+- bob@example.com
+sre: [carol@example.com]
+`,
+				format: identityFormatGroups,
+			},
+			want: want{members: map[string][]string{
+				"payments-eng": {"alice@example.com", "bob@example.com"},
+				"sre":          {"carol@example.com"},
+			}},
+		},
+		"SCIM": {
+			reason: "Members of SCIM groups should be identified by display name, falling back to their value.",
+			args: args{
+				doc: `{
+					"schemas": ["urn:ietf:params:scim:api:messages:2.0:ListResponse"],
+					"Resources": [
+						{"displayName": "payments-eng", "members": [
+							{"value": "2819c223", "display": "alice@example.com"},
+							{"value": "bob@example.com"}
+						]},
+						{"displayName": "empty"}
+					]
+				}`,
+				format: identityFormatSCIM,
+			},
+			want: want{members: map[string][]string{
+				"payments-eng": {"alice@example.com", "bob@example.com"},
+			}},
+		},
+		"Invalid": {
+			reason: "A document that isn't an object of groups should be rejected.",
+			args:   args{doc: "- alice@example.com", format: identityFormatGroups},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseGroupMembers(tc.args.doc, tc.args.format)
+			if diff := cmp.Diff(tc.want.members, got); diff != "" {
+				t.Errorf("%s\nparseGroupMembers(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if (err != nil) != tc.want.err {
+				t.Errorf("%s\nparseGroupMembers(...): want error %t, got %v", tc.reason, tc.want.err, err)
+			}
+		})
+	}
+}
+
+func TestMapIdentities(t *testing.T) {
+	password := userAuthentication{Type: authenticationPassword, PasswordSecretRef: &secretKeyRef{Name: "payments-eng", Key: "password"}}
+	roles := []identityRole{
+		{SSOGroup: "payments-admins", AccessString: "on ~* +@all", UserGroups: []string{"ops"}, Authentication: userAuthentication{Type: authenticationIAM}},
+		{SSOGroup: "payments-eng", AccessString: "on ~payments:* +@read", UserGroups: []string{"app"}, Authentication: password},
+	}
+	members := map[string][]string{
+		"payments-eng":    {"alice@example.com", "bob@example.com"},
+		"payments-admins": {"bob@example.com"},
+		"unmapped":        {"carol@example.com"},
+	}
+
+	want := []managedUser{
+		{
+			ID:             "sso-alice-example-com",
+			Name:           "alice@example.com",
+			Engine:         engineRedis,
+			AccessString:   "on ~payments:* +@read",
+			Authentication: password,
+			SSOGroups:      []string{"payments-eng"},
+			UserGroups:     []string{"app"},
+		},
+		{
+			// IAM-authenticated users must be named after their ID
+			ID:             "sso-bob-example-com",
+			Name:           "sso-bob-example-com",
+			Engine:         engineRedis,
+			AccessString:   "on ~* +@all",
+			Authentication: userAuthentication{Type: authenticationIAM},
+			SSOGroups:      []string{"payments-admins", "payments-eng"},
+			UserGroups:     []string{"ops", "app"},
+		},
+	}
+
+	got := mapIdentities(roles, members)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mapIdentities(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestManagedUserEngine(t *testing.T) {
+	groups := []userGroupMembership{{Name: "app", Engine: engineValkey}, {Name: "ops", Engine: engineRedis}}
+
+	cases := map[string]struct {
+		reason  string
+		granted []string
+		want    string
+	}{
+		"UserGroupEngine": {
+			reason:  "A user should take the engine of the user group it's granted.",
+			granted: []string{"app"},
+			want:    engineValkey,
+		},
+		"PreferRedis": {
+			reason:  "A user granted Redis OSS and Valkey user groups should be a Redis OSS user, which Valkey user groups also accept.",
+			granted: []string{"app", "ops"},
+			want:    engineRedis,
+		},
+		"Fallback": {
+			reason:  "A user granted no configured user group should take the fallback engine.",
+			granted: []string{"unknown"},
+			want:    engineValkey,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := managedUserEngine(tc.granted, groups, engineValkey)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nmanagedUserEngine(%v, ...): -want, +got:\n%s", tc.reason, tc.granted, diff)
+			}
+		})
+	}
+}
+
+func TestIdentityUserID(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		member string
+		want   string
+	}{
+		"Email": {
+			reason: "Characters that aren't valid in user IDs should become single hyphens.",
+			member: "Alice.Smith@Example.com",
+			want:   "sso-alice-smith-example-com",
+		},
+		"TrailingSymbols": {
+			reason: "User IDs must not end in a hyphen.",
+			member: "bob!",
+			want:   "sso-bob",
+		},
+		"TooLong": {
+			reason: "Long names should be truncated and suffixed with a hash so they remain unique.",
+			member: "a.very.long.name.indeed@subsidiary.example.com",
+			want:   "sso-a-very-long-name-indeed-sub-fbbcc4f4",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := identityUserID(tc.member)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nidentityUserID(%q): -want, +got:\n%s", tc.reason, tc.member, diff)
+			}
+			if len(got) > maxUserIDLength {
+				t.Errorf("%s\nidentityUserID(%q): %q is longer than %d characters", tc.reason, tc.member, got, maxUserIDLength)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// The kinds of provider-aws MR a user group can be attached to.
+const (
+	replicationGroupMRKind = "ReplicationGroup"
+	serverlessCacheMRKind  = "ServerlessCache"
+)
+
+// elastiCacheMRGroups are the API groups of provider-aws's ElastiCache MRs,
+// cluster scoped and namespaced.
+var elastiCacheMRGroups = []string{"elasticache.aws.upbound.io", "elasticache.aws.m.upbound.io"}
+
+// userGroupInjectionParameters select desired ReplicationGroups and
+// ServerlessCaches, composed by earlier pipeline steps, to attach a user
+// group to. A resource is selected if its composition resource name is one
+// of ResourceNames, or its labels include every one of MatchLabels. Nothing
+// is selected if neither is set.
+type userGroupInjectionParameters struct {
+	ResourceNames []string
+	MatchLabels   map[string]string
+
+	// UserGroupID is the user group to attach. It defaults to the only one
+	// of spec.parameters.userGroups, or spec.parameters.userGroupId without
+	// them.
+	UserGroupID string
+}
+
+// Enabled returns true if the parameters select any resources.
+func (p userGroupInjectionParameters) Enabled() bool {
+	return len(p.ResourceNames) > 0 || len(p.MatchLabels) > 0
+}
+
+// parseUserGroupInjection reads the resources to attach a user group to. An
+// invalid user group ID is reported and ignored.
+func parseUserGroupInjection(r *paramReader, path string) userGroupInjectionParameters {
+	p := userGroupInjectionParameters{
+		ResourceNames: r.StringList(path + ".resourceNames"),
+		MatchLabels:   r.StringMap(path + ".matchLabels"),
+		UserGroupID:   r.String(path+".userGroupId", ""),
+	}
+	if p.UserGroupID != "" && !validUserGroupID(p.UserGroupID) {
+		r.errs = append(r.errs, fmt.Errorf("%s.userGroupId: %q is not a valid user group ID", path, p.UserGroupID))
+		p.UserGroupID = ""
+	}
+	return p
+}
+
+// injectedUserGroupID returns the user group to attach to the selected
+// resources, or an error if there's no single user group to pick.
+func injectedUserGroupID(p *parameters) (string, error) {
+	switch {
+	case p.UserGroupInjection.UserGroupID != "":
+		return p.UserGroupInjection.UserGroupID, nil
+	case len(p.UserGroups) == 1:
+		return p.UserGroups[0].Name, nil
+	case len(p.UserGroups) > 1:
+		return "", fmt.Errorf("spec.parameters.userGroupInjection.userGroupId is required to pick one of the %d user groups", len(p.UserGroups))
+	case p.UserGroupID != "":
+		return p.UserGroupID, nil
+	default:
+		return "", fmt.Errorf("spec.parameters.userGroupInjection.userGroupId or spec.parameters.userGroupId is required to attach a user group")
+	}
+}
+
+// Selects returns true if the parameters select the named desired resource.
+func (p userGroupInjectionParameters) Selects(name resource.Name, dc *resource.DesiredComposed) bool {
+	if slices.Contains(p.ResourceNames, string(name)) {
+		return true
+	}
+	if len(p.MatchLabels) == 0 {
+		return false
+	}
+	labels := dc.Resource.GetLabels()
+	for k, v := range p.MatchLabels {
+		if l, ok := labels[k]; !ok || l != v {
+			return false
+		}
+	}
+	return true
+}
+
+// userGroupAssociations returns the desired ReplicationGroups and
+// ServerlessCaches p selects, each attached to the user group, sorted by
+// resource name.
+func userGroupAssociations(desired map[resource.Name]*resource.DesiredComposed, p userGroupInjectionParameters, userGroupID string) []desiredAssociation {
+	var out []desiredAssociation
+	for name, dc := range desired {
+		if dc == nil || dc.Resource == nil || !isElastiCacheMR(dc) || !p.Selects(name, dc) {
+			continue
+		}
+		if k := dc.Resource.GetKind(); k == replicationGroupMRKind || k == serverlessCacheMRKind {
+			out = append(out, desiredAssociation{Resource: string(name), Kind: k, UserGroupID: userGroupID})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Resource < out[j].Resource })
+	return out
+}
+
+// injectUserGroup attaches the user group to every desired ReplicationGroup
+// and ServerlessCache p selects, replacing any user group they already had.
+// A ReplicationGroup takes a list of user groups and a ServerlessCache a
+// single one. It returns the names of the resources it changed, sorted.
+func injectUserGroup(desired map[resource.Name]*resource.DesiredComposed, p userGroupInjectionParameters, userGroupID string) ([]string, error) {
+	var injected []string
+	for _, a := range userGroupAssociations(desired, p, userGroupID) {
+		dc := desired[resource.Name(a.Resource)]
+		var err error
+		switch a.Kind {
+		case replicationGroupMRKind:
+			err = dc.Resource.SetValue("spec.forProvider.userGroupIds", []any{userGroupID})
+		case serverlessCacheMRKind:
+			err = dc.Resource.SetValue("spec.forProvider.userGroupId", userGroupID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot attach user group %q to %s: %w", userGroupID, a.Resource, err)
+		}
+		injected = append(injected, a.Resource)
+	}
+	return injected, nil
+}
+
+func isElastiCacheMR(dc *resource.DesiredComposed) bool {
+	return slices.Contains(elastiCacheMRGroups, dc.Resource.GroupVersionKind().Group)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+)
+
+func TestInjectUserGroup(t *testing.T) {
+	mr := func(apiVersion, kind string, labels map[string]string) *resource.DesiredComposed {
+		cd := composed.New()
+		cd.SetAPIVersion(apiVersion)
+		cd.SetKind(kind)
+		cd.SetLabels(labels)
+		return &resource.DesiredComposed{Resource: cd}
+	}
+	desired := func() map[resource.Name]*resource.DesiredComposed {
+		return map[resource.Name]*resource.DesiredComposed{
+			"replication-group": mr("elasticache.aws.m.upbound.io/v1beta1", replicationGroupMRKind, nil),
+			"serverless-cache":  mr("elasticache.aws.upbound.io/v1beta1", serverlessCacheMRKind, map[string]string{"tier": "cache"}),
+			"user-group":        mr("elasticache.aws.m.upbound.io/v1beta1", userGroupMRKind, map[string]string{"tier": "cache"}),
+			"bucket":            mr("s3.aws.m.upbound.io/v1beta1", "Bucket", map[string]string{"tier": "cache"}),
+		}
+	}
+
+	type want struct {
+		injected []string
+		values   map[string]any
+	}
+
+	cases := map[string]struct {
+		reason string
+		p      userGroupInjectionParameters
+		want   want
+	}{
+		"ResourceNames": {
+			reason: "A ReplicationGroup selected by name should get a list of one user group.",
+			p:      userGroupInjectionParameters{ResourceNames: []string{"replication-group"}},
+			want: want{
+				injected: []string{"replication-group"},
+				values:   map[string]any{"replication-group": []any{"app"}},
+			},
+		},
+		"MatchLabels": {
+			reason: "Only ElastiCache caches with every label should be selected, and a ServerlessCache should get a single user group.",
+			p:      userGroupInjectionParameters{MatchLabels: map[string]string{"tier": "cache"}},
+			want: want{
+				injected: []string{"serverless-cache"},
+				values:   map[string]any{"serverless-cache": "app"},
+			},
+		},
+		"NoMatch": {
+			reason: "Nothing should change if no resource is selected.",
+			p:      userGroupInjectionParameters{MatchLabels: map[string]string{"tier": "db"}},
+			want:   want{values: map[string]any{}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			d := desired()
+			injected, err := injectUserGroup(d, tc.p, "app")
+			if err != nil {
+				t.Fatalf("%s\ninjectUserGroup(...): %v", tc.reason, err)
+			}
+			got := want{injected: injected, values: map[string]any{}}
+			for n, dc := range d {
+				if v, err := dc.Resource.GetValue("spec.forProvider.userGroupIds"); err == nil {
+					got.values[string(n)] = v
+				}
+				if v, err := dc.Resource.GetValue("spec.forProvider.userGroupId"); err == nil {
+					got.values[string(n)] = v
+				}
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\ninjectUserGroup(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestInjectedUserGroupID(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		p      *parameters
+		want   string
+		err    bool
+	}{
+		"Explicit": {
+			reason: "The user group named in userGroupInjection should win.",
+			p:      &parameters{UserGroupID: "implicit", UserGroupInjection: userGroupInjectionParameters{UserGroupID: "explicit"}},
+			want:   "explicit",
+		},
+		"OnlyUserGroup": {
+			reason: "The only configured user group should be picked.",
+			p:      &parameters{UserGroupID: "implicit", UserGroups: []userGroupTarget{{Name: "app"}}},
+			want:   "app",
+		},
+		"ManyUserGroups": {
+			reason: "No user group should be picked from several.",
+			p:      &parameters{UserGroups: []userGroupTarget{{Name: "app"}, {Name: "ops"}}},
+			err:    true,
+		},
+		"Implicit": {
+			reason: "The implicit user group should be picked without configured ones.",
+			p:      &parameters{UserGroupID: "implicit"},
+			want:   "implicit",
+		},
+		"None": {
+			reason: "There's nothing to pick without any user group ID.",
+			p:      &parameters{},
+			err:    true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := injectedUserGroupID(tc.p)
+			if (err != nil) != tc.err {
+				t.Fatalf("%s\ninjectedUserGroupID(...): want error %t, got %v", tc.reason, tc.err, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\ninjectedUserGroupID(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"maps"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/input/v1beta1"
+)
+
+// inputParameters returns the fields set in the function's input in the
+// shape of the XR's spec.parameters.
+func inputParameters(in *v1beta1.Input) map[string]any {
+	p := map[string]any{}
+	if in.Region != "" {
+		p["region"] = in.Region
+	}
+	if len(in.Regions) > 0 {
+		regions := make([]any, len(in.Regions))
+		for i, r := range in.Regions {
+			regions[i] = r
+		}
+		p["regions"] = regions
+	}
+	if in.EndpointURL != "" {
+		p["endpointURL"] = in.EndpointURL
+	}
+	if in.CacheID != "" {
+		p["cacheId"] = in.CacheID
+	}
+	if in.UserGroupID != "" {
+		p["userGroupId"] = in.UserGroupID
+	}
+	if in.ManagementMode != "" {
+		p["managementMode"] = in.ManagementMode
+	}
+	if tf := in.TagFilter; tf != nil {
+		f := map[string]any{}
+		if tf.Key != "" {
+			f["key"] = tf.Key
+		}
+		if tf.Value != "" {
+			f["value"] = tf.Value
+		}
+		p["tagFilter"] = f
+	}
+	if ui := in.UserGroupInjection; ui != nil {
+		inj := map[string]any{}
+		if len(ui.ResourceNames) > 0 {
+			names := make([]any, len(ui.ResourceNames))
+			for i, n := range ui.ResourceNames {
+				names[i] = n
+			}
+			inj["resourceNames"] = names
+		}
+		if len(ui.MatchLabels) > 0 {
+			labels := make(map[string]any, len(ui.MatchLabels))
+			for k, v := range ui.MatchLabels {
+				labels[k] = v
+			}
+			inj["matchLabels"] = labels
+		}
+		if ui.UserGroupID != "" {
+			inj["userGroupId"] = ui.UserGroupID
+		}
+		p["userGroupInjection"] = inj
+	}
+	return p
+}
+
+// withInputDefaults returns the XR object with the fields set in the
+// function's input added to its spec.parameters, unless the XR sets them. The
+// XR object isn't modified.
+func withInputDefaults(xr map[string]any, in *v1beta1.Input) map[string]any {
+	return mergeDefaults(xr, map[string]any{"spec": map[string]any{"parameters": inputParameters(in)}})
+}
+
+// mergeDefaults returns m with the fields of defaults it doesn't have,
+// merging nested objects. Neither map is modified.
+func mergeDefaults(m, defaults map[string]any) map[string]any {
+	out := make(map[string]any, len(m)+len(defaults))
+	maps.Copy(out, m)
+	for k, d := range defaults {
+		v, ok := out[k]
+		if !ok {
+			out[k] = d
+			continue
+		}
+		vm, ok := v.(map[string]any)
+		dm, dok := d.(map[string]any)
+		if ok && dok {
+			out[k] = mergeDefaults(vm, dm)
+		}
+	}
+	return out
+}
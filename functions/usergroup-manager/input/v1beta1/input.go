@@ -0,0 +1,94 @@
+// Package v1beta1 contains the input type for this Function
+// +kubebuilder:object:generate=true
+// +groupName=usergroup-manager.fn.upbound.io
+// +versionName=v1beta1
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// This isn't a custom resource, in the sense that we never install its CRD.
+// It is a KRM-like object, so we generate a CRD to describe its schema.
+
+// An Input configures the usergroup-manager pipeline step. Every field is a
+// default for the parameter of the same name under the XR's spec.parameters,
+// which takes precedence, so one composition can configure the function
+// without every XR schema having to expose the parameters.
+// +kubebuilder:object:root=true
+// +kubebuilder:storageversion
+// +kubebuilder:resource:categories=crossplane
+type Input struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Region is the AWS region of the ElastiCache resources.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// Regions are additional regions whose users are discovered and
+	// reported per region.
+	// +optional
+	Regions []string `json:"regions,omitempty"`
+
+	// CacheID is the value of the cache-id tag identifying the ElastiCache
+	// resources that belong to the cache.
+	// +optional
+	CacheID string `json:"cacheId,omitempty"`
+
+	// UserGroupID is the user group whose membership is converged on the
+	// discovered users in direct mode, or the name of the implicit user
+	// group in composed mode.
+	// +optional
+	UserGroupID string `json:"userGroupId,omitempty"`
+
+	// ManagementMode selects who changes user group membership.
+	// +kubebuilder:validation:Enum=discover;direct;composed
+	// +optional
+	ManagementMode string `json:"managementMode,omitempty"`
+
+	// EndpointURL overrides the endpoint of the ElastiCache client in
+	// Region, e.g. to point it at LocalStack or at an interface VPC endpoint.
+	// +optional
+	EndpointURL string `json:"endpointURL,omitempty"`
+
+	// TagFilter selects the users to discover when the tagFiltering feature
+	// is enabled.
+	// +optional
+	TagFilter *TagFilter `json:"tagFilter,omitempty"`
+
+	// UserGroupInjection selects the ReplicationGroups and ServerlessCaches
+	// composed by earlier pipeline steps to attach a user group to.
+	// +optional
+	UserGroupInjection *UserGroupInjection `json:"userGroupInjection,omitempty"`
+}
+
+// A TagFilter selects users by tag.
+type TagFilter struct {
+	// Key of the tag a user must have. Defaults to cache-id.
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// Value the tag must have. Defaults to the cache ID.
+	// +optional
+	Value string `json:"value,omitempty"`
+}
+
+// A UserGroupInjection selects desired ReplicationGroups and ServerlessCaches
+// to attach a user group to. A resource is selected if its composition
+// resource name is listed, or its labels include every one of MatchLabels.
+type UserGroupInjection struct {
+	// ResourceNames are composition resource names of the resources to
+	// select.
+	// +optional
+	ResourceNames []string `json:"resourceNames,omitempty"`
+
+	// MatchLabels are labels a resource must have to be selected.
+	// +optional
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+
+	// UserGroupID is the user group to attach. Defaults to the only one of
+	// the XR's user groups, or its userGroupId.
+	// +optional
+	UserGroupID string `json:"userGroupId,omitempty"`
+}
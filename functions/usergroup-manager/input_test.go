@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/input/v1beta1"
+)
+
+func TestWithInputDefaults(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		xr     map[string]any
+		in     *v1beta1.Input
+		want   *parameters
+	}{
+		"NoInput": {
+			reason: "Without input the XR's parameters should be used as is.",
+			xr:     map[string]any{"spec": map[string]any{"parameters": map[string]any{"region": "eu-west-1"}}},
+			in:     &v1beta1.Input{},
+			want: &parameters{
+				Region:         "eu-west-1",
+				ManagementMode: managementModeDiscover,
+				TagFilter:      discovery.TagFilter{Key: defaultCacheIDTagKey},
+			},
+		},
+		"InputDefaults": {
+			reason: "Fields set in the input should be used when the XR doesn't set them.",
+			xr:     map[string]any{},
+			in: &v1beta1.Input{
+				Region:         "eu-west-1",
+				EndpointURL:    "http://localstack:4566",
+				CacheID:        "orders",
+				UserGroupID:    "orders-users",
+				ManagementMode: managementModeComposed,
+				TagFilter:      &v1beta1.TagFilter{Key: "team"},
+				UserGroupInjection: &v1beta1.UserGroupInjection{
+					ResourceNames: []string{"replication-group"},
+					MatchLabels:   map[string]string{"tier": "cache"},
+				},
+			},
+			want: &parameters{
+				Region:         "eu-west-1",
+				EndpointURL:    "http://localstack:4566",
+				CacheID:        "orders",
+				UserGroupID:    "orders-users",
+				ManagementMode: managementModeComposed,
+				TagFilter:      discovery.TagFilter{Key: "team", Value: "orders"},
+				UserGroupInjection: userGroupInjectionParameters{
+					ResourceNames: []string{"replication-group"},
+					MatchLabels:   map[string]string{"tier": "cache"},
+				},
+			},
+		},
+		"XRTakesPrecedence": {
+			reason: "Parameters the XR sets should override the input, field by field.",
+			xr: map[string]any{"spec": map[string]any{"parameters": map[string]any{
+				"region":    "us-west-2",
+				"tagFilter": map[string]any{"value": "payments"},
+			}}},
+			in: &v1beta1.Input{
+				Region:    "eu-west-1",
+				TagFilter: &v1beta1.TagFilter{Key: "team", Value: "orders"},
+			},
+			want: &parameters{
+				Region:         "us-west-2",
+				ManagementMode: managementModeDiscover,
+				TagFilter:      discovery.TagFilter{Key: "team", Value: "payments"},
+			},
+		},
+	}
+
+	// Only compare the parameters the input can set.
+	inputFields := func(p *parameters) *parameters {
+		return &parameters{
+			Region:             p.Region,
+			Regions:            p.Regions,
+			EndpointURL:        p.EndpointURL,
+			CacheID:            p.CacheID,
+			UserGroupID:        p.UserGroupID,
+			ManagementMode:     p.ManagementMode,
+			TagFilter:          p.TagFilter,
+			UserGroupInjection: p.UserGroupInjection,
+		}
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			xr := withInputDefaults(tc.xr, tc.in)
+			got, errs := parseParameters(xr)
+			if len(errs) > 0 {
+				t.Fatalf("%s\nparseParameters(...): unexpected errors: %v", tc.reason, errs)
+			}
+			if diff := cmp.Diff(tc.want, inputFields(got), cmp.AllowUnexported(parameters{})); diff != "" {
+				t.Errorf("%s\nwithInputDefaults(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestWithInputDefaultsDoesNotModifyXR(t *testing.T) {
+	xr := map[string]any{"spec": map[string]any{"parameters": map[string]any{"region": "us-west-2"}}}
+	withInputDefaults(xr, &v1beta1.Input{CacheID: "orders"})
+
+	want := map[string]any{"spec": map[string]any{"parameters": map[string]any{"region": "us-west-2"}}}
+	if diff := cmp.Diff(want, xr); diff != "" {
+		t.Errorf("withInputDefaults(...): modified the XR: -want, +got:\n%s", diff)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+// defaultMaxStatusUserIDs is the most user IDs written to the XR status by
+// default. Longer lists are summarized.
+const defaultMaxStatusUserIDs = 1000
+
+// statusUserIDsPreview is the number of user IDs kept in the status when the
+// list is summarized.
+const statusUserIDsPreview = 20
+
+// userIDsExportKey is the context key the full user ID list is written to
+// when the status is summarized, for later steps to compose into a ConfigMap.
+const userIDsExportKey = "userIDsExport"
+
+// userIDsResourceName is the composition resource name of the ConfigMap
+// holding the full user ID list.
+const userIDsResourceName = "user-ids"
+
+// userIDsDataKey is the ConfigMap data key holding the full user ID list, one
+// per line.
+const userIDsDataKey = "userIDs"
+
+type statusSizeParameters struct {
+	// MaxUserIDs is the most user IDs written to status.userGroupManager.userIDs.
+	// Zero disables summarization.
+	MaxUserIDs int
+}
+
+// A userIDsSummary stands in for a user ID list too long for the XR status.
+type userIDsSummary struct {
+	Count         int
+	SHA256        string
+	ConfigMapName string
+}
+
+// summarizeUserIDs returns a summary of ids if there are more than max, or
+// nil. The hash covers the full list, so consumers can tell when it changed.
+func summarizeUserIDs(ids []string, max int, configMapName string) *userIDsSummary {
+	if max <= 0 || len(ids) <= max {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(joinUserIDs(ids)))
+	return &userIDsSummary{Count: len(ids), SHA256: hex.EncodeToString(sum[:]), ConfigMapName: configMapName}
+}
+
+// Status returns the summary in the form written to the XR status.
+func (s *userIDsSummary) Status() map[string]any {
+	return map[string]any{
+		"truncated":     true,
+		"count":         s.Count,
+		"sha256":        s.SHA256,
+		"configMapName": s.ConfigMapName,
+	}
+}
+
+// userIDsConfigMapName returns the name of the ConfigMap holding the full
+// user ID list of the named XR.
+func userIDsConfigMapName(xrName string) string {
+	return xrName + "-" + userIDsResourceName
+}
+
+func joinUserIDs(ids []string) string {
+	return strings.Join(ids, "\n")
+}
+
+// observedUserIDs returns the user IDs recorded last time. When the status
+// was summarized, they're read from the observed ConfigMap holding the full
+// list instead. It returns nil if the full list isn't observed yet.
+func observedUserIDs(oxr *resource.Composite, observed map[resource.Name]resource.ObservedComposed) []string {
+	if truncated, _ := oxr.Resource.GetBool(status.Path("userIDsSummary.truncated")); !truncated {
+		ids, _ := oxr.Resource.GetStringArray(status.Path("userIDs"))
+		return ids
+	}
+	oc, ok := observed[userIDsResourceName]
+	if !ok || oc.Resource == nil {
+		return nil
+	}
+	data, err := oc.Resource.GetString("data." + userIDsDataKey)
+	if err != nil || data == "" {
+		return nil
+	}
+	return strings.Split(data, "\n")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+func TestSummarizeUserIDs(t *testing.T) {
+	ids := []string{"app1", "app2", "app3"}
+
+	cases := map[string]struct {
+		reason string
+		max    int
+		want   *userIDsSummary
+	}{
+		"Short": {
+			reason: "Lists within the limit shouldn't be summarized.",
+			max:    3,
+		},
+		"Disabled": {
+			reason: "Lists shouldn't be summarized when the limit is zero.",
+		},
+		"Long": {
+			reason: "Lists over the limit should be summarized with a hash of the full list.",
+			max:    2,
+			want:   &userIDsSummary{Count: 3, SHA256: "417c01afea925315659dbee41776f07fafa626009ea1832a972632173d10b309", ConfigMapName: "prod-user-ids"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := summarizeUserIDs(ids, tc.max, userIDsConfigMapName("prod"))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nsummarizeUserIDs(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestObservedUserIDs(t *testing.T) {
+	xr := func(fields map[string]any) *resource.Composite {
+		c := composite.New()
+		c.Object["status"] = map[string]any{status.Key: fields}
+		return &resource.Composite{Resource: c}
+	}
+	cm := composed.New()
+	cm.Object["data"] = map[string]any{userIDsDataKey: "app1\napp2\napp3"}
+	withConfigMap := map[resource.Name]resource.ObservedComposed{userIDsResourceName: {Resource: cm}}
+
+	cases := map[string]struct {
+		reason   string
+		oxr      *resource.Composite
+		observed map[resource.Name]resource.ObservedComposed
+		want     []string
+	}{
+		"Status": {
+			reason:   "User IDs should be read from the status when it wasn't summarized.",
+			oxr:      xr(map[string]any{"userIDs": []any{"app1"}}),
+			observed: withConfigMap,
+			want:     []string{"app1"},
+		},
+		"ConfigMap": {
+			reason:   "User IDs should be read from the ConfigMap when the status was summarized.",
+			oxr:      xr(map[string]any{"userIDs": []any{"app1"}, "userIDsSummary": map[string]any{"truncated": true}}),
+			observed: withConfigMap,
+			want:     []string{"app1", "app2", "app3"},
+		},
+		"ConfigMapNotObserved": {
+			reason: "No user IDs should be returned when the status was summarized but the ConfigMap isn't observed.",
+			oxr:    xr(map[string]any{"userIDs": []any{"app1"}, "userIDsSummary": map[string]any{"truncated": true}}),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := observedUserIDs(tc.oxr, tc.observed)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nobservedUserIDs(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
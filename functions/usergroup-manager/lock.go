@@ -0,0 +1,10 @@
+package main
+
+import "time"
+
+type applyLockParameters struct {
+	// Enabled locks the target user group of direct mode before modifying
+	// it, so only one function replica modifies it at a time.
+	Enabled bool
+	TTL     time.Duration
+}
@@ -2,6 +2,9 @@
 package main
 
 import (
+	"context"
+	"time"
+
 	"github.com/alecthomas/kong"
 
 	"github.com/crossplane/function-sdk-go"
@@ -9,6 +12,11 @@ import (
 
 // CLI of this Function.
 type CLI struct {
+	Serve     serveCommand     `cmd:"" default:"withargs" help:"Serve the function. This is the default command."`
+	Preflight preflightCommand `cmd:"" help:"Check that credentials can reach and use every AWS API the function needs, then print a report."`
+}
+
+type serveCommand struct {
 	Debug bool `short:"d" help:"Emit debug logs in addition to info logs."`
 
 	Network            string `help:"Network on which to listen for gRPC connections." default:"tcp"`
@@ -16,20 +24,63 @@ type CLI struct {
 	TLSCertsDir        string `help:"Directory containing server certs (tls.key, tls.crt) and the CA used to verify client certificates (ca.crt)" env:"TLS_SERVER_CERTS_DIR"`
 	Insecure           bool   `help:"Run without mTLS credentials. If you supply this flag --tls-server-certs-dir will be ignored."`
 	MaxRecvMessageSize int    `help:"Maximum size of received messages in MB." default:"4"`
+	MaxSendMessageSize int    `help:"Maximum size of sent messages in MB. Larger responses are replaced by a Fatal result saying so. Zero doesn't limit them." default:"0"`
+
+	AWSDefaultCredentials bool              `help:"Use the AWS SDK's default credential chain (environment, web identity, ECS container and EC2 instance metadata credentials) when a composition supplies no aws credentials."`
+	AWSEndpoints          map[string]string `help:"Endpoint URL to use for an AWS service, e.g. elasticache=https://vpce-123.elasticache.us-east-1.vpce.amazonaws.com. May be repeated. Services: elasticache, iam, kms, resourcegroupstaggingapi, secretsmanager, sts." placeholder:"SERVICE=URL"`
+
+	TelemetrySampleRate float64 `help:"Fraction of runs, between 0 and 1, whose AWS API calls are counted in metrics. Compositions may lower it, or opt out of telemetry entirely." default:"1"`
+
+	FullDiscoveryBudget       int           `help:"Most full user discoveries, i.e. listings of every user in an account, to run per --full-discovery-window across every XR. XRs over budget verify their previously discovered users instead. Zero disables the budget." default:"0"`
+	FullDiscoveryWindow       time.Duration `help:"Window over which the full discovery budget is spread." default:"1m"`
+	FullDiscoveryMaxStaleness time.Duration `help:"Give XRs whose users were last fully discovered longer ago than this priority over the budget." default:"1h"`
+
+	WatchdogInterval      time.Duration `help:"How often to sample goroutine count and heap usage. Zero disables the watchdog." default:"30s"`
+	WatchdogMaxGoroutines int           `help:"Log a warning with a goroutine dump when more goroutines than this are running. Zero disables the check." default:"1000"`
+	WatchdogMaxHeapMB     int           `help:"Log a warning when more heap than this many MB is in use. Zero disables the check." default:"512"`
 }
 
 // Run this Function.
-func (c *CLI) Run() error {
+func (c *serveCommand) Run() error {
 	log, err := function.NewLogger(c.Debug)
 	if err != nil {
 		return err
 	}
 
-	return function.Serve(&Function{log: log},
+	if err := validateEndpoints(c.AWSEndpoints); err != nil {
+		return err
+	}
+	if err := validateSampleRate(c.TelemetrySampleRate); err != nil {
+		return err
+	}
+	if err := validateMessageSizes(c.MaxRecvMessageSize, c.MaxSendMessageSize); err != nil {
+		return err
+	}
+
+	if c.WatchdogInterval > 0 {
+		w := &watchdog{
+			log:           log,
+			interval:      c.WatchdogInterval,
+			maxGoroutines: c.WatchdogMaxGoroutines,
+			maxHeapBytes:  uint64(max(c.WatchdogMaxHeapMB, 0)) * 1024 * 1024,
+		}
+		go w.Run(context.Background())
+	}
+
+	return function.Serve(&Function{
+		log:                 log,
+		defaultCredentials:  c.AWSDefaultCredentials,
+		telemetrySampleRate: c.TelemetrySampleRate,
+		endpoints:           c.AWSEndpoints,
+		replays:             newReplayCache(),
+		scheduler:           newDiscoveryScheduler(c.FullDiscoveryBudget, c.FullDiscoveryWindow),
+		maxStaleness:        c.FullDiscoveryMaxStaleness,
+	},
 		function.Listen(c.Network, c.Address),
 		function.MTLSCertificates(c.TLSCertsDir),
 		function.Insecure(c.Insecure),
-		function.MaxRecvMessageSize(c.MaxRecvMessageSize*1024*1024))
+		function.MaxRecvMessageSize(c.MaxRecvMessageSize*1024*1024),
+		maxSendMessageSize(c.MaxSendMessageSize*1024*1024))
 }
 
 func main() {
@@ -0,0 +1,48 @@
+package membership
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// DefaultConsistencyWindow is how long after modifying a user group the
+// function trusts the membership it applied over the one AWS reports, which
+// can lag behind ModifyUserGroup.
+const DefaultConsistencyWindow = time.Minute
+
+// An Applied membership is that of a user group right after the function last
+// modified it.
+type Applied struct {
+	UserGroupID string
+	UserIDs     []string
+	AppliedTime time.Time
+}
+
+// AppliedUserIDs returns the sorted members of a user group with the supplied
+// members once diff is applied to it.
+func AppliedUserIDs(members []string, diff Diff) []string {
+	out := slices.DeleteFunc(slices.Clone(members), func(id string) bool { return slices.Contains(diff.Removed, id) })
+	out = append(out, diff.Added...)
+	sort.Strings(out)
+	return slices.Compact(out)
+}
+
+// Trusted returns true if the membership was applied less than window ago,
+// and so is trusted over the one AWS reports.
+func (a *Applied) Trusted(window time.Duration, now time.Time) bool {
+	return a != nil && now.Sub(a.AppliedTime) < window
+}
+
+// Status returns the membership in the form written to the XR status.
+func (a *Applied) Status() map[string]any {
+	ids := a.UserIDs
+	if ids == nil {
+		ids = []string{}
+	}
+	return map[string]any{
+		"userGroupId": a.UserGroupID,
+		"userIDs":     ids,
+		"appliedTime": a.AppliedTime.UTC().Format(time.RFC3339),
+	}
+}
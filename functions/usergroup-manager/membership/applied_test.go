@@ -0,0 +1,15 @@
+package membership
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAppliedUserIDs(t *testing.T) {
+	got := AppliedUserIDs([]string{"default", "gone", "app1"}, Diff{Added: []string{"app2", "app1"}, Removed: []string{"gone"}})
+	want := []string{"app1", "app2", "default"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("AppliedUserIDs(...): -want, +got:\n%s", diff)
+	}
+}
@@ -0,0 +1,111 @@
+package membership
+
+import (
+	"context"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+)
+
+// fakeClient is an in-memory ElastiCache account that implements Client and
+// LockClient. Modified user groups report their new members right away.
+type fakeClient struct {
+	users      []types.User
+	userGroups []types.UserGroup
+	tags       map[string][]types.Tag
+	err        error
+
+	// usersErr is returned by DescribeUsers.
+	usersErr error
+
+	// modified records every ModifyUserGroup call and untagged every
+	// RemoveTagsFromResource call. Tags added and removed apply to tags.
+	modified []*elasticache.ModifyUserGroupInput
+	untagged []*elasticache.RemoveTagsFromResourceInput
+}
+
+func (c *fakeClient) DescribeUsers(_ context.Context, in *elasticache.DescribeUsersInput, _ ...func(*elasticache.Options)) (*elasticache.DescribeUsersOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.usersErr != nil {
+		return nil, c.usersErr
+	}
+	out := &elasticache.DescribeUsersOutput{}
+	for _, u := range c.users {
+		if in.UserId != nil && aws.ToString(in.UserId) != aws.ToString(u.UserId) {
+			continue
+		}
+		if len(in.Filters) > 0 && !slices.Contains(in.Filters[0].Values, aws.ToString(u.UserId)) {
+			continue
+		}
+		out.Users = append(out.Users, u)
+	}
+	return out, nil
+}
+
+func (c *fakeClient) DescribeUserGroups(_ context.Context, in *elasticache.DescribeUserGroupsInput, _ ...func(*elasticache.Options)) (*elasticache.DescribeUserGroupsOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	out := &elasticache.DescribeUserGroupsOutput{}
+	for _, ug := range c.userGroups {
+		if in.UserGroupId != nil && aws.ToString(in.UserGroupId) != aws.ToString(ug.UserGroupId) {
+			continue
+		}
+		out.UserGroups = append(out.UserGroups, ug)
+	}
+	if in.UserGroupId != nil && len(out.UserGroups) == 0 {
+		return nil, &types.UserGroupNotFoundFault{Message: aws.String("user group not found")}
+	}
+	return out, nil
+}
+
+func (c *fakeClient) ModifyUserGroup(_ context.Context, in *elasticache.ModifyUserGroupInput, _ ...func(*elasticache.Options)) (*elasticache.ModifyUserGroupOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.modified = append(c.modified, in)
+	for i, ug := range c.userGroups {
+		if aws.ToString(ug.UserGroupId) != aws.ToString(in.UserGroupId) {
+			continue
+		}
+		ids := slices.DeleteFunc(slices.Clone(ug.UserIds), func(id string) bool { return slices.Contains(in.UserIdsToRemove, id) })
+		c.userGroups[i].UserIds = append(ids, in.UserIdsToAdd...)
+	}
+	return &elasticache.ModifyUserGroupOutput{UserGroupId: in.UserGroupId, Status: aws.String("modifying")}, nil
+}
+
+func (c *fakeClient) AddTagsToResource(_ context.Context, in *elasticache.AddTagsToResourceInput, _ ...func(*elasticache.Options)) (*elasticache.AddTagsToResourceOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.tags == nil {
+		c.tags = map[string][]types.Tag{}
+	}
+	arn := aws.ToString(in.ResourceName)
+	for _, t := range in.Tags {
+		c.tags[arn] = slices.DeleteFunc(c.tags[arn], func(e types.Tag) bool { return aws.ToString(e.Key) == aws.ToString(t.Key) })
+		c.tags[arn] = append(c.tags[arn], t)
+	}
+	return &elasticache.AddTagsToResourceOutput{TagList: c.tags[arn]}, nil
+}
+
+func (c *fakeClient) RemoveTagsFromResource(_ context.Context, in *elasticache.RemoveTagsFromResourceInput, _ ...func(*elasticache.Options)) (*elasticache.RemoveTagsFromResourceOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.untagged = append(c.untagged, in)
+	arn := aws.ToString(in.ResourceName)
+	c.tags[arn] = slices.DeleteFunc(c.tags[arn], func(t types.Tag) bool { return slices.Contains(in.TagKeys, aws.ToString(t.Key)) })
+	return &elasticache.RemoveTagsFromResourceOutput{TagList: c.tags[arn]}, nil
+}
+
+func (c *fakeClient) ListTagsForResource(_ context.Context, in *elasticache.ListTagsForResourceInput, _ ...func(*elasticache.Options)) (*elasticache.ListTagsForResourceOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &elasticache.ListTagsForResourceOutput{TagList: c.tags[aws.ToString(in.ResourceName)]}, nil
+}
@@ -0,0 +1,128 @@
+// Package membership works out how the membership of ElastiCache user groups
+// must change, and changes it.
+package membership
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// maxDiffLines bounds the number of added and removed users rendered in a
+// membership diff, so results stay readable in kubectl describe.
+const maxDiffLines = 20
+
+// A Diff is how a user group's observed membership differs from the
+// membership the function desires.
+type Diff struct {
+	Resource string
+	Added    []string
+	Removed  []string
+}
+
+// NewDiff returns the users in desired but not current, and those in current
+// but not desired, sorted.
+func NewDiff(resource string, current, desired []string) Diff {
+	in := func(ids []string) map[string]bool {
+		m := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			m[id] = true
+		}
+		return m
+	}
+	cur, des := in(current), in(desired)
+
+	d := Diff{Resource: resource}
+	for id := range des {
+		if !cur[id] {
+			d.Added = append(d.Added, id)
+		}
+	}
+	for id := range cur {
+		if !des[id] {
+			d.Removed = append(d.Removed, id)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	return d
+}
+
+// Empty returns true if the membership doesn't change.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// String renders the diff in a compact, unified diff style, e.g.
+//
+//	user-group-app membership: +1 -1
+//	+ app3
+//	- app1
+//
+// At most maxDiffLines users are listed.
+func (d Diff) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "%s membership: +%d -%d", d.Resource, len(d.Added), len(d.Removed))
+	lines := 0
+	for _, l := range []struct {
+		prefix string
+		ids    []string
+	}{{"+", d.Added}, {"-", d.Removed}} {
+		for _, id := range l.ids {
+			if lines == maxDiffLines {
+				fmt.Fprintf(b, "\n... %d more", len(d.Added)+len(d.Removed)-lines)
+				return b.String()
+			}
+			fmt.Fprintf(b, "\n%s %s", l.prefix, id)
+			lines++
+		}
+	}
+	return b.String()
+}
+
+// Check returns the diff of every target user group whose membership differs
+// from the target's, keyed by user group ID, computed the way Describe
+// computes it, e.g. never removing users named default. A target's Applied
+// membership is checked instead of the one AWS reports. Unlike a diff of
+// composed user groups it doesn't depend on the user groups being composed,
+// so it also catches changes made outside Crossplane. It also returns the user
+// groups that don't exist.
+func Check(ctx context.Context, client Reader, targets []Target) ([]Diff, []string, error) {
+	targets = slices.Clone(targets)
+	sort.Slice(targets, func(i, j int) bool { return targets[i].UserGroupID < targets[j].UserGroupID })
+
+	var drift []Diff
+	var missing []string
+	for _, t := range targets {
+		out, err := client.DescribeUserGroups(ctx, &elasticache.DescribeUserGroupsInput{UserGroupId: aws.String(t.UserGroupID)})
+		switch {
+		case awsclient.Kind(err) == awsclient.ErrNotFound:
+			missing = append(missing, t.UserGroupID)
+			continue
+		case err != nil:
+			return nil, nil, fmt.Errorf("failed to describe user group %q: %w", t.UserGroupID, err)
+		case len(out.UserGroups) == 0:
+			missing = append(missing, t.UserGroupID)
+			continue
+		}
+		members := out.UserGroups[0].UserIds
+		if t.Applied != nil {
+			members = t.Applied
+		}
+		d, _, err := converge(ctx, client, t, members)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !d.Empty() {
+			drift = append(drift, d)
+		}
+	}
+	return drift, missing, nil
+}
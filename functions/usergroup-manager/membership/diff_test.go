@@ -0,0 +1,152 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestDiffString(t *testing.T) {
+	many := make([]string, maxDiffLines+5)
+	for i := range many {
+		many[i] = fmt.Sprintf("app%02d", i)
+	}
+
+	cases := map[string]struct {
+		reason  string
+		current []string
+		desired []string
+		want    string
+	}{
+		"AddedAndRemoved": {
+			reason:  "Added users should be prefixed with + and removed users with -.",
+			current: []string{"default", "app1"},
+			desired: []string{"default", "app3", "app2"},
+			want:    "user-group-app membership: +2 -1\n+ app2\n+ app3\n- app1",
+		},
+		"Truncated": {
+			reason:  "At most maxDiffLines users should be listed.",
+			desired: many,
+			want: "user-group-app membership: +25 -0\n+ app00\n+ app01\n+ app02\n+ app03\n+ app04\n+ app05\n+ app06\n+ app07\n+ app08\n+ app09" +
+				"\n+ app10\n+ app11\n+ app12\n+ app13\n+ app14\n+ app15\n+ app16\n+ app17\n+ app18\n+ app19\n... 5 more",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := NewDiff("user-group-app", tc.current, tc.desired).String()
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nString(): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	user := func(id, name string) types.User {
+		return types.User{UserId: aws.String(id), UserName: aws.String(name)}
+	}
+	client := func(usersErr error) *fakeClient {
+		return &fakeClient{
+			usersErr: usersErr,
+			users:    []types.User{user("default", "default"), user("off-default", "default"), user("app1", "app1"), user("manual", "manual")},
+			userGroups: []types.UserGroup{
+				{UserGroupId: aws.String("app"), UserIds: []string{"default", "app1", "manual"}},
+				{UserGroupId: aws.String("ops"), UserIds: []string{"default", "ops1"}},
+			},
+		}
+	}
+
+	type want struct {
+		drift   []Diff
+		missing []string
+		err     bool
+	}
+
+	cases := map[string]struct {
+		reason   string
+		usersErr error
+		targets  []Target
+		want     want
+	}{
+		"Drift": {
+			reason: "User groups whose members differ from the target's should be reported, and those that don't exist reported missing.",
+			targets: []Target{
+				{UserGroupID: "ops", UserIDs: []string{"ops1", "default"}},
+				{UserGroupID: "app", UserIDs: []string{"default", "app1", "app2"}},
+				{UserGroupID: "new", UserIDs: []string{"default"}},
+			},
+			want: want{
+				drift:   []Diff{{Resource: "app", Added: []string{"app2"}, Removed: []string{"manual"}}},
+				missing: []string{"new"},
+			},
+		},
+		"DefaultUserExcluded": {
+			reason: "A user named default that isn't a target member, e.g. because it was excluded from discovery, isn't drift, since it's never removed.",
+			targets: []Target{
+				{UserGroupID: "app", UserIDs: []string{"app1", "manual"}},
+				{UserGroupID: "ops", UserIDs: []string{"ops1"}},
+			},
+			want: want{},
+		},
+		"DefaultUserKept": {
+			reason: "The selected default user isn't drift if the user group keeps another user named default.",
+			targets: []Target{
+				{UserGroupID: "app", UserIDs: []string{"off-default", "app1", "manual"}, DefaultUserID: "off-default"},
+			},
+			want: want{},
+		},
+		"Applied": {
+			reason: "A target's applied membership should be checked instead of the one AWS reports.",
+			targets: []Target{
+				{UserGroupID: "app", UserIDs: []string{"app1"}, Applied: []string{"default", "app1"}},
+			},
+			want: want{},
+		},
+		"AppliedDrift": {
+			reason: "A target's applied membership that differs from the target's should be reported as drift.",
+			targets: []Target{
+				{UserGroupID: "app", UserIDs: []string{"app1", "app2"}, Applied: []string{"default", "app1"}},
+			},
+			want: want{drift: []Diff{{Resource: "app", Added: []string{"app2"}}}},
+		},
+		"Unchecked": {
+			reason:   "Membership shouldn't be reported in sync if the function may not describe the users it would remove to check whether they're named default.",
+			usersErr: &smithy.GenericAPIError{Code: "AccessDenied"},
+			targets: []Target{
+				{UserGroupID: "app", UserIDs: []string{"default", "app1"}},
+			},
+			want: want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			drift, missing, err := Check(context.Background(), client(tc.usersErr), tc.targets)
+			if diff := cmp.Diff(tc.want, want{drift: drift, missing: missing, err: err != nil}, cmp.AllowUnexported(want{}), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\nCheck(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func BenchmarkNewDiff(b *testing.B) {
+	current, desired := make([]string, 10000), make([]string, 10000)
+	for i := range current {
+		// A tenth of the users are replaced
+		current[i], desired[i] = fmt.Sprintf("app%05d", i), fmt.Sprintf("app%05d", i)
+		if i%10 == 0 {
+			desired[i] = fmt.Sprintf("new%05d", i)
+		}
+	}
+	b.ResetTimer()
+	for range b.N {
+		NewDiff("app", current, desired)
+	}
+}
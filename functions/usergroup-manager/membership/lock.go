@@ -0,0 +1,123 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// LockTagKey is the tag of a user group that records which function replica
+// may modify it, and until when, as "<holder> <expiry>".
+const LockTagKey = "usergroup-manager.upbound.io/apply-lock"
+
+// DefaultLockTTL is how long a lock is held if it isn't released, e.g.
+// because the replica holding it crashed.
+const DefaultLockTTL = time.Minute
+
+// ErrLocked is returned by Acquire if another holder has the lock. It's a
+// conflict, so the function retries on the next reconcile.
+var ErrLocked = fmt.Errorf("locked by another function replica: %w", awsclient.ErrConflict)
+
+// A LockClient reads and writes the tags a Lock is recorded in.
+type LockClient interface {
+	AddTagsToResource(ctx context.Context, in *elasticache.AddTagsToResourceInput, o ...func(*elasticache.Options)) (*elasticache.AddTagsToResourceOutput, error)
+	RemoveTagsFromResource(ctx context.Context, in *elasticache.RemoveTagsFromResourceInput, o ...func(*elasticache.Options)) (*elasticache.RemoveTagsFromResourceOutput, error)
+	ListTagsForResource(ctx context.Context, in *elasticache.ListTagsForResourceInput, o ...func(*elasticache.Options)) (*elasticache.ListTagsForResourceOutput, error)
+}
+
+// A Lock is a lease on modifying a user group. It's recorded in a tag of the
+// user group rather than in memory, so replicas that share nothing but the
+// AWS account see it.
+type Lock struct {
+	UserGroupID string
+	ARN         string
+
+	// Holder identifies the replica and XR taking the lock.
+	Holder string
+	TTL    time.Duration
+}
+
+// LockHolder returns the holder of the locks the function takes for the XR
+// with the supplied UID: the function's pod, which is its hostname, and the
+// XR, since one replica runs the function for many XRs at once.
+func LockHolder(uid string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + "/" + uid
+}
+
+// Value returns the value of the lock's tag when it's taken at now.
+func (l *Lock) Value(now time.Time) string {
+	return l.Holder + " " + now.Add(l.TTL).UTC().Format(time.RFC3339)
+}
+
+// Acquire takes the lock unless another holder has one that hasn't expired.
+// Tags can't be changed conditionally, so it reads the lock back after writing
+// it: of replicas taking it at once only the one whose write AWS kept goes on.
+// A replica that reads its lock back before another overwrites it can still
+// race that one, but the version check of Apply and ElastiCache rejecting
+// changes to a user group that's being modified catch most of those.
+func (l *Lock) Acquire(ctx context.Context, client LockClient, now time.Time) error {
+	if l.ARN == "" {
+		return fmt.Errorf("cannot lock user group %q: it has no ARN", l.UserGroupID)
+	}
+	holder, expiry, err := l.read(ctx, client)
+	if err != nil {
+		return err
+	}
+	if holder != "" && holder != l.Holder && now.Before(expiry) {
+		return fmt.Errorf("user group %q is %w until %s", l.UserGroupID, ErrLocked, expiry.Format(time.RFC3339))
+	}
+	tags := []types.Tag{{Key: aws.String(LockTagKey), Value: aws.String(l.Value(now))}}
+	if _, err := client.AddTagsToResource(ctx, &elasticache.AddTagsToResourceInput{ResourceName: aws.String(l.ARN), Tags: tags}); err != nil {
+		return fmt.Errorf("failed to lock user group %q: %w", l.UserGroupID, err)
+	}
+	if holder, _, err = l.read(ctx, client); err != nil {
+		return err
+	}
+	if holder != l.Holder {
+		return fmt.Errorf("user group %q is %w", l.UserGroupID, ErrLocked)
+	}
+	return nil
+}
+
+// Release removes the lock if this holder still has it. A lock that can't be
+// released expires after its TTL.
+func (l *Lock) Release(ctx context.Context, client LockClient) error {
+	holder, _, err := l.read(ctx, client)
+	if err != nil || holder != l.Holder {
+		return err
+	}
+	if _, err := client.RemoveTagsFromResource(ctx, &elasticache.RemoveTagsFromResourceInput{ResourceName: aws.String(l.ARN), TagKeys: []string{LockTagKey}}); err != nil {
+		return fmt.Errorf("failed to unlock user group %q: %w", l.UserGroupID, err)
+	}
+	return nil
+}
+
+// read returns the holder and expiry of the user group's lock, if any. A lock
+// that can't be parsed has expired.
+func (l *Lock) read(ctx context.Context, client LockClient) (string, time.Time, error) {
+	out, err := client.ListTagsForResource(ctx, &elasticache.ListTagsForResourceInput{ResourceName: aws.String(l.ARN)})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read the lock of user group %q: %w", l.UserGroupID, err)
+	}
+	for _, t := range out.TagList {
+		if aws.ToString(t.Key) != LockTagKey {
+			continue
+		}
+		holder, at, _ := strings.Cut(aws.ToString(t.Value), " ")
+		expiry, _ := time.Parse(time.RFC3339, at)
+		return holder, expiry, nil
+	}
+	return "", time.Time{}, nil
+}
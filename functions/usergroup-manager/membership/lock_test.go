@@ -0,0 +1,98 @@
+package membership
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+func TestLock(t *testing.T) {
+	const arn = "arn:aws:elasticache:us-east-1:123456789012:usergroup:app"
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	lockTag := func(value string) map[string][]types.Tag {
+		return map[string][]types.Tag{arn: {{Key: aws.String(LockTagKey), Value: aws.String(value)}}}
+	}
+
+	type want struct {
+		err error
+		// lock is the lock tag once Acquire returns, and released whether
+		// Release removed it.
+		lock     string
+		released bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		arn    string
+		tags   map[string][]types.Tag
+		want   want
+	}{
+		"Unlocked": {
+			reason: "A user group nobody locked should be locked until the TTL passes, and unlocked on release.",
+			arn:    arn,
+			want:   want{lock: "pod-a/xr 2026-10-15T12:01:00Z", released: true},
+		},
+		"LockedByOther": {
+			reason: "A user group another holder locked should be reported as a conflict, and its lock kept on release.",
+			arn:    arn,
+			tags:   lockTag("pod-b/xr 2026-10-15T12:00:30Z"),
+			want:   want{err: awsclient.ErrConflict, lock: "pod-b/xr 2026-10-15T12:00:30Z"},
+		},
+		"Expired": {
+			reason: "A lock that expired should be taken over.",
+			arn:    arn,
+			tags:   lockTag("pod-b/xr 2026-10-15T11:59:00Z"),
+			want:   want{lock: "pod-a/xr 2026-10-15T12:01:00Z", released: true},
+		},
+		"Unparseable": {
+			reason: "A lock that can't be parsed should be treated as expired.",
+			arn:    arn,
+			tags:   lockTag("pod-b/xr"),
+			want:   want{lock: "pod-a/xr 2026-10-15T12:01:00Z", released: true},
+		},
+		"Renewed": {
+			reason: "A lock the same holder already has should be renewed.",
+			arn:    arn,
+			tags:   lockTag("pod-a/xr 2026-10-15T12:00:30Z"),
+			want:   want{lock: "pod-a/xr 2026-10-15T12:01:00Z", released: true},
+		},
+		"NoARN": {
+			reason: "A user group without an ARN can't be tagged, so it can't be locked.",
+			want:   want{err: cmpopts.AnyError},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			client := &fakeClient{tags: tc.tags}
+			l := &Lock{UserGroupID: "app", ARN: tc.arn, Holder: "pod-a/xr", TTL: time.Minute}
+			got := want{err: l.Acquire(context.Background(), client, now)}
+			got.lock = lockValue(client.tags[arn])
+			if tc.arn != "" {
+				if err := l.Release(context.Background(), client); err != nil {
+					t.Fatalf("%s\nRelease(...): %v", tc.reason, err)
+				}
+				got.released = len(client.untagged) > 0 && lockValue(client.tags[arn]) == ""
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{}), cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nAcquire(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func lockValue(tags []types.Tag) string {
+	for _, t := range tags {
+		if aws.ToString(t.Key) == LockTagKey {
+			return aws.ToString(t.Value)
+		}
+	}
+	return ""
+}
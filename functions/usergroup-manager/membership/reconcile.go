@@ -0,0 +1,366 @@
+package membership
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// StatusActive is the status of a user group that can be modified, and of a
+// user that can be added to one. ElastiCache rejects changes to user groups
+// that are still being created or modified.
+const StatusActive = "active"
+
+// A Reader reads the membership of user groups, and the users in them.
+type Reader interface {
+	elasticache.DescribeUsersAPIClient
+	elasticache.DescribeUserGroupsAPIClient
+}
+
+// A Client reads and changes the membership of user groups, and tags the user
+// groups it changes.
+type Client interface {
+	Reader
+	ModifyUserGroup(ctx context.Context, in *elasticache.ModifyUserGroupInput, o ...func(*elasticache.Options)) (*elasticache.ModifyUserGroupOutput, error)
+	AddTagsToResource(ctx context.Context, in *elasticache.AddTagsToResourceInput, o ...func(*elasticache.Options)) (*elasticache.AddTagsToResourceOutput, error)
+}
+
+// A Reconcile is the outcome of converging a user group's membership on the
+// discovered users.
+type Reconcile struct {
+	UserGroupID string
+	ARN         string
+	Diff        Diff
+
+	// Pending is the status of a user group that wasn't active, and so
+	// couldn't be modified this time.
+	Pending string
+
+	// Unsettled are the users to add that weren't active, e.g. because
+	// they're being modified. The user group isn't modified until they are.
+	Unsettled []string
+
+	// KeepsDefaultUser is true if the user group has a user named default
+	// once its membership is converged. It's false if that's unknown because
+	// some members are Unchecked.
+	KeepsDefaultUser bool
+
+	// Unchecked are the members that would be removed, but may be named
+	// default: the function may not describe them to check. They're kept,
+	// and no default user is added in case one of them is named default.
+	Unchecked []string
+
+	// Members are the members the diff was computed from: those AWS
+	// reports, or those the function recently applied if it trusts them.
+	Members []string
+
+	// Unreported are the changes the function recently applied that AWS
+	// doesn't report yet. They're only known while it trusts them.
+	Unreported Diff
+
+	// Version identifies the user group's members, status and pending
+	// changes when it was described. Apply only modifies a user group that
+	// still has this version.
+	Version string
+}
+
+// ErrUserGroupChanged is returned by Apply if the user group changed after it
+// was described, e.g. because another controller modified it. It's a
+// conflict, so the function retries on the next reconcile with a fresh diff
+// rather than overwriting the other change.
+var ErrUserGroupChanged = fmt.Errorf("changed since it was described: %w", awsclient.ErrConflict)
+
+// An UncheckedError reports the members of a user group that would be removed,
+// but weren't checked for users named default because the function may not
+// describe them.
+type UncheckedError struct {
+	UserGroupID string
+	UserIDs     []string
+	Err         error
+}
+
+func (e *UncheckedError) Error() string {
+	return fmt.Sprintf("cannot check whether users %v of user group %q are named default, so they aren't removed: %s", e.UserIDs, e.UserGroupID, e.Err)
+}
+
+func (e *UncheckedError) Unwrap() error {
+	return e.Err
+}
+
+// Version returns a short hash of the user group's members, status and
+// pending membership changes.
+func Version(g types.UserGroup) string {
+	var add, remove []string
+	if p := g.PendingChanges; p != nil {
+		add, remove = slices.Sorted(slices.Values(p.UserIdsToAdd)), slices.Sorted(slices.Values(p.UserIdsToRemove))
+	}
+	members := slices.Sorted(slices.Values(g.UserIds))
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		aws.ToString(g.Status),
+		strings.Join(members, ","),
+		strings.Join(add, ","),
+		strings.Join(remove, ","),
+	}, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// A Target is the membership a user group is converged on.
+type Target struct {
+	UserGroupID string
+	UserIDs     []string
+
+	// DefaultUserID is the user named default selected for the user group.
+	// It's only added if the user group doesn't keep another.
+	DefaultUserID string
+
+	// Applied, if it isn't nil, is the membership the function recently
+	// applied to the user group. It's diffed against instead of the one AWS
+	// reports, since that can lag behind ModifyUserGroup.
+	Applied []string
+}
+
+// Describe returns how the user group's membership must change to converge on
+// the target's members, whose statuses are looked up in the discovered users.
+// Users named default are never removed, since ElastiCache requires one in
+// every Redis OSS user group and the built-in one isn't discovered by default.
+func Describe(ctx context.Context, client Client, t Target, users []discovery.User) (*Reconcile, error) {
+	out, err := client.DescribeUserGroups(ctx, &elasticache.DescribeUserGroupsInput{UserGroupId: aws.String(t.UserGroupID)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe user group %q: %w", t.UserGroupID, err)
+	}
+	if len(out.UserGroups) == 0 {
+		return nil, fmt.Errorf("user group %q not found", t.UserGroupID)
+	}
+	g := out.UserGroups[0]
+
+	status := make(map[string]string, len(users))
+	for _, u := range users {
+		status[u.ID] = u.Status
+	}
+	members := g.UserIds
+	if t.Applied != nil {
+		members = t.Applied
+	}
+	diff, keeps, err := converge(ctx, client, t, members)
+	var unchecked *UncheckedError
+	switch {
+	case errors.As(err, &unchecked):
+	case err != nil:
+		return nil, err
+	}
+	r := &Reconcile{
+		UserGroupID:      t.UserGroupID,
+		ARN:              aws.ToString(g.ARN),
+		Diff:             diff,
+		KeepsDefaultUser: keeps,
+		Members:          members,
+		Version:          Version(g),
+	}
+	if unchecked != nil {
+		r.Unchecked = unchecked.UserIDs
+	}
+	if t.Applied != nil {
+		r.Unreported = NewDiff(t.UserGroupID, g.UserIds, t.Applied)
+	}
+	if s := aws.ToString(g.Status); s != StatusActive {
+		r.Pending = s
+	}
+	// Users kept from a previous discovery have no known status
+	for _, id := range r.Diff.Added {
+		if s := status[id]; s != "" && s != StatusActive {
+			r.Unsettled = append(r.Unsettled, id)
+		}
+	}
+	return r, nil
+}
+
+// converge returns how members must change to converge on the target's
+// members, and whether the user group has a user named default once they
+// have. Users named default are never removed, and the target's default user
+// is only added if the user group doesn't keep another. If the function may
+// not describe the users to remove it returns an *UncheckedError along with
+// the diff, which removes none of them and doesn't add the default user, and
+// only reports the user group keeps a user named default if the built-in one
+// is a member.
+func converge(ctx context.Context, client elasticache.DescribeUsersAPIClient, t Target, members []string) (Diff, bool, error) {
+	d := NewDiff(t.UserGroupID, members, t.UserIDs)
+	removed := d.Removed
+	kept, err := withoutDefaultUsers(ctx, client, removed)
+	var unchecked *UncheckedError
+	switch {
+	case awsclient.IsAccessDenied(err):
+		ids := slices.DeleteFunc(slices.Clone(removed), func(id string) bool { return id == discovery.DefaultUserID })
+		unchecked = &UncheckedError{UserGroupID: t.UserGroupID, UserIDs: ids, Err: err}
+		d.Removed = nil
+	case err != nil:
+		return Diff{}, false, fmt.Errorf("failed to describe the users to remove from user group %q: %w", t.UserGroupID, err)
+	default:
+		d.Removed = kept
+	}
+	keeps := slices.Contains(members, discovery.DefaultUserID) || (unchecked == nil && len(d.Removed) < len(removed))
+	if t.DefaultUserID != "" {
+		// It's not added if one of the unchecked users may be named default
+		if keeps || unchecked != nil {
+			d.Added = slices.DeleteFunc(d.Added, func(id string) bool { return id == t.DefaultUserID })
+		}
+		keeps = keeps || unchecked == nil
+	}
+	if unchecked != nil {
+		return d, keeps, unchecked
+	}
+	return d, keeps, nil
+}
+
+// DescribeDrain returns how the user group's membership must change to only
+// keep its users named default, which ElastiCache requires in Redis OSS user
+// groups. Users are never added. It returns nil if the user group doesn't
+// exist.
+func DescribeDrain(ctx context.Context, client Client, userGroupID string) (*Reconcile, error) {
+	out, err := client.DescribeUserGroups(ctx, &elasticache.DescribeUserGroupsInput{UserGroupId: aws.String(userGroupID)})
+	switch {
+	case awsclient.Kind(err) == awsclient.ErrNotFound:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to describe user group %q: %w", userGroupID, err)
+	case len(out.UserGroups) == 0:
+		return nil, nil
+	}
+	g := out.UserGroups[0]
+
+	members, _, err := discovery.Verify(ctx, client, g.UserIds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the users of user group %q: %w", userGroupID, err)
+	}
+	var keep []string
+	for _, u := range members {
+		if u.Name == discovery.DefaultUserName {
+			keep = append(keep, u.ID)
+		}
+	}
+	r := &Reconcile{UserGroupID: userGroupID, ARN: aws.ToString(g.ARN), Diff: NewDiff(userGroupID, g.UserIds, keep), Members: g.UserIds, Version: Version(g)}
+	if s := aws.ToString(g.Status); s != StatusActive {
+		r.Pending = s
+	}
+	return r, nil
+}
+
+// withoutDefaultUsers returns the supplied user IDs but those of users named
+// default. Only the built-in default user is known by ID, so the others are
+// described.
+func withoutDefaultUsers(ctx context.Context, client elasticache.DescribeUsersAPIClient, ids []string) ([]string, error) {
+	var candidates []string
+	for _, id := range ids {
+		if id != discovery.DefaultUserID {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	users, err := discovery.Describe(ctx, client, candidates)
+	if err != nil {
+		return nil, err
+	}
+	named := map[string]bool{}
+	for _, u := range users {
+		if aws.ToString(u.UserName) == discovery.DefaultUserName {
+			named[aws.ToString(u.UserId)] = true
+		}
+	}
+	var out []string
+	for _, id := range candidates {
+		if !named[id] {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+// Settled returns true if the user group and the users to add to it are
+// active.
+func (r *Reconcile) Settled() bool {
+	return r.Pending == "" && len(r.Unsettled) == 0
+}
+
+// NeedsModify returns true if the user group must, and can, be modified.
+func (r *Reconcile) NeedsModify() bool {
+	return !r.Diff.Empty() && r.Settled()
+}
+
+// Apply adds the discovered users missing from the user group, and removes
+// those it has that weren't discovered. It then adds the supplied tags to the
+// user group, e.g. so it can be traced back to the XR that changed it. The
+// user group is described again first, and isn't modified if its version
+// changed.
+func (r *Reconcile) Apply(ctx context.Context, client Client, tags []types.Tag) error {
+	if !r.NeedsModify() {
+		return nil
+	}
+	out, err := client.DescribeUserGroups(ctx, &elasticache.DescribeUserGroupsInput{UserGroupId: aws.String(r.UserGroupID)})
+	if err != nil {
+		return fmt.Errorf("failed to describe user group %q: %w", r.UserGroupID, err)
+	}
+	if len(out.UserGroups) == 0 || Version(out.UserGroups[0]) != r.Version {
+		return fmt.Errorf("user group %q %w", r.UserGroupID, ErrUserGroupChanged)
+	}
+	in := &elasticache.ModifyUserGroupInput{UserGroupId: aws.String(r.UserGroupID)}
+	if len(r.Diff.Added) > 0 {
+		in.UserIdsToAdd = r.Diff.Added
+	}
+	if len(r.Diff.Removed) > 0 {
+		in.UserIdsToRemove = r.Diff.Removed
+	}
+	if _, err := client.ModifyUserGroup(ctx, in); err != nil {
+		return fmt.Errorf("failed to modify user group %q: %w", r.UserGroupID, err)
+	}
+	if len(tags) == 0 || r.ARN == "" {
+		return nil
+	}
+	if _, err := client.AddTagsToResource(ctx, &elasticache.AddTagsToResourceInput{ResourceName: aws.String(r.ARN), Tags: tags}); err != nil {
+		return fmt.Errorf("failed to tag user group %q: %w", r.UserGroupID, err)
+	}
+	return nil
+}
+
+// PlannedChanges returns the membership changes a dry run didn't make, as
+// written to the XR status and the plannedChanges context key.
+func (r *Reconcile) PlannedChanges() map[string]any {
+	return map[string]any{
+		"userGroupId": r.UserGroupID,
+		"add":         append([]string{}, r.Diff.Added...),
+		"remove":      append([]string{}, r.Diff.Removed...),
+	}
+}
+
+// Status returns the reconcile outcome as written to the XR status.
+func (r *Reconcile) Status() map[string]any {
+	s := map[string]any{
+		"userGroupId": r.UserGroupID,
+		"added":       len(r.Diff.Added),
+		"removed":     len(r.Diff.Removed),
+	}
+	if r.Pending != "" {
+		s["pending"] = r.Pending
+	}
+	if len(r.Unsettled) > 0 {
+		s["unsettledUserIDs"] = r.Unsettled
+	}
+	if len(r.Unchecked) > 0 {
+		s["uncheckedUserIDs"] = r.Unchecked
+	}
+	if r.Version != "" {
+		s["version"] = r.Version
+	}
+	return s
+}
@@ -0,0 +1,229 @@
+package membership
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+func TestReconcileStatus(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		r      *Reconcile
+		want   map[string]any
+	}{
+		"Modified": {
+			reason: "The number of added and removed users should be reported.",
+			r: &Reconcile{
+				UserGroupID: "app",
+				Diff:        NewDiff("app", []string{"default", "app1"}, []string{"default", "app2", "app3"}),
+			},
+			want: map[string]any{"userGroupId": "app", "added": 2, "removed": 1},
+		},
+		"Pending": {
+			reason: "The status of a user group that couldn't be modified should be reported.",
+			r: &Reconcile{
+				UserGroupID: "app",
+				Diff:        NewDiff("app", nil, []string{"default"}),
+				Pending:     "modifying",
+			},
+			want: map[string]any{"userGroupId": "app", "added": 1, "removed": 0, "pending": "modifying"},
+		},
+		"Unsettled": {
+			reason: "The users to add that weren't active should be reported.",
+			r: &Reconcile{
+				UserGroupID: "app",
+				Diff:        NewDiff("app", nil, []string{"app1"}),
+				Unsettled:   []string{"app1"},
+			},
+			want: map[string]any{"userGroupId": "app", "added": 1, "removed": 0, "unsettledUserIDs": []string{"app1"}},
+		},
+		"Unchecked": {
+			reason: "The users that couldn't be checked for users named default should be reported.",
+			r: &Reconcile{
+				UserGroupID: "app",
+				Diff:        NewDiff("app", nil, nil),
+				Unchecked:   []string{"manual"},
+			},
+			want: map[string]any{"userGroupId": "app", "added": 0, "removed": 0, "uncheckedUserIDs": []string{"manual"}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.r.Status()); diff != "" {
+				t.Errorf("%s\nStatus(): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestReconcilePlannedChanges(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		r      *Reconcile
+		want   map[string]any
+	}{
+		"Changes": {
+			reason: "The users a dry run would add and remove should be reported.",
+			r: &Reconcile{
+				UserGroupID: "app",
+				Diff:        NewDiff("app", []string{"default", "app1"}, []string{"default", "app3", "app2"}),
+			},
+			want: map[string]any{"userGroupId": "app", "add": []string{"app2", "app3"}, "remove": []string{"app1"}},
+		},
+		"UpToDate": {
+			reason: "A user group that doesn't change should be reported with empty lists rather than without them.",
+			r: &Reconcile{
+				UserGroupID: "app",
+				Diff:        NewDiff("app", []string{"default"}, []string{"default"}),
+			},
+			want: map[string]any{"userGroupId": "app", "add": []string{}, "remove": []string{}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.r.PlannedChanges()); diff != "" {
+				t.Errorf("%s\nPlannedChanges(): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestReconcileApply(t *testing.T) {
+	group := types.UserGroup{
+		UserGroupId: aws.String("app"),
+		Status:      aws.String(StatusActive),
+		UserIds:     []string{"default", "app1"},
+	}
+	changed := group
+	changed.UserIds = []string{"default", "app1", "other"}
+
+	type want struct {
+		err      error
+		modified []*elasticache.ModifyUserGroupInput
+	}
+
+	cases := map[string]struct {
+		reason string
+		client *fakeClient
+		want   want
+	}{
+		"Unchanged": {
+			reason: "A user group that didn't change since it was described should be modified.",
+			client: &fakeClient{userGroups: []types.UserGroup{group}},
+			want: want{
+				modified: []*elasticache.ModifyUserGroupInput{{UserGroupId: aws.String("app"), UserIdsToAdd: []string{"app2"}}},
+			},
+		},
+		"Changed": {
+			reason: "A user group that changed since it was described shouldn't be modified, returning a conflict.",
+			client: &fakeClient{userGroups: []types.UserGroup{changed}},
+			want:   want{err: awsclient.ErrConflict},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &Reconcile{
+				UserGroupID: "app",
+				Diff:        NewDiff("app", group.UserIds, []string{"default", "app1", "app2"}),
+				Version:     Version(group),
+			}
+			err := r.Apply(context.Background(), tc.client, nil)
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nApply(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.modified, tc.client.modified, cmpopts.IgnoreUnexported(elasticache.ModifyUserGroupInput{})); diff != "" {
+				t.Errorf("%s\nApply(...): -want ModifyUserGroup calls, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	user := func(id, name string) types.User {
+		return types.User{UserId: aws.String(id), UserName: aws.String(name)}
+	}
+	client := func(members []string, usersErr error) *fakeClient {
+		return &fakeClient{
+			users:      []types.User{user("default", "default"), user("off-default", "default"), user("app1", "app1"), user("manual", "manual")},
+			userGroups: []types.UserGroup{{UserGroupId: aws.String("app"), Status: aws.String(StatusActive), UserIds: members}},
+			usersErr:   usersErr,
+		}
+	}
+	denied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized to perform elasticache:DescribeUsers"}
+
+	type want struct {
+		diff      Diff
+		keeps     bool
+		unchecked []string
+		err       bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		client *fakeClient
+		target Target
+		want   want
+	}{
+		"KeepsDefaultUser": {
+			reason: "A member named default should be kept, and reported as the user group's default user.",
+			client: client([]string{"off-default", "manual"}, nil),
+			target: Target{UserGroupID: "app", UserIDs: []string{"app1"}},
+			want:   want{diff: Diff{Resource: "app", Added: []string{"app1"}, Removed: []string{"manual"}}, keeps: true},
+		},
+		"AddsDefaultUser": {
+			reason: "The target's default user should be added if the user group keeps no other user named default.",
+			client: client([]string{"manual"}, nil),
+			target: Target{UserGroupID: "app", UserIDs: []string{"app1", "off-default"}, DefaultUserID: "off-default"},
+			want:   want{diff: Diff{Resource: "app", Added: []string{"app1", "off-default"}, Removed: []string{"manual"}}, keeps: true},
+		},
+		"Unchecked": {
+			reason: "Members the function may not describe shouldn't be removed, and whether the user group keeps a user named default is unknown.",
+			client: client([]string{"off-default", "manual"}, denied),
+			target: Target{UserGroupID: "app", UserIDs: []string{"app1"}},
+			want:   want{diff: Diff{Resource: "app", Added: []string{"app1"}}, unchecked: []string{"manual", "off-default"}},
+		},
+		"UncheckedDefaultUserNotAdded": {
+			reason: "The target's default user shouldn't be added if an unchecked member may be named default already.",
+			client: client([]string{"off-default", "manual"}, denied),
+			target: Target{UserGroupID: "app", UserIDs: []string{"app1", "new-default"}, DefaultUserID: "new-default"},
+			want:   want{diff: Diff{Resource: "app", Added: []string{"app1"}}, unchecked: []string{"manual", "off-default"}},
+		},
+		"UncheckedBuiltInDefaultUser": {
+			reason: "A user group that has the built-in default user keeps a user named default, even if other members are unchecked.",
+			client: client([]string{"default", "manual"}, denied),
+			target: Target{UserGroupID: "app", UserIDs: []string{"app1"}},
+			want:   want{diff: Diff{Resource: "app", Added: []string{"app1"}}, keeps: true, unchecked: []string{"manual"}},
+		},
+		"DescribeUsersFailed": {
+			reason: "Failing to describe the members to remove for another reason should return an error.",
+			client: client([]string{"manual"}, &smithy.GenericAPIError{Code: "InternalFailure"}),
+			target: Target{UserGroupID: "app", UserIDs: []string{"app1"}},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r, err := Describe(context.Background(), tc.client, tc.target, nil)
+			got := want{err: err != nil}
+			if r != nil {
+				got.diff, got.keeps, got.unchecked = r.Diff, r.KeepsDefaultUser, r.Unchecked
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{}), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\nDescribe(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
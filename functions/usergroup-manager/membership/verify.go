@@ -0,0 +1,78 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+)
+
+// Bounds of the read-after-write verification of a user group the function
+// modified. Verification that outlasts them continues on the next reconcile.
+const (
+	VerifyAttempts = 3
+	VerifyInterval = 2 * time.Second
+)
+
+// A Verifier describes a user group the function modified until AWS reports
+// the membership changes it made.
+type Verifier struct {
+	Attempts int
+	Interval time.Duration
+
+	// Sleep waits for d, or until ctx is done.
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewVerifier returns a Verifier with the default bounds that waits between
+// attempts with the supplied sleep.
+func NewVerifier(sleep func(ctx context.Context, d time.Duration) error) *Verifier {
+	return &Verifier{Attempts: VerifyAttempts, Interval: VerifyInterval, Sleep: sleep}
+}
+
+// Verify describes the user group until it has every user diff added and none
+// it removed, at most Attempts times. It returns the changes AWS didn't report
+// yet after the last attempt, which are empty once it reports all of them.
+func (v *Verifier) Verify(ctx context.Context, client elasticache.DescribeUserGroupsAPIClient, diff Diff) (Diff, error) {
+	pending := diff
+	for attempt := range max(v.Attempts, 1) {
+		if attempt > 0 {
+			if err := v.Sleep(ctx, v.Interval); err != nil {
+				return pending, nil
+			}
+		}
+		out, err := client.DescribeUserGroups(ctx, &elasticache.DescribeUserGroupsInput{UserGroupId: aws.String(diff.Resource)})
+		if err != nil {
+			return pending, fmt.Errorf("failed to verify user group %q: %w", diff.Resource, err)
+		}
+		var members []string
+		if len(out.UserGroups) > 0 {
+			members = out.UserGroups[0].UserIds
+		}
+		pending = unappliedChanges(diff, members)
+		if pending.Empty() {
+			return pending, nil
+		}
+	}
+	return pending, nil
+}
+
+// unappliedChanges returns the changes of diff the supplied members don't
+// reflect: the added users they don't include, and the removed ones they do.
+func unappliedChanges(diff Diff, members []string) Diff {
+	pending := Diff{Resource: diff.Resource}
+	for _, id := range diff.Added {
+		if !slices.Contains(members, id) {
+			pending.Added = append(pending.Added, id)
+		}
+	}
+	for _, id := range diff.Removed {
+		if slices.Contains(members, id) {
+			pending.Removed = append(pending.Removed, id)
+		}
+	}
+	return pending
+}
@@ -0,0 +1,86 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestVerifierVerify(t *testing.T) {
+	boom := errors.New("boom")
+	diff := Diff{Resource: "app", Added: []string{"app2"}, Removed: []string{"gone"}}
+	group := func(ids ...string) []types.UserGroup {
+		return []types.UserGroup{{UserGroupId: aws.String("app"), Status: aws.String("modifying"), UserIds: ids}}
+	}
+
+	type want struct {
+		pending Diff
+		err     error
+		sleeps  int
+	}
+
+	cases := map[string]struct {
+		reason string
+		client *fakeClient
+		// settled is the membership AWS reports after the first sleep.
+		settled []types.UserGroup
+		want    want
+	}{
+		"Applied": {
+			reason: "Changes AWS reports right away should be verified without waiting.",
+			client: &fakeClient{userGroups: group("default", "app1", "app2")},
+			want:   want{pending: Diff{Resource: "app"}},
+		},
+		"AppliedAfterRetry": {
+			reason:  "Changes AWS reports after a while should be verified once it does.",
+			client:  &fakeClient{userGroups: group("default", "app1", "gone")},
+			settled: group("default", "app1", "app2"),
+			want:    want{pending: Diff{Resource: "app"}, sleeps: 1},
+		},
+		"NotApplied": {
+			reason: "Changes AWS doesn't report after every attempt should be returned.",
+			client: &fakeClient{userGroups: group("default", "app1", "gone")},
+			want:   want{pending: diff, sleeps: 2},
+		},
+		"PartlyApplied": {
+			reason: "Only the changes AWS doesn't report yet should be returned.",
+			client: &fakeClient{userGroups: group("default", "app1", "app2", "gone")},
+			want:   want{pending: Diff{Resource: "app", Removed: []string{"gone"}}, sleeps: 2},
+		},
+		"DescribeFailed": {
+			reason: "An error describing the user group should be returned.",
+			client: &fakeClient{err: boom},
+			want:   want{pending: diff, err: boom},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := want{}
+			v := &Verifier{
+				Attempts: 3,
+				Interval: time.Second,
+				Sleep: func(_ context.Context, d time.Duration) error {
+					if d != time.Second {
+						t.Errorf("%s\nVerify(...): slept %s, want %s", tc.reason, d, time.Second)
+					}
+					if got.sleeps == 0 && tc.settled != nil {
+						tc.client.userGroups = tc.settled
+					}
+					got.sleeps++
+					return nil
+				},
+			}
+			got.pending, got.err = v.Verify(context.Background(), tc.client, diff)
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{}), cmpopts.EquateErrors(), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\nVerify(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
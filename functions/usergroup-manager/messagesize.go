@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/crossplane/function-sdk-go"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// validateMessageSizes returns an error if the maximum gRPC message sizes, in
+// MB, can't be used. A maximum send size of zero doesn't limit responses.
+func validateMessageSizes(recv, send int) error {
+	if recv <= 0 {
+		return fmt.Errorf("maximum received message size must be at least 1 MB, got %d", recv)
+	}
+	if send < 0 {
+		return fmt.Errorf("maximum sent message size must not be negative, got %d", send)
+	}
+	return nil
+}
+
+// maxSendMessageSize returns a ServeOption that replaces responses larger than
+// sz bytes with a Fatal result explaining why, rather than sending them.
+// Crossplane fails opaquely when a response is larger than it accepts, so this
+// surfaces the problem on the XR. A size of zero doesn't limit responses.
+//
+// Unlike MaxRecvMessageSize the SDK has no option for it, so it's enforced by
+// a unary interceptor, which the SDK only installs while metrics are served.
+func maxSendMessageSize(sz int) function.ServeOption {
+	return func(o *function.ServeOptions) error {
+		if sz > 0 {
+			o.UnaryInterceptors = append(o.UnaryInterceptors, limitResponseSize(sz))
+		}
+		return nil
+	}
+}
+
+// limitResponseSize returns an interceptor that replaces RunFunctionResponses
+// larger than sz bytes with a Fatal result.
+func limitResponseSize(sz int) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		rsp, ok := resp.(*fnv1.RunFunctionResponse)
+		if !ok {
+			return resp, nil
+		}
+		if n := proto.Size(rsp); n > sz {
+			// Drop the desired state and context, which would make the
+			// Fatal result as large as the response it replaces
+			rsp = &fnv1.RunFunctionResponse{Meta: rsp.GetMeta()}
+			response.Fatal(rsp, fmt.Errorf("response of %d bytes is larger than the maximum message size of %d bytes. Start the function with a larger --max-send-message-size, or set spec.parameters.contextSize to shrink the pipeline context", n, sz))
+		}
+		return rsp, nil
+	}
+}
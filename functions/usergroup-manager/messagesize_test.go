@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestLimitResponseSize(t *testing.T) {
+	rsp := &fnv1.RunFunctionResponse{
+		Meta:    &fnv1.ResponseMeta{Tag: "hello"},
+		Context: resource.MustStructJSON(`{"discoveredUserIDs": ["app1", "app2", "app3"]}`),
+	}
+
+	cases := map[string]struct {
+		reason string
+		sz     int
+		want   *fnv1.RunFunctionResponse
+	}{
+		"WithinLimit": {
+			reason: "A response no larger than the limit should be sent as is.",
+			sz:     proto.Size(rsp),
+			want:   rsp,
+		},
+		"OverLimit": {
+			reason: "A response larger than the limit should be replaced by a Fatal result.",
+			sz:     proto.Size(rsp) - 1,
+			want: &fnv1.RunFunctionResponse{
+				Meta: &fnv1.ResponseMeta{Tag: "hello"},
+				Results: []*fnv1.Result{{
+					Severity: fnv1.Severity_SEVERITY_FATAL,
+					Message:  "response of 60 bytes is larger than the maximum message size of 59 bytes. Start the function with a larger --max-send-message-size, or set spec.parameters.contextSize to shrink the pipeline context",
+					Target:   fnv1.Target_TARGET_COMPOSITE.Enum(),
+				}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			handler := func(context.Context, any) (any, error) { return rsp, nil }
+			got, err := limitResponseSize(tc.sz)(context.Background(), &fnv1.RunFunctionRequest{}, &grpc.UnaryServerInfo{}, handler)
+			if err != nil {
+				t.Fatalf("%s\nlimitResponseSize(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("%s\nlimitResponseSize(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestValidateMessageSizes(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		recv   int
+		send   int
+		want   string
+	}{
+		"Defaults": {
+			reason: "The default sizes should be valid.",
+			recv:   4,
+		},
+		"NoReceive": {
+			reason: "Receiving no messages at all should be rejected.",
+			want:   "maximum received message size must be at least 1 MB, got 0",
+		},
+		"NegativeSend": {
+			reason: "A negative send size should be rejected.",
+			recv:   4,
+			send:   -1,
+			want:   "maximum sent message size must not be negative, got -1",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := ""
+			if err := validateMessageSizes(tc.recv, tc.send); err != nil {
+				got = err.Error()
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nvalidateMessageSizes(%d, %d): -want error, +got error:\n%s", tc.reason, tc.recv, tc.send, diff)
+			}
+		})
+	}
+}
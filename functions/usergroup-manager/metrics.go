@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsNamespace prefixes every metric this function exports. Metrics are
+// registered with the default Prometheus registry, which function.Serve
+// exposes at /metrics alongside the Go runtime collector's go_goroutines and
+// go_memstats_* series.
+const metricsNamespace = "usergroup_manager"
+
+// syncForgetAfter is how long a composite's sync age keeps being reported
+// after its last successful sync. It bounds the tracker's memory for deleted
+// composites while still reporting stuck ones for long enough to alert.
+const syncForgetAfter = 7 * 24 * time.Hour
+
+var watchdogBreaches = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "watchdog_threshold_exceeded_total",
+	Help:      "Number of watchdog samples that exceeded a goroutine or heap threshold.",
+}, []string{"resource"})
+
+var discoveredUsers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "discovered_users",
+	Help:      "Number of ElastiCache users discovered by the last successful sync of a composite.",
+}, []string{"namespace", "name"})
+
+var membershipDriftUsers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "membership_drift_users",
+	Help:      "Number of users the last membership drift check of a composite found missing from, or unexpectedly in, each of its user groups.",
+}, []string{"namespace", "name", "user_group"})
+
+var awsAPICalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "aws_api_calls_total",
+	Help:      "Number of AWS API operations, including all of their retry attempts, by outcome: success, throttled, not_found, conflict, validation or error.",
+}, []string{"service", "operation", "outcome"})
+
+var awsAPIRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "aws_api_retries_total",
+	Help:      "Number of AWS API request attempts that were retries.",
+}, []string{"service", "operation"})
+
+var awsAPIThrottles = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "aws_api_throttles_total",
+	Help:      "Number of AWS API request attempts that were throttled.",
+}, []string{"service", "operation"})
+
+var syncs = newSyncTracker()
+
+func init() {
+	prometheus.MustRegister(watchdogBreaches, discoveredUsers, membershipDriftUsers, awsAPICalls, awsAPIRetries, awsAPIThrottles, syncs)
+}
+
+type compositeKey struct {
+	namespace string
+	name      string
+}
+
+// A syncTracker records when each composite last synced successfully and
+// reports the time since then, computed at scrape time.
+type syncTracker struct {
+	mu   sync.Mutex
+	last map[compositeKey]time.Time
+	now  func() time.Time
+	desc *prometheus.Desc
+}
+
+func newSyncTracker() *syncTracker {
+	return &syncTracker{
+		last: map[compositeKey]time.Time{},
+		now:  time.Now,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "seconds_since_last_successful_sync"),
+			"Seconds since the composite last synced successfully.",
+			[]string{"namespace", "name"}, nil,
+		),
+	}
+}
+
+// Succeeded records a successful sync of the supplied composite.
+func (t *syncTracker) Succeeded(namespace, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last[compositeKey{namespace: namespace, name: name}] = t.now()
+}
+
+// Forget stops reporting the supplied composite, e.g. because it opted out of
+// telemetry.
+func (t *syncTracker) Forget(namespace, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.last, compositeKey{namespace: namespace, name: name})
+	discoveredUsers.DeleteLabelValues(namespace, name)
+	membershipDriftUsers.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "name": name})
+}
+
+// Describe implements prometheus.Collector.
+func (t *syncTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.desc
+}
+
+// Collect implements prometheus.Collector.
+func (t *syncTracker) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for k, last := range t.last {
+		age := now.Sub(last)
+		if age > syncForgetAfter {
+			delete(t.last, k)
+			discoveredUsers.DeleteLabelValues(k.namespace, k.name)
+			membershipDriftUsers.DeletePartialMatch(prometheus.Labels{"namespace": k.namespace, "name": k.name})
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(t.desc, prometheus.GaugeValue, age.Seconds(), k.namespace, k.name)
+	}
+}
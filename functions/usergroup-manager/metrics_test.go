@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+)
+
+func TestSyncTrackerCollect(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tr := newSyncTracker()
+
+	tr.now = func() time.Time { return now.Add(-90 * time.Second) }
+	tr.Succeeded("default", "example")
+	tr.now = func() time.Time { return now.Add(-syncForgetAfter - time.Second) }
+	tr.Succeeded("default", "deleted")
+	tr.now = func() time.Time { return now }
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(tr)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather(): %v", err)
+	}
+
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			got[labels["namespace"]+"/"+labels["name"]] = m.GetGauge().GetValue()
+		}
+	}
+
+	want := map[string]float64{"default/example": 90}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Collect(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestSyncTrackerForget(t *testing.T) {
+	tr := newSyncTracker()
+	tr.Succeeded("default", "example")
+	tr.Succeeded("default", "private")
+	tr.Forget("default", "private")
+
+	got := map[compositeKey]bool{}
+	for k := range tr.last {
+		got[k] = true
+	}
+	want := map[compositeKey]bool{{namespace: "default", name: "example"}: true}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(compositeKey{})); diff != "" {
+		t.Errorf("Forget(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestRunFunctionRecordsMetrics(t *testing.T) {
+	req := func(name, parameters, status string) *fnv1.RunFunctionRequest {
+		return &fnv1.RunFunctionRequest{
+			Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+				"apiVersion": "customer.upbound.io/v1alpha1",
+				"kind": "XCacheInfra",
+				"metadata": {"name": "` + name + `", "namespace": "metrics"},
+				"spec": {"parameters": ` + parameters + `},
+				"status": ` + status + `
+			}`)}},
+			Credentials: map[string]*fnv1.Credentials{
+				awsCredentialsName: {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+					Data: map[string][]byte{"aws_access_key_id": []byte("AKIA"), "aws_secret_access_key": []byte("secret")},
+				}}},
+			},
+		}
+	}
+	user := func(id string) types.User {
+		return types.User{UserId: aws.String(id), UserName: aws.String(id), Engine: aws.String(engineRedis), Status: aws.String("active")}
+	}
+	group := func(ids ...string) []types.UserGroup {
+		return []types.UserGroup{{UserGroupId: aws.String("app"), Status: aws.String(membership.StatusActive), UserIds: ids}}
+	}
+
+	type want struct {
+		synced bool
+
+		// gauges are the values of the composite's series, keyed by metric
+		// name and user group, if any.
+		gauges map[string]float64
+	}
+
+	cases := map[string]struct {
+		reason string
+		client *fakeElastiCache
+		req    *fnv1.RunFunctionRequest
+		want   want
+	}{
+		"Drift": {
+			reason: "The users missing from, and unexpectedly in, a user group should be recorded as its drift.",
+			client: &fakeElastiCache{users: []types.User{user("app1"), user(discovery.DefaultUserID)}, userGroups: group(discovery.DefaultUserID, "manual")},
+			req:    req("drift", `{"region": "us-east-1", "userGroupId": "app", "excludeDefaultUser": false, "detectMembershipDrift": true}`, `{}`),
+			want: want{synced: true, gauges: map[string]float64{
+				"usergroup_manager_discovered_users":           2,
+				"usergroup_manager_membership_drift_users/app": 2,
+			}},
+		},
+		"InSync": {
+			reason: "A user group that's in sync should be recorded as having no drift.",
+			client: &fakeElastiCache{users: []types.User{user("app1"), user(discovery.DefaultUserID)}, userGroups: group(discovery.DefaultUserID, "app1")},
+			req:    req("insync", `{"region": "us-east-1", "userGroupId": "app", "excludeDefaultUser": false, "detectMembershipDrift": true}`, `{}`),
+			want: want{synced: true, gauges: map[string]float64{
+				"usergroup_manager_discovered_users":           2,
+				"usergroup_manager_membership_drift_users/app": 0,
+			}},
+		},
+		"Stale": {
+			reason: "A sync that fell back to the users discovered previously shouldn't be recorded as successful.",
+			client: &fakeElastiCache{err: &smithy.GenericAPIError{Code: "Throttling", Message: "Rate exceeded"}},
+			req:    req("stale", `{"region": "us-east-1", "retry": {"discoveryAttempts": 1}}`, `{"userGroupManager": {"userIDs": ["app1", "default"]}}`),
+			want:   want{gauges: map[string]float64{}},
+		},
+		"TelemetryDisabled": {
+			reason: "No metrics should be recorded for a composite that opted out of telemetry.",
+			client: &fakeElastiCache{users: []types.User{user("app1"), user(discovery.DefaultUserID)}, userGroups: group(discovery.DefaultUserID, "manual")},
+			req:    req("private", `{"region": "us-east-1", "userGroupId": "app", "detectMembershipDrift": true, "telemetry": {"enabled": false}}`, `{}`),
+			want:   want{gauges: map[string]float64{}},
+		},
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(discoveredUsers, membershipDriftUsers)
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), elastiCache: tc.client, sts: &fakeSTS{account: "123456789012"}}
+			if _, err := f.RunFunction(context.Background(), tc.req); err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): %v", tc.reason, err)
+			}
+
+			xr := tc.req.GetObserved().GetComposite().GetResource().GetFields()["metadata"].GetStructValue().GetFields()["name"].GetStringValue()
+			syncs.mu.Lock()
+			_, synced := syncs.last[compositeKey{namespace: "metrics", name: xr}]
+			syncs.mu.Unlock()
+
+			mfs, err := reg.Gather()
+			if err != nil {
+				t.Fatalf("Gather(): %v", err)
+			}
+			got := want{synced: synced, gauges: map[string]float64{}}
+			for _, mf := range mfs {
+				for _, m := range mf.GetMetric() {
+					labels := map[string]string{}
+					for _, l := range m.GetLabel() {
+						labels[l.GetName()] = l.GetValue()
+					}
+					if labels["namespace"] != "metrics" || labels["name"] != xr {
+						continue
+					}
+					key := mf.GetName()
+					if ug, ok := labels["user_group"]; ok {
+						key += "/" + ug
+					}
+					got.gauges[key] = m.GetGauge().GetValue()
+				}
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
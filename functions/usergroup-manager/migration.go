@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+)
+
+// Phases of an AUTH token to RBAC migration, in order. A migration can become
+// blocked in any phase before it's associating.
+const (
+	// migrationPhaseStaging waits for the user group to exist and be active.
+	migrationPhaseStaging = "Staging"
+
+	// migrationPhaseBlocked needs a change to the replication group, e.g. an
+	// engine upgrade, or the user group, e.g. a password-protected default
+	// user, before it can use user groups.
+	migrationPhaseBlocked = "Blocked"
+
+	// migrationPhaseReady has validated the replication group and user
+	// group, and waits for the applyMode feature to associate them.
+	migrationPhaseReady = "Ready"
+
+	// migrationPhaseAssociating waits for ElastiCache to associate the user
+	// group and delete the AUTH token.
+	migrationPhaseAssociating = "Associating"
+
+	// migrationPhaseComplete uses RBAC only.
+	migrationPhaseComplete = "Complete"
+)
+
+// replicationGroupStatusAvailable is the status of a replication group that
+// can be modified.
+const replicationGroupStatusAvailable = "available"
+
+// migrationParameters configure migrating a replication group from AUTH
+// token authentication to RBAC.
+type migrationParameters struct {
+	ReplicationGroupID string
+
+	// UserGroupID is the user group the replication group is associated with.
+	// It defaults to spec.parameters.userGroupId.
+	UserGroupID string
+}
+
+// A migrationStatus is the phase an AUTH token to RBAC migration is in.
+type migrationStatus struct {
+	ReplicationGroupID string
+	UserGroupID        string
+	Phase              string
+	Message            string
+}
+
+// Status returns the migration status as written to the XR status.
+func (m *migrationStatus) Status() map[string]any {
+	return map[string]any{
+		"replicationGroupId": m.ReplicationGroupID,
+		"userGroupId":        m.UserGroupID,
+		"phase":              m.Phase,
+		"message":            m.Message,
+	}
+}
+
+// describeMigration returns the phase the migration of a replication group
+// from AUTH token authentication to the user group is in. Every phase is
+// derived from what AWS reports, so it's safe to call on every reconcile.
+func describeMigration(ctx context.Context, client awsclient.ElastiCache, p migrationParameters) (*migrationStatus, error) {
+	rg, version, err := describeReplicationGroup(ctx, client, p.ReplicationGroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ug *types.UserGroup
+	out, err := client.DescribeUserGroups(ctx, &elasticache.DescribeUserGroupsInput{UserGroupId: aws.String(p.UserGroupID)})
+	switch {
+	case errors.Is(err, awsclient.ErrNotFound):
+	case err != nil:
+		return nil, fmt.Errorf("failed to describe user group %q: %w", p.UserGroupID, err)
+	case len(out.UserGroups) > 0:
+		ug = &out.UserGroups[0]
+	}
+
+	var members []types.User
+	if ug != nil && aws.ToString(ug.Status) == membership.StatusActive {
+		if members, err = discovery.Describe(ctx, client, ug.UserIds); err != nil {
+			return nil, fmt.Errorf("failed to describe the users of user group %q: %w", p.UserGroupID, err)
+		}
+	}
+	return planMigration(rg, version, ug, members, p.UserGroupID), nil
+}
+
+// Associate advances a Ready migration to Associating by associating the user
+// group with the replication group and deleting its AUTH token.
+func (m *migrationStatus) Associate(ctx context.Context, client awsclient.ElastiCache) error {
+	if m.Phase != migrationPhaseReady {
+		return nil
+	}
+	_, err := client.ModifyReplicationGroup(ctx, &elasticache.ModifyReplicationGroupInput{
+		ReplicationGroupId:      aws.String(m.ReplicationGroupID),
+		UserGroupIdsToAdd:       []string{m.UserGroupID},
+		AuthTokenUpdateStrategy: types.AuthTokenUpdateStrategyTypeDelete,
+		ApplyImmediately:        aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to associate user group %q with replication group %q: %w", m.UserGroupID, m.ReplicationGroupID, err)
+	}
+	m.Phase = migrationPhaseAssociating
+	m.Message = fmt.Sprintf("Associating user group %q and deleting the AUTH token", m.UserGroupID)
+	return nil
+}
+
+// planMigration returns the phase a migration is in, given the replication
+// group, the engine version it runs, the user group, which is nil if it
+// doesn't exist yet, and the user group's members.
+func planMigration(rg types.ReplicationGroup, engineVersion string, ug *types.UserGroup, members []types.User, userGroupID string) *migrationStatus {
+	m := &migrationStatus{ReplicationGroupID: aws.ToString(rg.ReplicationGroupId), UserGroupID: userGroupID}
+	associated := slices.Contains(rg.UserGroupIds, userGroupID)
+	available := aws.ToString(rg.Status) == replicationGroupStatusAvailable
+
+	switch {
+	case associated && available && !aws.ToBool(rg.AuthTokenEnabled):
+		m.Phase, m.Message = migrationPhaseComplete, fmt.Sprintf("Uses user group %q", userGroupID)
+		return m
+	case associated || (rg.PendingModifiedValues != nil && rg.PendingModifiedValues.UserGroups != nil):
+		m.Phase, m.Message = migrationPhaseAssociating, fmt.Sprintf("Replication group is %s", aws.ToString(rg.Status))
+		return m
+	case !aws.ToBool(rg.AuthTokenEnabled):
+		m.Phase, m.Message = migrationPhaseBlocked, "Replication group doesn't use AUTH token authentication; associate its user groups directly"
+		return m
+	}
+
+	// Everything but the AUTH token, which the migration deletes, must
+	// already support user groups.
+	rg.AuthTokenEnabled = aws.Bool(false)
+	if problems := rbacProblems(rg, engineVersion); len(problems) > 0 {
+		m.Phase, m.Message = migrationPhaseBlocked, (&rbacError{ReplicationGroupID: m.ReplicationGroupID, Problems: problems}).Error()
+		return m
+	}
+
+	switch {
+	case ug == nil:
+		m.Phase, m.Message = migrationPhaseStaging, fmt.Sprintf("Waiting for user group %q to be created", userGroupID)
+	case aws.ToString(ug.Status) != membership.StatusActive:
+		m.Phase, m.Message = migrationPhaseStaging, fmt.Sprintf("Waiting for user group %q to become active; it's %s", userGroupID, aws.ToString(ug.Status))
+	case !hasProtectedDefaultUser(members):
+		// Without the AUTH token anyone who can reach the replication group
+		// is authenticated as the user named default
+		m.Phase, m.Message = migrationPhaseBlocked, fmt.Sprintf("User group %q has no password-protected user named default; add one before deleting the AUTH token", userGroupID)
+	case !available:
+		m.Phase, m.Message = migrationPhaseStaging, fmt.Sprintf("Waiting for replication group to become available; it's %s", aws.ToString(rg.Status))
+	default:
+		m.Phase, m.Message = migrationPhaseReady, fmt.Sprintf("Ready to associate user group %q and delete the AUTH token; enable the applyMode feature to proceed", userGroupID)
+	}
+	return m
+}
+
+// hasProtectedDefaultUser returns true if one of the users is named default
+// and needs a password, unlike the built-in default user.
+func hasProtectedDefaultUser(users []types.User) bool {
+	for _, u := range users {
+		if aws.ToString(u.UserName) == discovery.DefaultUserName && u.Authentication != nil && u.Authentication.Type == types.AuthenticationTypePassword {
+			return true
+		}
+	}
+	return false
+}
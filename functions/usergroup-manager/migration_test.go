@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlanMigration(t *testing.T) {
+	authToken := func(status string) types.ReplicationGroup {
+		return types.ReplicationGroup{
+			ReplicationGroupId:       aws.String("orders"),
+			Engine:                   aws.String("redis"),
+			Status:                   aws.String(status),
+			AuthTokenEnabled:         aws.Bool(true),
+			TransitEncryptionEnabled: aws.Bool(true),
+		}
+	}
+	active := &types.UserGroup{UserGroupId: aws.String("app"), Status: aws.String("active")}
+	protected := []types.User{
+		{UserId: aws.String("default"), UserName: aws.String("default"), Authentication: &types.Authentication{Type: types.AuthenticationTypeNoPassword}},
+		{UserId: aws.String("app-default"), UserName: aws.String("default"), Authentication: &types.Authentication{Type: types.AuthenticationTypePassword}},
+	}
+
+	type want struct {
+		phase   string
+		message string
+	}
+
+	cases := map[string]struct {
+		reason  string
+		rg      types.ReplicationGroup
+		version string
+		ug      *types.UserGroup
+		members []types.User
+		want    want
+	}{
+		"Staging": {
+			reason:  "A missing user group should be waited for.",
+			rg:      authToken("available"),
+			version: "7.1",
+			want:    want{phase: migrationPhaseStaging, message: `Waiting for user group "app" to be created`},
+		},
+		"StagingUserGroup": {
+			reason:  "A user group that isn't active yet should be waited for.",
+			rg:      authToken("available"),
+			version: "7.1",
+			ug:      &types.UserGroup{Status: aws.String("creating")},
+			want:    want{phase: migrationPhaseStaging, message: `Waiting for user group "app" to become active; it's creating`},
+		},
+		"StagingReplicationGroup": {
+			reason:  "A replication group that isn't available should be waited for.",
+			rg:      authToken("snapshotting"),
+			version: "7.1",
+			ug:      active,
+			members: protected,
+			want:    want{phase: migrationPhaseStaging, message: "Waiting for replication group to become available; it's snapshotting"},
+		},
+		"Blocked": {
+			reason:  "A replication group that can't use user groups even without its AUTH token should block the migration.",
+			rg:      authToken("available"),
+			version: "5.0.6",
+			ug:      active,
+			want: want{
+				phase:   migrationPhaseBlocked,
+				message: `replication group "orders" doesn't support user groups: it runs Redis 5.0.6, and user groups need Redis 6.0 or later; upgrade its engine version`,
+			},
+		},
+		"NoAuthToken": {
+			reason:  "A replication group that doesn't use an AUTH token has nothing to migrate.",
+			rg:      types.ReplicationGroup{ReplicationGroupId: aws.String("orders"), Status: aws.String("available")},
+			version: "7.1",
+			ug:      active,
+			want:    want{phase: migrationPhaseBlocked, message: "Replication group doesn't use AUTH token authentication; associate its user groups directly"},
+		},
+		"NoProtectedDefaultUser": {
+			reason:  "A user group whose only user named default is the built-in one that needs no password should block the migration.",
+			rg:      authToken("available"),
+			version: "6.2.6",
+			ug:      active,
+			members: protected[:1],
+			want:    want{phase: migrationPhaseBlocked, message: `User group "app" has no password-protected user named default; add one before deleting the AUTH token`},
+		},
+		"Ready": {
+			reason:  "A valid replication group and active user group with a password-protected default user should be ready to associate.",
+			rg:      authToken("available"),
+			version: "6.2.6",
+			ug:      active,
+			members: protected,
+			want:    want{phase: migrationPhaseReady, message: `Ready to associate user group "app" and delete the AUTH token; enable the applyMode feature to proceed`},
+		},
+		"Associating": {
+			reason: "A replication group still being modified should be waited for.",
+			rg: func() types.ReplicationGroup {
+				rg := authToken("modifying")
+				rg.PendingModifiedValues = &types.ReplicationGroupPendingModifiedValues{UserGroups: &types.UserGroupsUpdateStatus{UserGroupIdsToAdd: []string{"app"}}}
+				return rg
+			}(),
+			version: "7.1",
+			ug:      active,
+			want:    want{phase: migrationPhaseAssociating, message: "Replication group is modifying"},
+		},
+		"Complete": {
+			reason: "An available replication group using the user group without an AUTH token should be complete.",
+			rg: func() types.ReplicationGroup {
+				rg := authToken("available")
+				rg.AuthTokenEnabled = aws.Bool(false)
+				rg.UserGroupIds = []string{"app"}
+				return rg
+			}(),
+			version: "7.1",
+			ug:      active,
+			want:    want{phase: migrationPhaseComplete, message: `Uses user group "app"`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := planMigration(tc.rg, tc.version, tc.ug, tc.members, "app")
+			if diff := cmp.Diff(tc.want, want{phase: m.Phase, message: m.Message}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nplanMigration(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// Tags recording which composite a user group the function changes belongs
+// to, so it can be traced back from the AWS console.
+const (
+	// originTagManagedBy is always the function's name.
+	originTagManagedBy = "managed-by"
+
+	// originTagComposite is the XR's namespace and name, e.g. team-a/app.
+	originTagComposite = "composite"
+
+	// originTagClaim is the namespace and name of the XR's claim, only set
+	// for XRs that were claimed.
+	originTagClaim = "claim"
+)
+
+// Labels Crossplane sets on claimed XRs.
+const (
+	claimNameLabel      = "crossplane.io/claim-name"
+	claimNamespaceLabel = "crossplane.io/claim-namespace"
+)
+
+// originTags returns the tags tracing an AWS resource back to the XR.
+func originTags(xr *resource.Composite) map[string]string {
+	tags := map[string]string{
+		originTagManagedBy: functionName,
+		originTagComposite: namespacedName(xr.Resource.GetNamespace(), xr.Resource.GetName()),
+	}
+	l := xr.Resource.GetLabels()
+	if name := l[claimNameLabel]; name != "" {
+		tags[originTagClaim] = namespacedName(l[claimNamespaceLabel], name)
+	}
+	return tags
+}
+
+// namespacedName returns namespace/name, or just name for cluster scoped
+// resources.
+func namespacedName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// elastiCacheTags returns tags in the form the ElastiCache API takes, sorted
+// by key.
+func elastiCacheTags(tags map[string]string) []types.Tag {
+	out := make([]types.Tag, 0, len(tags))
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		out = append(out, types.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+	return out
+}
+
+// composedTags returns tags in the form a composed MR's forProvider.tags
+// takes.
+func composedTags(tags map[string]string) map[string]any {
+	out := make(map[string]any, len(tags))
+	for k, v := range tags {
+		out[k] = v
+	}
+	return out
+}
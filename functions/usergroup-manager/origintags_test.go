@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+)
+
+func TestOriginTags(t *testing.T) {
+	xr := func(namespace, name string, labels map[string]string) *resource.Composite {
+		c := composite.New()
+		c.SetNamespace(namespace)
+		c.SetName(name)
+		c.SetLabels(labels)
+		return &resource.Composite{Resource: c}
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     *resource.Composite
+		want   map[string]string
+	}{
+		"Namespaced": {
+			reason: "A namespaced XR should be identified by its namespace and name.",
+			xr:     xr("team-a", "app", nil),
+			want:   map[string]string{originTagManagedBy: functionName, originTagComposite: "team-a/app"},
+		},
+		"ClusterScoped": {
+			reason: "A cluster scoped XR should be identified by its name.",
+			xr:     xr("", "app-x7k2p", nil),
+			want:   map[string]string{originTagManagedBy: functionName, originTagComposite: "app-x7k2p"},
+		},
+		"Claimed": {
+			reason: "A claimed XR should also identify its claim.",
+			xr:     xr("", "app-x7k2p", map[string]string{claimNamespaceLabel: "team-a", claimNameLabel: "app"}),
+			want:   map[string]string{originTagManagedBy: functionName, originTagComposite: "app-x7k2p", originTagClaim: "team-a/app"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, originTags(tc.xr)); diff != "" {
+				t.Errorf("%s\noriginTags(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+// composableOutputKey is the pipeline context key holding the discovery
+// results in a shape that later steps can read with plain field paths, e.g.
+// function-patch-and-transform's FromContextFieldPath.
+//
+// The key contains no dots so the paths below can be used verbatim:
+//
+//	usergroupManager.schemaVersion                 string, v1, or v1+gzip if a per-user list is compressed
+//	usergroupManager.userIDs                       []string
+//	usergroupManager.userIDsCSV                    string, comma separated user IDs
+//	usergroupManager.userCount                     number
+//	usergroupManager.users                         []object, in the order of userIDs
+//	usergroupManager.users[].userId                string
+//	usergroupManager.users[].engine                string, only set if known
+//	usergroupManager.users[].authenticationType    string, password, no-password-required or iam, only set if known
+//	usergroupManager.users[].status                string, e.g. active, modifying or deleting, only set if known
+//	usergroupManager.cacheId                       string, only set if configured
+//	usergroupManager.managementMode                string, discover, direct or composed
+//	usergroupManager.serverlessCacheNames          []string, only set if discovered
+//	usergroupManager.serverlessCacheARNs           []string, only set if discovered
+//	usergroupManager.serverlessCacheCount          number, only set if discovered
+//	usergroupManager.userGroups                    []object, only set if configured or grouped per cache
+//	usergroupManager.userGroups[].name             string
+//	usergroupManager.userGroups[].engine           string
+//	usergroupManager.userGroups[].userIDs          []string
+//	usergroupManager.implicitUserGroupUserIDs      []string, the members of the implicit user group composed without
+//	                                               userGroups: the discovered users with exactly one user named
+//	                                               default, only set if user names are known
+//	usergroupManager.iamPrincipals                 []object, only set if resolved
+//	usergroupManager.iamPrincipals[].userId        string
+//	usergroupManager.iamPrincipals[].type          string, role or user
+//	usergroupManager.iamPrincipals[].name          string
+//	usergroupManager.iamPrincipals[].arn           string
+//	usergroupManager.iamPrincipals[].path          string
+//	usergroupManager.iamPrincipals[].tags          object of strings
+//	usergroupManager.identityUsers                 []object, only set if mapped
+//	usergroupManager.identityUsers[].userId        string
+//	usergroupManager.identityUsers[].userName      string
+//	usergroupManager.identityUsers[].engine        string
+//	usergroupManager.identityUsers[].accessString  string
+//	usergroupManager.identityUsers[].ssoGroups     []string
+//	usergroupManager.identityUsers[].userGroups    []string
+//	usergroupManager.identityUsers[].observeOnly   bool
+//	usergroupManager.bundleUsers                   []object, only set if read
+//	usergroupManager.bundleUsers[].userId          string
+//	usergroupManager.bundleUsers[].userName        string
+//	usergroupManager.bundleUsers[].engine          string
+//	usergroupManager.bundleUsers[].accessString    string
+//	usergroupManager.bundleUsers[].userGroups      []string
+//	usergroupManager.bundleUsers[].observeOnly     bool
+//	usergroupManager.regions                       object keyed by region, only set if configured
+//	usergroupManager.regions.<region>.userIDs      []string
+//	usergroupManager.regions.<region>.userCount    number
+//	usergroupManager.<list>Compressed              string, base64 encoded gzipped JSON of users or iamPrincipals,
+//	                                               replacing it if it's too large
+//
+// These paths are a stable contract. Add new fields rather than changing the
+// type or meaning of existing ones.
+const composableOutputKey = "usergroupManager"
+
+// composableOutput holds the discovery results written to
+// composableOutputKey.
+type composableOutput struct {
+	UserIDs []string
+	// Users describes each user in UserIDs.
+	Users   []discovery.User
+	CacheID string
+	// ManagementMode tells later steps whether to compose user groups.
+	ManagementMode string
+	// ServerlessCaches is only rendered if ServerlessDiscovered is true, so
+	// consumers can tell "none found" from "not looked for".
+	ServerlessDiscovered bool
+	ServerlessCaches     []serverlessCache
+	// UserGroups is only rendered if user groups are configured.
+	UserGroups []userGroupMembership
+	// ImplicitUserGroupUserIDs is only rendered if set.
+	ImplicitUserGroupUserIDs []string
+	// IAMPrincipals is only rendered if IAMResolved is true.
+	IAMResolved   bool
+	IAMPrincipals []iamPrincipal
+	// IdentityUsers is only rendered if IdentityMapped is true.
+	IdentityMapped bool
+	IdentityUsers  []managedUser
+	// BundleUsers is only rendered if BundleRead is true.
+	BundleRead  bool
+	BundleUsers []managedUser
+	// Regions is only rendered if regions are configured. Regions that
+	// couldn't be discovered are left out.
+	Regions []discovery.Region
+}
+
+// Context returns the output in a form that can be written to the pipeline
+// context. Lists are never nil so consumers always see an array.
+func (o *composableOutput) Context() map[string]any {
+	ids := make([]any, len(o.UserIDs))
+	for i, id := range o.UserIDs {
+		ids[i] = id
+	}
+
+	out := map[string]any{
+		"schemaVersion": outputSchemaVersion,
+		"userIDs":       ids,
+		"userIDsCSV":    strings.Join(o.UserIDs, ","),
+		"userCount":     len(o.UserIDs),
+		"users":         status.Users(o.Users),
+	}
+	if o.CacheID != "" {
+		out["cacheId"] = o.CacheID
+	}
+	if o.ManagementMode != "" {
+		out["managementMode"] = o.ManagementMode
+	}
+	if o.ServerlessDiscovered {
+		names := make([]any, len(o.ServerlessCaches))
+		arns := make([]any, len(o.ServerlessCaches))
+		for i, c := range o.ServerlessCaches {
+			names[i] = c.Name
+			arns[i] = c.ARN
+		}
+		out["serverlessCacheNames"] = names
+		out["serverlessCacheARNs"] = arns
+		out["serverlessCacheCount"] = len(o.ServerlessCaches)
+	}
+	if len(o.UserGroups) > 0 {
+		out["userGroups"] = userGroupsContext(o.UserGroups)
+	}
+	if o.ImplicitUserGroupUserIDs != nil {
+		ids := make([]any, len(o.ImplicitUserGroupUserIDs))
+		for i, id := range o.ImplicitUserGroupUserIDs {
+			ids[i] = id
+		}
+		out["implicitUserGroupUserIDs"] = ids
+	}
+	if o.IAMResolved {
+		out["iamPrincipals"] = iamPrincipalsContext(o.IAMPrincipals)
+	}
+	if o.IdentityMapped {
+		out["identityUsers"] = managedUsersContext(o.IdentityUsers)
+	}
+	if o.BundleRead {
+		out["bundleUsers"] = managedUsersContext(o.BundleUsers)
+	}
+	if len(o.Regions) > 0 {
+		regions := map[string]any{}
+		for _, rd := range o.Regions {
+			if rd.Err != nil {
+				continue
+			}
+			ids := make([]any, len(rd.UserIDs))
+			for i, id := range rd.UserIDs {
+				ids[i] = id
+			}
+			regions[rd.Region] = map[string]any{"userIDs": ids, "userCount": len(rd.UserIDs)}
+		}
+		out["regions"] = regions
+	}
+	return out
+}
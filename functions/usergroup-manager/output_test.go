@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestComposableOutputContext(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		o      *composableOutput
+		want   map[string]any
+	}{
+		"NoUsers": {
+			reason: "An empty discovery should still render lists rather than omitting them.",
+			o:      &composableOutput{},
+			want: map[string]any{
+				"schemaVersion": outputSchemaVersion,
+				"userIDs":       []any{},
+				"userIDsCSV":    "",
+				"userCount":     0,
+				"users":         []any{},
+			},
+		},
+		"UsersAndServerlessCaches": {
+			reason: "Discovered users and serverless caches should be rendered at their documented paths.",
+			o: &composableOutput{
+				UserIDs: []string{"default", "app1"},
+				Users: []discovery.User{
+					{ID: "default", Engine: engineRedis, AuthenticationType: "no-password-required", Status: "active"},
+					{ID: "app1", Engine: engineRedis, AuthenticationType: authenticationTypeIAM, Status: "modifying"},
+				},
+				CacheID:              "prod-cache",
+				ManagementMode:       managementModeDiscover,
+				ServerlessDiscovered: true,
+				ServerlessCaches: []serverlessCache{
+					{Name: "prod", ARN: "arn:aws:elasticache:us-east-1:123456789012:serverlesscache:prod"},
+				},
+			},
+			want: map[string]any{
+				"schemaVersion": outputSchemaVersion,
+				"userIDs":       []any{"default", "app1"},
+				"userIDsCSV":    "default,app1",
+				"userCount":     2,
+				"users": []any{
+					map[string]any{"userId": "default", "engine": engineRedis, "authenticationType": "no-password-required", "status": "active"},
+					map[string]any{"userId": "app1", "engine": engineRedis, "authenticationType": "iam", "status": "modifying"},
+				},
+				"cacheId":              "prod-cache",
+				"managementMode":       "discover",
+				"serverlessCacheNames": []any{"prod"},
+				"serverlessCacheARNs":  []any{"arn:aws:elasticache:us-east-1:123456789012:serverlesscache:prod"},
+				"serverlessCacheCount": 1,
+			},
+		},
+		"IAMPrincipals": {
+			reason: "Resolved IAM principals should be rendered at their documented paths.",
+			o: &composableOutput{
+				UserIDs:     []string{"app1"},
+				IAMResolved: true,
+				IAMPrincipals: []iamPrincipal{{
+					UserID: "app1",
+					Type:   iamPrincipalRole,
+					Name:   "app1",
+					ARN:    "arn:aws:iam::123456789012:role/teams/payments/app1",
+					Path:   "/teams/payments/",
+					Tags:   map[string]string{"team": "payments"},
+				}},
+			},
+			want: map[string]any{
+				"schemaVersion": outputSchemaVersion,
+				"userIDs":       []any{"app1"},
+				"userIDsCSV":    "app1",
+				"userCount":     1,
+				"users":         []any{},
+				"iamPrincipals": []any{map[string]any{
+					"userId": "app1",
+					"type":   "role",
+					"name":   "app1",
+					"arn":    "arn:aws:iam::123456789012:role/teams/payments/app1",
+					"path":   "/teams/payments/",
+					"tags":   map[string]any{"team": "payments"},
+				}},
+			},
+		},
+		"Regions": {
+			reason: "Each discovered region should be rendered under its name, leaving out regions that failed.",
+			o: &composableOutput{
+				UserIDs: []string{"default", "app1"},
+				Regions: []discovery.Region{
+					{Region: "eu-west-1", UserIDs: []string{"default"}},
+					{Region: "us-west-2", Err: errors.New("boom")},
+					{Region: "us-east-1", UserIDs: []string{"default", "app1"}},
+				},
+			},
+			want: map[string]any{
+				"schemaVersion": outputSchemaVersion,
+				"userIDs":       []any{"default", "app1"},
+				"userIDsCSV":    "default,app1",
+				"userCount":     2,
+				"users":         []any{},
+				"regions": map[string]any{
+					"eu-west-1": map[string]any{"userIDs": []any{"default"}, "userCount": 1},
+					"us-east-1": map[string]any{"userIDs": []any{"default", "app1"}, "userCount": 2},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.o.Context()
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nContext(): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,741 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	gopath "path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/policy"
+)
+
+// defaultRegion is used when the XR doesn't specify one.
+const defaultRegion = "us-east-1"
+
+// parameters are the function's settings, read from the XR's
+// spec.parameters.
+type parameters struct {
+	Region string
+	// Regions are additional regions, e.g. of a Global Datastore, whose users
+	// are discovered and reported alongside those of Region.
+	Regions []string
+	// EndpointURL overrides the endpoint of the ElastiCache client in Region,
+	// e.g. to point it at LocalStack.
+	EndpointURL      string
+	CacheID          string
+	CredentialSource string
+	// DiscoverySource is where users are discovered: the AWS API, or the
+	// User MRs in the cluster.
+	DiscoverySource          string
+	AssumeRole               assumeRoleParameters
+	DiscoverServerlessCaches bool
+	ExportToEnvironment      bool
+	// ResolveIAMPrincipals looks up the IAM role or user of each
+	// IAM-authenticated user.
+	ResolveIAMPrincipals bool
+	CostAllocation       costAllocationParameters
+	Verification         verificationParameters
+
+	// UserGroups are the user groups whose membership is discovered. If none
+	// are configured all discovered users belong to a single, implicit group.
+	UserGroups []userGroupTarget
+
+	// ExclusiveMembership assigns each user to at most one user group. Users
+	// that match several are assigned to the first in UserGroups.
+	ExclusiveMembership bool
+
+	// PerCache maintains a user group per cache, grouping the discovered
+	// users by their cache tag, rather than configured UserGroups.
+	PerCache perCacheParameters
+
+	// IdentityMapping derives ElastiCache users from SSO group membership.
+	IdentityMapping identityMappingParameters
+
+	// UserBundle reads user definitions from a ConfigMap.
+	UserBundle userBundleParameters
+
+	// AdoptionReport periodically reports users that match but aren't
+	// declared.
+	AdoptionReport adoptionReportParameters
+
+	// ObserveOnlyUsers are the IDs of SSO or bundle users that are added to
+	// user groups but never modified or deleted.
+	ObserveOnlyUsers []string
+
+	// DesiredStateExport renders everything the function asks later steps to
+	// compose as canonical YAML, for review.
+	DesiredStateExport desiredStateExportParameters
+
+	// UserExport writes the discovered users in a bulk format for later
+	// steps to compose into a ConfigMap.
+	UserExport userExportParameters
+
+	// StatusSize bounds the size of the XR status.
+	StatusSize statusSizeParameters
+
+	// ContextSize bounds the size of the pipeline context.
+	ContextSize contextSizeParameters
+
+	// UserCountAnomaly flags large drops in the number of discovered users.
+	UserCountAnomaly userCountAnomalyParameters
+
+	// Telemetry controls the metrics recorded for the XR.
+	Telemetry telemetryParameters
+
+	// TagFilter only discovers users with a tag, if the tagFiltering feature
+	// is enabled.
+	TagFilter discovery.TagFilter
+
+	// ExcludeDefaultUser leaves the default user ElastiCache creates in every
+	// account out of the discovered users.
+	ExcludeDefaultUser bool
+
+	// DefaultUserPreference picks the user named default each user group
+	// gets when more than one was discovered: builtIn or replacement.
+	DefaultUserPreference string
+
+	// NameFilter only discovers users whose name or ID follows a naming
+	// convention.
+	NameFilter discovery.NameFilter
+
+	// Engine only discovers users of this engine, if set.
+	Engine string
+
+	// SharedPool publishes common users for other XRs to opt in to.
+	SharedPool sharedPoolParameters
+
+	// SharedPools are the names of the pools whose users are added to every
+	// user group.
+	SharedPools []string
+
+	// ReplicationGroupIDs are the replication groups the user groups will be
+	// associated with, checked for user group support.
+	ReplicationGroupIDs []string
+
+	// DefaultUserReplacement replaces the built-in default user of a user
+	// group with a user named default that can't do anything.
+	DefaultUserReplacement defaultUserReplacementParameters
+
+	// Migration migrates a replication group from AUTH token authentication
+	// to RBAC.
+	Migration migrationParameters
+
+	// ManagementMode selects who changes user group membership.
+	ManagementMode string
+
+	// DryRun plans the function's own AWS writes without making them.
+	DryRun bool
+
+	// ConsistencyWindow is how long after modifying the target user group of
+	// direct mode the function trusts the membership it applied over the one
+	// AWS reports.
+	ConsistencyWindow time.Duration
+
+	// UserGroupInjection attaches a user group to ReplicationGroups and
+	// ServerlessCaches composed by earlier pipeline steps.
+	UserGroupInjection userGroupInjectionParameters
+
+	// Teardown configures what the function does while the XR is being
+	// deleted.
+	Teardown teardownParameters
+
+	// DetectMembershipDrift compares the membership AWS reports for the user
+	// groups with the discovered users, even when it doesn't manage them.
+	DetectMembershipDrift bool
+
+	// ApplyLock serializes modifications of the target user group of direct
+	// mode across function replicas.
+	ApplyLock applyLockParameters
+
+	// Approval holds plans that need too many AWS write calls until they're
+	// approved.
+	Approval policy.Approval
+
+	// TagPolicy checks the tags the function writes against the account's
+	// tag policy.
+	TagPolicy tagPolicyParameters
+
+	// UserGroupID is the user group whose membership is converged on the
+	// discovered users in direct mode, or the name of the implicit user group
+	// in composed mode.
+	UserGroupID string
+
+	// Features enables subsystems that are off by default.
+	Features featureFlags
+
+	// Retry configures how AWS calls and user discovery are retried.
+	Retry retryParameters
+
+	// StatusFields maps output names (e.g. userIDs) to additional XR status
+	// paths (e.g. cache.users) the output should be written to.
+	StatusFields map[string]string
+}
+
+type verificationParameters struct {
+	// Mode is either full, to list every user on each run, or targeted, to
+	// only verify the previously discovered users between full listings.
+	Mode               string
+	FullResyncInterval time.Duration
+}
+
+type costAllocationParameters struct {
+	Enabled          bool
+	TagKey           string
+	IncludeResources bool
+}
+
+// parseParameters reads parameters from the supplied XR object. It never
+// fails outright: values of a convertible type (e.g. a number where a string
+// is expected) are converted, and every value that can't be used is reported
+// in the returned errors and replaced by its default.
+func parseParameters(xr map[string]any) (*parameters, []error) {
+	r := &paramReader{root: xr}
+	p := &parameters{
+		Region:                   r.String("spec.parameters.region", defaultRegion),
+		CacheID:                  r.String("spec.parameters.cacheId", ""),
+		CredentialSource:         r.Enum("spec.parameters.credentialSource", credentialSourceAuto, credentialSourceAuto, credentialSourceIRSA),
+		DiscoverySource:          r.Enum("spec.parameters.discoverySource", discoverySourceAWS, discoverySourceAWS, discoverySourceCluster),
+		DiscoverServerlessCaches: r.Bool("spec.parameters.discoverServerlessCaches", false),
+		ExportToEnvironment:      r.Bool("spec.parameters.exportToEnvironment", false),
+		ResolveIAMPrincipals:     r.Bool("spec.parameters.resolveIAMPrincipals", false),
+		CostAllocation: costAllocationParameters{
+			Enabled:          r.Bool("spec.parameters.costAllocation.enabled", false),
+			TagKey:           r.String("spec.parameters.costAllocation.tagKey", defaultCacheIDTagKey),
+			IncludeResources: r.Bool("spec.parameters.costAllocation.includeResources", false),
+		},
+		Verification: verificationParameters{
+			Mode:               r.Enum("spec.parameters.verification.mode", syncModeFull, syncModeFull, syncModeTargeted),
+			FullResyncInterval: r.Duration("spec.parameters.verification.fullResyncInterval", time.Hour),
+		},
+		ManagementMode:        r.Enum("spec.parameters.managementMode", managementModeDiscover, managementModeDiscover, managementModeDirect, managementModeComposed),
+		DryRun:                r.Bool("spec.parameters.dryRun", false),
+		ConsistencyWindow:     r.Duration("spec.parameters.consistencyWindow", membership.DefaultConsistencyWindow),
+		DetectMembershipDrift: r.Bool("spec.parameters.detectMembershipDrift", false),
+		ExclusiveMembership:   r.Bool("spec.parameters.exclusiveMembership", false),
+		StatusFields:          r.StringMap("spec.parameters.statusFields"),
+	}
+	p.UserGroups = parseUserGroups(r, "spec.parameters.userGroups")
+	p.PerCache = parsePerCache(r, "spec.parameters.perCache")
+	switch {
+	case !p.PerCache.Enabled:
+	case len(p.UserGroups) > 0:
+		r.errs = append(r.errs, errors.New("spec.parameters.perCache: can't be enabled with spec.parameters.userGroups"))
+	case p.ManagementMode == managementModeDirect:
+		r.errs = append(r.errs, errors.New("spec.parameters.perCache: isn't supported in managementMode direct"))
+	}
+	if id := r.String("spec.parameters.userGroupId", ""); id != "" && !validUserGroupID(id) {
+		r.errs = append(r.errs, fmt.Errorf("spec.parameters.userGroupId: %q is not a valid user group ID", id))
+	} else {
+		p.UserGroupID = id
+	}
+	p.Region, p.Regions = parseRegions(r, p.Region)
+	p.AssumeRole = parseAssumeRole(r, p.Region)
+	p.SharedPool, p.SharedPools = parseSharedPools(r)
+	p.ReplicationGroupIDs = r.StringList("spec.parameters.replicationGroupIds")
+	p.DefaultUserReplacement = defaultUserReplacementParameters{
+		UserID:      r.String("spec.parameters.defaultUserReplacement.userId", ""),
+		UserGroupID: r.String("spec.parameters.defaultUserReplacement.userGroupId", p.UserGroupID),
+	}
+	p.Migration = migrationParameters{
+		ReplicationGroupID: r.String("spec.parameters.migration.replicationGroupId", ""),
+		UserGroupID:        r.String("spec.parameters.migration.userGroupId", p.UserGroupID),
+	}
+	p.IdentityMapping = parseIdentityMapping(r, "spec.parameters.identityMapping")
+	p.ObserveOnlyUsers = r.StringList("spec.parameters.observeOnlyUsers")
+	p.AdoptionReport = adoptionReportParameters{
+		Enabled:  r.Bool("spec.parameters.adoptionReport.enabled", false),
+		Interval: r.Duration("spec.parameters.adoptionReport.interval", 24*time.Hour),
+		Notify:   r.Bool("spec.parameters.adoptionReport.notify", false),
+	}
+	p.UserBundle = userBundleParameters{
+		ConfigMapName: r.String("spec.parameters.userBundle.configMapName", ""),
+		Key:           r.String("spec.parameters.userBundle.key", defaultUserBundleDataKey),
+	}
+	p.DesiredStateExport = desiredStateExportParameters{
+		Enabled:       r.Bool("spec.parameters.desiredStateExport.enabled", false),
+		ConfigMapName: r.String("spec.parameters.desiredStateExport.configMapName", ""),
+	}
+	p.UserExport = userExportParameters{
+		Enabled:       r.Bool("spec.parameters.userExport.enabled", false),
+		Format:        r.Enum("spec.parameters.userExport.format", userExportFormatNDJSON, userExportFormatNDJSON, userExportFormatCSV),
+		ConfigMapName: r.String("spec.parameters.userExport.configMapName", ""),
+	}
+	p.StatusSize = statusSizeParameters{
+		MaxUserIDs: r.Int("spec.parameters.statusSize.maxUserIDs", defaultMaxStatusUserIDs),
+	}
+	p.ContextSize = contextSizeParameters{
+		MaxUserIDs:         r.Int("spec.parameters.contextSize.maxUserIDs", defaultMaxContextUserIDs),
+		Overflow:           r.Enum("spec.parameters.contextSize.overflow", contextOverflowChunk, contextOverflowChunk, contextOverflowTruncate),
+		CompressAboveBytes: r.Int("spec.parameters.contextSize.compressAboveBytes", 0),
+	}
+	p.UserGroupInjection = parseUserGroupInjection(r, "spec.parameters.userGroupInjection")
+	p.Teardown = teardownParameters{
+		DrainUserGroup: r.Bool("spec.parameters.teardown.drainUserGroup", false),
+	}
+	p.ApplyLock = applyLockParameters{
+		Enabled: r.Bool("spec.parameters.applyLock.enabled", false),
+		TTL:     r.Duration("spec.parameters.applyLock.ttl", membership.DefaultLockTTL),
+	}
+	p.Approval = policy.Approval{
+		WriteThreshold:   r.Int("spec.parameters.approval.writeThreshold", 0),
+		SecurityRemovals: r.StringList("spec.parameters.approval.securityRemovals"),
+	}
+	p.TagPolicy = tagPolicyParameters{
+		Enabled: r.Bool("spec.parameters.tagPolicy.enabled", false),
+	}
+	p.Retry = retryParameters{
+		MaxAttempts:       r.Int("spec.parameters.retry.maxAttempts", retry.DefaultMaxAttempts),
+		MaxBackoff:        r.Duration("spec.parameters.retry.maxBackoff", retry.DefaultMaxBackoff),
+		DiscoveryAttempts: r.Int("spec.parameters.retry.discoveryAttempts", defaultDiscoveryAttempts),
+	}
+	p.UserCountAnomaly = userCountAnomalyParameters{
+		DropThreshold: r.Fraction("spec.parameters.userCountAnomaly.dropThreshold", defaultUserCountDropThreshold),
+	}
+	p.Telemetry = telemetryParameters{
+		Enabled:    r.Bool("spec.parameters.telemetry.enabled", true),
+		SampleRate: r.Fraction("spec.parameters.telemetry.sampleRate", -1),
+		HashNames:  r.Bool("spec.parameters.telemetry.hashNames", false),
+	}
+	p.EndpointURL = parseEndpointURL(r, "spec.parameters.endpointURL")
+	p.Features = parseFeatures(r, "spec.parameters.features")
+	p.ExcludeDefaultUser = r.Bool("spec.parameters.excludeDefaultUser", true)
+	p.DefaultUserPreference = r.Enum("spec.parameters.defaultUser.prefer", defaultUserPreferBuiltIn, defaultUserPreferBuiltIn, defaultUserPreferReplacement)
+	p.Engine = r.Enum("spec.parameters.engine", "", "", engineRedis, engineValkey)
+	p.NameFilter = discovery.NameFilter{
+		Prefix: r.String("spec.parameters.userNamePrefix", ""),
+		Regex:  r.Regexp("spec.parameters.userNameRegex"),
+	}
+	p.TagFilter = discovery.TagFilter{
+		Key:   r.String("spec.parameters.tagFilter.key", defaultCacheIDTagKey),
+		Value: r.String("spec.parameters.tagFilter.value", p.CacheID),
+	}
+	return p, r.errs
+}
+
+// parseEndpointURL reads the endpoint URL at path. A URL that isn't absolute
+// is reported and ignored, so the SDK's default endpoint is used.
+func parseEndpointURL(r *paramReader, path string) string {
+	u := r.String(path, "")
+	if u != "" && !absoluteURL(u) {
+		r.errs = append(r.errs, fmt.Errorf("%s: must be an absolute URL such as http://localhost:4566, got %q", path, u))
+		return ""
+	}
+	return u
+}
+
+// parseFeatures reads the feature flags at path. Flags this version of the
+// function doesn't know are reported and ignored, so a typo or a flag from a
+// newer version doesn't silently leave a feature off.
+func parseFeatures(r *paramReader, path string) featureFlags {
+	v, ok := r.lookup(path)
+	if !ok {
+		return nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		r.errs = append(r.errs, fmt.Errorf("%s: expected an object, got %T", path, v))
+		return nil
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var f featureFlags
+	for _, name := range names {
+		if !slices.Contains(knownFeatures, name) {
+			r.errs = append(r.errs, fmt.Errorf("%s.%s: unknown feature flag, must be one of %s", path, name, strings.Join(knownFeatures, ", ")))
+			continue
+		}
+		if r.Bool(path+"."+name, false) {
+			if f == nil {
+				f = featureFlags{}
+			}
+			f[name] = true
+		}
+	}
+	return f
+}
+
+// parseIdentityMapping reads the identity mapping at path. Roles without an
+// SSO group or access, or with an unknown access template, are reported and
+// skipped.
+func parseIdentityMapping(r *paramReader, path string) identityMappingParameters {
+	p := identityMappingParameters{
+		ConfigMapName: r.String(path+".configMapName", ""),
+		Key:           r.String(path+".key", defaultIdentitySourceDataKey),
+		Format:        r.Enum(path+".format", identityFormatGroups, identityFormatGroups, identityFormatSCIM),
+	}
+	for i := range r.Len(path + ".roles") {
+		rp := fmt.Sprintf("%s.roles[%d]", path, i)
+		role := identityRole{
+			SSOGroup:     r.String(rp+".ssoGroup", ""),
+			AccessString: r.String(rp+".accessString", ""),
+			UserGroups:   r.StringList(rp + ".userGroups"),
+		}
+		auth, authErr := parseAuthentication(r, rp+".authentication")
+		if ref := r.String(rp+".accessTemplate", ""); ref != "" {
+			if role.AccessString != "" {
+				r.errs = append(r.errs, fmt.Errorf("%s: accessString and accessTemplate are mutually exclusive", rp))
+				continue
+			}
+			t, err := resolveAccessTemplate(ref)
+			if err == nil {
+				err = t.CheckAuthentication(auth)
+			}
+			if err != nil {
+				r.errs = append(r.errs, fmt.Errorf("%s.accessTemplate: %w", rp, err))
+				continue
+			}
+			role.AccessString, role.AccessTemplate = t.AccessString, t.Ref()
+		}
+		if role.SSOGroup == "" || role.AccessString == "" {
+			r.errs = append(r.errs, fmt.Errorf("%s: ssoGroup and accessString or accessTemplate are required", rp))
+			continue
+		}
+		if authErr != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s: %w", rp, authErr))
+			continue
+		}
+		role.Authentication = auth
+		p.Roles = append(p.Roles, role)
+	}
+	return p
+}
+
+// parsePerCache reads the per-cache grouping at path. A name template that
+// doesn't contain the cache ID placeholder is reported, since it would give
+// every cache the same user group.
+func parsePerCache(r *paramReader, path string) perCacheParameters {
+	p := perCacheParameters{
+		Enabled:      r.Bool(path+".enabled", false),
+		TagKey:       r.String(path+".tagKey", defaultCacheIDTagKey),
+		NameTemplate: r.String(path+".nameTemplate", defaultPerCacheNameTemplate),
+		Engine:       r.Enum(path+".engine", engineRedis, engineRedis, engineValkey),
+	}
+	if !strings.Contains(p.NameTemplate, cacheIDPlaceholder) {
+		r.errs = append(r.errs, fmt.Errorf("%s.nameTemplate: %q must contain %s", path, p.NameTemplate, cacheIDPlaceholder))
+		p.NameTemplate = defaultPerCacheNameTemplate
+	}
+	return p
+}
+
+// parseUserGroups reads the list of user group targets at path. Groups
+// without a valid, unique name are reported and skipped.
+func parseUserGroups(r *paramReader, path string) []userGroupTarget {
+	n := r.Len(path)
+	if n == 0 {
+		return nil
+	}
+
+	groups := make([]userGroupTarget, 0, n)
+	seen := map[string]bool{}
+	for i := range n {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		name := r.String(p+".name", "")
+		switch {
+		case name == "":
+			r.errs = append(r.errs, fmt.Errorf("%s.name: is required", p))
+			continue
+		case !validUserGroupID(name):
+			r.errs = append(r.errs, fmt.Errorf("%s.name: %q is not a valid user group ID", p, name))
+			continue
+		case seen[name]:
+			r.errs = append(r.errs, fmt.Errorf("%s.name: duplicate user group %q", p, name))
+			continue
+		}
+		seen[name] = true
+
+		groups = append(groups, userGroupTarget{
+			Name:   name,
+			Engine: r.Enum(p+".engine", engineRedis, engineRedis, engineValkey),
+			Filter: userFilter{
+				UserIDs:         r.StringList(p + ".filter.userIds"),
+				UserIDPattern:   r.Pattern(p + ".filter.userIdPattern"),
+				UserNamePattern: r.Pattern(p + ".filter.userNamePattern"),
+			},
+		})
+	}
+	return groups
+}
+
+// A paramReader reads typed values at dotted paths of an unstructured object,
+// recording a per-field error for each value it can't use.
+type paramReader struct {
+	root map[string]any
+	errs []error
+
+	// badParents records parent paths already reported as not being objects,
+	// so each is only reported once.
+	badParents map[string]bool
+}
+
+// lookup returns the value at path. A missing value, including one whose
+// parent objects are missing, is reported as not found rather than an error.
+// Path segments may index a list, e.g. userGroups[0].name. Callers should check
+// the list with Len first; lookup doesn't report values that aren't lists.
+func (r *paramReader) lookup(path string) (any, bool) {
+	var cur any = r.root
+	segs := strings.Split(path, ".")
+	for i, seg := range segs {
+		seg, idx := splitIndex(seg)
+		m, ok := cur.(map[string]any)
+		if !ok {
+			parent := strings.Join(segs[:i], ".")
+			if cur != nil && !r.badParents[parent] {
+				if r.badParents == nil {
+					r.badParents = map[string]bool{}
+				}
+				r.badParents[parent] = true
+				r.errs = append(r.errs, fmt.Errorf("%s: expected an object, got %T", parent, cur))
+			}
+			return nil, false
+		}
+		if cur, ok = m[seg]; !ok {
+			return nil, false
+		}
+		if idx < 0 {
+			continue
+		}
+		l, ok := cur.([]any)
+		if !ok || idx >= len(l) {
+			return nil, false
+		}
+		cur = l[idx]
+	}
+	return cur, cur != nil
+}
+
+// splitIndex splits a path segment such as userGroups[2] into its field name
+// and list index. The index is -1 if the segment doesn't index a list.
+func splitIndex(seg string) (string, int) {
+	open := strings.IndexByte(seg, '[')
+	if open < 0 || !strings.HasSuffix(seg, "]") {
+		return seg, -1
+	}
+	idx, err := strconv.Atoi(seg[open+1 : len(seg)-1])
+	if err != nil || idx < 0 {
+		return seg, -1
+	}
+	return seg[:open], idx
+}
+
+// Len returns the length of the list at path, or zero if there is no list.
+func (r *paramReader) Len(path string) int {
+	v, ok := r.lookup(path)
+	if !ok {
+		return 0
+	}
+	l, ok := v.([]any)
+	if !ok {
+		r.errs = append(r.errs, fmt.Errorf("%s: expected a list, got %T", path, v))
+		return 0
+	}
+	return len(l)
+}
+
+// String returns the string at path. Numbers and booleans are converted to
+// their string form.
+func (r *paramReader) String(path, def string) string {
+	v, ok := r.lookup(path)
+	if !ok {
+		return def
+	}
+	switch t := v.(type) {
+	case string:
+		if t == "" {
+			return def
+		}
+		return t
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	r.errs = append(r.errs, fmt.Errorf("%s: expected a string, got %T", path, v))
+	return def
+}
+
+// Bool returns the boolean at path. Strings such as "true" and "false" are
+// parsed.
+func (r *paramReader) Bool(path string, def bool) bool {
+	v, ok := r.lookup(path)
+	if !ok {
+		return def
+	}
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(t))
+		if err == nil {
+			return b
+		}
+		r.errs = append(r.errs, fmt.Errorf("%s: expected a boolean, got %q", path, t))
+		return def
+	}
+	r.errs = append(r.errs, fmt.Errorf("%s: expected a boolean, got %T", path, v))
+	return def
+}
+
+// StringMap returns the object of strings at path. Entries whose values can't
+// be converted to strings are reported and omitted.
+func (r *paramReader) StringMap(path string) map[string]string {
+	v, ok := r.lookup(path)
+	if !ok {
+		return nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		r.errs = append(r.errs, fmt.Errorf("%s: expected an object, got %T", path, v))
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k := range m {
+		if s := r.String(path+"."+k, ""); s != "" {
+			out[k] = s
+		}
+	}
+	return out
+}
+
+// StringList returns the list of strings at path. Elements that can't be
+// converted to strings are reported and omitted.
+func (r *paramReader) StringList(path string) []string {
+	n := r.Len(path)
+	if n == 0 {
+		return nil
+	}
+	out := make([]string, 0, n)
+	for i := range n {
+		if s := r.String(fmt.Sprintf("%s[%d]", path, i), ""); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Pattern returns the glob pattern at path, e.g. app-*. Patterns path.Match
+// can't parse are reported and ignored.
+func (r *paramReader) Pattern(path string) string {
+	s := r.String(path, "")
+	if _, err := gopath.Match(s, ""); err != nil {
+		r.errs = append(r.errs, fmt.Errorf("%s: invalid pattern %q: %w", path, s, err))
+		return ""
+	}
+	return s
+}
+
+// Regexp returns the regular expression at path, or nil if there's none.
+// Expressions that don't compile are reported and ignored.
+func (r *paramReader) Regexp(path string) *regexp.Regexp {
+	s := r.String(path, "")
+	if s == "" {
+		return nil
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		r.errs = append(r.errs, fmt.Errorf("%s: invalid regular expression %q: %w", path, s, err))
+		return nil
+	}
+	return re
+}
+
+// Int returns the non-negative integer at path. Integral floats and strings
+// are converted.
+func (r *paramReader) Int(path string, def int) int {
+	v, ok := r.lookup(path)
+	if !ok {
+		return def
+	}
+	var n int64
+	switch t := v.(type) {
+	case int64:
+		n = t
+	case float64:
+		if t != float64(int64(t)) {
+			r.errs = append(r.errs, fmt.Errorf("%s: expected a non-negative integer, got %v", path, t))
+			return def
+		}
+		n = int64(t)
+	case string:
+		var err error
+		if n, err = strconv.ParseInt(strings.TrimSpace(t), 10, 64); err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s: expected a non-negative integer, got %q", path, t))
+			return def
+		}
+	default:
+		r.errs = append(r.errs, fmt.Errorf("%s: expected a non-negative integer, got %T", path, v))
+		return def
+	}
+	if n < 0 {
+		r.errs = append(r.errs, fmt.Errorf("%s: expected a non-negative integer, got %d", path, n))
+		return def
+	}
+	return int(n)
+}
+
+// Fraction returns the number between zero and one at path, e.g. 0.25.
+func (r *paramReader) Fraction(path string, def float64) float64 {
+	v, ok := r.lookup(path)
+	if !ok {
+		return def
+	}
+	var f float64
+	switch t := v.(type) {
+	case float64:
+		f = t
+	case int64:
+		f = float64(t)
+	case string:
+		var err error
+		if f, err = strconv.ParseFloat(strings.TrimSpace(t), 64); err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s: expected a number between 0 and 1, got %q", path, t))
+			return def
+		}
+	default:
+		r.errs = append(r.errs, fmt.Errorf("%s: expected a number between 0 and 1, got %T", path, v))
+		return def
+	}
+	if f < 0 || f > 1 {
+		r.errs = append(r.errs, fmt.Errorf("%s: expected a number between 0 and 1, got %v", path, f))
+		return def
+	}
+	return f
+}
+
+// Enum returns the string at path, which must be one of the allowed values.
+func (r *paramReader) Enum(path, def string, allowed ...string) string {
+	s := r.String(path, def)
+	if slices.Contains(allowed, s) {
+		return s
+	}
+	r.errs = append(r.errs, fmt.Errorf("%s: must be one of %s, got %q", path, strings.Join(allowed, ", "), s))
+	return def
+}
+
+// Duration returns the duration at path, e.g. 30m or 1h.
+func (r *paramReader) Duration(path string, def time.Duration) time.Duration {
+	s := r.String(path, "")
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		r.errs = append(r.errs, fmt.Errorf("%s: expected a positive duration such as 30m, got %q", path, s))
+		return def
+	}
+	return d
+}
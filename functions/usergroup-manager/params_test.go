@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+)
+
+func TestParseParameters(t *testing.T) {
+	type want struct {
+		p    *parameters
+		errs []string
+	}
+
+	defaults := &parameters{
+		Region:                defaultRegion,
+		CredentialSource:      credentialSourceAuto,
+		DefaultUserPreference: defaultUserPreferBuiltIn,
+		PerCache:              perCacheParameters{TagKey: defaultCacheIDTagKey, NameTemplate: defaultPerCacheNameTemplate, Engine: engineRedis},
+		ExcludeDefaultUser:    true,
+		UserExport:            userExportParameters{Format: userExportFormatNDJSON},
+		Retry:                 retryParameters{MaxAttempts: retry.DefaultMaxAttempts, MaxBackoff: retry.DefaultMaxBackoff, DiscoveryAttempts: defaultDiscoveryAttempts},
+		DiscoverySource:       discoverySourceAWS,
+		CostAllocation:        costAllocationParameters{TagKey: defaultCacheIDTagKey},
+		Verification:          verificationParameters{Mode: syncModeFull, FullResyncInterval: time.Hour},
+		IdentityMapping:       identityMappingParameters{Key: defaultIdentitySourceDataKey, Format: identityFormatGroups},
+		UserBundle:            userBundleParameters{Key: defaultUserBundleDataKey},
+		AdoptionReport:        adoptionReportParameters{Interval: 24 * time.Hour},
+		StatusSize:            statusSizeParameters{MaxUserIDs: defaultMaxStatusUserIDs},
+		ContextSize:           contextSizeParameters{MaxUserIDs: defaultMaxContextUserIDs, Overflow: contextOverflowChunk},
+		UserCountAnomaly:      userCountAnomalyParameters{DropThreshold: defaultUserCountDropThreshold},
+		Telemetry:             telemetryParameters{Enabled: true, SampleRate: -1},
+		TagFilter:             discovery.TagFilter{Key: defaultCacheIDTagKey},
+		ManagementMode:        managementModeDiscover,
+		ConsistencyWindow:     membership.DefaultConsistencyWindow,
+		ApplyLock:             applyLockParameters{TTL: membership.DefaultLockTTL},
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     string
+		want   want
+	}{
+		"NoSpec": {
+			reason: "Missing intermediate objects should produce defaults without errors.",
+			xr:     `{"apiVersion":"customer.upbound.io/v1alpha1","kind":"XCacheInfra"}`,
+			want:   want{p: defaults},
+		},
+		"ConvertibleTypes": {
+			reason: "Numbers and booleans where strings are expected, and strings where booleans are expected, should be converted.",
+			xr: `{"spec":{"parameters":{
+				"region": "eu-west-1",
+				"cacheId": 42,
+				"exportToEnvironment": "true",
+				"observeOnlyUsers": ["app1", 2],
+				"costAllocation": {"enabled": " TRUE ", "tagKey": false},
+				"telemetry": {"enabled": "false", "sampleRate": "0.5"},
+				"statusSize": {"maxUserIDs": "50"}
+			}}}`,
+			want: want{p: &parameters{
+				Region:                "eu-west-1",
+				CredentialSource:      credentialSourceAuto,
+				DefaultUserPreference: defaultUserPreferBuiltIn,
+				PerCache:              perCacheParameters{TagKey: defaultCacheIDTagKey, NameTemplate: defaultPerCacheNameTemplate, Engine: engineRedis},
+				ExcludeDefaultUser:    true,
+				UserExport:            userExportParameters{Format: userExportFormatNDJSON},
+				Retry:                 retryParameters{MaxAttempts: retry.DefaultMaxAttempts, MaxBackoff: retry.DefaultMaxBackoff, DiscoveryAttempts: defaultDiscoveryAttempts},
+				DiscoverySource:       discoverySourceAWS,
+				CacheID:               "42",
+				ExportToEnvironment:   true,
+				ObserveOnlyUsers:      []string{"app1", "2"},
+				CostAllocation:        costAllocationParameters{Enabled: true, TagKey: "false"},
+				Verification:          verificationParameters{Mode: syncModeFull, FullResyncInterval: time.Hour},
+				IdentityMapping:       identityMappingParameters{Key: defaultIdentitySourceDataKey, Format: identityFormatGroups},
+				UserBundle:            userBundleParameters{Key: defaultUserBundleDataKey},
+				AdoptionReport:        adoptionReportParameters{Interval: 24 * time.Hour},
+				StatusSize:            statusSizeParameters{MaxUserIDs: 50},
+				ContextSize:           contextSizeParameters{MaxUserIDs: defaultMaxContextUserIDs, Overflow: contextOverflowChunk},
+				UserCountAnomaly:      userCountAnomalyParameters{DropThreshold: defaultUserCountDropThreshold},
+				Telemetry:             telemetryParameters{Enabled: false, SampleRate: 0.5},
+				TagFilter:             discovery.TagFilter{Key: defaultCacheIDTagKey, Value: "42"},
+				ManagementMode:        managementModeDiscover,
+				ConsistencyWindow:     membership.DefaultConsistencyWindow,
+				ApplyLock:             applyLockParameters{TTL: membership.DefaultLockTTL},
+			}},
+		},
+		"WrongTypes": {
+			reason: "Values that can't be converted should be reported per field and replaced by defaults.",
+			xr: `{"spec":{"parameters":{
+				"region": ["us-east-1"],
+				"discoverServerlessCaches": "sometimes",
+				"costAllocation": "yes",
+				"verification": {"mode": "sometimes", "fullResyncInterval": "soon"},
+				"telemetry": {"sampleRate": 1.5},
+				"statusSize": {"maxUserIDs": 1.5},
+				"userNameRegex": "app-(",
+				"endpointURL": "localhost:4566",
+				"perCache": {"nameTemplate": "users"}
+			}}}`,
+			want: want{
+				p: defaults,
+				errs: []string{
+					"spec.parameters.region: expected a string, got []interface {}",
+					`spec.parameters.discoverServerlessCaches: expected a boolean, got "sometimes"`,
+					"spec.parameters.costAllocation: expected an object, got string",
+					`spec.parameters.verification.mode: must be one of full, targeted, got "sometimes"`,
+					`spec.parameters.verification.fullResyncInterval: expected a positive duration such as 30m, got "soon"`,
+					`spec.parameters.perCache.nameTemplate: "users" must contain {cacheId}`,
+					"spec.parameters.statusSize.maxUserIDs: expected a non-negative integer, got 1.5",
+					"spec.parameters.telemetry.sampleRate: expected a number between 0 and 1, got 1.5",
+					`spec.parameters.endpointURL: must be an absolute URL such as http://localhost:4566, got "localhost:4566"`,
+					"spec.parameters.userNameRegex: invalid regular expression \"app-(\": error parsing regexp: missing closing ): `app-(`",
+				},
+			},
+		},
+		"UserGroups": {
+			reason: "Valid user groups should be read in order, and invalid ones reported and skipped.",
+			xr: `{"spec":{"parameters":{"userGroups":[
+				{"name": "app", "filter": {"userIds": ["default", 7], "userIdPattern": "app-*"}},
+				{"name": "ops", "engine": "valkey", "filter": {"userNamePattern": "ops-*"}},
+				{"engine": "redis"},
+				{"name": "app"},
+				{"name": "-bad"},
+				{"name": "analytics", "engine": "memcached", "filter": {"userIdPattern": "[", "userIds": "all"}}
+			]}}}`,
+			want: want{
+				p: &parameters{
+					Region:                defaultRegion,
+					CredentialSource:      credentialSourceAuto,
+					DefaultUserPreference: defaultUserPreferBuiltIn,
+					PerCache:              perCacheParameters{TagKey: defaultCacheIDTagKey, NameTemplate: defaultPerCacheNameTemplate, Engine: engineRedis},
+					ExcludeDefaultUser:    true,
+					UserExport:            userExportParameters{Format: userExportFormatNDJSON},
+					Retry:                 retryParameters{MaxAttempts: retry.DefaultMaxAttempts, MaxBackoff: retry.DefaultMaxBackoff, DiscoveryAttempts: defaultDiscoveryAttempts},
+					DiscoverySource:       discoverySourceAWS,
+					CostAllocation:        costAllocationParameters{TagKey: defaultCacheIDTagKey},
+					Verification:          verificationParameters{Mode: syncModeFull, FullResyncInterval: time.Hour},
+					IdentityMapping:       identityMappingParameters{Key: defaultIdentitySourceDataKey, Format: identityFormatGroups},
+					UserBundle:            userBundleParameters{Key: defaultUserBundleDataKey},
+					AdoptionReport:        adoptionReportParameters{Interval: 24 * time.Hour},
+					StatusSize:            statusSizeParameters{MaxUserIDs: defaultMaxStatusUserIDs},
+					ContextSize:           contextSizeParameters{MaxUserIDs: defaultMaxContextUserIDs, Overflow: contextOverflowChunk},
+					UserCountAnomaly:      userCountAnomalyParameters{DropThreshold: defaultUserCountDropThreshold},
+					Telemetry:             telemetryParameters{Enabled: true, SampleRate: -1},
+					TagFilter:             discovery.TagFilter{Key: defaultCacheIDTagKey},
+					ManagementMode:        managementModeDiscover,
+					ConsistencyWindow:     membership.DefaultConsistencyWindow,
+					ApplyLock:             applyLockParameters{TTL: membership.DefaultLockTTL},
+					UserGroups: []userGroupTarget{
+						{Name: "app", Engine: engineRedis, Filter: userFilter{UserIDs: []string{"default", "7"}, UserIDPattern: "app-*"}},
+						{Name: "ops", Engine: engineValkey, Filter: userFilter{UserNamePattern: "ops-*"}},
+						{Name: "analytics", Engine: engineRedis},
+					},
+				},
+				errs: []string{
+					"spec.parameters.userGroups[2].name: is required",
+					`spec.parameters.userGroups[3].name: duplicate user group "app"`,
+					`spec.parameters.userGroups[4].name: "-bad" is not a valid user group ID`,
+					`spec.parameters.userGroups[5].engine: must be one of redis, valkey, got "memcached"`,
+					"spec.parameters.userGroups[5].filter.userIds: expected a list, got string",
+					`spec.parameters.userGroups[5].filter.userIdPattern: invalid pattern "[": syntax error in pattern`,
+				},
+			},
+		},
+		"Features": {
+			reason: "Known feature flags should be read, and unknown ones reported and ignored.",
+			xr: `{"spec":{"parameters":{"features":{
+				"tagFiltering": true,
+				"applyMode": "true",
+				"rotation": false,
+				"gc": "maybe",
+				"tagfiltering": true
+			}}}}`,
+			want: want{
+				p: &parameters{
+					Region:                defaultRegion,
+					CredentialSource:      credentialSourceAuto,
+					DefaultUserPreference: defaultUserPreferBuiltIn,
+					PerCache:              perCacheParameters{TagKey: defaultCacheIDTagKey, NameTemplate: defaultPerCacheNameTemplate, Engine: engineRedis},
+					ExcludeDefaultUser:    true,
+					UserExport:            userExportParameters{Format: userExportFormatNDJSON},
+					Retry:                 retryParameters{MaxAttempts: retry.DefaultMaxAttempts, MaxBackoff: retry.DefaultMaxBackoff, DiscoveryAttempts: defaultDiscoveryAttempts},
+					DiscoverySource:       discoverySourceAWS,
+					CostAllocation:        costAllocationParameters{TagKey: defaultCacheIDTagKey},
+					Verification:          verificationParameters{Mode: syncModeFull, FullResyncInterval: time.Hour},
+					IdentityMapping:       identityMappingParameters{Key: defaultIdentitySourceDataKey, Format: identityFormatGroups},
+					UserBundle:            userBundleParameters{Key: defaultUserBundleDataKey},
+					AdoptionReport:        adoptionReportParameters{Interval: 24 * time.Hour},
+					StatusSize:            statusSizeParameters{MaxUserIDs: defaultMaxStatusUserIDs},
+					ContextSize:           contextSizeParameters{MaxUserIDs: defaultMaxContextUserIDs, Overflow: contextOverflowChunk},
+					UserCountAnomaly:      userCountAnomalyParameters{DropThreshold: defaultUserCountDropThreshold},
+					Telemetry:             telemetryParameters{Enabled: true, SampleRate: -1},
+					TagFilter:             discovery.TagFilter{Key: defaultCacheIDTagKey},
+					ManagementMode:        managementModeDiscover,
+					ConsistencyWindow:     membership.DefaultConsistencyWindow,
+					ApplyLock:             applyLockParameters{TTL: membership.DefaultLockTTL},
+					Features:              featureFlags{featureTagFiltering: true, featureApplyMode: true},
+				},
+				errs: []string{
+					`spec.parameters.features.gc: expected a boolean, got "maybe"`,
+					"spec.parameters.features.tagfiltering: unknown feature flag, must be one of tagFiltering, applyMode, rotation, notifications, gc",
+				},
+			},
+		},
+		"IdentityMapping": {
+			reason: "Identity mapping roles should be read in order, and incomplete ones, or ones that don't say how members authenticate, reported and skipped.",
+			xr: `{"spec":{"parameters":{"identityMapping":{
+				"configMapName": "sso-groups",
+				"format": "scim",
+				"roles": [
+					{"ssoGroup": "payments-eng", "accessString": "on ~payments:* +@all", "userGroups": ["app"], "authentication": {"type": "password", "passwordSecretRef": {"name": "payments-eng", "key": "password"}}},
+					{"ssoGroup": "sre"},
+					{"ssoGroup": "payments-ops", "accessString": "on ~payments:* +@all"},
+					{"ssoGroup": "payments-bi", "accessString": "on ~payments:* +@read", "authentication": {"type": "password"}},
+					{"ssoGroup": "payments-oncall", "accessTemplate": "admin-break-glass"}
+				]
+			}}}}`,
+			want: want{
+				p: &parameters{
+					Region:                defaultRegion,
+					CredentialSource:      credentialSourceAuto,
+					DefaultUserPreference: defaultUserPreferBuiltIn,
+					PerCache:              perCacheParameters{TagKey: defaultCacheIDTagKey, NameTemplate: defaultPerCacheNameTemplate, Engine: engineRedis},
+					ExcludeDefaultUser:    true,
+					UserExport:            userExportParameters{Format: userExportFormatNDJSON},
+					Retry:                 retryParameters{MaxAttempts: retry.DefaultMaxAttempts, MaxBackoff: retry.DefaultMaxBackoff, DiscoveryAttempts: defaultDiscoveryAttempts},
+					DiscoverySource:       discoverySourceAWS,
+					CostAllocation:        costAllocationParameters{TagKey: defaultCacheIDTagKey},
+					Verification:          verificationParameters{Mode: syncModeFull, FullResyncInterval: time.Hour},
+					IdentityMapping: identityMappingParameters{
+						ConfigMapName: "sso-groups",
+						Key:           defaultIdentitySourceDataKey,
+						Format:        identityFormatSCIM,
+						Roles: []identityRole{
+							{
+								SSOGroup:       "payments-eng",
+								AccessString:   "on ~payments:* +@all",
+								UserGroups:     []string{"app"},
+								Authentication: userAuthentication{Type: authenticationPassword, PasswordSecretRef: &secretKeyRef{Name: "payments-eng", Key: "password"}},
+							},
+						},
+					},
+					UserBundle:        userBundleParameters{Key: defaultUserBundleDataKey},
+					AdoptionReport:    adoptionReportParameters{Interval: 24 * time.Hour},
+					StatusSize:        statusSizeParameters{MaxUserIDs: defaultMaxStatusUserIDs},
+					ContextSize:       contextSizeParameters{MaxUserIDs: defaultMaxContextUserIDs, Overflow: contextOverflowChunk},
+					UserCountAnomaly:  userCountAnomalyParameters{DropThreshold: defaultUserCountDropThreshold},
+					Telemetry:         telemetryParameters{Enabled: true, SampleRate: -1},
+					TagFilter:         discovery.TagFilter{Key: defaultCacheIDTagKey},
+					ManagementMode:    managementModeDiscover,
+					ConsistencyWindow: membership.DefaultConsistencyWindow,
+					ApplyLock:         applyLockParameters{TTL: membership.DefaultLockTTL},
+				},
+				errs: []string{
+					"spec.parameters.identityMapping.roles[1]: ssoGroup and accessString or accessTemplate are required",
+					"spec.parameters.identityMapping.roles[2]: authentication.type is required, one of iam, password",
+					"spec.parameters.identityMapping.roles[3]: authentication.passwordSecretRef.name and key are required with password authentication",
+					`spec.parameters.identityMapping.roles[4].accessTemplate: access template "admin-break-glass@v1" grants +@all, so it requires iam or password authentication`,
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			xr := map[string]any{}
+			if err := json.Unmarshal([]byte(tc.xr), &xr); err != nil {
+				t.Fatal(err)
+			}
+
+			p, errs := parseParameters(xr)
+			got := make([]string, 0, len(errs))
+			for _, err := range errs {
+				got = append(got, err.Error())
+			}
+
+			if diff := cmp.Diff(tc.want.p, p); diff != "" {
+				t.Errorf("%s\nparseParameters(...): -want parameters, +got parameters:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.errs, got, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\nparseParameters(...): -want errors, +got errors:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func FuzzParseParameters(f *testing.F) {
+	f.Add(`{"spec":{"parameters":{"region":"us-east-2","cacheId":"prod-cache"}}}`)
+	f.Add(`{"spec":{"parameters":{"costAllocation":{"enabled":1}}}}`)
+	f.Add(`{"spec":"parameters"}`)
+	f.Add(`{"spec":{"parameters":null}}`)
+	f.Add(`{"spec":{"parameters":{"userGroups":[{"name":"app","filter":{"userIds":["a"]}}]}}}`)
+
+	f.Fuzz(func(t *testing.T, in string) {
+		xr := map[string]any{}
+		if err := json.Unmarshal([]byte(in), &xr); err != nil {
+			t.Skip()
+		}
+		p, _ := parseParameters(xr)
+		if p.Region == "" {
+			t.Errorf("parseParameters(%q): region must never be empty", in)
+		}
+	})
+}
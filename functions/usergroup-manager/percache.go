@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// cacheIDPlaceholder is replaced with a cache's ID in per-cache user group
+// name templates.
+const cacheIDPlaceholder = "{cacheId}"
+
+// defaultPerCacheNameTemplate names the user group of each cache by default.
+const defaultPerCacheNameTemplate = cacheIDPlaceholder + "-users"
+
+// perCacheParameters group the discovered users by the cache they're tagged
+// with, maintaining one user group per cache rather than one per XR.
+type perCacheParameters struct {
+	Enabled bool
+	// TagKey is the tag whose value identifies a user's cache.
+	TagKey string
+	// NameTemplate names each cache's user group. It must contain
+	// cacheIDPlaceholder.
+	NameTemplate string
+	Engine       string
+}
+
+// UserGroupName returns the name of the user group of the supplied cache.
+func (p perCacheParameters) UserGroupName(cacheID string) string {
+	return strings.ReplaceAll(p.NameTemplate, cacheIDPlaceholder, cacheID)
+}
+
+// groupUsersByCache returns a user group for each cache the users are tagged
+// with, sorted by name. cacheIDs holds the cache of each tagged user, keyed by
+// user ID. Untagged users named default are added to every user group, since
+// ElastiCache requires one in each. Other untagged users, and users of an
+// engine the user groups don't accept, are returned separately. So are the
+// caches whose user group name wouldn't be a valid user group ID.
+func groupUsersByCache(users []discovery.User, cacheIDs map[string]string, p perCacheParameters) (groups []userGroupMembership, ungrouped, invalid []string) {
+	target := userGroupTarget{Engine: p.Engine}
+	members := map[string][]string{}
+	var defaults []string
+	for _, u := range users {
+		cacheID, ok := cacheIDs[u.ID]
+		switch {
+		case !target.Accepts(u.Engine):
+			ungrouped = append(ungrouped, u.ID)
+		case ok:
+			members[cacheID] = append(members[cacheID], u.ID)
+		case u.Name == discovery.DefaultUserName:
+			defaults = append(defaults, u.ID)
+		default:
+			ungrouped = append(ungrouped, u.ID)
+		}
+	}
+
+	for cacheID, ids := range members {
+		name := p.UserGroupName(cacheID)
+		if !validUserGroupID(name) {
+			invalid = append(invalid, cacheID)
+			continue
+		}
+		groups = append(groups, userGroupMembership{Name: name, Engine: p.Engine, UserIDs: append(ids, defaults...)})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	sort.Strings(invalid)
+	return groups, ungrouped, invalid
+}
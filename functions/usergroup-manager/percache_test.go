@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestGroupUsersByCache(t *testing.T) {
+	p := perCacheParameters{Enabled: true, TagKey: defaultCacheIDTagKey, NameTemplate: defaultPerCacheNameTemplate, Engine: engineRedis}
+	users := []discovery.User{
+		{ID: "orders-app", Name: "orders-app", Engine: engineRedis},
+		{ID: "orders-ro", Name: "orders-ro", Engine: engineRedis},
+		{ID: "payments-app", Name: "payments-app", Engine: engineRedis},
+		{ID: "off-default", Name: discovery.DefaultUserName, Engine: engineRedis},
+		{ID: "untagged", Name: "untagged", Engine: engineRedis},
+	}
+
+	type want struct {
+		groups    []userGroupMembership
+		ungrouped []string
+		invalid   []string
+	}
+
+	cases := map[string]struct {
+		reason   string
+		users    []discovery.User
+		cacheIDs map[string]string
+		p        perCacheParameters
+		want     want
+	}{
+		"GroupedByCache": {
+			reason:   "Users should be grouped by their cache, with untagged users named default in every group.",
+			users:    users,
+			cacheIDs: map[string]string{"orders-app": "orders", "orders-ro": "orders", "payments-app": "payments"},
+			p:        p,
+			want: want{
+				groups: []userGroupMembership{
+					{Name: "orders-users", Engine: engineRedis, UserIDs: []string{"orders-app", "orders-ro", "off-default"}},
+					{Name: "payments-users", Engine: engineRedis, UserIDs: []string{"payments-app", "off-default"}},
+				},
+				ungrouped: []string{"untagged"},
+			},
+		},
+		"InvalidName": {
+			reason:   "Caches whose user group name isn't a valid user group ID should be reported rather than grouped.",
+			users:    users[:1],
+			cacheIDs: map[string]string{"orders-app": "orders_eu"},
+			p:        p,
+			want:     want{invalid: []string{"orders_eu"}},
+		},
+		"OtherEngine": {
+			reason:   "Users of an engine the user groups don't accept should be reported rather than grouped.",
+			users:    []discovery.User{{ID: "orders-app", Name: "orders-app", Engine: engineValkey}},
+			cacheIDs: map[string]string{"orders-app": "orders"},
+			p:        p,
+			want:     want{ungrouped: []string{"orders-app"}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			groups, ungrouped, invalid := groupUsersByCache(tc.users, tc.cacheIDs, tc.p)
+			if diff := cmp.Diff(tc.want, want{groups: groups, ungrouped: ungrouped, invalid: invalid}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\ngroupUsersByCache(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
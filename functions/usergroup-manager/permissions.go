@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// permissionCheckName is a role and user name that's never expected to exist.
+// Looking it up returns NoSuchEntity if the caller may look up IAM principals.
+const permissionCheckName = "usergroup-manager-permission-check"
+
+// A permissionCheck probes whether the function may call an IAM action, with
+// a cheap, read-only call.
+type permissionCheck struct {
+	Action string
+	Probe  func(ctx context.Context) error
+}
+
+// A permissionError is an access denied error annotated with the IAM actions
+// the function is missing.
+type permissionError struct {
+	Missing []string
+	err     error
+}
+
+func (e *permissionError) Error() string {
+	return fmt.Sprintf("missing IAM permissions for %s: %v", strings.Join(e.Missing, ", "), e.err)
+}
+
+func (e *permissionError) Unwrap() error {
+	return e.err
+}
+
+// permissionChecks returns a check for every action the function calls with
+// the supplied parameters.
+func (f *Function) permissionChecks(cfg aws.Config, client awsclient.ElastiCache, params *parameters) []permissionCheck {
+	checks := []permissionCheck{{
+		Action: "elasticache:DescribeUsers",
+		Probe: func(ctx context.Context) error {
+			_, err := client.DescribeUsers(ctx, &elasticache.DescribeUsersInput{MaxRecords: aws.Int32(20)})
+			return err
+		},
+	}}
+	if params.DiscoverServerlessCaches {
+		checks = append(checks, permissionCheck{
+			Action: "elasticache:DescribeServerlessCaches",
+			Probe: func(ctx context.Context) error {
+				_, err := client.DescribeServerlessCaches(ctx, &elasticache.DescribeServerlessCachesInput{MaxResults: aws.Int32(1)})
+				return err
+			},
+		})
+	}
+	if (params.ManagementMode == managementModeDirect && (params.Features.Enabled(featureApplyMode) || params.DryRun) && params.UserGroupID != "") || params.Migration.ReplicationGroupID != "" || params.DefaultUserReplacement.UserID != "" || params.DetectMembershipDrift {
+		checks = append(checks, permissionCheck{
+			Action: "elasticache:DescribeUserGroups",
+			Probe: func(ctx context.Context) error {
+				_, err := client.DescribeUserGroups(ctx, &elasticache.DescribeUserGroupsInput{MaxRecords: aws.Int32(20)})
+				return err
+			},
+		})
+	}
+	if len(params.ReplicationGroupIDs) > 0 || params.Migration.ReplicationGroupID != "" {
+		checks = append(checks,
+			permissionCheck{
+				Action: "elasticache:DescribeReplicationGroups",
+				Probe: func(ctx context.Context) error {
+					_, err := client.DescribeReplicationGroups(ctx, &elasticache.DescribeReplicationGroupsInput{MaxRecords: aws.Int32(20)})
+					return err
+				},
+			},
+			permissionCheck{
+				Action: "elasticache:DescribeCacheClusters",
+				Probe: func(ctx context.Context) error {
+					_, err := client.DescribeCacheClusters(ctx, &elasticache.DescribeCacheClustersInput{MaxRecords: aws.Int32(20)})
+					return err
+				},
+			},
+		)
+	}
+	if params.CostAllocation.Enabled {
+		tagging := resourcegroupstaggingapi.NewFromConfig(cfg, func(o *resourcegroupstaggingapi.Options) {
+			o.BaseEndpoint = f.endpoint("resourcegroupstaggingapi")
+		})
+		checks = append(checks, permissionCheck{
+			Action: "tag:GetResources",
+			Probe: func(ctx context.Context) error {
+				_, err := tagging.GetResources(ctx, &resourcegroupstaggingapi.GetResourcesInput{ResourcesPerPage: aws.Int32(1)})
+				return err
+			},
+		})
+	}
+	if params.TagPolicy.Enabled {
+		client := f.organizationsClient(cfg)
+		checks = append(checks, permissionCheck{
+			Action: "organizations:DescribeEffectivePolicy",
+			Probe: func(ctx context.Context) error {
+				_, err := client.DescribeEffectivePolicy(ctx, &organizations.DescribeEffectivePolicyInput{PolicyType: orgtypes.EffectivePolicyTypeTagPolicy})
+				return err
+			},
+		})
+	}
+	if params.ResolveIAMPrincipals {
+		client := iam.NewFromConfig(cfg, func(o *iam.Options) {
+			o.BaseEndpoint = f.endpoint("iam")
+		})
+		checks = append(checks,
+			permissionCheck{
+				Action: "iam:GetRole",
+				Probe: func(ctx context.Context) error {
+					_, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(permissionCheckName)})
+					return err
+				},
+			},
+			permissionCheck{
+				Action: "iam:GetUser",
+				Probe: func(ctx context.Context) error {
+					_, err := client.GetUser(ctx, &iam.GetUserInput{UserName: aws.String(permissionCheckName)})
+					return err
+				},
+			},
+		)
+	}
+	return checks
+}
+
+// diagnosePermissions runs every check if err is an access denied error, and
+// returns a *permissionError listing the actions that were denied. Any other
+// error, or one for which no check was denied, is returned unchanged. Checks
+// that fail for other reasons, e.g. NoSuchEntity, aren't missing permissions.
+func diagnosePermissions(ctx context.Context, err error, checks []permissionCheck) error {
+	if !awsclient.IsAccessDenied(err) {
+		return err
+	}
+	var missing []string
+	for _, c := range checks {
+		if awsclient.IsAccessDenied(c.Probe(ctx)) {
+			missing = append(missing, c.Action)
+		}
+	}
+	if len(missing) == 0 {
+		return err
+	}
+	return &permissionError{Missing: missing, err: err}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiagnosePermissions(t *testing.T) {
+	denied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized"}
+	probe := func(err error) func(context.Context) error {
+		return func(context.Context) error { return err }
+	}
+	checks := []permissionCheck{
+		{Action: "elasticache:DescribeUsers", Probe: probe(denied)},
+		{Action: "iam:GetRole", Probe: probe(&smithy.GenericAPIError{Code: "NoSuchEntity"})},
+		{Action: "tag:GetResources", Probe: probe(&smithy.GenericAPIError{Code: "AccessDeniedException"})},
+	}
+
+	cases := map[string]struct {
+		reason string
+		err    error
+		checks []permissionCheck
+		want   string
+	}{
+		"OtherError": {
+			reason: "Errors other than access denied shouldn't be diagnosed.",
+			err:    errors.New("boom"),
+			checks: checks,
+			want:   "boom",
+		},
+		"Missing": {
+			reason: "Every denied action should be listed.",
+			err:    denied,
+			checks: checks,
+			want:   "missing IAM permissions for elasticache:DescribeUsers, tag:GetResources: api error AccessDenied: not authorized",
+		},
+		"NoneDenied": {
+			reason: "The error should be returned unchanged if no check is denied.",
+			err:    denied,
+			checks: checks[1:2],
+			want:   "api error AccessDenied: not authorized",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := diagnosePermissions(context.Background(), tc.err, tc.checks)
+			if diff := cmp.Diff(tc.want, got.Error()); diff != "" {
+				t.Errorf("%s\ndiagnosePermissions(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/policy"
+)
+
+// planComposedWrites returns the AWS write calls provider-aws needs to make
+// for composed user groups and users to reach the desired state.
+func planComposedWrites(state *desiredState, observed map[resource.Name]resource.ObservedComposed, drift []membership.Diff) *policy.Plan {
+	p := policy.NewPlan()
+	for _, g := range state.UserGroups {
+		if _, ok := observed[resource.Name(g.Resource)]; !ok {
+			p.Add(policy.ActionCreateUserGroup, 1)
+		}
+	}
+	p.Add(policy.ActionModifyUserGroup, len(drift))
+
+	desired := make(map[resource.Name]bool, len(state.Users))
+	for _, u := range state.Users {
+		desired[resource.Name(u.Resource)] = true
+		if _, ok := observed[resource.Name(u.Resource)]; !ok && !u.ObserveOnly {
+			p.Add(policy.ActionCreateUser, 1)
+		}
+	}
+	for name := range observed {
+		if isManagedUserResource(name) && !desired[name] {
+			p.Add(policy.ActionDeleteUser, 1)
+		}
+	}
+	return p
+}
+
+// isManagedUserResource returns true if name is the composition resource name
+// of an SSO or bundle user.
+func isManagedUserResource(name resource.Name) bool {
+	return strings.HasPrefix(string(name), "identity-user-") || strings.HasPrefix(string(name), "bundle-user-")
+}
+
+// heldUserGroups returns the user groups with their observed membership, so
+// composing them changes nothing while a plan awaits approval. User groups
+// that aren't observed yet aren't created. Bypassed users are removed anyway,
+// unless they're still desired.
+func heldUserGroups(groups []desiredUserGroup, observed map[resource.Name]resource.ObservedComposed, bypassed []string) []desiredUserGroup {
+	out := make([]desiredUserGroup, 0, len(groups))
+	for _, g := range groups {
+		oc, ok := observed[resource.Name(g.Resource)]
+		if !ok || oc.Resource == nil {
+			continue
+		}
+		if current, err := oc.Resource.GetStringArray("status.atProvider.userIds"); err == nil {
+			g.UserIDs = slices.DeleteFunc(current, func(id string) bool {
+				return slices.Contains(bypassed, id) && !slices.Contains(g.UserIDs, id)
+			})
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+// A securityBypass records the security-critical removals made while a plan
+// was held, so there's an audit trail of every change made without approval.
+type securityBypass struct {
+	PlanHash   string
+	UserIDs    []string
+	UserGroups []string
+}
+
+// Add records the removal of the supplied users from a user group.
+func (b *securityBypass) Add(userGroup string, ids []string) {
+	b.UserGroups = append(b.UserGroups, userGroup)
+	for _, id := range ids {
+		if !slices.Contains(b.UserIDs, id) {
+			b.UserIDs = append(b.UserIDs, id)
+		}
+	}
+	sort.Strings(b.UserIDs)
+}
+
+// Bypassed returns the users removed despite the held plan. A nil bypass
+// removes none.
+func (b *securityBypass) Bypassed() []string {
+	if b == nil {
+		return nil
+	}
+	return b.UserIDs
+}
+
+// Status returns the bypass as written to the XR status.
+func (b *securityBypass) Status(now time.Time) map[string]any {
+	return map[string]any{
+		"planHash":     b.PlanHash,
+		"userIDs":      b.UserIDs,
+		"userGroups":   b.UserGroups,
+		"bypassedTime": now.UTC().Format(time.RFC3339),
+	}
+}
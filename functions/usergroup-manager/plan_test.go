@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composed"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/policy"
+)
+
+func TestPlanComposedWrites(t *testing.T) {
+	userGroup := func(ids ...any) resource.ObservedComposed {
+		cd := composed.New()
+		cd.Object["status"] = map[string]any{"atProvider": map[string]any{"userIds": ids}}
+		return resource.ObservedComposed{Resource: cd}
+	}
+	observed := map[resource.Name]resource.ObservedComposed{
+		"user-group-app":      userGroup("default", "app1"),
+		"identity-user-alice": {Resource: composed.New()},
+		"identity-user-bob":   {Resource: composed.New()},
+		"bundle-user-ci":      {Resource: composed.New()},
+	}
+	state := &desiredState{
+		UserGroups: []desiredUserGroup{
+			{Resource: "user-group-app", UserIDs: []string{"alice", "app1", "carol", "default"}},
+			{Resource: "user-group-ops", UserIDs: []string{"default"}},
+		},
+		Users: []desiredUser{
+			{Resource: "identity-user-alice"},
+			{Resource: "identity-user-carol"},
+			{Resource: "identity-user-dave", ObserveOnly: true},
+		},
+	}
+	drift := membershipDrift(observed, state.Memberships())
+
+	want := map[string]int{
+		policy.ActionCreateUserGroup: 1,
+		policy.ActionModifyUserGroup: 1,
+		policy.ActionCreateUser:      1,
+		policy.ActionDeleteUser:      2,
+	}
+	got := planComposedWrites(state, observed, drift)
+	if diff := cmp.Diff(want, got.Calls); diff != "" {
+		t.Errorf("planComposedWrites(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestHeldUserGroups(t *testing.T) {
+	cd := composed.New()
+	cd.Object["status"] = map[string]any{"atProvider": map[string]any{"userIds": []any{"default", "app1", "leaked"}}}
+	observed := map[resource.Name]resource.ObservedComposed{"user-group-app": {Resource: cd}}
+	groups := []desiredUserGroup{
+		{Resource: "user-group-app", Name: "app", UserIDs: []string{"app2", "default"}},
+		{Resource: "user-group-ops", Name: "ops", UserIDs: []string{"default"}},
+	}
+
+	cases := map[string]struct {
+		reason   string
+		bypassed []string
+		want     []desiredUserGroup
+	}{
+		"Held": {
+			reason: "Observed user groups should keep their observed membership, and those not observed yet shouldn't be created.",
+			want:   []desiredUserGroup{{Resource: "user-group-app", Name: "app", UserIDs: []string{"default", "app1", "leaked"}}},
+		},
+		"Bypassed": {
+			reason:   "Bypassed users should be removed from held user groups anyway, unless they're still desired.",
+			bypassed: []string{"leaked", "default"},
+			want:     []desiredUserGroup{{Resource: "user-group-app", Name: "app", UserIDs: []string{"default", "app1"}}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := heldUserGroups(groups, observed, tc.bypassed)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nheldUserGroups(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
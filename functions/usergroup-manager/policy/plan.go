@@ -0,0 +1,130 @@
+// Package policy decides whether the function may make the AWS write calls
+// needed to reach the desired state.
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ApprovePlanAnnotation approves a plan that needs more AWS write calls than
+// the approval threshold. Its value must be the plan's hash, so approving one
+// plan never approves a different one.
+const ApprovePlanAnnotation = "usergroup-manager.upbound.io/approve-plan"
+
+// AWS write calls a plan can need.
+const (
+	ActionCreateUser             = "elasticache:CreateUser"
+	ActionDeleteUser             = "elasticache:DeleteUser"
+	ActionCreateUserGroup        = "elasticache:CreateUserGroup"
+	ActionModifyUserGroup        = "elasticache:ModifyUserGroup"
+	ActionAddTagsToResource      = "elasticache:AddTagsToResource"
+	ActionRemoveTagsFromResource = "elasticache:RemoveTagsFromResource"
+	ActionModifyReplicationGroup = "elasticache:ModifyReplicationGroup"
+)
+
+// A Plan counts the AWS write calls needed to reach the desired state,
+// whether the function makes them itself or provider-aws makes them for
+// composed resources.
+type Plan struct {
+	Calls map[string]int
+}
+
+// NewPlan returns a plan without any calls.
+func NewPlan() *Plan {
+	return &Plan{Calls: map[string]int{}}
+}
+
+// Add adds n calls of action to the plan.
+func (p *Plan) Add(action string, n int) {
+	if n > 0 {
+		p.Calls[action] += n
+	}
+}
+
+// Total returns the number of write calls in the plan.
+func (p *Plan) Total() int {
+	total := 0
+	for _, n := range p.Calls {
+		total += n
+	}
+	return total
+}
+
+// String returns the plan's calls, e.g. "3 AWS write calls: 1
+// elasticache:CreateUser, 2 elasticache:ModifyUserGroup".
+func (p *Plan) String() string {
+	actions := make([]string, 0, len(p.Calls))
+	for a := range p.Calls {
+		actions = append(actions, a)
+	}
+	sort.Strings(actions)
+	calls := make([]string, len(actions))
+	for i, a := range actions {
+		calls[i] = fmt.Sprintf("%d %s", p.Calls[a], a)
+	}
+	return fmt.Sprintf("%d AWS write calls: %s", p.Total(), strings.Join(calls, ", "))
+}
+
+// Hash returns a short hash identifying the plan and the desired state it
+// reaches.
+func (p *Plan) Hash(desiredStateYAML string) string {
+	sum := sha256.Sum256([]byte(p.String() + "\n" + desiredStateYAML))
+	return hex.EncodeToString(sum[:6])
+}
+
+// NeedsApproval returns true if the plan needs more write calls than the
+// threshold.
+func (p *Plan) NeedsApproval(threshold int) bool {
+	return threshold > 0 && p.Total() > threshold
+}
+
+// Status returns the plan as written to the XR status.
+func (p *Plan) Status(hash string, held bool) map[string]any {
+	calls := make(map[string]any, len(p.Calls))
+	for a, n := range p.Calls {
+		calls[a] = n
+	}
+	return map[string]any{
+		"total": p.Total(),
+		"calls": calls,
+		"hash":  hash,
+		"held":  held,
+	}
+}
+
+// An Approval holds plans that need too many AWS write calls until they're
+// approved.
+type Approval struct {
+	// WriteThreshold is the most AWS write calls a plan may need before it
+	// must be approved. Zero disables approval.
+	WriteThreshold int
+
+	// SecurityRemovals are the users whose removal from user groups is
+	// security-critical, e.g. because their credentials leaked. They're
+	// removed even while a plan is held.
+	SecurityRemovals []string
+}
+
+// Holds returns true if the plan with the supplied hash needs approval, and
+// the supplied annotations of the XR don't approve it.
+func (a Approval) Holds(p *Plan, hash string, annotations map[string]string) bool {
+	return p.NeedsApproval(a.WriteThreshold) && annotations[ApprovePlanAnnotation] != hash
+}
+
+// Bypassed returns the supplied removed users whose removal is
+// security-critical, sorted, so it bypasses a held plan.
+func (a Approval) Bypassed(removed []string) []string {
+	var out []string
+	for _, id := range removed {
+		if slices.Contains(a.SecurityRemovals, id) {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlanString(t *testing.T) {
+	p := NewPlan()
+	p.Add(ActionModifyUserGroup, 2)
+	p.Add(ActionCreateUser, 1)
+	p.Add(ActionDeleteUser, 0)
+
+	want := "3 AWS write calls: 1 elasticache:CreateUser, 2 elasticache:ModifyUserGroup"
+	if diff := cmp.Diff(want, p.String()); diff != "" {
+		t.Errorf("String(): -want, +got:\n%s", diff)
+	}
+}
+
+func TestPlanNeedsApproval(t *testing.T) {
+	cases := map[string]struct {
+		reason    string
+		calls     int
+		threshold int
+		want      bool
+	}{
+		"Disabled": {
+			reason:    "A zero threshold should never require approval.",
+			calls:     100,
+			threshold: 0,
+			want:      false,
+		},
+		"AtThreshold": {
+			reason:    "A plan that needs exactly the threshold should not require approval.",
+			calls:     5,
+			threshold: 5,
+			want:      false,
+		},
+		"OverThreshold": {
+			reason:    "A plan that needs more than the threshold should require approval.",
+			calls:     6,
+			threshold: 5,
+			want:      true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := NewPlan()
+			p.Add(ActionCreateUser, tc.calls)
+			if diff := cmp.Diff(tc.want, p.NeedsApproval(tc.threshold)); diff != "" {
+				t.Errorf("%s\nNeedsApproval(%d): -want, +got:\n%s", tc.reason, tc.threshold, diff)
+			}
+		})
+	}
+}
+
+func TestPlanHash(t *testing.T) {
+	p := &Plan{Calls: map[string]int{ActionCreateUser: 1}}
+	other := &Plan{Calls: map[string]int{ActionCreateUser: 2}}
+
+	if p.Hash("a") != p.Hash("a") {
+		t.Errorf("Hash(...): the same plan and desired state should have the same hash")
+	}
+	if p.Hash("a") == p.Hash("b") {
+		t.Errorf("Hash(...): a different desired state should have a different hash")
+	}
+	if p.Hash("a") == other.Hash("a") {
+		t.Errorf("Hash(...): a different plan should have a different hash")
+	}
+}
+
+func TestApprovalHolds(t *testing.T) {
+	p := NewPlan()
+	p.Add(ActionCreateUser, 6)
+
+	cases := map[string]struct {
+		reason      string
+		approval    Approval
+		annotations map[string]string
+		want        bool
+	}{
+		"WithinThreshold": {
+			reason:   "A plan within the threshold shouldn't be held.",
+			approval: Approval{WriteThreshold: 10},
+			want:     false,
+		},
+		"NotApproved": {
+			reason:   "A plan over the threshold shouldn't be applied until it's approved.",
+			approval: Approval{WriteThreshold: 5},
+			want:     true,
+		},
+		"ApprovedOtherPlan": {
+			reason:      "Approving a different plan shouldn't approve this one.",
+			approval:    Approval{WriteThreshold: 5},
+			annotations: map[string]string{ApprovePlanAnnotation: "other"},
+			want:        true,
+		},
+		"Approved": {
+			reason:      "A plan approved by its hash shouldn't be held.",
+			approval:    Approval{WriteThreshold: 5},
+			annotations: map[string]string{ApprovePlanAnnotation: "abc"},
+			want:        false,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.approval.Holds(p, "abc", tc.annotations)); diff != "" {
+				t.Errorf("%s\nHolds(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestApprovalBypassed(t *testing.T) {
+	cases := map[string]struct {
+		reason   string
+		approval Approval
+		removed  []string
+		want     []string
+	}{
+		"NoSecurityRemovals": {
+			reason:  "No removal should bypass approval unless it's marked security-critical.",
+			removed: []string{"app1", "leaked"},
+		},
+		"SecurityRemovals": {
+			reason:   "Removals marked security-critical should bypass approval, sorted.",
+			approval: Approval{SecurityRemovals: []string{"leaked", "stolen", "other"}},
+			removed:  []string{"stolen", "app1", "leaked"},
+			want:     []string{"leaked", "stolen"},
+		},
+		"NotRemoved": {
+			reason:   "Security-critical users that aren't being removed bypass nothing.",
+			approval: Approval{SecurityRemovals: []string{"leaked"}},
+			removed:  []string{"app1"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.approval.Bypassed(tc.removed)); diff != "" {
+				t.Errorf("%s\nBypassed(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
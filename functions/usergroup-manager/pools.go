@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// sharedPoolLabel names the shared pool a ConfigMap publishes. Cache XRs find
+// the pools they opt in to by this label, in any namespace.
+const sharedPoolLabel = "elasticache-users.fn/shared-pool"
+
+// sharedPoolExportKey is the context key the XR's own pool is written to, for
+// later steps to compose into a ConfigMap.
+const sharedPoolExportKey = "sharedPoolExport"
+
+// sharedPoolResourceName is the composition resource name of the ConfigMap
+// publishing the XR's pool.
+const sharedPoolResourceName = "shared-pool"
+
+// sharedPoolKeyPrefix prefixes the required resources key of each pool.
+const sharedPoolKeyPrefix = "sharedPool-"
+
+// sharedPoolParameters declare common users, e.g. monitoring or migration
+// tooling, that other XRs add to their user groups by opting in to the pool.
+type sharedPoolParameters struct {
+	Name    string
+	UserIDs []string
+}
+
+func parseSharedPools(r *paramReader) (sharedPoolParameters, []string) {
+	var pool sharedPoolParameters
+	if name := r.String("spec.parameters.sharedPool.name", ""); name != "" {
+		if errs := validation.IsValidLabelValue(name); len(errs) > 0 {
+			r.errs = append(r.errs, fmt.Errorf("spec.parameters.sharedPool.name: %q is not a valid pool name: %s", name, strings.Join(errs, "; ")))
+		} else {
+			pool = sharedPoolParameters{Name: name, UserIDs: r.StringList("spec.parameters.sharedPool.userIds")}
+		}
+	}
+
+	var names []string
+	for i, name := range r.StringList("spec.parameters.sharedPools") {
+		if errs := validation.IsValidLabelValue(name); len(errs) > 0 || name == "" {
+			r.errs = append(r.errs, fmt.Errorf("spec.parameters.sharedPools[%d]: %q is not a valid pool name", i, name))
+			continue
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return pool, names
+}
+
+// sharedPoolSelector selects the ConfigMaps, in any namespace, publishing the
+// named pool.
+func sharedPoolSelector(name string) *fnv1.ResourceSelector {
+	return &fnv1.ResourceSelector{
+		ApiVersion: "v1",
+		Kind:       "ConfigMap",
+		Match: &fnv1.ResourceSelector_MatchLabels{MatchLabels: &fnv1.MatchLabels{
+			Labels: map[string]string{sharedPoolLabel: name},
+		}},
+	}
+}
+
+// sharedPoolUserIDs returns the user IDs published in the named pool's
+// ConfigMap. A pool must be published by exactly one ConfigMap, since
+// carrying on without it would remove its users from user groups.
+func sharedPoolUserIDs(name string, rs []resource.Required) ([]string, error) {
+	switch len(rs) {
+	case 0:
+		return nil, fmt.Errorf("shared pool %q not found: no ConfigMap has label %s=%s", name, sharedPoolLabel, name)
+	case 1:
+	default:
+		return nil, fmt.Errorf("shared pool %q is published by %d ConfigMaps", name, len(rs))
+	}
+	data, err := configMapValue(rs[0].Resource, userIDsDataKey)
+	if err != nil {
+		return nil, fmt.Errorf("shared pool %q: %w", name, err)
+	}
+	var ids []string
+	for _, id := range strings.Split(data, "\n") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// sharedPoolConfigMapName returns the name of the ConfigMap publishing the
+// named XR's pool.
+func sharedPoolConfigMapName(xrName string) string {
+	return xrName + "-" + sharedPoolResourceName
+}
+
+// sharedPoolExportContext returns the XR's pool in the form written to the
+// pipeline context.
+func sharedPoolExportContext(pool sharedPoolParameters, configMapName string) map[string]any {
+	ids := slices.Clone(pool.UserIDs)
+	sort.Strings(ids)
+	return map[string]any{
+		"configMapName": configMapName,
+		"poolName":      pool.Name,
+		"label":         sharedPoolLabel,
+		"dataKey":       userIDsDataKey,
+		"data":          joinUserIDs(slices.Compact(ids)),
+	}
+}
+
+// undiscoveredUserIDs returns the IDs in ids that aren't of a user in users,
+// sorted.
+func undiscoveredUserIDs(users []discovery.User, ids map[string]bool) []string {
+	discovered := make(map[string]bool, len(users))
+	for _, u := range users {
+		discovered[u.ID] = true
+	}
+	var out []string
+	for id := range ids {
+		if !discovered[id] {
+			out = append(out, id)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// addPoolMembers adds the users whose IDs are in pooled to every user group.
+func addPoolMembers(groups []userGroupMembership, users []discovery.User, pooled map[string]bool) {
+	for _, u := range users {
+		if !pooled[u.ID] {
+			continue
+		}
+		for i := range groups {
+			if !slices.Contains(groups[i].UserIDs, u.ID) {
+				groups[i].UserIDs = append(groups[i].UserIDs, u.ID)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestSharedPoolUserIDs(t *testing.T) {
+	cm := func(data map[string]any) resource.Required {
+		u := &unstructured.Unstructured{Object: map[string]any{"data": data}}
+		u.SetNamespace("platform")
+		u.SetName("pools-shared-pool")
+		return resource.Required{Resource: u}
+	}
+
+	type want struct {
+		ids []string
+		err error
+	}
+
+	cases := map[string]struct {
+		reason string
+		rs     []resource.Required
+		want   want
+	}{
+		"Published": {
+			reason: "The pool's user IDs should be read one per line, skipping blank lines.",
+			rs:     []resource.Required{cm(map[string]any{userIDsDataKey: "monitoring\n\n migration \n"})},
+			want:   want{ids: []string{"monitoring", "migration"}},
+		},
+		"NotFound": {
+			reason: "A pool no ConfigMap publishes should be an error.",
+			want:   want{err: cmpopts.AnyError},
+		},
+		"Ambiguous": {
+			reason: "A pool published by several ConfigMaps should be an error.",
+			rs:     []resource.Required{cm(map[string]any{userIDsDataKey: "a"}), cm(map[string]any{userIDsDataKey: "b"})},
+			want:   want{err: cmpopts.AnyError},
+		},
+		"MissingKey": {
+			reason: "A pool ConfigMap without user IDs should be an error.",
+			rs:     []resource.Required{cm(map[string]any{})},
+			want:   want{err: cmpopts.AnyError},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ids, err := sharedPoolUserIDs("common", tc.rs)
+			if diff := cmp.Diff(tc.want.ids, ids); diff != "" {
+				t.Errorf("%s\nsharedPoolUserIDs(...): -want ids, +got ids:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.err, err, cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nsharedPoolUserIDs(...): -want error, +got error:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestAddPoolMembers(t *testing.T) {
+	users := []discovery.User{{ID: "default"}, {ID: "app1"}, {ID: "monitoring"}}
+	pooled := map[string]bool{"monitoring": true, "gone": true}
+
+	groups := []userGroupMembership{
+		{Name: "app", UserIDs: []string{"default", "app1"}},
+		{Name: "ops", UserIDs: []string{"default", "monitoring"}},
+	}
+	addPoolMembers(groups, users, pooled)
+
+	want := []userGroupMembership{
+		{Name: "app", UserIDs: []string{"default", "app1", "monitoring"}},
+		{Name: "ops", UserIDs: []string{"default", "monitoring"}},
+	}
+	if diff := cmp.Diff(want, groups); diff != "" {
+		t.Errorf("Pool users should be added once to every user group, skipping those that weren't discovered.\naddPoolMembers(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestUndiscoveredUserIDs(t *testing.T) {
+	users := []discovery.User{{ID: "default"}, {ID: "monitoring"}}
+	got := undiscoveredUserIDs(users, map[string]bool{"monitoring": true, "migration": true, "backup": true})
+	want := []string{"backup", "migration"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Only the IDs of users that weren't discovered should be returned, sorted.\nundiscoveredUserIDs(...): -want, +got:\n%s", diff)
+	}
+}
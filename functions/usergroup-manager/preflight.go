@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/aws/smithy-go"
+	"sigs.k8s.io/yaml"
+
+	"github.com/crossplane/function-sdk-go/logging"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// maxUsersPerUserGroup is the most users an ElastiCache user group can hold.
+const maxUsersPerUserGroup = 100
+
+// preflightCommand checks, before a composition is installed, that the
+// function will be able to do its job with the supplied credentials.
+type preflightCommand struct {
+	CredentialsFile string            `help:"YAML or JSON file with the aws_access_key_id, aws_secret_access_key and optional aws_session_token the composition will supply. The AWS SDK's default credential chain is used if omitted." type:"existingfile"`
+	Config          string            `help:"XR manifest whose spec.parameters select the features to check, e.g. discoverServerlessCaches or userGroups." type:"existingfile"`
+	Regions         []string          `help:"Regions to check. Defaults to the region in --config, or us-east-1."`
+	AWSEndpoints    map[string]string `help:"Endpoint URL to use for an AWS service, as for the serve command." placeholder:"SERVICE=URL"`
+}
+
+// Run the preflight checks and print a report. It returns an error if any
+// check failed, so bootstrap pipelines can stop.
+func (c *preflightCommand) Run() error {
+	if err := validateEndpoints(c.AWSEndpoints); err != nil {
+		return err
+	}
+
+	xr := map[string]any{}
+	if c.Config != "" {
+		b, err := os.ReadFile(c.Config)
+		if err != nil {
+			return fmt.Errorf("cannot read config: %w", err)
+		}
+		if err := yaml.Unmarshal(b, &xr); err != nil {
+			return fmt.Errorf("cannot parse config: %w", err)
+		}
+	}
+	params, errs := parseParameters(xr)
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if c.CredentialsFile != "" {
+		b, err := os.ReadFile(c.CredentialsFile)
+		if err != nil {
+			return fmt.Errorf("cannot read credentials file: %w", err)
+		}
+		data, err := parseCredentialsDocument(b)
+		if err != nil {
+			return fmt.Errorf("credentials file: %w", err)
+		}
+		opts = append(opts, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			string(data["aws_access_key_id"]),
+			string(data["aws_secret_access_key"]),
+			string(data["aws_session_token"]),
+		)))
+	}
+
+	regions := c.Regions
+	if len(regions) == 0 {
+		regions = []string{params.Region}
+	}
+
+	ctx := context.Background()
+	f := &Function{log: logging.NewNopLogger(), endpoints: c.AWSEndpoints}
+	var report preflightReport
+	for _, region := range regions {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx, append([]func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(region)}, opts...)...)
+		if err != nil {
+			return fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		report = append(report, f.preflight(ctx, region, cfg, params)...)
+	}
+
+	if err := report.Write(os.Stdout); err != nil {
+		return err
+	}
+	if report.Failed() {
+		return errors.New("preflight checks failed")
+	}
+	return nil
+}
+
+// A preflightResult is the outcome of one preflight check in one region.
+type preflightResult struct {
+	Region string
+	Check  string
+	OK     bool
+	Detail string
+}
+
+type preflightReport []preflightResult
+
+// Failed returns true if any check failed.
+func (r preflightReport) Failed() bool {
+	for _, res := range r {
+		if !res.OK {
+			return true
+		}
+	}
+	return false
+}
+
+// Write prints the report as a table.
+func (r preflightReport) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGION\tCHECK\tRESULT\tDETAIL")
+	for _, res := range r {
+		result := "OK"
+		if !res.OK {
+			result = "FAIL"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Region, res.Check, result, res.Detail)
+	}
+	return tw.Flush()
+}
+
+// preflight checks that region is reachable, that the function has every
+// permission it needs with the supplied parameters, and that discovered users
+// fit in their user groups.
+func (f *Function) preflight(ctx context.Context, region string, cfg aws.Config, params *parameters) []preflightResult {
+	client := f.elastiCacheClient(cfg, region, params.EndpointURL)
+
+	// Any response from AWS, even access denied, means it's reachable
+	_, err := client.DescribeUsers(ctx, &elasticache.DescribeUsersInput{MaxRecords: aws.Int32(20)})
+	var ae smithy.APIError
+	if err != nil && !errors.As(err, &ae) {
+		return []preflightResult{{Region: region, Check: "reachability", Detail: err.Error()}}
+	}
+	out := []preflightResult{{Region: region, Check: "reachability", OK: true, Detail: "ElastiCache API responded"}}
+
+	denied := false
+	for _, c := range f.permissionChecks(cfg, client, params) {
+		res := preflightResult{Region: region, Check: c.Action, OK: true, Detail: "allowed"}
+		if err := c.Probe(ctx); err != nil {
+			switch {
+			case awsclient.IsAccessDenied(err):
+				res.OK, res.Detail = false, "access denied"
+				denied = true
+			case !errors.As(err, &ae):
+				res.OK, res.Detail = false, err.Error()
+			}
+		}
+		out = append(out, res)
+	}
+	if denied {
+		return out
+	}
+
+	var users []discovery.User
+	if err := discovery.Users(ctx, client, params.Engine, func(u types.User) {
+		if u.UserId != nil {
+			users = append(users, discovery.NewUser(u))
+		}
+	}); err != nil {
+		return append(out, preflightResult{Region: region, Check: "quotas", Detail: err.Error()})
+	}
+	return append(out, userGroupQuotas(region, params, users)...)
+}
+
+// userGroupQuotas checks that the users each user group would hold fit in a
+// user group.
+func userGroupQuotas(region string, params *parameters, users []discovery.User) []preflightResult {
+	groups := []userGroupMembership{{Name: "default", UserIDs: make([]string, len(users))}}
+	for i, u := range users {
+		groups[0].UserIDs[i] = u.ID
+	}
+	if len(params.UserGroups) > 0 {
+		groups, _ = assignUserGroups(params.UserGroups, users, params.ExclusiveMembership)
+	}
+
+	out := make([]preflightResult, len(groups))
+	for i, g := range groups {
+		out[i] = preflightResult{
+			Region: region,
+			Check:  "users in user group " + g.Name,
+			OK:     len(g.UserIDs) <= maxUsersPerUserGroup,
+			Detail: fmt.Sprintf("%d of at most %d", len(g.UserIDs), maxUsersPerUserGroup),
+		}
+	}
+	return out
+}
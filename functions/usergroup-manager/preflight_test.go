@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestUserGroupQuotas(t *testing.T) {
+	users := make([]discovery.User, maxUsersPerUserGroup+1)
+	for i := range users {
+		users[i] = discovery.User{ID: fmt.Sprintf("app-%d", i), Engine: engineRedis}
+	}
+	users[0].ID = "ops-0"
+
+	cases := map[string]struct {
+		reason string
+		params *parameters
+		want   []preflightResult
+	}{
+		"ImplicitGroup": {
+			reason: "All discovered users should have to fit in the implicit user group.",
+			params: &parameters{},
+			want: []preflightResult{
+				{Region: "us-east-1", Check: "users in user group default", Detail: "101 of at most 100"},
+			},
+		},
+		"UserGroups": {
+			reason: "The users matching each configured user group should have to fit in it.",
+			params: &parameters{UserGroups: []userGroupTarget{
+				{Name: "app", Engine: engineRedis, Filter: userFilter{UserIDPattern: "app-*"}},
+				{Name: "ops", Engine: engineRedis, Filter: userFilter{UserIDPattern: "ops-*"}},
+			}},
+			want: []preflightResult{
+				{Region: "us-east-1", Check: "users in user group app", OK: true, Detail: "100 of at most 100"},
+				{Region: "us-east-1", Check: "users in user group ops", OK: true, Detail: "1 of at most 100"},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := userGroupQuotas("us-east-1", tc.params, users)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nuserGroupQuotas(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestPreflightReportWrite(t *testing.T) {
+	r := preflightReport{
+		{Region: "us-east-1", Check: "reachability", OK: true, Detail: "ElastiCache API responded"},
+		{Region: "us-east-1", Check: "elasticache:DescribeUsers", Detail: "access denied"},
+	}
+	b := &strings.Builder{}
+	if err := r.Write(b); err != nil {
+		t.Fatalf("Write(...): %v", err)
+	}
+	want := `REGION     CHECK                      RESULT  DETAIL
+us-east-1  reachability               OK      ElastiCache API responded
+us-east-1  elasticache:DescribeUsers  FAIL    access denied
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("Write(...): -want, +got:\n%s", diff)
+	}
+	if !r.Failed() {
+		t.Errorf("Failed(): want true, got false")
+	}
+}
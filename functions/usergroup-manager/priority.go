@@ -0,0 +1,51 @@
+package main
+
+import (
+	"time"
+
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// priorityAnnotation prioritizes an XR over the rest of the fleet when set to
+// priorityHigh, e.g. during an incident when its user group can't wait.
+const priorityAnnotation = "elasticache-users.fn/priority"
+
+// priorityHigh is the only supported value of priorityAnnotation.
+const priorityHigh = "high"
+
+// priorityRequeueInterval is how soon the function asks to be called again
+// for a prioritized XR, rather than waiting for the usual poll interval.
+const priorityRequeueInterval = 30 * time.Second
+
+// prioritySettleRequeueInterval replaces settleRequeueInterval for a
+// prioritized XR.
+const prioritySettleRequeueInterval = 5 * time.Second
+
+// observedPriority returns true if the XR is annotated to be prioritized. It
+// also returns the annotation's value if it isn't supported.
+func observedPriority(oxr *resource.Composite) (prioritized bool, unsupported string) {
+	v, ok := oxr.Resource.GetAnnotations()[priorityAnnotation]
+	switch {
+	case !ok:
+		return false, ""
+	case v == priorityHigh:
+		return true, ""
+	default:
+		return false, v
+	}
+}
+
+// requeueInterval returns how soon the function should be called again for
+// an XR, or zero to wait for the usual poll interval.
+func requeueInterval(settled, prioritized bool) time.Duration {
+	switch {
+	case !settled && prioritized:
+		return prioritySettleRequeueInterval
+	case !settled:
+		return settleRequeueInterval
+	case prioritized:
+		return priorityRequeueInterval
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+)
+
+func TestObservedPriority(t *testing.T) {
+	xr := func(annotations map[string]string) *resource.Composite {
+		c := composite.New()
+		c.SetAnnotations(annotations)
+		return &resource.Composite{Resource: c}
+	}
+
+	type want struct {
+		prioritized bool
+		unsupported string
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     *resource.Composite
+		want   want
+	}{
+		"High": {
+			reason: "An XR annotated with high priority should be prioritized.",
+			xr:     xr(map[string]string{priorityAnnotation: priorityHigh}),
+			want:   want{prioritized: true},
+		},
+		"Unannotated": {
+			reason: "An XR without the annotation shouldn't be prioritized.",
+			xr:     xr(nil),
+		},
+		"Unsupported": {
+			reason: "An unsupported value should be returned rather than prioritizing the XR.",
+			xr:     xr(map[string]string{priorityAnnotation: "urgent"}),
+			want:   want{unsupported: "urgent"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			prioritized, unsupported := observedPriority(tc.xr)
+			if got := (want{prioritized: prioritized, unsupported: unsupported}); got != tc.want {
+				t.Errorf("%s\nobservedPriority(...): want %+v, got %+v", tc.reason, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRequeueInterval(t *testing.T) {
+	cases := map[string]struct {
+		reason      string
+		settled     bool
+		prioritized bool
+		want        time.Duration
+	}{
+		"Settled": {
+			reason:  "A settled XR should wait for the usual poll interval.",
+			settled: true,
+			want:    0,
+		},
+		"Unsettled": {
+			reason: "An XR waiting for AWS to settle should be checked again soon.",
+			want:   settleRequeueInterval,
+		},
+		"Prioritized": {
+			reason:      "A prioritized XR should be checked again sooner than the usual poll interval.",
+			settled:     true,
+			prioritized: true,
+			want:        priorityRequeueInterval,
+		},
+		"PrioritizedUnsettled": {
+			reason:      "A prioritized XR waiting for AWS to settle should be checked again sooner still.",
+			prioritized: true,
+			want:        prioritySettleRequeueInterval,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := requeueInterval(tc.settled, tc.prioritized); got != tc.want {
+				t.Errorf("%s\nrequeueInterval(...): want %s, got %s", tc.reason, tc.want, got)
+			}
+		})
+	}
+}
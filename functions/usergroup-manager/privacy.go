@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+)
+
+// telemetryCredentialsName is the name of the composition credentials holding
+// the key used to hash names in telemetry.
+const telemetryCredentialsName = "telemetry"
+
+// telemetryHashKeyField is the credentials key holding the HMAC key.
+const telemetryHashKeyField = "hmac_key"
+
+// hashedNameLength is the number of hex characters of the HMAC kept in a
+// hashed name. It's long enough to make collisions between the names of one
+// deployment unlikely.
+const hashedNameLength = 16
+
+// A nameHasher replaces user names, user IDs, cache IDs, user group IDs, which
+// may be derived from cache IDs, and XR names with a keyed hash before they're
+// written to metrics labels, logs or events. The
+// same name always hashes to the same value, so telemetry can still be
+// correlated, but only holders of the key can test a guessed name. Raw values
+// are only ever written to the XR status.
+//
+// A nil nameHasher returns names unchanged.
+type nameHasher struct {
+	key []byte
+}
+
+// newNameHasher returns a nameHasher using the HMAC key in the composition's
+// telemetry credentials.
+func newNameHasher(req *fnv1.RunFunctionRequest) (*nameHasher, error) {
+	creds, err := request.GetCredentials(req, telemetryCredentialsName)
+	if err != nil {
+		return nil, fmt.Errorf("spec.parameters.telemetry.hashNames requires %q credentials: %w", telemetryCredentialsName, err)
+	}
+	key := creds.Data[telemetryHashKeyField]
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%q credentials have no %q", telemetryCredentialsName, telemetryHashKeyField)
+	}
+	return &nameHasher{key: key}, nil
+}
+
+// Hash returns the hashed form of name, e.g. h-1f2e3d4c5b6a7980.
+func (h *nameHasher) Hash(name string) string {
+	if h == nil {
+		return name
+	}
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(name))
+	return "h-" + hex.EncodeToString(mac.Sum(nil))[:hashedNameLength]
+}
+
+// HashDiff returns the diff with its user group ID and user IDs hashed, e.g.
+// to emit it as an event.
+func (h *nameHasher) HashDiff(d membership.Diff) membership.Diff {
+	if h == nil {
+		return d
+	}
+	return membership.Diff{Resource: h.Hash(d.Resource), Added: h.HashAll(d.Added), Removed: h.HashAll(d.Removed)}
+}
+
+// HashAll returns the hashed form of each name.
+func (h *nameHasher) HashAll(names []string) []string {
+	if h == nil {
+		return names
+	}
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = h.Hash(n)
+	}
+	return out
+}
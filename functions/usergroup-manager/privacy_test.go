@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/go-logr/logr/funcr"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+)
+
+func TestNameHasher(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		h      *nameHasher
+		names  []string
+		want   []string
+	}{
+		"Disabled": {
+			reason: "A nil nameHasher should return names unchanged.",
+			names:  []string{"app1"},
+			want:   []string{"app1"},
+		},
+		"Hashed": {
+			reason: "Names should be replaced by a truncated HMAC-SHA256 of the name.",
+			h:      &nameHasher{key: []byte("key")},
+			names:  []string{"app1", "app1"},
+			want:   []string{"h-1bba356554e0e7cc", "h-1bba356554e0e7cc"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.h.HashAll(tc.names)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nHashAll(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestNewNameHasher(t *testing.T) {
+	creds := func(data map[string][]byte) *fnv1.RunFunctionRequest {
+		return &fnv1.RunFunctionRequest{Credentials: map[string]*fnv1.Credentials{
+			telemetryCredentialsName: {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{Data: data}}},
+		}}
+	}
+
+	type want struct {
+		hash string
+		err  string
+	}
+
+	cases := map[string]struct {
+		reason string
+		req    *fnv1.RunFunctionRequest
+		want   want
+	}{
+		"Key": {
+			reason: "The HMAC key should be read from the telemetry credentials.",
+			req:    creds(map[string][]byte{telemetryHashKeyField: []byte("key")}),
+			want:   want{hash: "h-1bba356554e0e7cc"},
+		},
+		"NoKey": {
+			reason: "Telemetry credentials without an HMAC key should be an error.",
+			req:    creds(map[string][]byte{"key": []byte("key")}),
+			want:   want{err: `"telemetry" credentials have no "hmac_key"`},
+		},
+		"NoCredentials": {
+			reason: "Missing telemetry credentials should be an error.",
+			req:    &fnv1.RunFunctionRequest{},
+			want:   want{err: `spec.parameters.telemetry.hashNames requires "telemetry" credentials: telemetry: credential not found`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			h, err := newNameHasher(tc.req)
+			got := want{}
+			if err != nil {
+				got.err = err.Error()
+			} else {
+				got.hash = h.Hash("app1")
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nnewNameHasher(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestRunFunctionHashesNames(t *testing.T) {
+	h := &nameHasher{key: []byte("key")}
+	req := func(parameters string, deleting bool) *fnv1.RunFunctionRequest {
+		meta := `{"name": "prod", "namespace": "default"}`
+		if deleting {
+			meta = `{"name": "prod", "namespace": "default", "deletionTimestamp": "2026-01-01T00:00:00Z"}`
+		}
+		return &fnv1.RunFunctionRequest{
+			Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+				"apiVersion": "customer.upbound.io/v1alpha1",
+				"kind": "XCacheInfra",
+				"metadata": ` + meta + `,
+				"spec": {"parameters": ` + parameters + `}
+			}`)}},
+			Credentials: map[string]*fnv1.Credentials{
+				awsCredentialsName: {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+					Data: map[string][]byte{"aws_access_key_id": []byte("AKIA"), "aws_secret_access_key": []byte("secret")},
+				}}},
+				telemetryCredentialsName: {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+					Data: map[string][]byte{telemetryHashKeyField: []byte("key")},
+				}}},
+			},
+		}
+	}
+	client := func() *fakeElastiCache {
+		user := func(id string) types.User {
+			return types.User{UserId: aws.String(id), UserName: aws.String(id), Engine: aws.String(engineRedis), Status: aws.String("active")}
+		}
+		return &fakeElastiCache{
+			users: []types.User{user("alice"), user(discovery.DefaultUserID)},
+			userGroups: []types.UserGroup{{
+				UserGroupId: aws.String("payments"),
+				ARN:         aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:payments"),
+				Status:      aws.String(membership.StatusActive),
+				UserIds:     []string{discovery.DefaultUserID, "mallory"},
+			}},
+		}
+	}
+	// raw are the names that must only be written to the XR status.
+	raw := []string{"alice", "mallory", "payments"}
+
+	cases := map[string]struct {
+		reason string
+		req    *fnv1.RunFunctionRequest
+
+		// events are the events that must be emitted, with hashed names.
+		events []string
+	}{
+		"Modified": {
+			reason: "The membership changes of the target user group should be logged and emitted as events with hashed names.",
+			req:    req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "payments", "features": {"applyMode": true}, "telemetry": {"hashNames": true}}`, false),
+			events: []string{membership.Diff{Resource: h.Hash("payments"), Added: h.HashAll([]string{"alice"}), Removed: h.HashAll([]string{"mallory"})}.String()},
+		},
+		"DryRun": {
+			reason: "The membership changes of a dry run should be logged and emitted as events with hashed names.",
+			req:    req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "payments", "dryRun": true, "features": {"applyMode": true}, "telemetry": {"hashNames": true}}`, false),
+			events: []string{"Dry run: " + membership.Diff{Resource: h.Hash("payments"), Added: h.HashAll([]string{"alice"}), Removed: h.HashAll([]string{"mallory"})}.String()},
+		},
+		"SecurityRemovalBypass": {
+			reason: "A bypass of plan approval should be logged and warned about with hashed names.",
+			req:    req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "payments", "features": {"applyMode": true}, "approval": {"writeThreshold": 1, "securityRemovals": ["mallory"]}, "telemetry": {"hashNames": true}}`, false),
+			events: []string{membership.Diff{Resource: h.Hash("payments"), Removed: h.HashAll([]string{"mallory"})}.String()},
+		},
+		"TeardownDrain": {
+			reason: "Draining the target user group should be logged and emitted as events with hashed names.",
+			req:    req(`{"region": "us-east-1", "managementMode": "direct", "userGroupId": "payments", "teardown": {"drainUserGroup": true}, "features": {"applyMode": true}, "telemetry": {"hashNames": true}}`, true),
+			events: []string{membership.Diff{Resource: h.Hash("payments"), Removed: h.HashAll([]string{"mallory"})}.String()},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var lines []string
+			log := funcr.New(func(prefix, args string) { lines = append(lines, args) }, funcr.Options{Verbosity: 1})
+			f := &Function{log: logging.NewLogrLogger(log), elastiCache: client(), sts: &fakeSTS{account: "123456789012"}}
+			rsp, err := f.RunFunction(context.Background(), tc.req)
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): %v", tc.reason, err)
+			}
+
+			var events []string
+			for _, r := range rsp.GetResults() {
+				events = append(events, r.GetMessage())
+			}
+			for _, e := range tc.events {
+				if !slices.Contains(events, e) {
+					t.Errorf("%s\nf.RunFunction(...): missing event %q in %q", tc.reason, e, events)
+				}
+			}
+			for _, l := range slices.Concat(events, lines) {
+				for _, n := range raw {
+					if strings.Contains(l, n) {
+						t.Errorf("%s\nf.RunFunction(...): %q contains the raw name %q", tc.reason, l, n)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// minRBACRedisVersion is the first Redis major version that supports user
+// groups.
+const minRBACRedisVersion = 6
+
+// An rbacError reports why a replication group can't be associated with user
+// groups.
+type rbacError struct {
+	ReplicationGroupID string
+	Problems           []string
+}
+
+func (e *rbacError) Error() string {
+	return fmt.Sprintf("replication group %q doesn't support user groups: %s", e.ReplicationGroupID, strings.Join(e.Problems, "; "))
+}
+
+// checkRBACSupport returns an *rbacError if AWS would refuse to associate the
+// replication group with user groups.
+func checkRBACSupport(ctx context.Context, client awsclient.ElastiCache, replicationGroupID string) error {
+	rg, version, err := describeReplicationGroup(ctx, client, replicationGroupID)
+	if err != nil {
+		return err
+	}
+	if problems := rbacProblems(rg, version); len(problems) > 0 {
+		return &rbacError{ReplicationGroupID: replicationGroupID, Problems: problems}
+	}
+	return nil
+}
+
+// describeReplicationGroup returns the replication group and the engine
+// version it runs.
+func describeReplicationGroup(ctx context.Context, client awsclient.ElastiCache, replicationGroupID string) (types.ReplicationGroup, string, error) {
+	out, err := client.DescribeReplicationGroups(ctx, &elasticache.DescribeReplicationGroupsInput{ReplicationGroupId: aws.String(replicationGroupID)})
+	if err != nil {
+		return types.ReplicationGroup{}, "", fmt.Errorf("failed to describe replication group %q: %w", replicationGroupID, err)
+	}
+	if len(out.ReplicationGroups) == 0 {
+		return types.ReplicationGroup{}, "", fmt.Errorf("replication group %q not found", replicationGroupID)
+	}
+	rg := out.ReplicationGroups[0]
+
+	// Replication groups don't report their engine version, but their
+	// member clusters all run the same one.
+	var version string
+	if len(rg.MemberClusters) > 0 {
+		cc, err := client.DescribeCacheClusters(ctx, &elasticache.DescribeCacheClustersInput{CacheClusterId: aws.String(rg.MemberClusters[0])})
+		if err != nil {
+			return types.ReplicationGroup{}, "", fmt.Errorf("failed to describe cache cluster %q: %w", rg.MemberClusters[0], err)
+		}
+		if len(cc.CacheClusters) > 0 {
+			version = aws.ToString(cc.CacheClusters[0].EngineVersion)
+		}
+	}
+	return rg, version, nil
+}
+
+// rbacProblems returns what keeps a replication group running the supplied
+// engine version from being associated with user groups, with guidance.
+func rbacProblems(rg types.ReplicationGroup, engineVersion string) []string {
+	var problems []string
+	switch engine := strings.ToLower(aws.ToString(rg.Engine)); engine {
+	case engineValkey:
+	case engineRedis, "":
+		if major, ok := majorVersion(engineVersion); ok && major < minRBACRedisVersion {
+			problems = append(problems, fmt.Sprintf("it runs Redis %s, and user groups need Redis %d.0 or later; upgrade its engine version", engineVersion, minRBACRedisVersion))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("its engine is %s, which doesn't support user groups", engine))
+	}
+	if aws.ToBool(rg.AuthTokenEnabled) {
+		problems = append(problems, "it uses AUTH token authentication; migrate it to RBAC by modifying it with a user group and --auth-token-update-strategy DELETE")
+	}
+	if !aws.ToBool(rg.TransitEncryptionEnabled) {
+		problems = append(problems, "in-transit encryption is disabled, and user groups require it")
+	}
+	return problems
+}
+
+// majorVersion returns the major version of an engine version like 6.2.6.
+func majorVersion(v string) (int, bool) {
+	major, _, _ := strings.Cut(v, ".")
+	n, err := strconv.Atoi(major)
+	return n, err == nil
+}
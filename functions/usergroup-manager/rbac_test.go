@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRBACProblems(t *testing.T) {
+	cases := map[string]struct {
+		reason  string
+		rg      types.ReplicationGroup
+		version string
+		want    []string
+	}{
+		"Supported": {
+			reason:  "Redis 6 or later with in-transit encryption and no AUTH token should support user groups.",
+			rg:      types.ReplicationGroup{Engine: aws.String("redis"), TransitEncryptionEnabled: aws.Bool(true)},
+			version: "7.1",
+		},
+		"Valkey": {
+			reason:  "Every Valkey version should support user groups.",
+			rg:      types.ReplicationGroup{Engine: aws.String("valkey"), TransitEncryptionEnabled: aws.Bool(true)},
+			version: "5.0",
+		},
+		"OldRedis": {
+			reason:  "Redis before 6.0 should be reported with guidance to upgrade.",
+			rg:      types.ReplicationGroup{Engine: aws.String("redis"), TransitEncryptionEnabled: aws.Bool(true)},
+			version: "5.0.6",
+			want:    []string{"it runs Redis 5.0.6, and user groups need Redis 6.0 or later; upgrade its engine version"},
+		},
+		"AuthToken": {
+			reason:  "AUTH token mode and missing in-transit encryption should both be reported.",
+			rg:      types.ReplicationGroup{Engine: aws.String("redis"), AuthTokenEnabled: aws.Bool(true)},
+			version: "6.2.6",
+			want: []string{
+				"it uses AUTH token authentication; migrate it to RBAC by modifying it with a user group and --auth-token-update-strategy DELETE",
+				"in-transit encryption is disabled, and user groups require it",
+			},
+		},
+		"Memcached": {
+			reason:  "Engines other than Redis and Valkey should be reported.",
+			rg:      types.ReplicationGroup{Engine: aws.String("memcached"), TransitEncryptionEnabled: aws.Bool(true)},
+			version: "1.6.22",
+			want:    []string{"its engine is memcached, which doesn't support user groups"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := rbacProblems(tc.rg, tc.version)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nrbacProblems(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
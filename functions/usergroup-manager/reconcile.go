@@ -0,0 +1,12 @@
+package main
+
+import "time"
+
+// settleRequeueInterval is how soon the function asks to be called again
+// while the user group or the users to add to it aren't active, rather than
+// waiting for the usual poll interval.
+const settleRequeueInterval = 15 * time.Second
+
+// plannedChangesKey is the context key a dry run writes the membership
+// changes it didn't make to, e.g. for a later step to post to a PR.
+const plannedChangesKey = "plannedChanges"
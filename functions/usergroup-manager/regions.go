@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// regionPattern matches the regions of the aws, aws-us-gov and aws-cn
+// partitions, e.g. us-east-1, us-gov-west-1 or cn-northwest-1.
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-gov)?-[a-z]+-\d+$`)
+
+// parseRegions validates region and reads the additional regions. An invalid
+// region is reported and replaced by the default. Additional regions that are
+// invalid, or in another partition than region, are reported and dropped,
+// since the function's credentials are only valid in one partition.
+func parseRegions(r *paramReader, region string) (string, []string) {
+	if !regionPattern.MatchString(region) {
+		r.errs = append(r.errs, fmt.Errorf("spec.parameters.region: %q is not a region of the aws, aws-us-gov or aws-cn partitions", region))
+		region = defaultRegion
+	}
+	var regions []string
+	for _, rg := range r.StringList("spec.parameters.regions") {
+		switch {
+		case !regionPattern.MatchString(rg):
+			r.errs = append(r.errs, fmt.Errorf("spec.parameters.regions: %q is not a region of the aws, aws-us-gov or aws-cn partitions", rg))
+		case discovery.Partition(rg) != discovery.Partition(region):
+			r.errs = append(r.errs, fmt.Errorf("spec.parameters.regions: %q is in partition %s, but region %s is in %s", rg, discovery.Partition(rg), region, discovery.Partition(region)))
+		default:
+			regions = append(regions, rg)
+		}
+	}
+	return region, regions
+}
+
+// regionsStatus returns the user IDs discovered in each region as written to
+// the XR status. Regions that failed report their error instead.
+func regionsStatus(rds []discovery.Region) map[string]any {
+	out := make(map[string]any, len(rds))
+	for _, rd := range rds {
+		if rd.Err != nil {
+			out[rd.Region] = map[string]any{"error": rd.Err.Error()}
+			continue
+		}
+		out[rd.Region] = map[string]any{
+			"discoveredUsers": len(rd.UserIDs),
+			"userIDs":         rd.UserIDs,
+		}
+	}
+	return out
+}
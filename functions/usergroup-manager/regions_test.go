@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestRegionsStatus(t *testing.T) {
+	rds := []discovery.Region{
+		{Region: "eu-west-1", UserIDs: []string{"default", "app1"}},
+		{Region: "us-west-2", Err: errors.New("region us-west-2: failed to describe ElastiCache users: boom")},
+	}
+
+	want := map[string]any{
+		"eu-west-1": map[string]any{"discoveredUsers": 2, "userIDs": []string{"default", "app1"}},
+		"us-west-2": map[string]any{"error": "region us-west-2: failed to describe ElastiCache users: boom"},
+	}
+	if diff := cmp.Diff(want, regionsStatus(rds)); diff != "" {
+		t.Errorf("regionsStatus(...): -want, +got:\n%s", diff)
+	}
+}
+
+func TestParseRegions(t *testing.T) {
+	type want struct {
+		region  string
+		regions []string
+		errs    int
+	}
+
+	cases := map[string]struct {
+		reason string
+		region string
+		params map[string]any
+		want   want
+	}{
+		"Standard": {
+			reason: "Additional regions in the region's partition should be read.",
+			region: "us-east-1",
+			params: map[string]any{"regions": []any{"eu-west-1"}},
+			want:   want{region: "us-east-1", regions: []string{"eu-west-1"}},
+		},
+		"GovCloud": {
+			reason: "GovCloud regions should be accepted together.",
+			region: "us-gov-west-1",
+			params: map[string]any{"regions": []any{"us-gov-east-1"}},
+			want:   want{region: "us-gov-west-1", regions: []string{"us-gov-east-1"}},
+		},
+		"OtherPartition": {
+			reason: "Additional regions in another partition should be reported and dropped.",
+			region: "cn-north-1",
+			params: map[string]any{"regions": []any{"cn-northwest-1", "us-east-1"}},
+			want:   want{region: "cn-north-1", regions: []string{"cn-northwest-1"}, errs: 1},
+		},
+		"InvalidRegion": {
+			reason: "An invalid region should be reported and the default used.",
+			region: "useast1",
+			want:   want{region: defaultRegion, errs: 1},
+		},
+		"InvalidAdditionalRegion": {
+			reason: "An invalid additional region should be reported and dropped.",
+			region: "us-east-1",
+			params: map[string]any{"regions": []any{"eu-west"}},
+			want:   want{region: "us-east-1", errs: 1},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := &paramReader{root: map[string]any{"spec": map[string]any{"parameters": tc.params}}}
+			region, regions := parseRegions(r, tc.region)
+			got := want{region: region, regions: regions, errs: len(r.errs)}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nparseRegions(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
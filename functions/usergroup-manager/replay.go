@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/input/v1beta1"
+)
+
+// replayWindow is how long the response to a request that may modify AWS
+// resources is replayed to duplicate deliveries of the same request.
+const replayWindow = 5 * time.Minute
+
+// maxReplayEntries bounds the replay cache's memory. The oldest response is
+// evicted to make room for a new one.
+const maxReplayEntries = 1024
+
+// A replayKey identifies a delivery of a request. Crossplane derives the tag
+// from the request's content, so a re-delivery of the same request has the
+// same key.
+type replayKey struct {
+	Tag       string
+	XRUID     string
+	InputHash string
+}
+
+// newReplayKey returns the key of the supplied request, and whether it's one
+// the function may modify AWS resources for. Only those are replayed.
+func newReplayKey(req *fnv1.RunFunctionRequest) (replayKey, bool) {
+	oxr, err := request.GetObservedCompositeResource(req)
+	if err != nil {
+		return replayKey{}, false
+	}
+	in := &v1beta1.Input{}
+	if err := request.GetInput(req, in); err != nil {
+		return replayKey{}, false
+	}
+	params, _ := parseParameters(withInputDefaults(oxr.Resource.Object, in))
+	if !params.mutates() {
+		return replayKey{}, false
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req.GetInput())
+	if err != nil {
+		return replayKey{}, false
+	}
+	sum := sha256.Sum256(b)
+	return replayKey{
+		Tag:       req.GetMeta().GetTag(),
+		XRUID:     string(oxr.Resource.GetUID()),
+		InputHash: hex.EncodeToString(sum[:]),
+	}, true
+}
+
+// mutates returns true if the function may modify AWS resources itself,
+// rather than leaving it to provider-aws.
+func (p *parameters) mutates() bool {
+	return p.Features.Enabled(featureApplyMode) && !p.DryRun && (p.ManagementMode == managementModeDirect || p.Migration.ReplicationGroupID != "")
+}
+
+type replayEntry struct {
+	rsp    *fnv1.RunFunctionResponse
+	stored time.Time
+}
+
+// A replayCache holds recent responses to requests that may modify AWS
+// resources, so duplicate deliveries don't apply changes twice. A nil cache
+// replays nothing.
+type replayCache struct {
+	mu      sync.Mutex
+	entries map[replayKey]replayEntry
+	now     func() time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{entries: map[replayKey]replayEntry{}, now: time.Now}
+}
+
+// Get returns a copy of the response stored for the key within the replay
+// window.
+func (c *replayCache) Get(k replayKey) (*fnv1.RunFunctionResponse, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[k]
+	if !ok || c.now().Sub(e.stored) > replayWindow {
+		return nil, false
+	}
+	return proto.Clone(e.rsp).(*fnv1.RunFunctionResponse), true
+}
+
+// Put stores a copy of the response for the key, dropping expired responses
+// and, if the cache is still full, the oldest one.
+func (c *replayCache) Put(k replayKey, rsp *fnv1.RunFunctionResponse) {
+	if c == nil || rsp == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for key, e := range c.entries {
+		if now.Sub(e.stored) > replayWindow {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) >= maxReplayEntries {
+		var oldest replayKey
+		var oldestTime time.Time
+		for key, e := range c.entries {
+			if oldestTime.IsZero() || e.stored.Before(oldestTime) {
+				oldest, oldestTime = key, e.stored
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[k] = replayEntry{rsp: proto.Clone(rsp).(*fnv1.RunFunctionResponse), stored: now}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+)
+
+func TestNewReplayKey(t *testing.T) {
+	req := func(parameters string) *fnv1.RunFunctionRequest {
+		return &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "hello"},
+			Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+				"apiVersion": "customer.upbound.io/v1alpha1",
+				"kind": "XCacheInfra",
+				"metadata": {"name": "prod", "uid": "1234"},
+				"spec": {"parameters": ` + parameters + `}
+			}`)}},
+		}
+	}
+
+	cases := map[string]struct {
+		reason  string
+		req     *fnv1.RunFunctionRequest
+		mutates bool
+	}{
+		"Discover": {
+			reason:  "Discovering users doesn't modify AWS resources, so it shouldn't be replayed.",
+			req:     req(`{"features": {"applyMode": true}}`),
+			mutates: false,
+		},
+		"DirectWithoutApplyMode": {
+			reason:  "Direct mode only modifies user groups if the applyMode feature is enabled.",
+			req:     req(`{"managementMode": "direct", "userGroupId": "app"}`),
+			mutates: false,
+		},
+		"Direct": {
+			reason:  "Direct mode with the applyMode feature modifies user groups, so it should be replayed.",
+			req:     req(`{"managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}}`),
+			mutates: true,
+		},
+		"Migration": {
+			reason:  "A migration with the applyMode feature modifies replication groups, so it should be replayed.",
+			req:     req(`{"migration": {"replicationGroupId": "orders", "userGroupId": "app"}, "features": {"applyMode": true}}`),
+			mutates: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			key, mutates := newReplayKey(tc.req)
+			if diff := cmp.Diff(tc.mutates, mutates); diff != "" {
+				t.Errorf("%s\nnewReplayKey(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if mutates && (key.Tag != "hello" || key.XRUID != "1234" || key.InputHash == "") {
+				t.Errorf("%s\nnewReplayKey(...): incomplete key %+v", tc.reason, key)
+			}
+		})
+	}
+}
+
+func TestReplayCache(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newReplayCache()
+	c.now = func() time.Time { return now }
+
+	key := replayKey{Tag: "hello", XRUID: "1234"}
+	rsp := &fnv1.RunFunctionResponse{Meta: &fnv1.ResponseMeta{Tag: "hello"}}
+	c.Put(key, rsp)
+
+	got, ok := c.Get(key)
+	if !ok {
+		t.Fatalf("Get(...): want a stored response")
+	}
+	if diff := cmp.Diff(rsp, got, protocmp.Transform()); diff != "" {
+		t.Errorf("Get(...): -want, +got:\n%s", diff)
+	}
+
+	if _, ok := c.Get(replayKey{Tag: "other", XRUID: "1234"}); ok {
+		t.Errorf("Get(...): a different request should not be replayed")
+	}
+
+	now = now.Add(replayWindow + time.Second)
+	if _, ok := c.Get(key); ok {
+		t.Errorf("Get(...): a response older than the replay window should not be replayed")
+	}
+}
+
+func TestReplayCacheEvictsOldest(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newReplayCache()
+	c.now = func() time.Time { return now }
+
+	first := replayKey{Tag: "first"}
+	c.Put(first, &fnv1.RunFunctionResponse{})
+	for i := range maxReplayEntries {
+		now = now.Add(time.Millisecond)
+		c.Put(replayKey{Tag: "tag", InputHash: string(rune(i))}, &fnv1.RunFunctionResponse{})
+	}
+
+	if _, ok := c.Get(first); ok {
+		t.Errorf("Put(...): the oldest response should be evicted from a full cache")
+	}
+	if got := len(c.entries); got != maxReplayEntries {
+		t.Errorf("Put(...): want %d entries, got %d", maxReplayEntries, got)
+	}
+}
+
+func TestRunFunctionReplaysDuplicates(t *testing.T) {
+	req := func(parameters string) *fnv1.RunFunctionRequest {
+		return &fnv1.RunFunctionRequest{
+			Meta: &fnv1.RequestMeta{Tag: "hello"},
+			Observed: &fnv1.State{Composite: &fnv1.Resource{Resource: resource.MustStructJSON(`{
+				"apiVersion": "customer.upbound.io/v1alpha1",
+				"kind": "XCacheInfra",
+				"metadata": {"name": "prod", "namespace": "default", "uid": "1234"},
+				"spec": {"parameters": ` + parameters + `}
+			}`)}},
+			Credentials: map[string]*fnv1.Credentials{
+				awsCredentialsName: {Source: &fnv1.Credentials_CredentialData{CredentialData: &fnv1.CredentialData{
+					Data: map[string][]byte{"aws_access_key_id": []byte("AKIA"), "aws_secret_access_key": []byte("secret")},
+				}}},
+			},
+		}
+	}
+	user := func(id, status string) types.User {
+		return types.User{UserId: aws.String(id), UserName: aws.String(id), Engine: aws.String(engineRedis), Status: aws.String(status)}
+	}
+	group := func() []types.UserGroup {
+		return []types.UserGroup{{
+			UserGroupId: aws.String("app"),
+			ARN:         aws.String("arn:aws:elasticache:us-east-1:123456789012:usergroup:app"),
+			Status:      aws.String(membership.StatusActive),
+			UserIds:     []string{discovery.DefaultUserID, "gone"},
+		}}
+	}
+	direct := `{"region": "us-east-1", "managementMode": "direct", "userGroupId": "app", "features": {"applyMode": true}, "applyLock": {"enabled": true}}`
+
+	type want struct {
+		modified   int
+		reconciled string
+	}
+
+	cases := map[string]struct {
+		reason string
+		client *fakeElastiCache
+		// between changes AWS between the first and the duplicate delivery.
+		between func(c *fakeElastiCache)
+		want    want
+	}{
+		"Modified": {
+			reason: "A duplicate delivery of a request the function modified the user group for should get the first response, without AWS calls.",
+			client: &fakeElastiCache{users: []types.User{user("app1", "active"), user(discovery.DefaultUserID, "active")}, userGroups: group()},
+			between: func(c *fakeElastiCache) {
+				c.err = errors.New("AWS shouldn't be called")
+			},
+			want: want{modified: 1, reconciled: "Modified"},
+		},
+		"WaitingToSettle": {
+			reason: "A duplicate delivery of a request that waited for users to settle should run again, modifying the user group once they have.",
+			client: &fakeElastiCache{users: []types.User{user("app1", "modifying"), user(discovery.DefaultUserID, "active")}, userGroups: group()},
+			between: func(c *fakeElastiCache) {
+				c.users[0].Status = aws.String("active")
+			},
+			want: want{modified: 1, reconciled: "Modified"},
+		},
+		"Locked": {
+			reason: "A duplicate delivery of a request that found the user group locked should run again, modifying the user group once it's unlocked.",
+			client: &fakeElastiCache{
+				users:      []types.User{user("app1", "active"), user(discovery.DefaultUserID, "active")},
+				userGroups: group(),
+				tags: map[string][]types.Tag{"arn:aws:elasticache:us-east-1:123456789012:usergroup:app": {
+					{Key: aws.String(membership.LockTagKey), Value: aws.String("other-pod/5678 2099-01-01T00:00:00Z")},
+				}},
+			},
+			between: func(c *fakeElastiCache) {
+				c.tags = nil
+			},
+			want: want{modified: 1, reconciled: "Modified"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &Function{log: logging.NewNopLogger(), elastiCache: tc.client, sts: &fakeSTS{account: "123456789012"}, replays: newReplayCache()}
+			if _, err := f.RunFunction(context.Background(), req(direct)); err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): %v", tc.reason, err)
+			}
+			tc.between(tc.client)
+			rsp, err := f.RunFunction(context.Background(), req(direct))
+			if err != nil {
+				t.Fatalf("%s\nf.RunFunction(...): %v", tc.reason, err)
+			}
+
+			got := want{modified: len(tc.client.modified)}
+			for _, c := range rsp.GetConditions() {
+				if c.GetType() == "UserGroupReconciled" {
+					got.reconciled = c.GetReason()
+				}
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nf.RunFunction(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+// requireResources asks Crossplane for the resources matching sel and returns
+// them if Crossplane already supplied them. Crossplane calls the function
+// again with the resources after the first response requiring them, so it
+// returns false until then.
+//
+// The requirement must be added to every response, or Crossplane stops
+// supplying the resources.
+func requireResources(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse, key string, sel *fnv1.ResourceSelector) ([]resource.Required, bool, error) {
+	if rsp.Requirements == nil {
+		rsp.Requirements = &fnv1.Requirements{}
+	}
+	if rsp.Requirements.Resources == nil {
+		rsp.Requirements.Resources = map[string]*fnv1.ResourceSelector{}
+	}
+	rsp.Requirements.Resources[key] = sel
+
+	required, err := request.GetRequiredResources(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot get required resources: %w", err)
+	}
+	rs, ok := required[key]
+	if !ok {
+		// Not required yet. Crossplane will call again.
+		return nil, false, nil
+	}
+	return rs, true, nil
+}
+
+// requireConfigMap asks Crossplane for the named ConfigMap and returns it if
+// Crossplane already supplied it. A missing ConfigMap is only an error once it
+// has been required and still isn't supplied.
+func requireConfigMap(req *fnv1.RunFunctionRequest, rsp *fnv1.RunFunctionResponse, key, namespace, name string) (*unstructured.Unstructured, bool, error) {
+	rs, ok, err := requireResources(req, rsp, key, &fnv1.ResourceSelector{
+		ApiVersion: "v1",
+		Kind:       "ConfigMap",
+		Match:      &fnv1.ResourceSelector_MatchName{MatchName: name},
+		Namespace:  &namespace,
+	})
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if len(rs) == 0 {
+		return nil, false, fmt.Errorf("ConfigMap %s/%s not found", namespace, name)
+	}
+	return rs[0].Resource, true, nil
+}
+
+// configMapValue returns the value of a ConfigMap data key.
+func configMapValue(cm *unstructured.Unstructured, key string) (string, error) {
+	v, ok, err := unstructured.NestedString(cm.Object, "data", key)
+	if err != nil {
+		return "", fmt.Errorf("ConfigMap %s/%s key %q: %w", cm.GetNamespace(), cm.GetName(), key, err)
+	}
+	if !ok {
+		return "", fmt.Errorf("ConfigMap %s/%s has no key %q", cm.GetNamespace(), cm.GetName(), key)
+	}
+	return v, nil
+}
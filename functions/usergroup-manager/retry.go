@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// defaultDiscoveryAttempts is how many times user discovery is attempted by
+// default.
+const defaultDiscoveryAttempts = 2
+
+// discoveryBackoff is how long to wait before retrying user discovery the
+// first time. It doubles with every attempt, up to the maximum backoff.
+const discoveryBackoff = time.Second
+
+// Sync mode recorded in status when discovery failed transiently and the
+// previously discovered users were used instead.
+const syncModeStale = "stale"
+
+type retryParameters struct {
+	// MaxAttempts and MaxBackoff configure the SDK's retryer, which retries
+	// each AWS API call.
+	MaxAttempts int
+	MaxBackoff  time.Duration
+
+	// DiscoveryAttempts is how many times the whole discovery pass is
+	// attempted while it fails with a transient error, e.g. throttling that
+	// outlasted the SDK's retries.
+	DiscoveryAttempts int
+}
+
+// Retryer returns the SDK retryer for the parameters. It backs off
+// exponentially with jitter.
+func (p retryParameters) Retryer() aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = max(p.MaxAttempts, 1)
+		o.MaxBackoff = p.MaxBackoff
+	})
+}
+
+// A passRetrier retries a pass of several AWS calls, such as discovering
+// every user, while it fails with a transient error.
+type passRetrier struct {
+	Attempts   int
+	MaxBackoff time.Duration
+
+	// sleep waits for d, or until ctx is done.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newPassRetrier(p retryParameters) *passRetrier {
+	return &passRetrier{Attempts: p.DiscoveryAttempts, MaxBackoff: p.MaxBackoff, sleep: sleep}
+}
+
+// Do calls fn until it succeeds, fails with an error that isn't transient, or
+// has been called Attempts times. It waits between calls with exponential
+// backoff and full jitter. It returns fn's last error.
+func (r *passRetrier) Do(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := range max(r.Attempts, 1) {
+		if attempt > 0 {
+			if serr := r.sleep(ctx, r.backoff(attempt)); serr != nil {
+				return err
+			}
+		}
+		if err = fn(); err == nil || !awsclient.IsTransient(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// backoff returns how long to wait before the supplied attempt: a random
+// duration up to discoveryBackoff doubled for every earlier retry, capped at
+// MaxBackoff.
+func (r *passRetrier) backoff(attempt int) time.Duration {
+	d := discoveryBackoff << min(attempt-1, 30)
+	if r.MaxBackoff > 0 && d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	return rand.N(d) + 1
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestPassRetrierDo(t *testing.T) {
+	throttled := &smithy.GenericAPIError{Code: "Throttling"}
+	boom := errors.New("boom")
+
+	type want struct {
+		err    error
+		calls  int
+		sleeps int
+	}
+
+	cases := map[string]struct {
+		reason   string
+		attempts int
+		errs     []error
+		want     want
+	}{
+		"Success": {
+			reason:   "A pass that succeeds shouldn't be retried.",
+			attempts: 3,
+			errs:     []error{nil},
+			want:     want{calls: 1},
+		},
+		"RetryTransient": {
+			reason:   "A pass that's throttled should be retried after backing off.",
+			attempts: 3,
+			errs:     []error{throttled, throttled, nil},
+			want:     want{calls: 3, sleeps: 2},
+		},
+		"GiveUp": {
+			reason:   "The last error should be returned once every attempt was throttled.",
+			attempts: 2,
+			errs:     []error{throttled, throttled},
+			want:     want{err: throttled, calls: 2, sleeps: 1},
+		},
+		"NotTransient": {
+			reason:   "A pass that fails with an error that isn't transient shouldn't be retried.",
+			attempts: 3,
+			errs:     []error{boom},
+			want:     want{err: boom, calls: 1},
+		},
+		"NoAttempts": {
+			reason:   "A pass should be attempted at least once.",
+			attempts: 0,
+			errs:     []error{nil},
+			want:     want{calls: 1},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := want{}
+			r := &passRetrier{
+				Attempts:   tc.attempts,
+				MaxBackoff: 5 * time.Second,
+				sleep: func(_ context.Context, d time.Duration) error {
+					if d <= 0 || d > 5*time.Second {
+						t.Errorf("%s\nDo(...): backoff %s out of range", tc.reason, d)
+					}
+					got.sleeps++
+					return nil
+				},
+			}
+			got.err = r.Do(context.Background(), func() error {
+				err := tc.errs[got.calls]
+				got.calls++
+				return err
+			})
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{}), cmpopts.EquateErrors()); diff != "" {
+				t.Errorf("%s\nDo(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestPassRetrierBackoff(t *testing.T) {
+	r := &passRetrier{MaxBackoff: 3 * time.Second}
+	for attempt, limit := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 3 * time.Second, 10: 3 * time.Second} {
+		for range 100 {
+			if d := r.backoff(attempt); d <= 0 || d > limit {
+				t.Fatalf("backoff(%d): want at most %s, got %s", attempt, limit, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/input/v1beta1"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/policy"
+)
+
+// A run is one call of the function for an XR. RunFunction runs its phases in
+// order. Each phase reads what earlier phases found and records what it
+// finds, and returns false if the run must stop, e.g. because it wrote a
+// Fatal result.
+type run struct {
+	f   *Function
+	ctx context.Context
+	req *fnv1.RunFunctionRequest
+	rsp *fnv1.RunFunctionResponse
+	log logging.Logger
+
+	// started is when the run started, and now when it read the XR. Every
+	// phase uses now, so e.g. the times it records agree.
+	started time.Time
+	now     time.Time
+
+	oxr      *resource.Composite
+	observed map[resource.Name]resource.ObservedComposed
+	params   *parameters
+	names    *nameHasher
+	cfg      aws.Config
+	client   awsclient.ElastiCache
+	calls    *apiCallRecorder
+
+	credsStatus   map[string]any
+	bundleReq     supportBundleRequest
+	collectBundle bool
+
+	// What the XR's status recorded about earlier runs.
+	previousIDs            []string
+	lastFullSync           string
+	lastFullSyncGeneration int64
+	prioritized            bool
+	history                []userCountSample
+
+	// The discovered users, sorted by ID, and how they were discovered.
+	users               []discovery.User
+	userIDs             []string
+	syncMode            string
+	goneIDs             []string
+	provisioningIDs     []string
+	excludedIDs         []string
+	otherRegionIDs      []string
+	otherAccountIDs     []string
+	pooled              map[string]bool
+	fullDeferred        bool
+	defaultUserExcluded bool
+	staleErr            error
+
+	// status is written to status.userGroupManager, and output to the
+	// composable output context key.
+	status map[string]any
+	output *composableOutput
+
+	groups           []userGroupMembership
+	implicit         *userGroupMembership
+	declaredComplete bool
+	defaults         map[string]string
+	missingDefaults  []string
+	defaultsChecked  bool
+
+	// The desired state, and the plan to reach it. drift is the drift of
+	// composed user groups from the desired state, and bypass the
+	// security-critical removals made even though the plan is held.
+	state       *desiredState
+	doc         string
+	drift       []membership.Diff
+	plan        *policy.Plan
+	hash        string
+	held        bool
+	bypass      *securityBypass
+	apply       bool
+	applied     *membership.Applied
+	migration   *migrationStatus
+	replacement *defaultUserReplacement
+	reconcile   *membership.Reconcile
+	settled     bool
+
+	// mutated is true if the run modified AWS resources, and deferred if it
+	// put off modifying them until a later run, e.g. because they were
+	// locked or hadn't settled.
+	mutated  bool
+	deferred bool
+
+	durations struct {
+		Discovery time.Duration
+		Filtering time.Duration
+		Policy    time.Duration
+		Apply     time.Duration
+	}
+}
+
+// timed returns a phase that runs the supplied phases in order until one of
+// them stops the run, recording the time they took in d.
+func (r *run) timed(name string, d *time.Duration, phases ...func() bool) func() bool {
+	return r.summarized(name, func() bool {
+		defer func(started time.Time) { *d = time.Since(started) }(time.Now())
+		return r.all(phases...)
+	})
+}
+
+// summarized returns a phase that runs the supplied phases in order until one
+// of them stops the run, then logs a summary of the AWS API calls they made.
+func (r *run) summarized(name string, phases ...func() bool) func() bool {
+	return func() bool {
+		defer r.calls.Summarize(name, r.calls.Mark())
+		return r.all(phases...)
+	}
+}
+
+// all runs the supplied phases in order until one of them stops the run. It
+// returns false if the run stopped.
+func (r *run) all(phases ...func() bool) bool {
+	for _, phase := range phases {
+		if !phase() {
+			return false
+		}
+	}
+	return true
+}
+
+// replayable returns true if the run's response may be replayed to duplicate
+// deliveries of its request. Only a response to a run that modified AWS
+// resources is, since replaying one that was waiting, e.g. for a plan to be
+// approved or AWS to settle, would skip the retry it asked for.
+func (r *run) replayable() bool {
+	return r.mutated && !r.deferred && !r.held
+}
+
+// fatal stops the run with a Fatal result.
+func (r *run) fatal(err error) bool {
+	response.Fatal(r.rsp, err)
+	return false
+}
+
+// discoveryFailed stops the run with a Fatal result for a failed user
+// discovery. The UserDiscoverySuccess condition names any IAM permissions
+// that are missing, or the kind of AWS error.
+func (r *run) discoveryFailed(err error) bool {
+	var pe *permissionError
+	switch {
+	case errors.As(err, &pe):
+		response.ConditionFalse(r.rsp, "UserDiscoverySuccess", "MissingPermissions").
+			WithMessage(fmt.Sprintf("The function's AWS credentials are missing IAM permissions for %s", strings.Join(pe.Missing, ", "))).
+			TargetCompositeAndClaim()
+	case awsclient.Kind(err) != nil:
+		response.ConditionFalse(r.rsp, "UserDiscoverySuccess", failureReason(err, "")).WithMessage(err.Error()).TargetCompositeAndClaim()
+	}
+	return r.fatal(err)
+}
+
+// diagnose probes every action the function needs if err is an access denied
+// error, so the result lists exactly which are missing.
+func (r *run) diagnose(err error) error {
+	return diagnosePermissions(r.ctx, err, r.f.permissionChecks(r.cfg, r.client, r.params))
+}
+
+// setup reads the XR and the function's input, and creates the AWS clients.
+func (r *run) setup() bool {
+	// Get the observed composite resource (XCacheInfra)
+	oxr, err := request.GetObservedCompositeResource(r.req)
+	if err != nil {
+		return r.fatal(err)
+	}
+	r.oxr = oxr
+
+	// The function's input supplies defaults for the XR's parameters
+	in := &v1beta1.Input{}
+	if err := request.GetInput(r.req, in); err != nil {
+		return r.fatal(err)
+	}
+
+	// Extract parameters from the XR, falling back to defaults for any that
+	// can't be used
+	params, errs := parseParameters(withInputDefaults(oxr.Resource.Object, in))
+	for _, err := range errs {
+		r.f.log.Info("Ignoring invalid parameter", "error", err)
+		response.Warning(r.rsp, fmt.Errorf("ignoring invalid parameter: %w", err)).TargetCompositeAndClaim()
+	}
+	r.params = params
+
+	// Get AWS credentials from the request, decrypting them if necessary, or
+	// the default chain if enabled
+	credsOpts, credsSource, err := r.f.credentialsOptions(r.ctx, r.req, params.Region, params.CredentialSource)
+	if err != nil {
+		return r.fatal(err)
+	}
+
+	// Hash names before they're written to telemetry, if required
+	if params.Telemetry.HashNames {
+		if r.names, err = newNameHasher(r.req); err != nil {
+			return r.fatal(err)
+		}
+	}
+
+	// Collect a support bundle if one was requested with an annotation
+	r.now = time.Now()
+	r.bundleReq = observedSupportBundleRequest(oxr)
+	r.collectBundle = r.bundleReq.Due(r.now)
+
+	// Record every AWS API call made for this XR in the audit log, capturing
+	// them in full if a support bundle is being collected
+	r.log = r.f.log.WithValues(
+		"tag", r.req.GetMeta().GetTag(),
+		"xrNamespace", r.names.Hash(oxr.Resource.GetNamespace()),
+		"xrName", r.names.Hash(oxr.Resource.GetName()),
+	)
+	r.calls = &apiCallRecorder{
+		log:     r.log,
+		Metrics: rand.Float64() < params.Telemetry.sampleRate(r.f.telemetrySampleRate),
+		Capture: r.collectBundle,
+	}
+	r.log.Debug("Using AWS credentials", "source", credsSource)
+
+	// Initialize AWS SDK config. The app ID and user agent let CloudTrail
+	// entries be attributed to this function and XR.
+	r.cfg, err = awsconfig.LoadDefaultConfig(r.ctx, append([]func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(params.Region),
+		awsconfig.WithRetryer(params.Retry.Retryer),
+		awsconfig.WithAppID(appID(oxr.Resource.GetNamespace(), oxr.Resource.GetName())),
+		awsconfig.WithAPIOptions([]func(*middleware.Stack) error{
+			r.calls.Install,
+			awsclient.ClassifyErrors,
+			awsmiddleware.AddUserAgentKeyValue(functionName, functionVersion()),
+		}),
+	}, credsOpts...)...)
+	if err != nil {
+		return r.fatal(fmt.Errorf("failed to load AWS config: %w", err))
+	}
+
+	// Record which credentials took effect, without revealing them. An
+	// assumed role's temporary keys change with every refresh, so the base
+	// credentials are fingerprinted instead.
+	fingerprint, err := credentialsFingerprint(r.ctx, r.cfg.Credentials, credsSource, os.Getenv("AWS_ROLE_ARN"))
+	if err != nil {
+		return r.fatal(err)
+	}
+	r.credsStatus = map[string]any{
+		"source":      credsSource,
+		"fingerprint": fingerprint,
+	}
+
+	// Manage caches in another account by assuming a role there
+	if ar := params.AssumeRole; ar.RoleARN != "" {
+		r.cfg.Credentials = r.f.assumeRole(r.cfg, ar, appID(oxr.Resource.GetNamespace(), oxr.Resource.GetName()))
+		r.credsStatus["assumedRole"] = "role ..." + lastChars(ar.RoleARN, fingerprintLength)
+	}
+
+	// Refresh expired temporary credentials and retry once, rather than
+	// failing until the next reconcile
+	cache, _ := r.cfg.Credentials.(*aws.CredentialsCache)
+	retrier := &expiredTokenRetrier{log: r.log, creds: cache, refreshable: credsSource == credentialsSourceDefaultChain || params.AssumeRole.RoleARN != ""}
+	r.cfg.APIOptions = append(r.cfg.APIOptions, retrier.Install)
+
+	// Create ElastiCache client
+	r.client = r.f.elastiCacheClient(r.cfg, params.Region, params.EndpointURL)
+	return true
+}
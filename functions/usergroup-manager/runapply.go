@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/crossplane/function-sdk-go/response"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+// applyMigration advances the move of a replication group to RBAC by a
+// phase.
+func (r *run) applyMigration() bool {
+	m := r.migration
+	if m == nil {
+		return true
+	}
+	var err error
+	switch {
+	case !r.apply:
+	case r.held && m.Phase == migrationPhaseReady:
+		r.deferred = true
+		m.Message = fmt.Sprintf("Waiting for plan %s to be approved", r.hash)
+	default:
+		phase := m.Phase
+		err = m.Associate(r.ctx, r.client)
+		r.mutated = r.mutated || m.Phase != phase
+	}
+	if err != nil {
+		r.f.awsCallFailed(r.rsp, "RBACMigrated", "MigrationFailed", r.diagnose(err))
+		return true
+	}
+	r.f.log.Info("RBAC migration", "replicationGroupId", m.ReplicationGroupID, "phase", m.Phase)
+	r.status["migration"] = m.Status()
+	if m.Phase == migrationPhaseComplete {
+		response.ConditionTrue(r.rsp, "RBACMigrated", m.Phase).WithMessage(m.Message).TargetCompositeAndClaim()
+	} else {
+		response.ConditionFalse(r.rsp, "RBACMigrated", m.Phase).WithMessage(m.Message).TargetCompositeAndClaim()
+	}
+	return true
+}
+
+// applyReplacement advances the replacement of the built-in default user by
+// a phase.
+func (r *run) applyReplacement() bool {
+	rep := r.replacement
+	if rep == nil {
+		return true
+	}
+	var err error
+	switch {
+	case !r.apply:
+	case r.held && (rep.Phase == replacementPhasePending || rep.Phase == replacementPhaseReady):
+		r.deferred = true
+		rep.Message = fmt.Sprintf("Waiting for plan %s to be approved", r.hash)
+	default:
+		phase := rep.Phase
+		err = rep.Advance(r.ctx, r.client, originTags(r.oxr))
+		r.mutated = r.mutated || rep.Phase != phase
+	}
+	if err != nil {
+		r.f.awsCallFailed(r.rsp, "DefaultUserReplaced", "ReplacementFailed", r.diagnose(err))
+		return true
+	}
+	r.f.log.Info("Default user replacement", "userGroupId", r.names.Hash(rep.UserGroupID), "phase", rep.Phase)
+	r.status["defaultUserReplacement"] = rep.Status()
+	r.settled = r.settled && rep.Settled()
+	if rep.Phase == replacementPhaseComplete {
+		response.ConditionTrue(r.rsp, "DefaultUserReplaced", rep.Phase).WithMessage(rep.Message).TargetCompositeAndClaim()
+	} else {
+		response.ConditionFalse(r.rsp, "DefaultUserReplaced", rep.Phase).WithMessage(rep.Message).TargetCompositeAndClaim()
+	}
+	return true
+}
+
+// applyReconcile converges the target user group's membership on the
+// discovered users in direct mode.
+func (r *run) applyReconcile() bool {
+	rec, params := r.reconcile, r.params
+	if rec == nil {
+		return true
+	}
+	r.status["userGroupReconcile"] = rec.Status()
+	if params.DryRun {
+		changes := rec.PlannedChanges()
+		r.status["plannedChanges"] = changes
+		if _, err := setContextValue(r.rsp, plannedChangesKey, changes); err != nil {
+			return r.fatal(err)
+		}
+	}
+	// Wait for the user group and the users to add to it to settle rather
+	// than racing AWS
+	switch {
+	case rec.Pending != "":
+		response.ConditionFalse(r.rsp, "UserGroupReady", "UserGroupNotActive").
+			WithMessage(fmt.Sprintf("User group %q is %s", rec.UserGroupID, rec.Pending)).
+			TargetCompositeAndClaim()
+	case len(rec.Unsettled) > 0:
+		response.ConditionFalse(r.rsp, "UserGroupReady", "UsersNotActive").
+			WithMessage(fmt.Sprintf("Users %v to add to user group %q aren't active", rec.Unsettled, rec.UserGroupID)).
+			TargetCompositeAndClaim()
+	default:
+		response.ConditionTrue(r.rsp, "UserGroupReady", "Active").TargetCompositeAndClaim()
+	}
+	// A dry run doesn't wait for AWS, since it won't modify anything
+	if !params.DryRun {
+		r.settled = r.settled && rec.Settled()
+	}
+
+	switch {
+	case rec.Diff.Empty():
+		response.ConditionTrue(r.rsp, "UserGroupReconciled", "UpToDate").TargetCompositeAndClaim()
+		switch {
+		case !r.apply:
+		case !rec.Unreported.Empty():
+			response.ConditionFalse(r.rsp, "MembershipApplied", "Verifying").
+				WithMessage(fmt.Sprintf("Waiting for AWS to report the changes to user group %q: %s", rec.UserGroupID, rec.Unreported.String())).
+				TargetCompositeAndClaim()
+			r.settled = false
+		default:
+			response.ConditionTrue(r.rsp, "MembershipApplied", "Applied").TargetCompositeAndClaim()
+		}
+	case params.DryRun:
+		r.f.log.Info("Dry run, not modifying user group membership", "userGroupId", r.names.Hash(rec.UserGroupID), "added", len(rec.Diff.Added), "removed", len(rec.Diff.Removed))
+		response.Normal(r.rsp, "Dry run: "+r.names.HashDiff(rec.Diff).String()).TargetCompositeAndClaim()
+		response.ConditionFalse(r.rsp, "UserGroupReconciled", "DryRun").
+			WithMessage(fmt.Sprintf("Dry run: would add %d and remove %d users; see status.%s.plannedChanges", len(rec.Diff.Added), len(rec.Diff.Removed), status.Key)).
+			TargetCompositeAndClaim()
+	case !rec.Settled():
+		r.deferred = true
+		r.f.log.Info("User group or users to add aren't active, retrying soon", "userGroupId", r.names.Hash(rec.UserGroupID), "status", rec.Pending, "unsettledUsers", len(rec.Unsettled))
+		response.ConditionFalse(r.rsp, "UserGroupReconciled", "WaitingToSettle").
+			WithMessage("Waiting for the user group and the users to add to it to be active").
+			TargetCompositeAndClaim()
+	case r.held && r.bypass == nil:
+		r.deferred = true
+		response.ConditionFalse(r.rsp, "UserGroupReconciled", "AwaitingApproval").
+			WithMessage(fmt.Sprintf("Waiting for plan %s to be approved", r.hash)).
+			TargetCompositeAndClaim()
+	default:
+		r.modifyUserGroup(rec)
+	}
+	return true
+}
+
+// modifyUserGroup applies the reconcile's membership changes, then reads them
+// back before claiming they're applied, since AWS may not report them right
+// away.
+func (r *run) modifyUserGroup(rec *membership.Reconcile) {
+	// Only one replica modifies the user group at a time
+	lock := r.applyLock(rec)
+	if lock != nil {
+		if err := lock.Acquire(r.ctx, r.client, r.now); err != nil {
+			// Try again soon once the other replica is done
+			if errors.Is(err, membership.ErrLocked) {
+				r.settled, r.deferred = false, true
+			}
+			r.f.awsCallFailed(r.rsp, "UserGroupReconciled", "ModifyFailed", r.diagnose(err))
+			return
+		}
+	}
+	err := rec.Apply(r.ctx, r.client, elastiCacheTags(originTags(r.oxr)))
+	if lock != nil {
+		if err := lock.Release(r.ctx, r.client); err != nil {
+			r.f.log.Info("Cannot release the apply lock, it expires on its own", "userGroupId", r.names.Hash(rec.UserGroupID), "error", err)
+		}
+	}
+	if err != nil {
+		// Diff against the changed user group soon
+		if errors.Is(err, membership.ErrUserGroupChanged) {
+			r.settled, r.deferred = false, true
+		}
+		r.f.awsCallFailed(r.rsp, "UserGroupReconciled", "ModifyFailed", r.diagnose(err))
+		return
+	}
+	r.mutated = true
+	r.f.log.Info("Modified user group membership", "userGroupId", r.names.Hash(rec.UserGroupID), "added", len(rec.Diff.Added), "removed", len(rec.Diff.Removed))
+	r.applied = &membership.Applied{UserGroupID: rec.UserGroupID, UserIDs: membership.AppliedUserIDs(rec.Members, rec.Diff), AppliedTime: r.now}
+	response.Normal(r.rsp, r.names.HashDiff(rec.Diff).String()).TargetCompositeAndClaim()
+	response.ConditionTrue(r.rsp, "UserGroupReconciled", "Modified").TargetCompositeAndClaim()
+
+	pending, err := r.f.membershipVerifier().Verify(r.ctx, r.client, rec.Diff)
+	switch {
+	case err != nil:
+		r.f.awsCallFailed(r.rsp, "MembershipApplied", "VerifyFailed", r.diagnose(err))
+	case pending.Empty():
+		response.ConditionTrue(r.rsp, "MembershipApplied", "Applied").TargetCompositeAndClaim()
+	default:
+		r.f.log.Info("AWS doesn't report the membership changes yet, verifying again soon", "userGroupId", r.names.Hash(rec.UserGroupID), "added", len(pending.Added), "removed", len(pending.Removed))
+		response.ConditionFalse(r.rsp, "MembershipApplied", "Verifying").
+			WithMessage(fmt.Sprintf("Waiting for AWS to report the changes to user group %q: %s", rec.UserGroupID, pending.String())).
+			TargetCompositeAndClaim()
+		r.settled = false
+	}
+}
+
+// applyLock returns the lock serializing modifications of the reconcile's
+// user group across function replicas, or nil if it isn't locked.
+func (r *run) applyLock(rec *membership.Reconcile) *membership.Lock {
+	if !r.params.ApplyLock.Enabled {
+		return nil
+	}
+	return &membership.Lock{UserGroupID: rec.UserGroupID, ARN: rec.ARN, Holder: membership.LockHolder(string(r.oxr.Resource.GetUID())), TTL: r.params.ApplyLock.TTL}
+}
+
+// requeue records the membership the function applied while it's trusted,
+// and asks to be called again soon while waiting for AWS to settle, and
+// sooner still for prioritized XRs.
+func (r *run) requeue() bool {
+	if r.applied.Trusted(r.params.ConsistencyWindow, r.now) {
+		r.status["appliedMembership"] = r.applied.Status()
+	}
+	if d := requeueInterval(r.settled, r.prioritized); d > 0 {
+		r.rsp.Meta.Ttl = durationpb.New(d)
+	}
+	return true
+}
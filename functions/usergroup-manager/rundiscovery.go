@@ -0,0 +1,406 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+// readObserved reads what the XR's status and composed resources recorded
+// about earlier runs.
+func (r *run) readObserved() bool {
+	observed, err := request.GetObservedComposedResources(r.req)
+	if err != nil {
+		return r.fatal(fmt.Errorf("failed to get observed composed resources: %w", err))
+	}
+	r.observed = observed
+	r.previousIDs = observedUserIDs(r.oxr, observed)
+	r.lastFullSync, _ = r.oxr.Resource.GetString(status.Path("lastFullSyncTime"))
+	r.lastFullSyncGeneration = observedLastFullSyncGeneration(r.oxr)
+	prioritized, unsupported := observedPriority(r.oxr)
+	if unsupported != "" {
+		response.Warning(r.rsp, fmt.Errorf("ignoring unsupported %s annotation %q, only %q is supported", priorityAnnotation, unsupported, priorityHigh)).TargetCompositeAndClaim()
+	}
+	r.prioritized = prioritized
+	return true
+}
+
+// discoverUsers discovers the users, from the User MRs labelled for this XR
+// or from AWS.
+func (r *run) discoverUsers() bool {
+	r.syncMode = syncModeFull
+	if r.params.DiscoverySource == discoverySourceCluster {
+		return r.discoverClusterUsers()
+	}
+	return r.discoverAWSUsers()
+}
+
+// discoverClusterUsers reads the User MRs labelled for this XR rather than
+// calling AWS.
+func (r *run) discoverClusterUsers() bool {
+	r.syncMode = syncModeCluster
+	tf := r.params.TagFilter
+	if tf.Value == "" {
+		return r.fatal(errors.New("spec.parameters.tagFilter.value or spec.parameters.cacheId is required to discover users from User MRs"))
+	}
+	rs, ok, err := requireResources(r.req, r.rsp, clusterUsersKey, clusterUsersSelector(tf.Key, tf.Value))
+	if err != nil {
+		return r.fatal(err)
+	}
+	if !ok {
+		// Crossplane calls again with the User MRs. Carrying on without
+		// them would empty every user group.
+		r.f.log.Debug("Waiting for User MRs", "label", tf.Key)
+		return false
+	}
+	r.users, r.provisioningIDs = clusterUsers(rs, r.params.Region)
+	r.users = discovery.FilterByEngine(discovery.FilterByName(r.users, r.params.NameFilter), r.params.Engine)
+	for _, id := range r.provisioningIDs {
+		r.f.log.Debug("User MR isn't ready", "userId", r.names.Hash(id))
+	}
+	return true
+}
+
+// discoverAWSUsers lists every user, or verifies those discovered last time,
+// keeping those that pass the name, engine and tag filters.
+func (r *run) discoverAWSUsers() bool {
+	params := r.params
+
+	// Only keep users tagged for this XR, so compositions in shared
+	// accounts don't pick up unrelated users
+	filterByTag := params.Features.Enabled(featureTagFiltering)
+	if filterByTag && params.TagFilter.Value == "" {
+		return r.fatal(errors.New("spec.parameters.tagFilter.value or spec.parameters.cacheId is required to filter users by tag"))
+	}
+
+	// Between full listings, only verify the users discovered last time if
+	// targeted verification is enabled
+	lastFull, _ := time.Parse(time.RFC3339, r.lastFullSync)
+	targeted := useTargetedSync(params.Verification, lastFull, r.previousIDs, r.now)
+
+	// Verify the users discovered last time rather than listing every user
+	// while the function's full discovery budget is spent, unless this XR
+	// needs a full discovery urgently or is prioritized
+	if !targeted {
+		p := fullDiscoveryPriority(r.previousIDs, lastFull, r.lastFullSyncGeneration, r.oxr.Resource.GetGeneration(), r.f.maxStaleness, r.now)
+		if r.prioritized {
+			p = discoveryPriorityRequired
+		}
+		if !r.f.scheduler.Admit(p, r.now) {
+			r.f.log.Debug("Full discovery budget spent, verifying previously discovered users", "count", len(r.previousIDs))
+			targeted, r.fullDeferred = true, true
+		}
+	}
+
+	// Retry the whole pass if AWS keeps throttling the function after the
+	// SDK's own retries
+	var degraded bool
+	err := newPassRetrier(params.Retry).Do(r.ctx, func() error {
+		r.users, r.goneIDs, degraded = nil, nil, false
+		var err error
+		if targeted {
+			r.users, r.goneIDs, err = discovery.Verify(r.ctx, r.client, r.previousIDs)
+		} else {
+			// Query all ElastiCache users, keeping only what user group
+			// filters need from each page
+			err = discovery.Users(r.ctx, r.client, params.Engine, func(user types.User) {
+				if user.UserId != nil {
+					r.users = append(r.users, discovery.NewUser(user))
+					r.f.log.Debug("Discovered user", "userId", r.names.Hash(*user.UserId), "userName", r.names.Hash(aws.ToString(user.UserName)))
+				}
+			})
+		}
+		// Derive the users from user group membership if the role may only
+		// describe user groups, rather than failing outright
+		if awsclient.IsAccessDenied(err) {
+			r.f.log.Info("Not allowed to describe users, deriving them from user group membership", "error", err)
+			r.users, r.goneIDs = nil, nil
+			r.users, err = discovery.UserGroupMembers(r.ctx, r.client, params.Engine)
+			degraded = err == nil
+		}
+		if err != nil {
+			return err
+		}
+		// Filter by name and engine first, since it saves a
+		// ListTagsForResource call per user. Listings are already filtered
+		// by engine, but verified users aren't.
+		r.users = discovery.FilterByEngine(discovery.FilterByName(r.users, params.NameFilter), params.Engine)
+		if filterByTag {
+			var err error
+			r.users, err = discovery.FilterByTag(r.ctx, r.client, r.users, params.TagFilter.Key, params.TagFilter.Value)
+			return err
+		}
+		return nil
+	})
+	switch {
+	case err == nil && degraded:
+		// Every user group was listed, so this counts as a full discovery
+		r.syncMode = syncModeDegraded
+		r.lastFullSync = r.now.UTC().Format(time.RFC3339)
+		r.lastFullSyncGeneration = r.oxr.Resource.GetGeneration()
+		response.Warning(r.rsp, errors.New("not allowed to call DescribeUsers, so users were derived from the membership of every user group. Users that aren't in any user group aren't discovered")).
+			TargetCompositeAndClaim()
+	case err == nil && targeted:
+		r.syncMode = syncModeTargeted
+		for _, id := range r.goneIDs {
+			r.f.log.Info("Previously discovered user no longer exists", "userId", r.names.Hash(id))
+		}
+	case err == nil:
+		r.lastFullSync = r.now.UTC().Format(time.RFC3339)
+		r.lastFullSyncGeneration = r.oxr.Resource.GetGeneration()
+	case awsclient.IsTransient(err) && len(r.previousIDs) > 0 && len(params.UserGroups) == 0 && !params.PerCache.Enabled:
+		// Keep the users discovered last time rather than failing the
+		// pipeline. User group filters need more than their IDs, so they
+		// can't be applied to them.
+		r.syncMode = syncModeStale
+		r.staleErr = r.diagnose(err)
+		r.users, r.goneIDs = make([]discovery.User, len(r.previousIDs)), nil
+		for i, id := range r.previousIDs {
+			r.users[i] = discovery.User{ID: id}
+		}
+		r.f.log.Info("Failed to discover users, using those discovered previously", "count", len(r.users), "error", r.staleErr)
+		response.Warning(r.rsp, fmt.Errorf("failed to discover users, using the %d discovered previously: %w", len(r.users), r.staleErr)).TargetCompositeAndClaim()
+	default:
+		return r.discoveryFailed(r.diagnose(err))
+	}
+	return true
+}
+
+// addSharedPoolUsers adds the users of the shared pools this XR opted in to,
+// as long as they still exist.
+func (r *run) addSharedPoolUsers() bool {
+	r.pooled = map[string]bool{}
+	for _, name := range r.params.SharedPools {
+		rs, ok, err := requireResources(r.req, r.rsp, sharedPoolKeyPrefix+name, sharedPoolSelector(name))
+		if err != nil {
+			return r.fatal(err)
+		}
+		if !ok {
+			continue
+		}
+		ids, err := sharedPoolUserIDs(name, rs)
+		if err != nil {
+			return r.fatal(err)
+		}
+		for _, id := range ids {
+			r.pooled[id] = true
+		}
+	}
+	if len(r.pooled) == 0 {
+		return true
+	}
+	present, gone, err := discovery.Verify(r.ctx, r.client, undiscoveredUserIDs(r.users, r.pooled))
+	if err != nil {
+		return r.discoveryFailed(r.diagnose(err))
+	}
+	if len(gone) > 0 {
+		response.Warning(r.rsp, fmt.Errorf("shared pool users %v don't exist", r.names.HashAll(gone))).TargetCompositeAndClaim()
+	}
+	r.users = append(r.users, present...)
+	return true
+}
+
+// filterUsers refuses the users of other regions and accounts, and drops the
+// users that opted out of user groups.
+func (r *run) filterUsers() bool {
+	params, region := r.params, r.params.Region
+
+	// Sort users by ID, so the status and context written from them don't
+	// change with the order AWS returns them in
+	discovery.SortByID(r.users)
+
+	// Refuse users of other regions, e.g. from a misconfigured client or
+	// stale User MRs, rather than failing when the user group is modified
+	users, otherRegion := discovery.FilterByRegion(r.users, region)
+	r.users = users
+	r.otherRegionIDs = make([]string, len(otherRegion))
+	for i, u := range otherRegion {
+		r.otherRegionIDs[i] = u.ID
+		r.f.log.Info("Refusing user of another region", "userId", r.names.Hash(u.ID), "userRegion", discovery.ARNRegion(u.ARN), "region", region)
+	}
+	if len(otherRegion) > 0 {
+		response.ConditionFalse(r.rsp, "UsersInRegion", "CrossRegionUsers").
+			WithMessage(fmt.Sprintf("Users %v aren't in region %s, so they can't be added to its user groups", r.otherRegionIDs, region)).
+			TargetCompositeAndClaim()
+	} else {
+		response.ConditionTrue(r.rsp, "UsersInRegion", "UsersInRegion").TargetCompositeAndClaim()
+	}
+
+	// Refuse users of other accounts too, e.g. when one account's
+	// credentials are used with another's settings, before anything is
+	// modified
+	if account, err := expectedAccountID(r.ctx, r.f.stsClient(r.cfg), params.AssumeRole.RoleARN); err != nil {
+		r.f.log.Info("Cannot check the account of discovered users", "error", err)
+		response.Warning(r.rsp, fmt.Errorf("cannot check the account of discovered users: %w", err)).TargetCompositeAndClaim()
+	} else {
+		var otherAccount []discovery.User
+		r.users, otherAccount = discovery.FilterByAccount(r.users, account)
+		for _, u := range otherAccount {
+			r.otherAccountIDs = append(r.otherAccountIDs, u.ID)
+			r.f.log.Info("Refusing user of another account", "userId", r.names.Hash(u.ID))
+		}
+		if len(otherAccount) > 0 {
+			response.ConditionFalse(r.rsp, "UsersInAccount", "CrossAccountUsers").
+				WithMessage(fmt.Sprintf("Users %v aren't in account %s, which the AWS credentials resolve to, so they can't be added to its user groups", r.otherAccountIDs, account)).
+				TargetCompositeAndClaim()
+		} else {
+			response.ConditionTrue(r.rsp, "UsersInAccount", "UsersInAccount").TargetCompositeAndClaim()
+		}
+	}
+
+	// Drop users whose User MR opted out of user groups
+	excluded, _, err := requireResources(r.req, r.rsp, excludedUsersKey, excludedUsersSelector())
+	if err != nil {
+		return r.fatal(err)
+	}
+	r.users, r.excludedIDs = excludeUsers(r.users, excludedUserIDs(excluded))
+	for _, id := range r.excludedIDs {
+		r.f.log.Info("Excluding user whose User MR opted out", "userId", r.names.Hash(id), "label", excludeLabel)
+	}
+
+	// Leave the default user ElastiCache creates in every account out of the
+	// user groups, unless the XR asks for it
+	if params.ExcludeDefaultUser {
+		var skipped []string
+		r.users, skipped = excludeUsers(r.users, []string{discovery.DefaultUserID})
+		r.defaultUserExcluded = len(skipped) > 0
+		// User names aren't known in stale or degraded mode. Direct mode
+		// keeps the users named default the target user group already has.
+		if r.defaultUserExcluded && r.syncMode != syncModeStale && r.syncMode != syncModeDegraded && params.ManagementMode != managementModeDirect && !hasDefaultUserName(r.users) {
+			response.Warning(r.rsp, errors.New("no user named default other than the default user was discovered, but ElastiCache requires one in every Redis OSS user group. Create one, e.g. with access string off, or set spec.parameters.excludeDefaultUser to false")).
+				TargetCompositeAndClaim()
+		}
+	}
+
+	r.userIDs = make([]string, len(r.users))
+	for i, u := range r.users {
+		r.userIDs[i] = u.ID
+	}
+	return true
+}
+
+// publishUsers writes the discovered users to the pipeline context and the
+// status.
+func (r *run) publishUsers() bool {
+	params, userIDs := r.params, r.userIDs
+	r.f.log.Info("Total users discovered", "count", len(userIDs), "mode", r.syncMode)
+
+	// Store user IDs in pipeline context for other functions to access,
+	// split across several keys or truncated if there are too many
+	truncated, err := writeDiscoveredUserIDs(r.rsp, userIDs, params.ContextSize)
+	if err != nil {
+		return r.fatal(err)
+	}
+	if truncated {
+		response.Warning(r.rsp, fmt.Errorf("only the first %d of %d discovered user IDs were written to the %s context key; see %s", params.ContextSize.MaxUserIDs, len(userIDs), discoveredUserIDsKey, discoveredUserIDsSummaryKey)).
+			TargetCompositeAndClaim()
+	}
+
+	r.status = map[string]any{
+		"discoveredUsers": len(userIDs),
+		"userIDs":         userIDs,
+		"users":           status.Users(r.users),
+		"syncMode":        r.syncMode,
+	}
+
+	// Summarize user ID lists too long for the XR status, asking later steps
+	// to compose the full list into a ConfigMap
+	if summary := summarizeUserIDs(userIDs, params.StatusSize.MaxUserIDs, userIDsConfigMapName(r.oxr.Resource.GetName())); summary != nil {
+		r.status["userIDs"] = userIDs[:min(len(userIDs), statusUserIDsPreview)]
+		r.status["users"] = status.Users(r.users[:min(len(r.users), statusUserIDsPreview)])
+		r.status["userIDsSummary"] = summary.Status()
+		if _, err := setContextValue(r.rsp, userIDsExportKey, map[string]any{
+			"configMapName": summary.ConfigMapName,
+			"dataKey":       userIDsDataKey,
+			"data":          joinUserIDs(userIDs),
+		}); err != nil {
+			return r.fatal(err)
+		}
+	}
+	// Only targeted verification and the full discovery budget need to know
+	// when users were last listed. Recording it otherwise would change the
+	// status on every run.
+	if params.Verification.Mode == syncModeTargeted || r.f.scheduler != nil {
+		r.status["lastFullSyncTime"] = r.lastFullSync
+	}
+	if r.f.scheduler != nil {
+		r.status["lastFullSyncGeneration"] = r.lastFullSyncGeneration
+	}
+	if r.fullDeferred {
+		r.status["fullSyncDeferred"] = true
+	}
+	if r.prioritized {
+		r.status["prioritized"] = true
+	}
+	if len(r.goneIDs) > 0 {
+		r.status["goneUserIDs"] = r.goneIDs
+	}
+	if len(r.excludedIDs) > 0 {
+		r.status["excludedUserIDs"] = r.excludedIDs
+	}
+	if len(r.provisioningIDs) > 0 {
+		r.status["provisioningUserIDs"] = r.provisioningIDs
+	}
+	if len(r.otherRegionIDs) > 0 {
+		r.status["otherRegionUserIDs"] = r.otherRegionIDs
+	}
+	if len(r.otherAccountIDs) > 0 {
+		r.status["otherAccountUserIDs"] = r.otherAccountIDs
+	}
+	if params.ExcludeDefaultUser {
+		r.status["defaultUserExcluded"] = r.defaultUserExcluded
+	}
+
+	// Keep a short history of user count changes, to flag partial losses
+	// such as those caused by IAM permission changes
+	r.history = observedUserCountHistory(r.oxr)
+	r.status["userCountHistory"] = userCountHistoryStatus(recordUserCount(r.history, len(userIDs), r.now))
+	r.status["credentials"] = r.credsStatus
+
+	r.output = &composableOutput{UserIDs: userIDs, Users: r.users, ManagementMode: params.ManagementMode}
+	r.output.CacheID = params.CacheID
+	return true
+}
+
+// discoverRegions discovers the users of the other regions, e.g. of a Global
+// Datastore, concurrently.
+func (r *run) discoverRegions() bool {
+	params, region := r.params, r.params.Region
+	if len(params.Regions) == 0 {
+		return true
+	}
+	clients := map[string]awsclient.ElastiCache{}
+	for _, rg := range params.Regions {
+		if rg != region {
+			clients[rg] = r.f.elastiCacheClient(r.cfg, rg, params.EndpointURL)
+		}
+	}
+	var tf *discovery.TagFilter
+	if params.Features.Enabled(featureTagFiltering) {
+		tf = &params.TagFilter
+	}
+	rds := discovery.Regions(r.ctx, clients, tf, params.NameFilter, params.Engine)
+	if slices.Contains(params.Regions, region) {
+		rds = append(rds, discovery.Region{Region: region, UserIDs: r.userIDs})
+	}
+	for _, rd := range rds {
+		if rd.Err != nil {
+			response.Warning(r.rsp, fmt.Errorf("failed to discover users: %w", r.diagnose(rd.Err))).TargetCompositeAndClaim()
+			continue
+		}
+		r.f.log.Info("Total users discovered in region", "region", rd.Region, "count", len(rd.UserIDs))
+	}
+	r.status["regions"] = regionsStatus(rds)
+	r.output.Regions = rds
+	return true
+}
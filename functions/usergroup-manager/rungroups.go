@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+// assignUserGroups splits the discovered users between the configured user
+// groups, or the user groups of the caches they're tagged with.
+func (r *run) assignUserGroups() bool {
+	params := r.params
+	if len(params.UserGroups) > 0 {
+		var conflicts []membershipConflict
+		r.groups, conflicts = assignUserGroups(params.UserGroups, r.users, params.ExclusiveMembership)
+		for _, c := range conflicts {
+			r.f.log.Info("User matches more than one user group", "userId", r.names.Hash(c.UserID), "userGroups", r.names.HashAll(c.Groups), "assignedTo", r.names.Hash(c.Groups[0]))
+		}
+		if len(conflicts) > 0 {
+			r.status["membershipConflicts"] = conflictsStatus(conflicts)
+			response.Warning(r.rsp, fmt.Errorf("%d users match more than one user group and were only added to the first; see status.%s.membershipConflicts", len(conflicts), status.Key)).
+				TargetCompositeAndClaim()
+		}
+	} else if pc := params.PerCache; pc.Enabled {
+		// Group users by the cache they're tagged with, one user group per
+		// cache. DescribeUsers doesn't return tags.
+		var cacheIDs map[string]string
+		err := newPassRetrier(params.Retry).Do(r.ctx, func() error {
+			var err error
+			cacheIDs, err = discovery.TagValues(r.ctx, r.client, r.users, pc.TagKey)
+			return err
+		})
+		if err != nil {
+			return r.discoveryFailed(r.diagnose(err))
+		}
+		var ungrouped, invalid []string
+		r.groups, ungrouped, invalid = groupUsersByCache(r.users, cacheIDs, pc)
+		if len(ungrouped) > 0 {
+			r.status["ungroupedUserIDs"] = ungrouped
+		}
+		if len(invalid) > 0 {
+			response.Warning(r.rsp, fmt.Errorf("not maintaining user groups for caches %v, since spec.parameters.perCache.nameTemplate doesn't give them valid user group IDs", r.names.HashAll(invalid))).
+				TargetCompositeAndClaim()
+		}
+	}
+
+	addPoolMembers(r.groups, r.users, r.pooled)
+	return true
+}
+
+// declareUsers derives users from SSO group membership and the user bundle,
+// adding those that already exist to the user groups they're granted.
+// Declared users are only complete once Crossplane has supplied every
+// required ConfigMap.
+func (r *run) declareUsers() bool {
+	r.declaredComplete = true
+	if im := r.params.IdentityMapping; im.ConfigMapName != "" {
+		cm, ok, err := requireConfigMap(r.req, r.rsp, identitySourceKey, r.oxr.Resource.GetNamespace(), im.ConfigMapName)
+		if err != nil {
+			// Carrying on without identity users would delete them.
+			return r.fatal(fmt.Errorf("cannot read identity source: %w", err))
+		}
+		r.declaredComplete = r.declaredComplete && ok
+		if ok {
+			identities, err := identityUsersFromConfigMap(cm, im)
+			if err != nil {
+				return r.fatal(fmt.Errorf("cannot read identity source: %w", err))
+			}
+			observeOnly(identities, r.params.ObserveOnlyUsers)
+			// Users take the engine of the user groups they're granted
+			engine := r.params.Engine
+			if engine == "" {
+				engine = engineRedis
+			}
+			for i := range identities {
+				identities[i].Engine = managedUserEngine(identities[i].UserGroups, r.groups, engine)
+			}
+			for _, name := range addManagedMembers(r.groups, identities, r.users) {
+				response.Warning(r.rsp, fmt.Errorf("identity mapping grants user group %q, which isn't in spec.parameters.userGroups", r.names.Hash(name))).
+					TargetCompositeAndClaim()
+			}
+			r.f.log.Info("Mapped SSO group members to users", "count", len(identities))
+			r.status["identityUsers"] = len(identities)
+			r.output.IdentityMapped = true
+			r.output.IdentityUsers = identities
+		}
+	}
+
+	// Read user definitions maintained in git from the bundle ConfigMap,
+	// adding those that already exist to their user groups
+	if ub := r.params.UserBundle; ub.ConfigMapName != "" {
+		cm, ok, err := requireConfigMap(r.req, r.rsp, userBundleKey, r.oxr.Resource.GetNamespace(), ub.ConfigMapName)
+		if err != nil {
+			// Carrying on without bundle users would delete them.
+			return r.fatal(fmt.Errorf("cannot read user bundle: %w", err))
+		}
+		r.declaredComplete = r.declaredComplete && ok
+		if ok {
+			bundled, err := bundleUsersFromConfigMap(cm, ub)
+			if err != nil {
+				// Refuse to apply a partial bundle. Report what's wrong with
+				// it where users will look, as well as failing.
+				reason := "UserBundleUnavailable"
+				if be := (&bundleError{}); errors.As(err, &be) {
+					reason = "InvalidUserBundle"
+				}
+				msg := fmt.Sprintf("ConfigMap %s/%s key %q: %s", cm.GetNamespace(), cm.GetName(), ub.Key, err)
+				response.ConditionFalse(r.rsp, "UserBundleValid", reason).WithMessage(msg).TargetCompositeAndClaim()
+				return r.fatal(errors.New(msg))
+			}
+			response.ConditionTrue(r.rsp, "UserBundleValid", "ValidUserBundle").TargetCompositeAndClaim()
+			observeOnly(bundled, r.params.ObserveOnlyUsers)
+			for _, name := range addManagedMembers(r.groups, bundled, r.users) {
+				response.Warning(r.rsp, fmt.Errorf("user bundle grants user group %q, which isn't in spec.parameters.userGroups", r.names.Hash(name))).
+					TargetCompositeAndClaim()
+			}
+			r.f.log.Info("Read users from user bundle", "count", len(bundled))
+			r.status["bundleUsers"] = len(bundled)
+			r.output.BundleRead = true
+			r.output.BundleUsers = bundled
+		}
+	}
+
+	// Record the access strings templates resolved to, for audit
+	if templates := accessTemplatesStatus(r.output.IdentityUsers, r.output.BundleUsers); len(templates) > 0 {
+		r.status["accessTemplates"] = templates
+	}
+	return true
+}
+
+// ensureDefaultUsers gives every user group exactly one user named default,
+// as ElastiCache requires of Redis OSS user groups. That includes the
+// implicit user group, and direct mode's target user group. User names
+// aren't known in stale or degraded mode.
+func (r *run) ensureDefaultUsers() bool {
+	params := r.params
+	r.implicit = implicitUserGroup(params, r.groups, r.userIDs)
+	r.defaultsChecked = (len(r.groups) > 0 || r.implicit != nil) && r.syncMode != syncModeStale && r.syncMode != syncModeDegraded
+	if r.defaultsChecked {
+		targets := slices.Clone(r.groups)
+		if r.implicit != nil {
+			targets = append(targets, *r.implicit)
+		}
+		r.defaults, r.missingDefaults = ensureDefaultUsers(targets, r.users, params.DefaultUserPreference)
+		copy(r.groups, targets)
+		if r.implicit != nil {
+			*r.implicit = targets[len(r.groups)]
+		}
+		r.status["defaultUsers"] = r.defaults
+		// Direct mode's target user group may already have a user named
+		// default, which is only known once its membership is described
+		switch {
+		case params.ManagementMode != managementModeDirect:
+			defaultUsersPresent(r.rsp, r.missingDefaults)
+			if r.implicit != nil {
+				r.output.ImplicitUserGroupUserIDs = r.implicit.UserIDs
+			}
+		case r.implicit == nil:
+			defaultUsersPresent(r.rsp, r.missingDefaults)
+		}
+	}
+
+	if len(r.groups) > 0 {
+		for _, g := range r.groups {
+			r.f.log.Info("Assigned users to user group", "userGroup", r.names.Hash(g.Name), "count", len(g.UserIDs))
+		}
+		r.status["userGroups"] = userGroupsStatus(r.groups)
+		r.output.UserGroups = r.groups
+	}
+	return true
+}
+
+// reportAdoption periodically reports matched users that nobody declared, so
+// they can be adopted or removed.
+func (r *run) reportAdoption() bool {
+	ar := r.params.AdoptionReport
+	if !ar.Enabled || !r.declaredComplete {
+		return true
+	}
+	report, ok := observedAdoptionReport(r.oxr)
+	if !ok || report.Due(ar.Interval, r.now) {
+		report = &adoptionReport{
+			GeneratedTime: r.now,
+			UserIDs:       unmanagedUsers(matchedUserIDs(r.groups, r.userIDs), r.output.IdentityUsers, r.output.BundleUsers),
+		}
+		r.f.log.Info("Generated adoption report", "unmanagedUsers", len(report.UserIDs))
+		if ar.Notify && len(report.UserIDs) > 0 {
+			response.Warning(r.rsp, fmt.Errorf("%d users match this XR's user groups but aren't declared: %v. Adopt or remove them", len(report.UserIDs), r.names.HashAll(report.UserIDs))).
+				TargetCompositeAndClaim()
+		}
+	}
+	r.status["adoptionReport"] = report.Status()
+	return true
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/crossplane/function-sdk-go/response"
+)
+
+// discoverServerlessCaches discovers the serverless caches tagged with this
+// XR's cache-id.
+func (r *run) discoverServerlessCaches() bool {
+	if !r.params.DiscoverServerlessCaches {
+		return true
+	}
+	if r.output.CacheID == "" {
+		return r.fatal(fmt.Errorf("spec.parameters.cacheId is required to discover serverless caches"))
+	}
+
+	caches, err := discoverServerlessCaches(r.ctx, r.client, defaultCacheIDTagKey, r.output.CacheID)
+	if err != nil {
+		return r.fatal(r.diagnose(err))
+	}
+	r.f.log.Info("Total serverless caches discovered", "count", len(caches), "cacheId", r.names.Hash(r.output.CacheID))
+
+	if _, err := setContextValue(r.rsp, "discoveredServerlessCaches", serverlessCachesContext(caches)); err != nil {
+		return r.fatal(err)
+	}
+	r.status["discoveredServerlessCaches"] = len(caches)
+	r.output.ServerlessDiscovered = true
+	r.output.ServerlessCaches = caches
+	return true
+}
+
+// resolveIAMPrincipals looks up the IAM principals of IAM-authenticated users
+// so later steps can make decisions based on e.g. their team or environment
+// tags.
+func (r *run) resolveIAMPrincipals() bool {
+	if !r.params.ResolveIAMPrincipals {
+		return true
+	}
+	principals, unresolved, err := resolveIAMPrincipals(r.ctx, iam.NewFromConfig(r.cfg, func(o *iam.Options) {
+		o.BaseEndpoint = r.f.endpoint("iam")
+	}), r.users)
+	if err != nil {
+		response.Warning(r.rsp, fmt.Errorf("failed to resolve IAM principals: %w", r.diagnose(err))).TargetCompositeAndClaim()
+		return true
+	}
+	if len(unresolved) > 0 {
+		r.f.log.Info("No IAM role or user matches IAM-authenticated users", "userIds", r.names.HashAll(unresolved))
+	}
+	r.output.IAMResolved = true
+	r.output.IAMPrincipals = principals
+	return true
+}
+
+// describeUserDetails looks up every detail of the users an earlier step
+// asked for, rather than keeping them for every discovered user.
+func (r *run) describeUserDetails() bool {
+	ids, dropped := requestedUserDetails(r.req)
+	if len(ids) == 0 {
+		return true
+	}
+	if dropped > 0 {
+		response.Warning(r.rsp, fmt.Errorf("context key %q lists more than %d users; not looking up the last %d", needUserDetailsKey, maxUserDetails, dropped)).TargetCompositeAndClaim()
+	}
+	details, err := describeUserDetails(r.ctx, r.client, ids)
+	if err != nil {
+		response.Warning(r.rsp, fmt.Errorf("failed to look up user details: %w", r.diagnose(err))).TargetCompositeAndClaim()
+		return true
+	}
+	r.f.log.Debug("Looked up user details", "count", len(ids))
+	if _, err := setContextValue(r.rsp, userDetailsKey, details); err != nil {
+		return r.fatal(err)
+	}
+	return true
+}
+
+// checkRBACSupport fails rather than compose user groups AWS will refuse to
+// associate with the target replication groups.
+func (r *run) checkRBACSupport() bool {
+	for _, id := range r.params.ReplicationGroupIDs {
+		err := checkRBACSupport(r.ctx, r.client, id)
+		if re := (&rbacError{}); errors.As(err, &re) {
+			response.ConditionFalse(r.rsp, "RBACSupported", "RBACUnsupported").WithMessage(re.Error()).TargetCompositeAndClaim()
+		}
+		if err != nil {
+			return r.fatal(r.diagnose(err))
+		}
+	}
+	if len(r.params.ReplicationGroupIDs) > 0 {
+		response.ConditionTrue(r.rsp, "RBACSupported", "RBACSupported").TargetCompositeAndClaim()
+	}
+	return true
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/resourcegroupstaggingapi"
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+// compose composes the user groups, and attaches the user group to the caches
+// earlier steps composed.
+func (r *run) compose() bool {
+	params := r.params
+	if params.ManagementMode != managementModeComposed && !params.UserGroupInjection.Enabled() {
+		return true
+	}
+	desired, err := request.GetDesiredComposedResources(r.req)
+	if err != nil {
+		return r.fatal(fmt.Errorf("failed to get desired composed resources: %w", err))
+	}
+
+	// Compose the user groups, rather than asking later steps to. While a
+	// plan is held they keep their observed membership.
+	if params.ManagementMode == managementModeComposed {
+		ugs := r.state.UserGroups
+		if r.held {
+			ugs = heldUserGroups(ugs, r.observed, r.bypass.Bypassed())
+		}
+		maps.Copy(desired, composedUserGroups(ugs, params.Region, params.UserGroupID, originTags(r.oxr)))
+	}
+
+	// Attach the user group to the caches earlier steps composed
+	if params.UserGroupInjection.Enabled() {
+		id, err := injectedUserGroupID(params)
+		if err != nil {
+			response.Warning(r.rsp, fmt.Errorf("not attaching a user group to caches: %w", err)).TargetCompositeAndClaim()
+		} else {
+			injected, err := injectUserGroup(desired, params.UserGroupInjection, id)
+			if err != nil {
+				return r.fatal(err)
+			}
+			if len(injected) == 0 {
+				response.Warning(r.rsp, errors.New("spec.parameters.userGroupInjection selects no desired ReplicationGroup or ServerlessCache; are they composed by an earlier step?")).TargetCompositeAndClaim()
+			}
+			r.f.log.Info("Attached user group to caches", "userGroupId", r.names.Hash(id), "resources", injected)
+			r.status["userGroupInjectedInto"] = injected
+		}
+	}
+
+	if err := response.SetDesiredComposedResources(r.rsp, desired); err != nil {
+		return r.fatal(fmt.Errorf("failed to set desired composed resources: %w", err))
+	}
+	return true
+}
+
+// export writes the desired state, the discovered users and this XR's shared
+// pool to the pipeline context for later steps to compose into ConfigMaps.
+func (r *run) export() bool {
+	params := r.params
+
+	// Render what later steps are asked to compose, so reviewers can diff it
+	if ex := params.DesiredStateExport; ex.Enabled {
+		if _, err := setContextValue(r.rsp, desiredStateExportKey, desiredStateExportContext(r.doc, ex.ConfigMapName)); err != nil {
+			return r.fatal(err)
+		}
+	}
+
+	// Write the discovered users in a bulk format for inventory systems
+	if ex := params.UserExport; ex.Enabled {
+		name := ex.ConfigMapName
+		if name == "" {
+			name = userExportConfigMapName(r.oxr.Resource.GetName())
+		}
+		records := userExportRecords(r.oxr.Resource.GetNamespace(), r.oxr.Resource.GetName(), params.Region, params.CacheID, r.users, r.groups)
+		data, err := encodeUserExport(records, ex.Format)
+		if err != nil {
+			return r.fatal(err)
+		}
+		if len(data) > maxUserExportBytes {
+			response.Warning(r.rsp, fmt.Errorf("the user export of %d users is %d bytes, more than ConfigMap %s can hold; not exporting users", len(records), len(data), name)).
+				TargetCompositeAndClaim()
+		} else if _, err := setContextValue(r.rsp, userExportKey, userExportContext(name, ex.Format, data)); err != nil {
+			return r.fatal(err)
+		}
+	}
+
+	// Publish this XR's shared pool for later steps to compose into a
+	// ConfigMap other XRs can find
+	if params.SharedPool.Name != "" {
+		if _, err := setContextValue(r.rsp, sharedPoolExportKey, sharedPoolExportContext(params.SharedPool, sharedPoolConfigMapName(r.oxr.Resource.GetName()))); err != nil {
+			return r.fatal(err)
+		}
+	}
+	return true
+}
+
+// publishOutput publishes discovery results at stable, documented context
+// paths, compressing per-user lists too large for the gRPC message limit.
+func (r *run) publishOutput() bool {
+	oc := r.output.Context()
+	compressed, err := compressOutput(oc, r.params.ContextSize.CompressAboveBytes)
+	if err != nil {
+		return r.fatal(err)
+	}
+	if len(compressed) > 0 {
+		r.f.log.Debug("Compressed large context values", "keys", compressed)
+	}
+	out, err := setContextValue(r.rsp, composableOutputKey, oc)
+	if err != nil {
+		return r.fatal(err)
+	}
+
+	// Optionally expose the same results to environment patches
+	if r.params.ExportToEnvironment {
+		response.SetContextKey(r.rsp, environmentKey, mergeIntoEnvironment(r.req, composableOutputKey, out))
+	}
+	return true
+}
+
+// reportCostAllocation summarizes users and user groups per cache-id for cost
+// allocation.
+func (r *run) reportCostAllocation() bool {
+	ca := r.params.CostAllocation
+	if !ca.Enabled {
+		return true
+	}
+	report, err := reportCostAllocation(r.ctx, resourcegroupstaggingapi.NewFromConfig(r.cfg, func(o *resourcegroupstaggingapi.Options) {
+		o.BaseEndpoint = r.f.endpoint("resourcegroupstaggingapi")
+	}), ca.TagKey)
+	if err != nil {
+		response.Warning(r.rsp, fmt.Errorf("failed to report cost allocation: %w", r.diagnose(err))).TargetCompositeAndClaim()
+		return true
+	}
+	r.status["costAllocation"] = report.Status()
+	if ca.IncludeResources {
+		if _, err := setContextValue(r.rsp, "costAllocationResources", report.Context()); err != nil {
+			response.Warning(r.rsp, err).TargetCompositeAndClaim()
+		}
+	}
+	return true
+}
+
+// writeStatus updates the XR status, preserving whatever earlier pipeline
+// steps desired.
+func (r *run) writeStatus() bool {
+	dxr, err := request.GetDesiredCompositeResource(r.req)
+	if err != nil {
+		return r.fatal(fmt.Errorf("failed to get desired composite resource: %w", err))
+	}
+	if legacy := status.LegacyFields(r.oxr, dxr); len(legacy) > 0 {
+		r.f.log.Info("Removing legacy top-level status fields", "fields", legacy)
+		response.Normalf(r.rsp, "Moved status fields %v to status.%s", legacy, status.Key)
+	}
+	if r.collectBundle {
+		r.bundleReq.LastToken, r.bundleReq.LastCollected = r.bundleReq.Token, r.now
+	}
+	if sb := r.bundleReq.Status(); sb != nil {
+		r.status["supportBundle"] = sb
+	}
+	r.status["summary"] = status.Summarize(r.status)
+	if err := status.Set(dxr, r.status); err != nil {
+		return r.fatal(err)
+	}
+	for _, err := range status.SetMapped(dxr, r.params.StatusFields) {
+		response.Warning(r.rsp, err).TargetCompositeAndClaim()
+	}
+	if err := response.SetDesiredCompositeResource(r.rsp, dxr); err != nil {
+		r.f.log.Info("Failed to update XR status", "error", err)
+	}
+	return true
+}
+
+// reportDiscovery records metrics, and sets the conditions that describe the
+// users discovered this run.
+func (r *run) reportDiscovery() bool {
+	params, userIDs := r.params, r.userIDs
+
+	// Per-composite metrics are labelled with the XR's name, so they're only
+	// recorded for compositions that allow telemetry. A sync that fell back
+	// to the users discovered previously didn't succeed
+	if params.Telemetry.Enabled && r.staleErr == nil {
+		ns, name := r.names.Hash(r.oxr.Resource.GetNamespace()), r.names.Hash(r.oxr.Resource.GetName())
+		discoveredUsers.WithLabelValues(ns, name).Set(float64(len(userIDs)))
+		syncs.Succeeded(ns, name)
+	}
+	if !params.Telemetry.Enabled || r.names != nil {
+		// Stop reporting series labelled with the raw name
+		syncs.Forget(r.oxr.Resource.GetNamespace(), r.oxr.Resource.GetName())
+	}
+
+	if r.staleErr != nil {
+		response.ConditionFalse(r.rsp, "UserDiscoverySuccess", failureReason(r.staleErr, "DiscoveryFailed")).
+			WithMessage(fmt.Sprintf("Using the %d ElastiCache users discovered previously: %s", len(userIDs), r.staleErr)).
+			TargetCompositeAndClaim()
+	} else {
+		response.ConditionTrue(r.rsp, "UserDiscoverySuccess", fmt.Sprintf("Discovered %d ElastiCache users", len(userIDs))).
+			TargetCompositeAndClaim()
+	}
+
+	if prev, drop, ok := userCountDrop(r.history, len(userIDs), params.UserCountAnomaly.DropThreshold); ok {
+		response.ConditionFalse(r.rsp, "UserCountStable", "UserCountDropped").
+			WithMessage(fmt.Sprintf("Discovered %d ElastiCache users, %.0f%% fewer than the %d previously discovered. Check the function's IAM permissions and user group filters", len(userIDs), drop*100, prev)).
+			TargetCompositeAndClaim()
+	} else {
+		response.ConditionTrue(r.rsp, "UserCountStable", "UserCountStable").TargetCompositeAndClaim()
+	}
+	return true
+}
+
+// reportRun describes what this run did for a report aggregated at the end
+// of the pipeline, and logs the support bundle if one is being collected.
+func (r *run) reportRun() bool {
+	params := r.params
+	report := &runReport{
+		ManagementMode:    params.ManagementMode,
+		DiscoverySource:   params.DiscoverySource,
+		SyncMode:          r.syncMode,
+		ApplyMode:         r.apply,
+		NameFilter:        params.NameFilter,
+		Engine:            params.Engine,
+		SharedPools:       params.SharedPools,
+		Regions:           params.Regions,
+		DiscoveredUsers:   len(r.userIDs),
+		GoneUsers:         len(r.goneIDs),
+		ExcludedUsers:     len(r.excludedIDs),
+		ProvisioningUsers: len(r.provisioningIDs),
+		PlannedWrites:     r.plan.Total(),
+		Warnings:          countWarnings(r.rsp),
+		Discovery:         r.durations.Discovery,
+		Filtering:         r.durations.Filtering,
+		Policy:            r.durations.Policy,
+		Apply:             r.durations.Apply,
+	}
+	if params.Features.Enabled(featureTagFiltering) && params.DiscoverySource == discoverySourceAWS {
+		report.TagFilter = &params.TagFilter
+	}
+	for _, g := range params.UserGroups {
+		report.UserGroups = append(report.UserGroups, g.Name)
+	}
+	report.AWSCalls, report.AWSThrottles, report.AWS = r.calls.Totals()
+	report.Total = time.Since(r.started)
+	report.LogTimings(r.log)
+	rv, _, err := toValue(report.Context())
+	if err != nil {
+		return r.fatal(fmt.Errorf("context key %q: %w", stepReportsKey, err))
+	}
+	response.SetContextKey(r.rsp, stepReportsKey, mergeStepReport(r.req, functionName, rv))
+
+	if r.collectBundle {
+		results := make([]string, 0, len(r.rsp.GetResults()))
+		for _, res := range r.rsp.GetResults() {
+			results = append(results, fmt.Sprintf("%s: %s", res.GetSeverity(), res.GetMessage()))
+		}
+		newSupportBundle(r.bundleReq.Token, r.now, r.req.GetMeta().GetTag(), params, r.calls.Calls(), r.status, results).Log(r.log)
+	}
+	return true
+}
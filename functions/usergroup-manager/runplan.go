@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/request"
+	"github.com/crossplane/function-sdk-go/response"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/policy"
+)
+
+// buildDesiredState works out what later steps are asked to compose, and
+// shows how the membership of composed user groups will change, so it's
+// readable in kubectl describe.
+func (r *run) buildDesiredState() bool {
+	params := r.params
+	implicitIDs := r.userIDs
+	if r.implicit != nil && params.ManagementMode != managementModeDirect {
+		implicitIDs = r.implicit.UserIDs
+	}
+	r.state = newDesiredState(r.groups, implicitIDs, r.output.IdentityUsers, r.output.BundleUsers)
+	// Errors are reported when the user group is attached
+	if params.UserGroupInjection.Enabled() {
+		if id, err := injectedUserGroupID(params); err == nil {
+			if desired, err := request.GetDesiredComposedResources(r.req); err == nil {
+				r.state.Associations = userGroupAssociations(desired, params.UserGroupInjection, id)
+			}
+		}
+	}
+	doc, err := r.state.YAML()
+	if err != nil {
+		return r.fatal(err)
+	}
+	r.doc = doc
+
+	// Count the AWS write calls needed to reach the desired state, both those
+	// provider-aws makes for composed resources and the function's own
+	r.drift = membershipDrift(r.observed, r.state.Memberships())
+	for _, d := range r.drift {
+		response.Normal(r.rsp, r.names.HashDiff(d).String()).TargetCompositeAndClaim()
+	}
+	r.plan = planComposedWrites(r.state, r.observed, r.drift)
+
+	// The membership the function applied to the target user group of
+	// direct mode is trusted over the one AWS reports for a while, since AWS
+	// can take a while to report it
+	r.applied = observedAppliedMembership(r.oxr)
+
+	// A dry run plans the function's own writes, e.g. to preview them in a
+	// PR, but never makes them
+	r.apply = params.Features.Enabled(featureApplyMode) && !params.DryRun
+	r.settled = true
+	return true
+}
+
+// detectMembershipDrift compares the membership AWS reports with the
+// discovered users, so alerts can key off a condition even when nothing
+// manages the user groups.
+func (r *run) detectMembershipDrift() bool {
+	params := r.params
+	if !params.DetectMembershipDrift {
+		return true
+	}
+	// The user groups are checked against the membership they'd be
+	// converged on, e.g. with the user named default they're assigned
+	var targets []membership.Target
+	for _, g := range r.groups {
+		targets = append(targets, membership.Target{UserGroupID: g.Name, UserIDs: g.UserIDs, DefaultUserID: r.defaults[g.Name]})
+	}
+	if len(r.groups) == 0 && params.UserGroupID != "" {
+		ids := r.userIDs
+		if r.implicit != nil {
+			ids = r.implicit.UserIDs
+		}
+		targets = append(targets, membership.Target{UserGroupID: params.UserGroupID, UserIDs: ids, DefaultUserID: r.defaults[params.UserGroupID]})
+	}
+	if len(targets) == 0 {
+		response.Warning(r.rsp, errors.New("spec.parameters.detectMembershipDrift requires spec.parameters.userGroups or spec.parameters.userGroupId; not checking membership")).TargetCompositeAndClaim()
+		return true
+	}
+	// The membership the function recently applied is trusted over the one
+	// AWS reports, as when it's reconciled
+	if r.applied.Trusted(params.ConsistencyWindow, r.now) {
+		for i := range targets {
+			if targets[i].UserGroupID == r.applied.UserGroupID {
+				targets[i].Applied = r.applied.UserIDs
+			}
+		}
+	}
+	drift, missing, err := membership.Check(r.ctx, r.client, targets)
+	if err == nil {
+		r.recordDrift(targets, drift, missing)
+	}
+	switch {
+	case err != nil:
+		r.f.awsCallFailed(r.rsp, "MembershipInSync", "DescribeFailed", r.diagnose(err))
+	case len(drift) > 0:
+		msgs := make([]string, len(drift))
+		for i, d := range drift {
+			msgs[i] = d.String()
+		}
+		response.ConditionFalse(r.rsp, "MembershipInSync", "MembershipDrift").WithMessage(strings.Join(msgs, "\n")).TargetCompositeAndClaim()
+	case len(missing) > 0:
+		response.ConditionUnknown(r.rsp, "MembershipInSync", "UserGroupNotFound").
+			WithMessage(fmt.Sprintf("User groups %v don't exist yet", missing)).
+			TargetCompositeAndClaim()
+	default:
+		response.ConditionTrue(r.rsp, "MembershipInSync", "InSync").TargetCompositeAndClaim()
+	}
+	return true
+}
+
+// recordDrift sets the membership drift gauge of each user group checked for
+// drift, and stops reporting those that no longer are. Like other
+// per-composite metrics it's only recorded for compositions that allow
+// telemetry.
+func (r *run) recordDrift(targets []membership.Target, drift []membership.Diff, missing []string) {
+	if !r.params.Telemetry.Enabled {
+		return
+	}
+	ns, name := r.names.Hash(r.oxr.Resource.GetNamespace()), r.names.Hash(r.oxr.Resource.GetName())
+	membershipDriftUsers.DeletePartialMatch(prometheus.Labels{"namespace": ns, "name": name})
+	users := map[string]int{}
+	for _, d := range drift {
+		users[d.Resource] = len(d.Added) + len(d.Removed)
+	}
+	for _, t := range targets {
+		if slices.Contains(missing, t.UserGroupID) {
+			continue
+		}
+		membershipDriftUsers.WithLabelValues(ns, name, r.names.Hash(t.UserGroupID)).Set(float64(users[t.UserGroupID]))
+	}
+}
+
+// describeMigration describes the move of a replication group from AUTH
+// token authentication to RBAC, which advances one phase per reconcile.
+func (r *run) describeMigration() bool {
+	mp := r.params.Migration
+	if mp.ReplicationGroupID == "" {
+		return true
+	}
+	if mp.UserGroupID == "" {
+		return r.fatal(errors.New("spec.parameters.migration.userGroupId or spec.parameters.userGroupId is required to migrate to RBAC"))
+	}
+	m, err := describeMigration(r.ctx, r.client, mp)
+	if err != nil {
+		r.f.awsCallFailed(r.rsp, "RBACMigrated", "MigrationFailed", r.diagnose(err))
+		return true
+	}
+	r.migration = m
+	if r.apply && m.Phase == migrationPhaseReady {
+		r.plan.Add(policy.ActionModifyReplicationGroup, 1)
+	}
+	return true
+}
+
+// describeReplacement describes the replacement of the built-in default user
+// of a user group, which advances one phase per reconcile.
+func (r *run) describeReplacement() bool {
+	rp := r.params.DefaultUserReplacement
+	if rp.UserID == "" {
+		return true
+	}
+	if rp.UserGroupID == "" {
+		return r.fatal(errors.New("spec.parameters.defaultUserReplacement.userGroupId or spec.parameters.userGroupId is required to replace the default user"))
+	}
+	rep, err := describeDefaultUserReplacement(r.ctx, r.client, rp)
+	if err != nil {
+		r.f.awsCallFailed(r.rsp, "DefaultUserReplaced", "ReplacementFailed", r.diagnose(err))
+		return true
+	}
+	r.replacement = rep
+	switch {
+	case r.apply && rep.Phase == replacementPhasePending:
+		r.plan.Add(policy.ActionCreateUser, 1)
+	case r.apply && rep.Phase == replacementPhaseReady:
+		r.plan.Add(policy.ActionModifyUserGroup, 1)
+	}
+	return true
+}
+
+// describeReconcile describes how the target user group's membership must
+// change to converge on the discovered users in direct mode.
+func (r *run) describeReconcile() bool {
+	params := r.params
+	if params.ManagementMode != managementModeDirect {
+		return true
+	}
+	switch {
+	case !r.apply && !params.DryRun:
+		response.Warning(r.rsp, errors.New("managementMode direct requires the applyMode feature; not modifying user groups")).TargetCompositeAndClaim()
+	case params.UserGroupID == "":
+		response.Warning(r.rsp, errors.New("managementMode direct requires spec.parameters.userGroupId; not modifying user groups")).TargetCompositeAndClaim()
+	}
+	if r.implicit == nil {
+		return true
+	}
+	var trusted []string
+	if r.applied.Trusted(params.ConsistencyWindow, r.now) && r.applied.UserGroupID == r.implicit.Name {
+		trusted = r.applied.UserIDs
+	}
+	target := membership.Target{UserGroupID: r.implicit.Name, UserIDs: r.implicit.UserIDs, DefaultUserID: r.defaults[r.implicit.Name], Applied: trusted}
+	rec, err := membership.Describe(r.ctx, r.client, target, r.users)
+	if err != nil {
+		r.f.awsCallFailed(r.rsp, "UserGroupReconciled", "ModifyFailed", r.diagnose(err))
+		return true
+	}
+	r.reconcile = rec
+	if len(rec.Unchecked) > 0 {
+		response.Warning(r.rsp, fmt.Errorf("not removing users %v from user group %q: without elasticache:DescribeUsers the function can't check whether they're named default, so it doesn't know whether the user group keeps a user named default", r.names.HashAll(rec.Unchecked), r.names.Hash(rec.UserGroupID))).
+			TargetCompositeAndClaim()
+	}
+	if r.apply && rec.NeedsModify() {
+		r.plan.Add(policy.ActionModifyUserGroup, 1)
+		r.plan.Add(policy.ActionAddTagsToResource, 1)
+		if params.ApplyLock.Enabled {
+			r.plan.Add(policy.ActionAddTagsToResource, 1)
+			r.plan.Add(policy.ActionRemoveTagsFromResource, 1)
+		}
+	}
+	if r.defaultsChecked {
+		if rec.KeepsDefaultUser {
+			r.missingDefaults = slices.DeleteFunc(r.missingDefaults, func(name string) bool { return name == rec.UserGroupID })
+		}
+		defaultUsersPresent(r.rsp, r.missingDefaults)
+	}
+	return true
+}
+
+// approvePlan holds plans that need more write calls than the approval
+// threshold until they're approved.
+func (r *run) approvePlan() bool {
+	plan, threshold := r.plan, r.params.Approval.WriteThreshold
+	r.hash = plan.Hash(r.doc)
+	r.held = r.params.Approval.Holds(plan, r.hash, r.oxr.Resource.GetAnnotations())
+	if r.held {
+		r.bypassApproval()
+	}
+	if plan.Total() > 0 {
+		r.status["plannedWrites"] = plan.Status(r.hash, r.held)
+		response.Normalf(r.rsp, "Plan %s needs %s", r.hash, plan).TargetCompositeAndClaim()
+	}
+	switch {
+	case r.held:
+		response.ConditionFalse(r.rsp, "PlanApproved", "AwaitingApproval").
+			WithMessage(fmt.Sprintf("Plan %s needs %d AWS write calls, more than the approval threshold of %d. Annotate the XR with %s=%s to apply it", r.hash, plan.Total(), threshold, policy.ApprovePlanAnnotation, r.hash)).
+			TargetCompositeAndClaim()
+	case plan.NeedsApproval(threshold):
+		response.ConditionTrue(r.rsp, "PlanApproved", "Approved").TargetCompositeAndClaim()
+	case threshold > 0:
+		response.ConditionTrue(r.rsp, "PlanApproved", "WithinThreshold").TargetCompositeAndClaim()
+	}
+	return true
+}
+
+// bypassApproval makes the security-critical removals of a held plan anyway,
+// e.g. of users whose credentials leaked, rather than waiting for the plan to
+// be approved. Only the removals bypass approval. The bypass is recorded in
+// the XR status and the log, and emitted as a warning.
+func (r *run) bypassApproval() {
+	approval := r.params.Approval
+	b := &securityBypass{PlanHash: r.hash}
+	if r.params.ManagementMode == managementModeComposed {
+		for _, d := range r.drift {
+			if ids := approval.Bypassed(d.Removed); len(ids) > 0 {
+				b.Add(d.Resource, ids)
+			}
+		}
+	}
+	if rec := r.reconcile; rec != nil && r.apply && rec.NeedsModify() {
+		if ids := approval.Bypassed(rec.Diff.Removed); len(ids) > 0 {
+			b.Add(rec.UserGroupID, ids)
+			rec.Diff = membership.Diff{Resource: rec.Diff.Resource, Removed: ids}
+		}
+	}
+	if len(b.UserIDs) == 0 {
+		return
+	}
+	r.bypass = b
+	ids, groups := r.names.HashAll(b.UserIDs), r.names.HashAll(b.UserGroups)
+	r.log.Info("Bypassing plan approval for security-critical removals", "planHash", r.hash, "userIDs", ids, "userGroups", groups)
+	response.Warning(r.rsp, fmt.Errorf("removing security-critical users %v from user groups %v without approval of plan %s", ids, groups, r.hash)).TargetCompositeAndClaim()
+	r.status["securityRemovalBypass"] = b.Status(r.now)
+}
+
+// checkTagPolicy checks the tags the function is about to write comply with
+// the account's effective tag policy, before it writes any, rather than
+// having AWS reject them part way through. Tags AWS would reject stop the
+// run. Other non-compliant tags, and those of a dry run, are warned about.
+func (r *run) checkTagPolicy() bool {
+	if !r.params.TagPolicy.Enabled {
+		return true
+	}
+	writes := r.tagWrites()
+	if len(writes) == 0 {
+		return true
+	}
+	tp, err := describeTagPolicy(r.ctx, r.f.organizationsClient(r.cfg))
+	if err != nil {
+		r.f.awsCallFailed(r.rsp, "TagPolicyCompliant", "DescribeFailed", r.diagnose(err))
+		return true
+	}
+	var violations []string
+	enforced := false
+	for _, rt := range slices.Sorted(maps.Keys(writes)) {
+		for _, v := range tp.Check(rt, writes[rt]) {
+			violations = append(violations, v.String())
+			enforced = enforced || v.Enforced
+		}
+	}
+	if len(violations) == 0 {
+		response.ConditionTrue(r.rsp, "TagPolicyCompliant", "Compliant").TargetCompositeAndClaim()
+		return true
+	}
+	err = fmt.Errorf("the tags the function writes don't comply with the account's tag policy: %s", strings.Join(violations, "; "))
+	if enforced && !r.params.DryRun {
+		response.ConditionFalse(r.rsp, "TagPolicyCompliant", "TagPolicyViolation").WithMessage(err.Error()).TargetCompositeAndClaim()
+		return r.fatal(err)
+	}
+	response.ConditionFalse(r.rsp, "TagPolicyCompliant", "NonCompliantTags").WithMessage(err.Error()).TargetCompositeAndClaim()
+	response.Warning(r.rsp, err).TargetCompositeAndClaim()
+	return true
+}
+
+// tagWrites returns the tags the function writes this run, keyed by the
+// resource type they're written to: the origin tags of the target user group
+// it modifies, and its lock, and of the replacement default user it creates.
+func (r *run) tagWrites() map[string]map[string]string {
+	writes := map[string]map[string]string{}
+	if !r.apply && !r.params.DryRun {
+		return writes
+	}
+	if rec := r.reconcile; rec != nil && rec.NeedsModify() {
+		tags := originTags(r.oxr)
+		if lock := r.applyLock(rec); lock != nil {
+			tags[membership.LockTagKey] = lock.Value(r.now)
+		}
+		writes[resourceTypeUserGroup] = tags
+	}
+	if rep := r.replacement; rep != nil && rep.Phase == replacementPhasePending {
+		writes[resourceTypeUser] = originTags(r.oxr)
+	}
+	return writes
+}
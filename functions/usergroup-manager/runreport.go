@@ -0,0 +1,170 @@
+package main
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/crossplane/function-sdk-go/logging"
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// stepReportsKey is the pipeline context key holding a machine-readable
+// description of what each function in the pipeline did this run, keyed by
+// function name, for a function at the end of the pipeline to aggregate into
+// a reconcile report:
+//
+//	stepReports.usergroup-manager.version                    string
+//	stepReports.usergroup-manager.mode.managementMode        string, discover, direct or composed
+//	stepReports.usergroup-manager.mode.discoverySource       string, aws or cluster
+//	stepReports.usergroup-manager.mode.syncMode              string, full, targeted, cluster, degraded or stale
+//	stepReports.usergroup-manager.mode.applyMode             bool
+//	stepReports.usergroup-manager.filters.tagFilter          object of key and value, only set if users were filtered by tag
+//	stepReports.usergroup-manager.filters.userNamePrefix     string, only set if configured
+//	stepReports.usergroup-manager.filters.userNameRegex      string, only set if configured
+//	stepReports.usergroup-manager.filters.engine             string, only set if configured
+//	stepReports.usergroup-manager.filters.userGroups         []string, only set if configured
+//	stepReports.usergroup-manager.filters.sharedPools        []string, only set if configured
+//	stepReports.usergroup-manager.filters.regions            []string, only set if configured
+//	stepReports.usergroup-manager.counts.<count>             number
+//	stepReports.usergroup-manager.durationsMs.<phase>        number
+//
+// Reports written by earlier steps are preserved.
+const stepReportsKey = "stepReports"
+
+// A runReport describes what the function did in one run.
+type runReport struct {
+	ManagementMode  string
+	DiscoverySource string
+	SyncMode        string
+	ApplyMode       bool
+
+	// TagFilter is only rendered if users were filtered by tag.
+	TagFilter   *discovery.TagFilter
+	NameFilter  discovery.NameFilter
+	Engine      string
+	UserGroups  []string
+	SharedPools []string
+	Regions     []string
+
+	DiscoveredUsers   int
+	GoneUsers         int
+	ExcludedUsers     int
+	ProvisioningUsers int
+	PlannedWrites     int
+	AWSCalls          int
+	AWSThrottles      int
+	Warnings          int
+
+	// Total is how long the run took. Discovery is how long listing or
+	// verifying users took, Filtering how long narrowing them down to this
+	// XR's took, Policy how long deciding what to do with them took and
+	// Apply how long doing it took. AWS is how long all AWS API calls took,
+	// whatever the phase.
+	Total     time.Duration
+	Discovery time.Duration
+	Filtering time.Duration
+	Policy    time.Duration
+	Apply     time.Duration
+	AWS       time.Duration
+}
+
+// Context returns the report in a form that can be written to the pipeline
+// context.
+func (r *runReport) Context() map[string]any {
+	filters := map[string]any{}
+	if r.TagFilter != nil {
+		filters["tagFilter"] = map[string]any{"key": r.TagFilter.Key, "value": r.TagFilter.Value}
+	}
+	if r.NameFilter.Prefix != "" {
+		filters["userNamePrefix"] = r.NameFilter.Prefix
+	}
+	if r.NameFilter.Regex != nil {
+		filters["userNameRegex"] = r.NameFilter.Regex.String()
+	}
+	if r.Engine != "" {
+		filters["engine"] = r.Engine
+	}
+	if len(r.UserGroups) > 0 {
+		filters["userGroups"] = r.UserGroups
+	}
+	if len(r.SharedPools) > 0 {
+		filters["sharedPools"] = r.SharedPools
+	}
+	if len(r.Regions) > 0 {
+		filters["regions"] = r.Regions
+	}
+	return map[string]any{
+		"version": functionVersion(),
+		"mode": map[string]any{
+			"managementMode":  r.ManagementMode,
+			"discoverySource": r.DiscoverySource,
+			"syncMode":        r.SyncMode,
+			"applyMode":       r.ApplyMode,
+		},
+		"filters": filters,
+		"counts": map[string]any{
+			"discoveredUsers":   r.DiscoveredUsers,
+			"goneUsers":         r.GoneUsers,
+			"excludedUsers":     r.ExcludedUsers,
+			"provisioningUsers": r.ProvisioningUsers,
+			"plannedWrites":     r.PlannedWrites,
+			"awsCalls":          r.AWSCalls,
+			"awsThrottles":      r.AWSThrottles,
+			"warnings":          r.Warnings,
+		},
+		"durationsMs": map[string]any{
+			"total":     r.Total.Milliseconds(),
+			"discovery": r.Discovery.Milliseconds(),
+			"filtering": r.Filtering.Milliseconds(),
+			"policy":    r.Policy.Milliseconds(),
+			"apply":     r.Apply.Milliseconds(),
+			"aws":       r.AWS.Milliseconds(),
+		},
+	}
+}
+
+// LogTimings writes how long each phase of the run took to the log as a
+// single line, so a phase that got slower stands out without debug logs.
+func (r *runReport) LogTimings(log logging.Logger) {
+	log.Info("Run timings",
+		"syncMode", r.SyncMode,
+		"discoveryMs", r.Discovery.Milliseconds(),
+		"filteringMs", r.Filtering.Milliseconds(),
+		"policyMs", r.Policy.Milliseconds(),
+		"applyMs", r.Apply.Milliseconds(),
+		"awsMs", r.AWS.Milliseconds(),
+		"totalMs", r.Total.Milliseconds(),
+	)
+}
+
+// mergeStepReport returns the request's step reports with value set as the
+// report of the named function. The reports of other functions are
+// preserved.
+func mergeStepReport(req *fnv1.RunFunctionRequest, name string, value *structpb.Value) *structpb.Value {
+	reports := &structpb.Struct{Fields: map[string]*structpb.Value{}}
+	if v, ok := request.GetContextKey(req, stepReportsKey); ok && v.GetStructValue() != nil {
+		reports = v.GetStructValue()
+	}
+
+	merged := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(reports.GetFields())+1)}
+	for k, v := range reports.GetFields() {
+		merged.Fields[k] = v
+	}
+	merged.Fields[name] = value
+	return structpb.NewStructValue(merged)
+}
+
+// countWarnings returns the number of warning results in rsp.
+func countWarnings(rsp *fnv1.RunFunctionResponse) int {
+	n := 0
+	for _, r := range rsp.GetResults() {
+		if r.GetSeverity() == fnv1.Severity_SEVERITY_WARNING {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestRunReportContext(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		report *runReport
+		want   map[string]any
+	}{
+		"Discover": {
+			reason: "A discovery run should report its mode, counts and durations, with no filters.",
+			report: &runReport{
+				ManagementMode:  managementModeDiscover,
+				DiscoverySource: discoverySourceAWS,
+				SyncMode:        syncModeFull,
+				DiscoveredUsers: 3,
+				AWSCalls:        1,
+				Total:           1500 * time.Millisecond,
+				Discovery:       time.Second,
+				Filtering:       100 * time.Millisecond,
+				Policy:          200 * time.Millisecond,
+				Apply:           150 * time.Millisecond,
+				AWS:             900 * time.Millisecond,
+			},
+			want: map[string]any{
+				"version": functionVersion(),
+				"mode": map[string]any{
+					"managementMode":  managementModeDiscover,
+					"discoverySource": discoverySourceAWS,
+					"syncMode":        syncModeFull,
+					"applyMode":       false,
+				},
+				"filters": map[string]any{},
+				"counts": map[string]any{
+					"discoveredUsers":   3,
+					"goneUsers":         0,
+					"excludedUsers":     0,
+					"provisioningUsers": 0,
+					"plannedWrites":     0,
+					"awsCalls":          1,
+					"awsThrottles":      0,
+					"warnings":          0,
+				},
+				"durationsMs": map[string]any{
+					"total":     int64(1500),
+					"discovery": int64(1000),
+					"filtering": int64(100),
+					"policy":    int64(200),
+					"apply":     int64(150),
+					"aws":       int64(900),
+				},
+			},
+		},
+		"Filtered": {
+			reason: "The filters a run applied should be reported.",
+			report: &runReport{
+				TagFilter:   &discovery.TagFilter{Key: defaultCacheIDTagKey, Value: "orders"},
+				UserGroups:  []string{"app", "ops"},
+				SharedPools: []string{"platform"},
+				Regions:     []string{"us-east-1", "eu-west-1"},
+			},
+			want: map[string]any{
+				"version": functionVersion(),
+				"mode": map[string]any{
+					"managementMode":  "",
+					"discoverySource": "",
+					"syncMode":        "",
+					"applyMode":       false,
+				},
+				"filters": map[string]any{
+					"tagFilter":   map[string]any{"key": defaultCacheIDTagKey, "value": "orders"},
+					"userGroups":  []string{"app", "ops"},
+					"sharedPools": []string{"platform"},
+					"regions":     []string{"us-east-1", "eu-west-1"},
+				},
+				"counts": map[string]any{
+					"discoveredUsers":   0,
+					"goneUsers":         0,
+					"excludedUsers":     0,
+					"provisioningUsers": 0,
+					"plannedWrites":     0,
+					"awsCalls":          0,
+					"awsThrottles":      0,
+					"warnings":          0,
+				},
+				"durationsMs": map[string]any{
+					"total":     int64(0),
+					"discovery": int64(0),
+					"filtering": int64(0),
+					"policy":    int64(0),
+					"apply":     int64(0),
+					"aws":       int64(0),
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, tc.report.Context()); diff != "" {
+				t.Errorf("%s\nContext(): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestMergeStepReport(t *testing.T) {
+	req := &fnv1.RunFunctionRequest{
+		Context: resource.MustStructJSON(`{
+			"stepReports": {
+				"function-kcl": {"counts": {"resources": 4}},
+				"usergroup-manager": {"counts": {"discoveredUsers": 1}}
+			}
+		}`),
+	}
+
+	got := mergeStepReport(req, functionName, structpb.NewStructValue(resource.MustStructJSON(`{"counts": {"discoveredUsers": 2}}`)))
+	want := structpb.NewStructValue(resource.MustStructJSON(`{
+		"function-kcl": {"counts": {"resources": 4}},
+		"usergroup-manager": {"counts": {"discoveredUsers": 2}}
+	}`))
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("The reports of other steps should be preserved, replacing this function's.\nmergeStepReport(...): -want, +got:\n%s", diff)
+	}
+}
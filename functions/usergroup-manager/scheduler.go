@@ -0,0 +1,119 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+// schedulerPriorityReserve is the fraction of the full discovery budget kept
+// for XRs that need a full discovery urgently.
+const schedulerPriorityReserve = 0.25
+
+// A discoveryPriority ranks how urgently an XR needs a full discovery, i.e. a
+// listing of every user.
+type discoveryPriority int
+
+const (
+	// discoveryPriorityNormal discoveries only run while the budget isn't
+	// nearly spent. Otherwise the previously discovered users are verified
+	// instead.
+	discoveryPriorityNormal discoveryPriority = iota
+
+	// discoveryPriorityHigh discoveries, of XRs whose spec changed or whose
+	// users are stale, may spend the reserve.
+	discoveryPriorityHigh
+
+	// discoveryPriorityRequired discoveries always run, since there are no
+	// previously discovered users to verify instead or the XR is
+	// prioritized. They may overspend the budget, which delays later
+	// discoveries.
+	discoveryPriorityRequired
+)
+
+// fullDiscoveryPriority returns how urgently an XR needs a full discovery.
+// Its spec changed if its generation differs from that of the last full
+// discovery, and its users are stale if they were last listed more than
+// maxStaleness ago.
+func fullDiscoveryPriority(previous []string, lastFull time.Time, lastGeneration, generation int64, maxStaleness time.Duration, now time.Time) discoveryPriority {
+	switch {
+	case len(previous) == 0:
+		return discoveryPriorityRequired
+	case lastFull.IsZero(), lastGeneration != generation, now.Sub(lastFull) >= maxStaleness:
+		return discoveryPriorityHigh
+	default:
+		return discoveryPriorityNormal
+	}
+}
+
+// observedLastFullSyncGeneration returns the XR's generation when its users
+// were last fully discovered, as recorded in its status.
+func observedLastFullSyncGeneration(oxr *resource.Composite) int64 {
+	v, err := oxr.Resource.GetValue(status.Path("lastFullSyncGeneration"))
+	if err != nil {
+		return 0
+	}
+	switch g := v.(type) {
+	case int64:
+		return g
+	case float64:
+		return int64(g)
+	}
+	return 0
+}
+
+// A discoveryScheduler spreads the full discoveries of every XR sharing the
+// function across time, keeping them within a budget of Budget per Window. The
+// budget refills continuously, so discoveries deferred in one time slice run
+// in a later one. A nil scheduler admits every discovery.
+type discoveryScheduler struct {
+	Budget int
+	Window time.Duration
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newDiscoveryScheduler returns a scheduler admitting budget full
+// discoveries per window, or nil if budget isn't positive.
+func newDiscoveryScheduler(budget int, window time.Duration) *discoveryScheduler {
+	if budget <= 0 || window <= 0 {
+		return nil
+	}
+	return &discoveryScheduler{Budget: budget, Window: window, tokens: float64(budget)}
+}
+
+// Admit returns true if a full discovery of the supplied priority may run
+// now, spending one from the budget if so.
+func (s *discoveryScheduler) Admit(p discoveryPriority, now time.Time) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.last.IsZero() && now.After(s.last) {
+		refill := float64(s.Budget) * float64(now.Sub(s.last)) / float64(s.Window)
+		s.tokens = min(s.tokens+refill, float64(s.Budget))
+	}
+	if s.last.IsZero() || now.After(s.last) {
+		s.last = now
+	}
+
+	need := 1.0
+	switch p {
+	case discoveryPriorityRequired:
+		need = 0
+	case discoveryPriorityNormal:
+		need += schedulerPriorityReserve * float64(s.Budget)
+	}
+	if s.tokens < need {
+		return false
+	}
+	s.tokens--
+	return true
+}
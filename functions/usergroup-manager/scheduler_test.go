@@ -0,0 +1,167 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+func TestFullDiscoveryPriority(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := map[string]struct {
+		reason         string
+		previous       []string
+		lastFull       time.Time
+		lastGeneration int64
+		want           discoveryPriority
+	}{
+		"NeverDiscovered": {
+			reason: "An XR without previously discovered users must be fully discovered.",
+			want:   discoveryPriorityRequired,
+		},
+		"NeverListed": {
+			reason:   "An XR whose users were never fully listed by the scheduler should have priority.",
+			previous: []string{"app1"},
+			want:     discoveryPriorityHigh,
+		},
+		"SpecChanged": {
+			reason:         "An XR whose spec changed since its last full discovery should have priority.",
+			previous:       []string{"app1"},
+			lastFull:       now.Add(-time.Minute),
+			lastGeneration: 1,
+			want:           discoveryPriorityHigh,
+		},
+		"Stale": {
+			reason:         "An XR whose users were last listed too long ago should have priority.",
+			previous:       []string{"app1"},
+			lastFull:       now.Add(-2 * time.Hour),
+			lastGeneration: 2,
+			want:           discoveryPriorityHigh,
+		},
+		"Fresh": {
+			reason:         "An unchanged XR whose users were listed recently shouldn't have priority.",
+			previous:       []string{"app1"},
+			lastFull:       now.Add(-time.Minute),
+			lastGeneration: 2,
+			want:           discoveryPriorityNormal,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := fullDiscoveryPriority(tc.previous, tc.lastFull, tc.lastGeneration, 2, time.Hour, now)
+			if got != tc.want {
+				t.Errorf("%s\nfullDiscoveryPriority(...): want %d, got %d", tc.reason, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDiscoverySchedulerAdmit(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	type admission struct {
+		p    discoveryPriority
+		at   time.Duration
+		want bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		s      *discoveryScheduler
+		admits []admission
+	}{
+		"Unlimited": {
+			reason: "A nil scheduler should admit every discovery.",
+			admits: []admission{
+				{p: discoveryPriorityNormal, want: true},
+				{p: discoveryPriorityNormal, want: true},
+			},
+		},
+		"Reserve": {
+			reason: "Normal discoveries should leave a reserve of the budget for priority ones.",
+			s:      newDiscoveryScheduler(4, time.Minute),
+			admits: []admission{
+				{p: discoveryPriorityNormal, want: true},
+				{p: discoveryPriorityNormal, want: true},
+				{p: discoveryPriorityNormal, want: true},
+				{p: discoveryPriorityNormal, want: false},
+				{p: discoveryPriorityHigh, want: true},
+				{p: discoveryPriorityHigh, want: false},
+			},
+		},
+		"Required": {
+			reason: "Required discoveries should run even when the budget is spent, delaying later ones.",
+			s:      newDiscoveryScheduler(1, time.Minute),
+			admits: []admission{
+				{p: discoveryPriorityHigh, want: true},
+				{p: discoveryPriorityRequired, want: true},
+				{p: discoveryPriorityHigh, at: time.Minute, want: false},
+				{p: discoveryPriorityHigh, at: 2 * time.Minute, want: true},
+			},
+		},
+		"Refill": {
+			reason: "The budget should refill over the window, spreading discoveries across time slices.",
+			s:      newDiscoveryScheduler(2, time.Minute),
+			admits: []admission{
+				{p: discoveryPriorityHigh, want: true},
+				{p: discoveryPriorityHigh, want: true},
+				{p: discoveryPriorityHigh, at: 10 * time.Second, want: false},
+				{p: discoveryPriorityHigh, at: 30 * time.Second, want: true},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			for i, a := range tc.admits {
+				if got := tc.s.Admit(a.p, now.Add(a.at)); got != a.want {
+					t.Errorf("%s\nAdmit(...) #%d: want %t, got %t", tc.reason, i, a.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestObservedLastFullSyncGeneration(t *testing.T) {
+	xr := func(fields map[string]any) *resource.Composite {
+		c := composite.New()
+		c.Object["status"] = map[string]any{status.Key: fields}
+		return &resource.Composite{Resource: c}
+	}
+
+	cases := map[string]struct {
+		reason string
+		xr     *resource.Composite
+		want   int64
+	}{
+		"Integer": {
+			reason: "A recorded integer generation should be returned.",
+			xr:     xr(map[string]any{"lastFullSyncGeneration": int64(3)}),
+			want:   3,
+		},
+		"Float": {
+			reason: "A recorded generation decoded as a float should be returned.",
+			xr:     xr(map[string]any{"lastFullSyncGeneration": float64(3)}),
+			want:   3,
+		},
+		"Missing": {
+			reason: "An XR without a recorded generation should return zero.",
+			xr:     xr(map[string]any{}),
+			want:   0,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := observedLastFullSyncGeneration(tc.xr); got != tc.want {
+				t.Errorf("%s\nobservedLastFullSyncGeneration(...): want %d, got %d", tc.reason, tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// serverlessCache identifies a serverless cache the user group should be
+// attached to.
+type serverlessCache struct {
+	Name string
+	ARN  string
+}
+
+// discoverServerlessCaches returns the serverless caches whose tagKey tag
+// equals cacheID. DescribeServerlessCaches doesn't return tags, so each cache's
+// tags are read with ListTagsForResource.
+func discoverServerlessCaches(ctx context.Context, client awsclient.ElastiCache, tagKey, cacheID string) ([]serverlessCache, error) {
+	var caches []serverlessCache
+
+	p := elasticache.NewDescribeServerlessCachesPaginator(client, &elasticache.DescribeServerlessCachesInput{})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe serverless caches: %w", err)
+		}
+
+		for _, c := range page.ServerlessCaches {
+			arn := aws.ToString(c.ARN)
+			tags, err := client.ListTagsForResource(ctx, &elasticache.ListTagsForResourceInput{ResourceName: c.ARN})
+			if err != nil {
+				return nil, fmt.Errorf("failed to list tags for serverless cache %q: %w", arn, err)
+			}
+
+			if discovery.HasTag(tags.TagList, tagKey, cacheID) {
+				caches = append(caches, serverlessCache{Name: aws.ToString(c.ServerlessCacheName), ARN: arn})
+			}
+		}
+	}
+
+	sort.Slice(caches, func(i, j int) bool { return caches[i].Name < caches[j].Name })
+	return caches, nil
+}
+
+// serverlessCachesContext returns the discovered caches in a form that can be
+// written to the pipeline context.
+func serverlessCachesContext(caches []serverlessCache) []any {
+	out := make([]any, len(caches))
+	for i, c := range caches {
+		out[i] = map[string]any{
+			"name": c.Name,
+			"arn":  c.ARN,
+		}
+	}
+	return out
+}
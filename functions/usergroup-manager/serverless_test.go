@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestDiscoverServerlessCaches(t *testing.T) {
+	cache := func(name string) types.ServerlessCache {
+		return types.ServerlessCache{ServerlessCacheName: aws.String(name), ARN: aws.String("arn:" + name)}
+	}
+	tag := func(value string) []types.Tag {
+		return []types.Tag{{Key: aws.String(defaultCacheIDTagKey), Value: aws.String(value)}}
+	}
+
+	type want struct {
+		caches     []serverlessCache
+		context    []any
+		listedTags []string
+		err        bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		client *fakeElastiCache
+		want   want
+	}{
+		"TagMatch": {
+			reason: "Only serverless caches tagged with the cache ID should be discovered, sorted by name, looking up each cache's tags once.",
+			client: &fakeElastiCache{
+				serverlessCaches: []types.ServerlessCache{cache("sessions"), cache("other"), cache("orders"), cache("untagged")},
+				tags: map[string][]types.Tag{
+					"arn:sessions": tag("prod-cache"),
+					"arn:other":    tag("test-cache"),
+					"arn:orders":   tag("prod-cache"),
+				},
+			},
+			want: want{
+				caches: []serverlessCache{{Name: "orders", ARN: "arn:orders"}, {Name: "sessions", ARN: "arn:sessions"}},
+				context: []any{
+					map[string]any{"name": "orders", "arn": "arn:orders"},
+					map[string]any{"name": "sessions", "arn": "arn:sessions"},
+				},
+				listedTags: []string{"arn:sessions", "arn:other", "arn:orders", "arn:untagged"},
+			},
+		},
+		"TagMismatch": {
+			reason: "No serverless caches should be discovered if none is tagged with the cache ID.",
+			client: &fakeElastiCache{
+				serverlessCaches: []types.ServerlessCache{cache("other")},
+				tags:             map[string][]types.Tag{"arn:other": tag("test-cache")},
+			},
+			want: want{
+				context:    []any{},
+				listedTags: []string{"arn:other"},
+			},
+		},
+		"Error": {
+			reason: "Failing to describe serverless caches should return an error.",
+			client: &fakeElastiCache{err: &smithy.GenericAPIError{Code: "AccessDenied"}},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			caches, err := discoverServerlessCaches(context.Background(), tc.client, defaultCacheIDTagKey, "prod-cache")
+			got := want{caches: caches, listedTags: tc.client.listedTags, err: err != nil}
+			if err == nil {
+				got.context = serverlessCachesContext(caches)
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{}), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\ndiscoverServerlessCaches(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+// Package status writes what the function reports to the XR status, below
+// status.userGroupManager.
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// Key is the only top-level XR status field this function writes.
+// Everything it reports lives below it, so other functions in the pipeline
+// can own the rest of the XR status.
+const Key = "userGroupManager"
+
+// Path returns the field path of a field of status.userGroupManager, e.g.
+// status.userGroupManager.userIDs for userIDs.
+func Path(field string) string {
+	return "status." + Key + "." + field
+}
+
+// mappable are the fields of status.userGroupManager that can be mapped
+// onto other status paths with spec.parameters.statusFields.
+var mappable = map[string]bool{
+	"discoveredUsers":            true,
+	"userIDs":                    true,
+	"users":                      true,
+	"discoveredServerlessCaches": true,
+	"costAllocation":             true,
+	"userGroups":                 true,
+	"identityUsers":              true,
+	"bundleUsers":                true,
+	"adoptionReport":             true,
+	"summary":                    true,
+}
+
+// legacyKeys were written at the top level of the XR status by earlier
+// versions of this function.
+var legacyKeys = []string{
+	"discoveredUsers",
+	"userIDs",
+	"discoveredServerlessCaches",
+	"costAllocation",
+}
+
+// Summarize returns a compact, human readable summary of status suitable for
+// a kubectl printer column, e.g. "37 users, 2 serverless caches, 3 user
+// groups".
+func Summarize(status map[string]any) string {
+	parts := []string{plural(status["discoveredUsers"], "user", "users")}
+	if n, ok := status["discoveredServerlessCaches"]; ok {
+		parts = append(parts, plural(n, "serverless cache", "serverless caches"))
+	}
+	if g, ok := status["userGroups"].(map[string]any); ok {
+		parts = append(parts, plural(len(g), "user group", "user groups"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func plural(n any, one, many string) string {
+	if n == 1 {
+		return fmt.Sprintf("%v %s", n, one)
+	}
+	return fmt.Sprintf("%v %s", n, many)
+}
+
+// Set sets status.userGroupManager on the desired XR, leaving any other
+// status fields desired by earlier pipeline steps untouched.
+func Set(dxr *resource.Composite, status map[string]any) error {
+	canonical, err := canonical(status)
+	if err != nil {
+		return err
+	}
+	if err := dxr.Resource.SetValue("status."+Key, canonical); err != nil {
+		return fmt.Errorf("cannot set status.%s: %w", Key, err)
+	}
+	return nil
+}
+
+// LegacyFields returns the legacy top-level status fields present in the
+// observed XR that no earlier pipeline step desires. They were written by this
+// function before it moved to status.userGroupManager; because they're no
+// longer in the desired XR, server-side apply removes them.
+func LegacyFields(oxr, dxr *resource.Composite) []string {
+	observed, _ := oxr.Resource.Object["status"].(map[string]any)
+	desired, _ := dxr.Resource.Object["status"].(map[string]any)
+
+	var found []string
+	for _, k := range legacyKeys {
+		if _, ok := observed[k]; !ok {
+			continue
+		}
+		if _, ok := desired[k]; ok {
+			continue
+		}
+		found = append(found, k)
+	}
+	return found
+}
+
+// SetMapped additionally writes each output named in mapping to the XR
+// status path it maps to, so XRDs with existing status fields can adopt the
+// function without a schema change. Outputs are read from the canonical
+// status.userGroupManager written by Set. Each mapping that can't be
+// applied is reported and skipped.
+func SetMapped(dxr *resource.Composite, mapping map[string]string) []error {
+	outputs, _ := dxr.Resource.Object["status"].(map[string]any)[Key].(map[string]any)
+
+	names := make([]string, 0, len(mapping))
+	for name := range mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	targets := map[string]string{}
+	for _, name := range names {
+		path := strings.TrimPrefix(mapping[name], "status.")
+		switch {
+		case !mappable[name]:
+			errs = append(errs, fmt.Errorf("statusFields.%s: unknown output", name))
+			continue
+		case path == "":
+			errs = append(errs, fmt.Errorf("statusFields.%s: status path must not be empty", name))
+			continue
+		case path == Key || strings.HasPrefix(path, Key+"."):
+			errs = append(errs, fmt.Errorf("statusFields.%s: cannot map onto status.%s, which this function owns", name, Key))
+			continue
+		case targets[path] != "":
+			errs = append(errs, fmt.Errorf("statusFields.%s: status.%s is already mapped from %s", name, path, targets[path]))
+			continue
+		}
+
+		v, ok := outputs[name]
+		if !ok {
+			// Optional outputs, e.g. costAllocation, are only present when
+			// enabled. Don't write anything rather than clearing the field.
+			continue
+		}
+		if err := dxr.Resource.SetValue("status."+path, v); err != nil {
+			errs = append(errs, fmt.Errorf("statusFields.%s: cannot set status.%s: %w", name, path, err))
+			continue
+		}
+		targets[path] = name
+	}
+	return errs
+}
+
+// Users returns the discovered users in the form written to the XR
+// status, so later steps can tell e.g. IAM-authenticated users from others.
+// Fields that aren't known, such as those of users kept from a previous
+// discovery, are left out.
+func Users(users []discovery.User) []any {
+	out := make([]any, len(users))
+	for i, u := range users {
+		s := map[string]any{"userId": u.ID}
+		if u.Engine != "" {
+			s["engine"] = u.Engine
+		}
+		if u.AuthenticationType != "" {
+			s["authenticationType"] = u.AuthenticationType
+		}
+		if u.Status != "" {
+			s["status"] = u.Status
+		}
+		out[i] = s
+	}
+	return out
+}
+
+// canonical returns status in the exact form the API server will return it:
+// JSON types only (float64 numbers, []any lists, map[string]any objects).
+// Writing the canonical form means the desired status compares equal to the
+// observed status when nothing changed, regardless of which Go types were
+// used to build it or the platform the function runs on.
+func canonical(status map[string]any) (map[string]any, error) {
+	b, err := json.Marshal(status)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode status: %w", err)
+	}
+	out := map[string]any{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, fmt.Errorf("cannot decode status: %w", err)
+	}
+	return out, nil
+}
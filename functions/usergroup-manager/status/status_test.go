@@ -0,0 +1,179 @@
+package status
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/crossplane/function-sdk-go/resource"
+	"github.com/crossplane/function-sdk-go/resource/composite"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestSetMapped(t *testing.T) {
+	type want struct {
+		status map[string]any
+		errs   []string
+	}
+
+	cases := map[string]struct {
+		reason  string
+		mapping map[string]string
+		want    want
+	}{
+		"NoMapping": {
+			reason: "Without a mapping only status.userGroupManager should be written.",
+			want: want{
+				status: map[string]any{
+					Key: map[string]any{"discoveredUsers": int64(1), "userIDs": []any{"app1"}},
+				},
+			},
+		},
+		"Mapped": {
+			reason: "Mapped outputs should be copied to their status paths, with or without a status. prefix.",
+			mapping: map[string]string{
+				"userIDs":         "cache.users",
+				"discoveredUsers": "status.cache.userCount",
+				"costAllocation":  "cache.cost",
+			},
+			want: want{
+				status: map[string]any{
+					Key:     map[string]any{"discoveredUsers": int64(1), "userIDs": []any{"app1"}},
+					"cache": map[string]any{"users": []any{"app1"}, "userCount": int64(1)},
+				},
+			},
+		},
+		"Invalid": {
+			reason: "Unknown outputs, owned paths and conflicting paths should be reported and skipped.",
+			mapping: map[string]string{
+				"userIds":         "cache.users",
+				"userIDs":         "userGroupManager.ids",
+				"discoveredUsers": "",
+			},
+			want: want{
+				status: map[string]any{
+					Key: map[string]any{"discoveredUsers": int64(1), "userIDs": []any{"app1"}},
+				},
+				errs: []string{
+					"statusFields.discoveredUsers: status path must not be empty",
+					"statusFields.userIDs: cannot map onto status.userGroupManager, which this function owns",
+					"statusFields.userIds: unknown output",
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dxr := &resource.Composite{Resource: composite.New()}
+			if err := Set(dxr, map[string]any{"discoveredUsers": 1, "userIDs": []string{"app1"}}); err != nil {
+				t.Fatal(err)
+			}
+
+			errs := []string{}
+			for _, err := range SetMapped(dxr, tc.mapping) {
+				errs = append(errs, err.Error())
+			}
+
+			if diff := cmp.Diff(tc.want.status, dxr.Resource.Object["status"]); diff != "" {
+				t.Errorf("%s\nSetMapped(...): -want status, +got status:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.errs, errs, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\nSetMapped(...): -want errs, +got errs:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		status map[string]any
+		want   string
+	}{
+		"UsersOnly": {
+			reason: "Only users should be summarized when serverless caches weren't discovered.",
+			status: map[string]any{"discoveredUsers": 37},
+			want:   "37 users",
+		},
+		"Singular": {
+			reason: "Counts of one should use the singular noun.",
+			status: map[string]any{"discoveredUsers": 1, "discoveredServerlessCaches": 1},
+			want:   "1 user, 1 serverless cache",
+		},
+		"ServerlessCaches": {
+			reason: "Discovered serverless caches should be included, even when there are none.",
+			status: map[string]any{"discoveredUsers": 2, "discoveredServerlessCaches": 0},
+			want:   "2 users, 0 serverless caches",
+		},
+		"UserGroups": {
+			reason: "The number of configured user groups should be included.",
+			status: map[string]any{"discoveredUsers": 5, "userGroups": map[string]any{"app": nil, "ops": nil}},
+			want:   "5 users, 2 user groups",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := Summarize(tc.status)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nSummarize(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	status := map[string]any{
+		"discoveredUsers": 2,
+		"userIDs":         []string{"default", "app1"},
+		"costAllocation": map[string]any{
+			"caches": map[string]any{"prod-cache": map[string]any{"users": int64(2)}},
+		},
+	}
+	want := map[string]any{
+		"discoveredUsers": float64(2),
+		"userIDs":         []any{"default", "app1"},
+		"costAllocation": map[string]any{
+			"caches": map[string]any{"prod-cache": map[string]any{"users": float64(2)}},
+		},
+	}
+
+	got, err := canonical(status)
+	if err != nil {
+		t.Fatalf("canonical(...): %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("canonical(...): -want, +got:\n%s", diff)
+	}
+}
+
+// benchmarkStatus returns a status holding n discovered users, like the one
+// the function writes.
+func benchmarkStatus(n int) map[string]any {
+	users := make([]discovery.User, n)
+	ids := make([]string, n)
+	for i := range users {
+		ids[i] = fmt.Sprintf("app%05d", i)
+		users[i] = discovery.User{ID: ids[i], Engine: "redis", Status: "active"}
+	}
+	return map[string]any{
+		"discoveredUsers": n,
+		"userIDs":         ids,
+		"users":           Users(users),
+		"syncMode":        "full",
+	}
+}
+
+func BenchmarkCanonical(b *testing.B) {
+	status := benchmarkStatus(10000)
+	b.ResetTimer()
+	for range b.N {
+		if _, err := canonical(status); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/crossplane/function-sdk-go/logging"
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+// supportBundleAnnotation requests a support bundle when set on an XR. Its
+// value is an arbitrary token; change it to request another bundle.
+const supportBundleAnnotation = "usergroup-manager.upbound.io/collect-support-bundle"
+
+// supportBundleMinInterval is the shortest time between two support bundles
+// for the same XR, however often the token changes.
+const supportBundleMinInterval = 10 * time.Minute
+
+// maxCapturedPayloadBytes bounds the size of each captured API input or
+// output. Larger payloads are replaced by their size.
+const maxCapturedPayloadBytes = 64 * 1024
+
+// redacted replaces the values of sensitive fields in support bundles.
+const redacted = "REDACTED"
+
+// sensitiveFields are substrings of field names whose values are never
+// written to a support bundle.
+var sensitiveFields = []string{"password", "secret", "token", "credential"}
+
+// A supportBundleRequest is an XR's current support bundle token and the
+// last bundle collected for it.
+type supportBundleRequest struct {
+	Token         string
+	LastToken     string
+	LastCollected time.Time
+}
+
+// observedSupportBundleRequest reads the requested token from the observed
+// XR's annotations and the last collected bundle from its status.
+func observedSupportBundleRequest(oxr *resource.Composite) supportBundleRequest {
+	r := supportBundleRequest{Token: oxr.Resource.GetAnnotations()[supportBundleAnnotation]}
+	r.LastToken, _ = oxr.Resource.GetString(status.Path("supportBundle.token"))
+	collected, _ := oxr.Resource.GetString(status.Path("supportBundle.collectedTime"))
+	r.LastCollected, _ = time.Parse(time.RFC3339, collected)
+	return r
+}
+
+// Due returns true if a new bundle was requested and the last one was
+// collected long enough ago.
+func (r supportBundleRequest) Due(now time.Time) bool {
+	if r.Token == "" || r.Token == r.LastToken {
+		return false
+	}
+	return r.LastCollected.IsZero() || now.Sub(r.LastCollected) >= supportBundleMinInterval
+}
+
+// Status returns the last collected bundle in the form written to the XR
+// status, or nil if none was ever collected.
+func (r supportBundleRequest) Status() map[string]any {
+	if r.LastToken == "" {
+		return nil
+	}
+	return map[string]any{
+		"token":         r.LastToken,
+		"collectedTime": r.LastCollected.UTC().Format(time.RFC3339),
+	}
+}
+
+// A supportBundle captures what a single RunFunction invocation saw and
+// decided, for attaching to support tickets.
+type supportBundle struct {
+	Token      string         `json:"token"`
+	Collected  time.Time      `json:"collectedTime"`
+	Version    string         `json:"version"`
+	Tag        string         `json:"tag"`
+	Parameters any            `json:"parameters"`
+	APICalls   []capturedCall `json:"apiCalls"`
+	Status     any            `json:"status"`
+	Results    []string       `json:"results"`
+}
+
+type capturedCall struct {
+	Service    string `json:"service"`
+	Operation  string `json:"operation"`
+	RequestID  string `json:"requestId"`
+	Attempts   int    `json:"attempts"`
+	Throttles  int    `json:"throttles"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+	Input      any    `json:"input,omitempty"`
+	Output     any    `json:"output,omitempty"`
+}
+
+// newSupportBundle returns a sanitized support bundle. Sensitive fields are
+// redacted and oversized payloads dropped.
+func newSupportBundle(token string, now time.Time, tag string, params *parameters, calls []apiCall, status map[string]any, results []string) *supportBundle {
+	b := &supportBundle{
+		Token:      token,
+		Collected:  now.UTC(),
+		Version:    functionVersion(),
+		Tag:        tag,
+		Parameters: sanitize(params),
+		APICalls:   make([]capturedCall, len(calls)),
+		Status:     sanitize(status),
+		Results:    results,
+	}
+	for i, c := range calls {
+		cc := capturedCall{
+			Service:    c.Service,
+			Operation:  c.Operation,
+			RequestID:  c.RequestID,
+			Attempts:   c.Attempts,
+			Throttles:  c.Throttles,
+			DurationMs: c.Duration.Milliseconds(),
+			Input:      sanitize(c.Input),
+			Output:     sanitize(c.Output),
+		}
+		if c.Err != nil {
+			cc.Error = c.Err.Error()
+		}
+		b.APICalls[i] = cc
+	}
+	return b
+}
+
+// Log writes the bundle to the log as a single JSON blob.
+func (b *supportBundle) Log(log logging.Logger) {
+	j, err := json.Marshal(b)
+	if err != nil {
+		log.Info("Cannot encode support bundle", "error", err)
+		return
+	}
+	log.Info("Support bundle", "token", b.Token, "bundle", string(j))
+}
+
+// sanitize returns v as plain JSON values with sensitive fields redacted.
+// Values that can't be encoded, or are too large, are replaced by a note.
+func sanitize(v any) any {
+	if v == nil {
+		return nil
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return map[string]any{"unencodable": err.Error()}
+	}
+	if len(j) > maxCapturedPayloadBytes {
+		return map[string]any{"truncatedBytes": len(j)}
+	}
+	var out any
+	if err := json.Unmarshal(j, &out); err != nil {
+		return map[string]any{"unencodable": err.Error()}
+	}
+	return redact(out)
+}
+
+func redact(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			if isSensitive(k) {
+				t[k] = redacted
+				continue
+			}
+			t[k] = redact(e)
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = redact(e)
+		}
+	}
+	return v
+}
+
+func isSensitive(field string) bool {
+	f := strings.ToLower(field)
+	for _, s := range sensitiveFields {
+		if strings.Contains(f, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSupportBundleRequestDue(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	cases := map[string]struct {
+		reason string
+		r      supportBundleRequest
+		want   bool
+	}{
+		"NotRequested": {
+			reason: "No bundle should be collected without the annotation.",
+			r:      supportBundleRequest{},
+			want:   false,
+		},
+		"FirstRequest": {
+			reason: "The first requested bundle should be collected.",
+			r:      supportBundleRequest{Token: "case-123"},
+			want:   true,
+		},
+		"AlreadyCollected": {
+			reason: "A bundle should only be collected once per token.",
+			r:      supportBundleRequest{Token: "case-123", LastToken: "case-123", LastCollected: now.Add(-time.Hour)},
+			want:   false,
+		},
+		"RateLimited": {
+			reason: "A new token shouldn't trigger a bundle shortly after the last one.",
+			r:      supportBundleRequest{Token: "case-124", LastToken: "case-123", LastCollected: now.Add(-time.Minute)},
+			want:   false,
+		},
+		"NewToken": {
+			reason: "A new token should trigger a bundle once the minimum interval has passed.",
+			r:      supportBundleRequest{Token: "case-124", LastToken: "case-123", LastCollected: now.Add(-supportBundleMinInterval)},
+			want:   true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.r.Due(now); got != tc.want {
+				t.Errorf("%s\nDue(...): want %t, got %t", tc.reason, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	type input struct {
+		UserId    *string
+		Passwords []string
+		Nested    map[string]any
+	}
+	id := "app1"
+
+	cases := map[string]struct {
+		reason string
+		v      any
+		want   any
+	}{
+		"Redacted": {
+			reason: "Sensitive fields should be redacted at any depth, leaving the rest intact.",
+			v: input{
+				UserId:    &id,
+				Passwords: []string{"hunter2"},
+				Nested:    map[string]any{"list": []any{map[string]any{"AuthToken": "abc", "Name": "x"}}},
+			},
+			want: map[string]any{
+				"UserId":    "app1",
+				"Passwords": redacted,
+				"Nested":    map[string]any{"list": []any{map[string]any{"AuthToken": redacted, "Name": "x"}}},
+			},
+		},
+		"TooLarge": {
+			reason: "Oversized payloads should be replaced by their size.",
+			v:      map[string]any{"blob": strings.Repeat("a", maxCapturedPayloadBytes)},
+			want:   map[string]any{"truncatedBytes": maxCapturedPayloadBytes + len(`{"blob":""}`)},
+		},
+		"Nil": {
+			reason: "Nil should stay nil so it's omitted.",
+			v:      nil,
+			want:   nil,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := sanitize(tc.v)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nsanitize(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+)
+
+// tagPolicyAllSupported in a tag policy's enforced_for enforces it for every
+// ElastiCache resource type that supports it.
+const tagPolicyAllSupported = "elasticache:ALL_SUPPORTED"
+
+type tagPolicyParameters struct {
+	// Enabled checks the tags the function writes against the account's
+	// effective tag policy before writing any.
+	Enabled bool
+}
+
+// organizationsAPI is the subset of the AWS Organizations API used to read
+// tag policies.
+type organizationsAPI interface {
+	DescribeEffectivePolicy(ctx context.Context, in *organizations.DescribeEffectivePolicyInput, o ...func(*organizations.Options)) (*organizations.DescribeEffectivePolicyOutput, error)
+}
+
+// organizationsClient returns a client of the AWS Organizations API.
+func (f *Function) organizationsClient(cfg aws.Config) organizationsAPI {
+	if f.organizations != nil {
+		return f.organizations
+	}
+	return organizations.NewFromConfig(cfg, func(o *organizations.Options) {
+		o.BaseEndpoint = f.endpoint("organizations")
+	})
+}
+
+// A tagPolicy is an account's effective AWS Organizations tag policy, keyed by
+// lower case tag key.
+type tagPolicy map[string]tagPolicyRule
+
+// A tagPolicyRule is what a tag policy requires of one tag.
+type tagPolicyRule struct {
+	// Key is the tag key's required capitalization.
+	Key string `json:"tag_key"`
+
+	// Values are the tag's allowed values. A value ending in * allows any
+	// value with that prefix. Any value is allowed if there are none.
+	Values []string `json:"tag_value"`
+
+	// EnforcedFor are the resource types AWS rejects non-compliant tags
+	// of, e.g. elasticache:usergroup. Non-compliant tags of other resource
+	// types are only reported by AWS.
+	EnforcedFor []string `json:"enforced_for"`
+}
+
+// describeTagPolicy returns the effective tag policy of the caller's account.
+// It returns nil if the account has none, e.g. because it isn't in an
+// organization.
+func describeTagPolicy(ctx context.Context, client organizationsAPI) (tagPolicy, error) {
+	out, err := client.DescribeEffectivePolicy(ctx, &organizations.DescribeEffectivePolicyInput{PolicyType: orgtypes.EffectivePolicyTypeTagPolicy})
+	var ae smithy.APIError
+	switch {
+	case awsclient.Kind(err) == awsclient.ErrNotFound:
+		return nil, nil
+	case errors.As(err, &ae) && ae.ErrorCode() == "AWSOrganizationsNotInUseException":
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to describe the effective tag policy: %w", err)
+	case out.EffectivePolicy == nil:
+		return nil, nil
+	}
+	return parseTagPolicy(aws.ToString(out.EffectivePolicy.PolicyContent))
+}
+
+// parseTagPolicy parses the content of an effective tag policy.
+func parseTagPolicy(content string) (tagPolicy, error) {
+	doc := struct {
+		Tags map[string]tagPolicyRule `json:"tags"`
+	}{}
+	if err := json.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, fmt.Errorf("cannot parse the effective tag policy: %w", err)
+	}
+	p := make(tagPolicy, len(doc.Tags))
+	for k, r := range doc.Tags {
+		p[strings.ToLower(k)] = r
+	}
+	return p, nil
+}
+
+// A tagViolation is a tag that doesn't comply with a tag policy.
+type tagViolation struct {
+	ResourceType string
+	Key          string
+	Value        string
+	Reason       string
+
+	// Enforced is true if AWS rejects the tag.
+	Enforced bool
+}
+
+func (v tagViolation) String() string {
+	return fmt.Sprintf("tag %s=%s of %s %s", v.Key, v.Value, v.ResourceType, v.Reason)
+}
+
+// Check returns the supplied tags of a resource of the supplied type that
+// don't comply with the policy, sorted by key.
+func (p tagPolicy) Check(resourceType string, tags map[string]string) []tagViolation {
+	var out []tagViolation
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		r, ok := p[strings.ToLower(k)]
+		if !ok {
+			continue
+		}
+		v := tagViolation{
+			ResourceType: resourceType,
+			Key:          k,
+			Value:        tags[k],
+			Enforced:     slices.Contains(r.EnforcedFor, resourceType) || slices.Contains(r.EnforcedFor, tagPolicyAllSupported),
+		}
+		switch {
+		case r.Key != "" && r.Key != k:
+			v.Reason = fmt.Sprintf("must be capitalized %s", r.Key)
+		case len(r.Values) > 0 && !slices.ContainsFunc(r.Values, func(allowed string) bool { return tagValueAllowed(allowed, tags[k]) }):
+			v.Reason = fmt.Sprintf("must have one of the values %s", strings.Join(r.Values, ", "))
+		default:
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// tagValueAllowed returns true if a tag policy's allowed value allows value.
+func tagValueAllowed(allowed, value string) bool {
+	if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+		return strings.HasPrefix(value, prefix)
+	}
+	return allowed == value
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/smithy-go"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeOrganizations returns an effective tag policy with the supplied content.
+type fakeOrganizations struct {
+	content string
+	err     error
+}
+
+func (f *fakeOrganizations) DescribeEffectivePolicy(_ context.Context, _ *organizations.DescribeEffectivePolicyInput, _ ...func(*organizations.Options)) (*organizations.DescribeEffectivePolicyOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &organizations.DescribeEffectivePolicyOutput{EffectivePolicy: &orgtypes.EffectivePolicy{PolicyContent: aws.String(f.content)}}, nil
+}
+
+func TestDescribeTagPolicy(t *testing.T) {
+	type want struct {
+		tp  tagPolicy
+		err bool
+	}
+
+	cases := map[string]struct {
+		reason string
+		client *fakeOrganizations
+		want   want
+	}{
+		"Policy": {
+			reason: "A tag policy should be keyed by lower case tag key.",
+			client: &fakeOrganizations{content: `{"tags": {"Managed-By": {"tag_key": "Managed-By", "tag_value": ["usergroup-manager"], "enforced_for": ["elasticache:usergroup"]}}}`},
+			want: want{tp: tagPolicy{"managed-by": {
+				Key:         "Managed-By",
+				Values:      []string{"usergroup-manager"},
+				EnforcedFor: []string{"elasticache:usergroup"},
+			}}},
+		},
+		"NoPolicy": {
+			reason: "An account without an effective tag policy shouldn't have one.",
+			client: &fakeOrganizations{err: &smithy.GenericAPIError{Code: "EffectivePolicyNotFoundException"}},
+		},
+		"NotInOrganization": {
+			reason: "An account that isn't in an organization shouldn't have a tag policy.",
+			client: &fakeOrganizations{err: &smithy.GenericAPIError{Code: "AWSOrganizationsNotInUseException"}},
+		},
+		"Denied": {
+			reason: "Failing to describe the tag policy should return an error.",
+			client: &fakeOrganizations{err: &smithy.GenericAPIError{Code: "AccessDeniedException"}},
+			want:   want{err: true},
+		},
+		"Malformed": {
+			reason: "A tag policy that can't be parsed should return an error.",
+			client: &fakeOrganizations{content: `{"tags": [`},
+			want:   want{err: true},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tp, err := describeTagPolicy(context.Background(), tc.client)
+			got := want{tp: tp, err: err != nil}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\ndescribeTagPolicy(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestTagPolicyCheck(t *testing.T) {
+	tp := tagPolicy{
+		"managed-by": {Key: "managed-by", Values: []string{functionName}, EnforcedFor: []string{resourceTypeUserGroup}},
+		"composite":  {Key: "Composite", EnforcedFor: []string{tagPolicyAllSupported}},
+		"claim":      {Values: []string{"team-*"}},
+	}
+
+	cases := map[string]struct {
+		reason       string
+		resourceType string
+		tags         map[string]string
+		want         []tagViolation
+	}{
+		"Compliant": {
+			reason:       "Tags with an allowed value, and tags the policy doesn't cover, should comply.",
+			resourceType: resourceTypeUserGroup,
+			tags:         map[string]string{"managed-by": functionName, "claim": "team-a/app", "owner": "anyone"},
+		},
+		"Capitalization": {
+			reason:       "A tag key capitalized differently from the policy should be enforced for every supported resource type.",
+			resourceType: resourceTypeUser,
+			tags:         map[string]string{"composite": "default/prod"},
+			want: []tagViolation{{
+				ResourceType: resourceTypeUser,
+				Key:          "composite",
+				Value:        "default/prod",
+				Reason:       "must be capitalized Composite",
+				Enforced:     true,
+			}},
+		},
+		"Value": {
+			reason:       "A tag value the policy doesn't allow should be enforced for the resource types the policy enforces it for.",
+			resourceType: resourceTypeUserGroup,
+			tags:         map[string]string{"managed-by": "someone"},
+			want: []tagViolation{{
+				ResourceType: resourceTypeUserGroup,
+				Key:          "managed-by",
+				Value:        "someone",
+				Reason:       "must have one of the values " + functionName,
+				Enforced:     true,
+			}},
+		},
+		"NotEnforced": {
+			reason:       "A tag value the policy doesn't allow shouldn't be enforced for other resource types.",
+			resourceType: resourceTypeUser,
+			tags:         map[string]string{"managed-by": "someone", "claim": "other/app"},
+			want: []tagViolation{
+				{ResourceType: resourceTypeUser, Key: "claim", Value: "other/app", Reason: "must have one of the values team-*"},
+				{ResourceType: resourceTypeUser, Key: "managed-by", Value: "someone", Reason: "must have one of the values " + functionName},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := tp.Check(tc.resourceType, tc.tags)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\ntp.Check(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/response"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/membership"
+)
+
+type teardownParameters struct {
+	// DrainUserGroup removes every user but those named default from the
+	// target user group of direct mode while the XR is being deleted, so
+	// deleting the users or the user group isn't blocked on its membership.
+	DrainUserGroup bool
+}
+
+// teardown handles a run while the XR is being deleted. Users aren't
+// discovered and nothing is composed, so no users are added to user groups
+// and the user groups the function composes are deleted with the XR. With
+// spec.parameters.teardown.drainUserGroup the target user group of direct
+// mode is drained. Names are hashed with names before they're logged or
+// emitted as events.
+func (f *Function) teardown(ctx context.Context, rsp *fnv1.RunFunctionResponse, client awsclient.ElastiCache, params *parameters, names *nameHasher, diagnose func(error) error) *fnv1.RunFunctionResponse {
+	f.log.Info("XR is being deleted, not discovering users")
+	if !params.Teardown.DrainUserGroup || params.ManagementMode != managementModeDirect || params.UserGroupID == "" {
+		response.ConditionTrue(rsp, "TeardownInProgress", "Deleting").TargetCompositeAndClaim()
+		return rsp
+	}
+
+	// The XR is still being deleted, so a failure doesn't make the
+	// condition False
+	failed := func(err error) {
+		err = diagnose(err)
+		response.ConditionTrue(rsp, "TeardownInProgress", failureReason(err, "DrainFailed")).WithMessage(err.Error()).TargetCompositeAndClaim()
+		if !awsclient.IsTransient(err) {
+			response.Warning(rsp, err).TargetCompositeAndClaim()
+		}
+	}
+
+	r, err := membership.DescribeDrain(ctx, client, params.UserGroupID)
+	switch {
+	case err != nil:
+		failed(err)
+	case r == nil || r.Diff.Empty():
+		response.ConditionTrue(rsp, "TeardownInProgress", "Drained").TargetCompositeAndClaim()
+	case !params.Features.Enabled(featureApplyMode) || params.DryRun:
+		response.Normal(rsp, names.HashDiff(r.Diff).String()).TargetCompositeAndClaim()
+		response.ConditionTrue(rsp, "TeardownInProgress", "DrainPlanned").
+			WithMessage(fmt.Sprintf("Not draining user group %q without the applyMode feature, or in a dry run", r.UserGroupID)).
+			TargetCompositeAndClaim()
+	case r.Pending != "":
+		response.ConditionTrue(rsp, "TeardownInProgress", "WaitingToSettle").
+			WithMessage(fmt.Sprintf("Waiting for user group %q to be active to drain it; it's %s", r.UserGroupID, r.Pending)).
+			TargetCompositeAndClaim()
+		rsp.Meta.Ttl = durationpb.New(settleRequeueInterval)
+	default:
+		if err := r.Apply(ctx, client, nil); err != nil {
+			failed(err)
+			break
+		}
+		f.log.Info("Drained user group membership", "userGroupId", names.Hash(r.UserGroupID), "removed", len(r.Diff.Removed))
+		response.Normal(rsp, names.HashDiff(r.Diff).String()).TargetCompositeAndClaim()
+		response.ConditionTrue(rsp, "TeardownInProgress", "Draining").TargetCompositeAndClaim()
+		rsp.Meta.Ttl = durationpb.New(settleRequeueInterval)
+	}
+	return rsp
+}
@@ -0,0 +1,40 @@
+package main
+
+import "fmt"
+
+type telemetryParameters struct {
+	// Enabled is false for compositions that must not export telemetry,
+	// e.g. because it contains their resource names. No metrics are recorded
+	// for them.
+	Enabled bool
+
+	// SampleRate is the fraction of runs whose AWS API calls are counted in
+	// metrics, or a negative number to use the function's sample rate. The
+	// lower of the two applies.
+	SampleRate float64
+
+	// HashNames replaces names in metrics labels, logs and events with a
+	// keyed hash. See nameHasher.
+	HashNames bool
+}
+
+// sampleRate returns the fraction of runs to record telemetry for, given the
+// function's sample rate.
+func (p telemetryParameters) sampleRate(server float64) float64 {
+	if !p.Enabled {
+		return 0
+	}
+	if p.SampleRate >= 0 {
+		return min(p.SampleRate, server)
+	}
+	return server
+}
+
+// validateSampleRate returns an error if rate isn't a fraction between zero
+// and one.
+func validateSampleRate(rate float64) error {
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("telemetry sample rate must be between 0 and 1, got %v", rate)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTelemetrySampleRate(t *testing.T) {
+	cases := map[string]struct {
+		reason string
+		p      telemetryParameters
+		server float64
+		want   float64
+	}{
+		"ServerRate": {
+			reason: "The function's sample rate should apply when the composition doesn't set one.",
+			p:      telemetryParameters{Enabled: true, SampleRate: -1},
+			server: 0.5,
+			want:   0.5,
+		},
+		"Lower": {
+			reason: "A composition should be able to lower the sample rate.",
+			p:      telemetryParameters{Enabled: true, SampleRate: 0.1},
+			server: 0.5,
+			want:   0.1,
+		},
+		"Higher": {
+			reason: "A composition shouldn't be able to raise the sample rate.",
+			p:      telemetryParameters{Enabled: true, SampleRate: 1},
+			server: 0.5,
+			want:   0.5,
+		},
+		"OptedOut": {
+			reason: "Compositions that opted out should never be sampled.",
+			p:      telemetryParameters{Enabled: false, SampleRate: 1},
+			server: 1,
+			want:   0,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := tc.p.sampleRate(tc.server)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nsampleRate(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
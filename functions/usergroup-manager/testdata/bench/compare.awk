@@ -0,0 +1,53 @@
+# compare.awk compares two sets of go test -bench -benchmem results, the
+# baseline first, and fails if the mean ns/op or allocs/op of a benchmark in
+# both grew by more than threshold percent. Benchmarks are matched by name,
+# ignoring the GOMAXPROCS suffix.
+#
+#	awk -v threshold=20 -f compare.awk baseline.txt bench.txt
+
+FNR == 1 { set++ }
+
+/^Benchmark/ {
+	name = $1
+	sub(/-[0-9]+$/, "", name)
+	if (!(name in seen)) {
+		seen[name] = 1
+		order[++n] = name
+	}
+	for (i = 3; i < NF; i += 2) {
+		if ($(i + 1) == "ns/op" || $(i + 1) == "allocs/op") {
+			sum[set, name, $(i + 1)] += $i
+			count[set, name, $(i + 1)]++
+		}
+	}
+}
+
+END {
+	metrics[1] = "ns/op"
+	metrics[2] = "allocs/op"
+	printf "%-28s %-10s %14s %14s %8s\n", "benchmark", "metric", "baseline", "new", "delta"
+	for (k = 1; k <= n; k++) {
+		for (m = 1; m <= 2; m++) {
+			name = order[k]
+			metric = metrics[m]
+			if (!count[1, name, metric] || !count[2, name, metric]) {
+				continue
+			}
+			old = sum[1, name, metric] / count[1, name, metric]
+			new = sum[2, name, metric] / count[2, name, metric]
+			delta = 0
+			if (old > 0) {
+				delta = (new - old) / old * 100
+			} else if (new > 0) {
+				delta = 100
+			}
+			verdict = ""
+			if (delta > threshold) {
+				verdict = "  regression"
+				failed = 1
+			}
+			printf "%-28s %-10s %14.0f %14.0f %+7.1f%%%s\n", name, metric, old, new, delta, verdict
+		}
+	}
+	exit failed
+}
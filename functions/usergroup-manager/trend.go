@@ -0,0 +1,115 @@
+package main
+
+import (
+	"time"
+
+	"github.com/crossplane/function-sdk-go/resource"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/status"
+)
+
+// maxUserCountHistory is the number of user count changes kept in status.
+const maxUserCountHistory = 10
+
+// defaultUserCountDropThreshold is the fraction of users that must disappear
+// between two runs to be flagged as an anomaly.
+const defaultUserCountDropThreshold = 0.3
+
+type userCountAnomalyParameters struct {
+	// DropThreshold is the fraction of users, between 0 and 1, that must
+	// disappear between runs to be flagged. Zero disables the check.
+	DropThreshold float64
+}
+
+// A userCountSample records how many users were discovered at a time.
+type userCountSample struct {
+	Time  time.Time
+	Count int
+}
+
+// observedUserCountHistory returns the user count history recorded in the
+// observed XR's status, oldest first. Malformed samples are skipped.
+func observedUserCountHistory(oxr *resource.Composite) []userCountSample {
+	v, err := oxr.Resource.GetValue(status.Path("userCountHistory"))
+	if err != nil {
+		return nil
+	}
+	l, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+	out := make([]userCountSample, 0, len(l))
+	for _, e := range l {
+		m, ok := e.(map[string]any)
+		if !ok {
+			continue
+		}
+		ts, _ := m["time"].(string)
+		t, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			continue
+		}
+		var n int
+		switch c := m["count"].(type) {
+		case int64:
+			n = int(c)
+		case float64:
+			n = int(c)
+		default:
+			continue
+		}
+		out = append(out, userCountSample{Time: t, Count: n})
+	}
+	return out
+}
+
+// recordUserCount returns the history with count appended if it differs from
+// the last recorded count. Only changes are recorded, so the status doesn't
+// change on every run. The oldest samples are dropped to keep at most
+// maxUserCountHistory.
+func recordUserCount(history []userCountSample, count int, now time.Time) []userCountSample {
+	if len(history) > 0 && history[len(history)-1].Count == count {
+		return history
+	}
+	history = append(history, userCountSample{Time: now, Count: count})
+	if len(history) > maxUserCountHistory {
+		history = history[len(history)-maxUserCountHistory:]
+	}
+	return history
+}
+
+// userCountDrop returns the previous user count and the fraction of it that
+// disappeared, and true if the fraction meets threshold. A partial loss like
+// this is typical of IAM permission changes that hide some users. The
+// previous count is the last one recorded that differs from count, so a drop
+// stays flagged until the count changes again.
+func userCountDrop(history []userCountSample, count int, threshold float64) (int, float64, bool) {
+	if threshold <= 0 {
+		return 0, 0, false
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		prev := history[i].Count
+		if prev == count {
+			continue
+		}
+		if prev == 0 || count > prev {
+			return prev, 0, false
+		}
+		drop := float64(prev-count) / float64(prev)
+		return prev, drop, drop >= threshold
+	}
+	return 0, 0, false
+}
+
+// userCountHistoryStatus returns the history in the form written to the XR
+// status.
+func userCountHistoryStatus(history []userCountSample) []any {
+	out := make([]any, len(history))
+	for i, s := range history {
+		out[i] = map[string]any{
+			"time":  s.Time.UTC().Format(time.RFC3339),
+			"count": s.Count,
+		}
+	}
+	return out
+}
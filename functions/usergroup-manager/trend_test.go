@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecordUserCount(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := t0.Add(time.Hour)
+
+	full := make([]userCountSample, maxUserCountHistory)
+	for i := range full {
+		full[i] = userCountSample{Time: t0, Count: i}
+	}
+
+	cases := map[string]struct {
+		reason  string
+		history []userCountSample
+		count   int
+		want    []userCountSample
+	}{
+		"First": {
+			reason: "The first count should be recorded.",
+			count:  10,
+			want:   []userCountSample{{Time: now, Count: 10}},
+		},
+		"Unchanged": {
+			reason:  "An unchanged count shouldn't be recorded.",
+			history: []userCountSample{{Time: t0, Count: 10}},
+			count:   10,
+			want:    []userCountSample{{Time: t0, Count: 10}},
+		},
+		"Changed": {
+			reason:  "A changed count should be recorded.",
+			history: []userCountSample{{Time: t0, Count: 10}},
+			count:   7,
+			want:    []userCountSample{{Time: t0, Count: 10}, {Time: now, Count: 7}},
+		},
+		"Full": {
+			reason:  "The oldest count should be dropped once the history is full.",
+			history: full,
+			count:   100,
+			want:    append(full[1:len(full):len(full)], userCountSample{Time: now, Count: 100}),
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := recordUserCount(tc.history, tc.count, now)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nrecordUserCount(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestUserCountDrop(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type want struct {
+		prev    int
+		drop    float64
+		anomaly bool
+	}
+
+	cases := map[string]struct {
+		reason    string
+		history   []userCountSample
+		count     int
+		threshold float64
+		want      want
+	}{
+		"NoHistory": {
+			reason:    "Nothing should be flagged without a previous count.",
+			count:     10,
+			threshold: 0.3,
+		},
+		"SmallDrop": {
+			reason:    "A drop below the threshold shouldn't be flagged.",
+			history:   []userCountSample{{Time: t0, Count: 10}},
+			count:     8,
+			threshold: 0.3,
+			want:      want{prev: 10, drop: 0.2},
+		},
+		"LargeDrop": {
+			reason:    "A drop meeting the threshold should be flagged.",
+			history:   []userCountSample{{Time: t0, Count: 10}},
+			count:     6,
+			threshold: 0.3,
+			want:      want{prev: 10, drop: 0.4, anomaly: true},
+		},
+		"StillDropped": {
+			reason:    "A drop should stay flagged after the lower count is recorded.",
+			history:   []userCountSample{{Time: t0, Count: 10}, {Time: t0.Add(time.Hour), Count: 6}},
+			count:     6,
+			threshold: 0.3,
+			want:      want{prev: 10, drop: 0.4, anomaly: true},
+		},
+		"Growth": {
+			reason:    "An increase shouldn't be flagged.",
+			history:   []userCountSample{{Time: t0, Count: 10}},
+			count:     20,
+			threshold: 0.3,
+			want:      want{prev: 10},
+		},
+		"Disabled": {
+			reason:  "Nothing should be flagged when the threshold is zero.",
+			history: []userCountSample{{Time: t0, Count: 10}},
+			count:   0,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			prev, drop, anomaly := userCountDrop(tc.history, tc.count, tc.threshold)
+			got := want{prev: prev, drop: drop, anomaly: anomaly}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nuserCountDrop(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
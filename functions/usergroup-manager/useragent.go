@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"runtime/debug"
+)
+
+// functionName identifies this function in the AWS user agent.
+const functionName = "usergroup-manager"
+
+// version is the function's version. Release builds may set it with
+// -ldflags "-X main.version=v1.2.3"; otherwise the module version recorded in
+// the build info is used.
+var version = ""
+
+// functionVersion returns the version reported in the AWS user agent.
+func functionVersion() string {
+	if version != "" {
+		return version
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" {
+		return bi.Main.Version
+	}
+	return "unknown"
+}
+
+// xrHash returns a short, stable hash of an XR's namespace and name. It's sent
+// in the AWS user agent so CloudTrail entries can be attributed to a
+// composition without disclosing the XR's name.
+func xrHash(namespace, name string) string {
+	sum := sha256.Sum256([]byte(namespace + "/" + name))
+	return hex.EncodeToString(sum[:6])
+}
+
+// appID returns the AWS SDK app ID for requests made on behalf of an XR. The
+// SDK recommends app IDs of at most 50 characters.
+func appID(namespace, name string) string {
+	return functionName + "-" + xrHash(namespace, name)
+}
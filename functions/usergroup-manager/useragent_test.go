@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAppID(t *testing.T) {
+	type args struct {
+		namespace string
+		name      string
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   string
+	}{
+		"Namespaced": {
+			reason: "The app ID should contain a hash of the XR's namespace and name.",
+			args:   args{namespace: "team-a", name: "prod-cache"},
+			want:   "usergroup-manager-c73864f1af1a",
+		},
+		"DifferentNamespace": {
+			reason: "XRs with the same name in different namespaces should have different app IDs.",
+			args:   args{namespace: "team-b", name: "prod-cache"},
+			want:   "usergroup-manager-c16bae0d024d",
+		},
+		"ClusterScoped": {
+			reason: "Cluster scoped XRs have no namespace, but should still get a stable app ID.",
+			args:   args{name: "prod-cache"},
+			want:   "usergroup-manager-e1d2b6d96951",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := appID(tc.args.namespace, tc.args.name)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nappID(...): -want, +got:\n%s", tc.reason, diff)
+			}
+			if len(got) > 50 {
+				t.Errorf("%s\nappID(...): %q is longer than 50 characters", tc.reason, got)
+			}
+		})
+	}
+
+}
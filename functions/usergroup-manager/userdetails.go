@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/request"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/awsclient"
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// needUserDetailsKey is the pipeline context key an earlier step sets to the
+// IDs of the users it needs every detail of, e.g. their access strings, which
+// aren't kept by discovery.
+const needUserDetailsKey = "needUserDetails"
+
+// userDetailsKey is the pipeline context key holding the details of the users
+// listed in needUserDetails:
+//
+//	userDetails.users.<id>.userId                  string
+//	userDetails.users.<id>.userName                string
+//	userDetails.users.<id>.arn                     string
+//	userDetails.users.<id>.engine                  string
+//	userDetails.users.<id>.status                  string
+//	userDetails.users.<id>.accessString            string
+//	userDetails.users.<id>.minimumEngineVersion    string
+//	userDetails.users.<id>.userGroupIds            []string
+//	userDetails.users.<id>.authenticationType      string, only set if known
+//	userDetails.users.<id>.passwordCount           number, only set if known
+//	userDetails.notFound                           []string, IDs of users that don't exist
+const userDetailsKey = "userDetails"
+
+// maxUserDetails is the most users whose details are looked up in one run,
+// so a misbehaving step can't turn lookups into a full listing.
+const maxUserDetails = 500
+
+// requestedUserDetails returns the sorted, unique user IDs listed in the
+// request's needUserDetails context key, at most maxUserDetails of them, and
+// how many more were listed.
+func requestedUserDetails(req *fnv1.RunFunctionRequest) ([]string, int) {
+	v, ok := request.GetContextKey(req, needUserDetailsKey)
+	if !ok {
+		return nil, 0
+	}
+	var ids []string
+	for _, e := range v.GetListValue().GetValues() {
+		if id := e.GetStringValue(); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) > maxUserDetails {
+		return ids[:maxUserDetails], len(ids) - maxUserDetails
+	}
+	return ids, 0
+}
+
+// describeUserDetails looks up the supplied users with targeted DescribeUsers
+// calls, returning their details as written to the userDetails context key.
+func describeUserDetails(ctx context.Context, client awsclient.ElastiCache, ids []string) (map[string]any, error) {
+	users, err := discovery.Describe(ctx, client, ids)
+	if err != nil {
+		return nil, err
+	}
+	details := make(map[string]any, len(users))
+	for _, u := range users {
+		details[aws.ToString(u.UserId)] = userDetails(u)
+	}
+	notFound := []string{}
+	for _, id := range ids {
+		if _, ok := details[id]; !ok {
+			notFound = append(notFound, id)
+		}
+	}
+	return map[string]any{"users": details, "notFound": notFound}, nil
+}
+
+func userDetails(u types.User) map[string]any {
+	groups := append([]string{}, u.UserGroupIds...)
+	slices.Sort(groups)
+	d := map[string]any{
+		"userId":               aws.ToString(u.UserId),
+		"userName":             aws.ToString(u.UserName),
+		"arn":                  aws.ToString(u.ARN),
+		"engine":               strings.ToLower(aws.ToString(u.Engine)),
+		"status":               aws.ToString(u.Status),
+		"accessString":         aws.ToString(u.AccessString),
+		"minimumEngineVersion": aws.ToString(u.MinimumEngineVersion),
+		"userGroupIds":         groups,
+	}
+	if a := u.Authentication; a != nil {
+		d["authenticationType"] = string(a.Type)
+		d["passwordCount"] = int(aws.ToInt32(a.PasswordCount))
+	}
+	return d
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+	"github.com/google/go-cmp/cmp"
+
+	fnv1 "github.com/crossplane/function-sdk-go/proto/v1"
+	"github.com/crossplane/function-sdk-go/resource"
+)
+
+func TestRequestedUserDetails(t *testing.T) {
+	// many lists two more users than are looked up, quoted for JSON
+	many, first := make([]string, maxUserDetails+2), make([]string, maxUserDetails)
+	for i := range many {
+		many[i] = fmt.Sprintf(`"app%04d"`, i)
+		if i < maxUserDetails {
+			first[i] = fmt.Sprintf("app%04d", i)
+		}
+	}
+
+	type want struct {
+		ids     []string
+		dropped int
+	}
+
+	cases := map[string]struct {
+		reason string
+		ctx    string
+		want   want
+	}{
+		"NotRequested": {
+			reason: "Nothing should be looked up if no step asked for it.",
+			ctx:    `{}`,
+		},
+		"Requested": {
+			reason: "The requested IDs should be sorted and deduplicated, ignoring anything that isn't an ID.",
+			ctx:    `{"needUserDetails": ["app2", "app1", "app2", "", 3]}`,
+			want:   want{ids: []string{"app1", "app2"}},
+		},
+		"TooMany": {
+			reason: "At most maxUserDetails users should be looked up.",
+			ctx:    `{"needUserDetails": [` + strings.Join(many, ",") + `]}`,
+			want:   want{ids: first, dropped: 2},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ids, dropped := requestedUserDetails(&fnv1.RunFunctionRequest{Context: resource.MustStructJSON(tc.ctx)})
+			if diff := cmp.Diff(tc.want, want{ids: ids, dropped: dropped}, cmp.AllowUnexported(want{})); diff != "" {
+				t.Errorf("%s\nrequestedUserDetails(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+func TestDescribeUserDetails(t *testing.T) {
+	client := &fakeElastiCache{users: []types.User{
+		{
+			UserId:               aws.String("app1"),
+			UserName:             aws.String("app1"),
+			ARN:                  aws.String("arn:aws:elasticache:us-east-1:123456789012:user:app1"),
+			Engine:               aws.String("Redis"),
+			Status:               aws.String("active"),
+			AccessString:         aws.String("on ~app:* +@read"),
+			MinimumEngineVersion: aws.String("6.0"),
+			UserGroupIds:         []string{"ops", "app"},
+			Authentication:       &types.Authentication{Type: types.AuthenticationTypePassword, PasswordCount: aws.Int32(2)},
+		},
+		{UserId: aws.String("app2"), UserName: aws.String("app2")},
+	}}
+
+	want := map[string]any{
+		"users": map[string]any{
+			"app1": map[string]any{
+				"userId":               "app1",
+				"userName":             "app1",
+				"arn":                  "arn:aws:elasticache:us-east-1:123456789012:user:app1",
+				"engine":               engineRedis,
+				"status":               "active",
+				"accessString":         "on ~app:* +@read",
+				"minimumEngineVersion": "6.0",
+				"userGroupIds":         []string{"app", "ops"},
+				"authenticationType":   "password",
+				"passwordCount":        2,
+			},
+		},
+		"notFound": []string{"gone"},
+	}
+	got, err := describeUserDetails(context.Background(), client, []string{"app1", "gone"})
+	if err != nil {
+		t.Fatalf("describeUserDetails(...): %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("describeUserDetails(...): -want, +got:\n%s", diff)
+	}
+}
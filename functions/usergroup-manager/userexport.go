@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// userExportKey is the context key the discovered users are written to, for
+// later steps to compose into a ConfigMap that inventory systems can ingest in
+// bulk rather than parsing the XR status.
+const userExportKey = "userExport"
+
+// userExportResourceName is the composition resource name of the ConfigMap
+// holding the user export.
+const userExportResourceName = "user-export"
+
+// maxUserExportBytes is the most data the user export may hold, leaving room
+// in the ConfigMap for its metadata. The API server rejects ConfigMaps over
+// 1MiB.
+const maxUserExportBytes = 1000 * 1000
+
+// Formats of the user export.
+const (
+	// userExportFormatNDJSON writes one JSON object per user per line.
+	userExportFormatNDJSON = "ndjson"
+	// userExportFormatCSV writes a header line, then one line per user.
+	userExportFormatCSV = "csv"
+)
+
+type userExportParameters struct {
+	Enabled bool
+	Format  string
+	// ConfigMapName is the ConfigMap, in the XR's namespace, later pipeline
+	// steps compose to hold the export. Defaults to the XR's name suffixed
+	// with user-export.
+	ConfigMapName string
+}
+
+// A userExportRecord is one user in the export. Every record names the XR,
+// so exports of a whole fleet can be concatenated.
+type userExportRecord struct {
+	XRNamespace        string   `json:"xrNamespace"`
+	XRName             string   `json:"xrName"`
+	Region             string   `json:"region"`
+	CacheID            string   `json:"cacheId,omitempty"`
+	UserID             string   `json:"userId"`
+	UserName           string   `json:"userName"`
+	Engine             string   `json:"engine"`
+	AuthenticationType string   `json:"authenticationType"`
+	ARN                string   `json:"arn"`
+	UserGroups         []string `json:"userGroups"`
+}
+
+// userExportCSVHeader names the CSV columns, in the order of
+// userExportRecord's fields.
+var userExportCSVHeader = []string{"xrNamespace", "xrName", "region", "cacheId", "userId", "userName", "engine", "authenticationType", "arn", "userGroups"}
+
+// userExportRecords returns a record for each user, sorted by user ID, with
+// the user groups it was assigned to.
+func userExportRecords(xrNamespace, xrName, region, cacheID string, users []discovery.User, groups []userGroupMembership) []userExportRecord {
+	memberOf := map[string][]string{}
+	for _, g := range groups {
+		for _, id := range g.UserIDs {
+			memberOf[id] = append(memberOf[id], g.Name)
+		}
+	}
+
+	out := make([]userExportRecord, len(users))
+	for i, u := range users {
+		ugs := memberOf[u.ID]
+		if ugs == nil {
+			ugs = []string{}
+		}
+		sort.Strings(ugs)
+		out[i] = userExportRecord{
+			XRNamespace:        xrNamespace,
+			XRName:             xrName,
+			Region:             region,
+			CacheID:            cacheID,
+			UserID:             u.ID,
+			UserName:           u.Name,
+			Engine:             u.Engine,
+			AuthenticationType: u.AuthenticationType,
+			ARN:                u.ARN,
+			UserGroups:         ugs,
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UserID < out[j].UserID })
+	return out
+}
+
+// encodeUserExport returns the records in the supplied format. CSV user
+// groups are separated by semicolons.
+func encodeUserExport(records []userExportRecord, format string) (string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case userExportFormatCSV:
+		w := csv.NewWriter(&buf)
+		_ = w.Write(userExportCSVHeader)
+		for _, r := range records {
+			_ = w.Write([]string{r.XRNamespace, r.XRName, r.Region, r.CacheID, r.UserID, r.UserName, r.Engine, r.AuthenticationType, r.ARN, strings.Join(r.UserGroups, ";")})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return "", fmt.Errorf("cannot encode user export: %w", err)
+		}
+	default:
+		enc := json.NewEncoder(&buf)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return "", fmt.Errorf("cannot encode user export: %w", err)
+			}
+		}
+	}
+	return buf.String(), nil
+}
+
+// userExportDataKey returns the ConfigMap data key holding an export in the
+// supplied format.
+func userExportDataKey(format string) string {
+	return "users." + format
+}
+
+// userExportConfigMapName returns the default name of the ConfigMap holding
+// the user export of the named XR.
+func userExportConfigMapName(xrName string) string {
+	return xrName + "-" + userExportResourceName
+}
+
+// userExportContext returns the export in the form written to the pipeline
+// context.
+func userExportContext(configMapName, format, data string) map[string]any {
+	return map[string]any{
+		"configMapName": configMapName,
+		"dataKey":       userExportDataKey(format),
+		"format":        format,
+		"data":          data,
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestEncodeUserExport(t *testing.T) {
+	users := []discovery.User{
+		{ID: "app2", Name: "app2", Engine: engineRedis, AuthenticationType: authenticationTypeIAM, ARN: "arn:aws:elasticache:us-east-1:123456789012:user:app2"},
+		{ID: "app1", Name: "app, one", Engine: engineValkey, AuthenticationType: "password", ARN: "arn:aws:elasticache:us-east-1:123456789012:user:app1"},
+	}
+	groups := []userGroupMembership{
+		{Name: "ops", UserIDs: []string{"app1"}},
+		{Name: "app", UserIDs: []string{"app1"}},
+	}
+	records := userExportRecords("default", "prod", "us-east-1", "orders", users, groups)
+
+	cases := map[string]struct {
+		reason string
+		format string
+		want   string
+	}{
+		"NDJSON": {
+			reason: "Each user should be written as one JSON object per line, sorted by user ID, with the user groups it was assigned to.",
+			format: userExportFormatNDJSON,
+			want: `{"xrNamespace":"default","xrName":"prod","region":"us-east-1","cacheId":"orders","userId":"app1","userName":"app, one","engine":"valkey","authenticationType":"password","arn":"arn:aws:elasticache:us-east-1:123456789012:user:app1","userGroups":["app","ops"]}
+{"xrNamespace":"default","xrName":"prod","region":"us-east-1","cacheId":"orders","userId":"app2","userName":"app2","engine":"redis","authenticationType":"iam","arn":"arn:aws:elasticache:us-east-1:123456789012:user:app2","userGroups":[]}
+`,
+		},
+		"CSV": {
+			reason: "CSV exports should start with a header, quote fields as needed and separate user groups with semicolons.",
+			format: userExportFormatCSV,
+			want: `xrNamespace,xrName,region,cacheId,userId,userName,engine,authenticationType,arn,userGroups
+default,prod,us-east-1,orders,app1,"app, one",valkey,password,arn:aws:elasticache:us-east-1:123456789012:user:app1,app;ops
+default,prod,us-east-1,orders,app2,app2,redis,iam,arn:aws:elasticache:us-east-1:123456789012:user:app2,
+`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := encodeUserExport(records, tc.format)
+			if err != nil {
+				t.Fatalf("%s\nencodeUserExport(...): %v", tc.reason, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("%s\nencodeUserExport(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/service/elasticache/types"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+// User group engines.
+const (
+	engineRedis  = "redis"
+	engineValkey = "valkey"
+)
+
+// userGroupIDPattern matches valid ElastiCache user group IDs: a letter
+// followed by letters, digits and single hyphens, not ending in a hyphen.
+var userGroupIDPattern = regexp.MustCompile(`^[a-zA-Z](-?[a-zA-Z0-9])*$`)
+
+// maxUserGroupIDLength is the longest user group ID ElastiCache accepts.
+const maxUserGroupIDLength = 40
+
+func validUserGroupID(id string) bool {
+	return len(id) <= maxUserGroupIDLength && userGroupIDPattern.MatchString(id)
+}
+
+// A userGroupTarget is a user group whose membership this function discovers,
+// configured in spec.parameters.userGroups.
+type userGroupTarget struct {
+	Name   string
+	Engine string
+	Filter userFilter
+}
+
+// A userFilter selects the discovered users that belong to a user group. A
+// user matches if it satisfies every criterion that is set, so an empty filter
+// matches every user.
+type userFilter struct {
+	UserIDs         []string
+	UserIDPattern   string
+	UserNamePattern string
+}
+
+// authenticationTypeIAM is the authentication type of users that connect
+// using IAM rather than a password.
+const authenticationTypeIAM = string(types.AuthenticationTypeIam)
+
+// Matches returns true if the user satisfies the filter.
+func (f userFilter) Matches(u discovery.User) bool {
+	if len(f.UserIDs) > 0 && !slices.Contains(f.UserIDs, u.ID) {
+		return false
+	}
+	if f.UserIDPattern != "" {
+		if ok, _ := path.Match(f.UserIDPattern, u.ID); !ok {
+			return false
+		}
+	}
+	if f.UserNamePattern != "" {
+		if ok, _ := path.Match(f.UserNamePattern, u.Name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Accepts returns true if a user of the supplied engine can be added to the
+// group. Valkey user groups also accept Redis OSS users.
+func (t userGroupTarget) Accepts(engine string) bool {
+	return engine == t.Engine || (t.Engine == engineValkey && engine == engineRedis)
+}
+
+// A userGroupMembership is the set of discovered users that belong to a user
+// group target.
+type userGroupMembership struct {
+	Name    string
+	Engine  string
+	UserIDs []string
+}
+
+// A membershipConflict reports a user that matched more than one user group
+// while exclusive membership is enforced.
+type membershipConflict struct {
+	UserID string
+	// Groups are the groups the user matched, in precedence order. The user
+	// was only assigned to the first.
+	Groups []string
+}
+
+// assignUserGroups returns the members of each target, in the order the
+// targets were configured. A user may belong to several groups unless
+// exclusive is true, in which case it's only assigned to the first group it
+// matches, in configuration order, and a conflict is returned for each user
+// that matched more than one.
+func assignUserGroups(targets []userGroupTarget, users []discovery.User, exclusive bool) ([]userGroupMembership, []membershipConflict) {
+	out := make([]userGroupMembership, len(targets))
+	for i, t := range targets {
+		out[i] = userGroupMembership{Name: t.Name, Engine: t.Engine, UserIDs: []string{}}
+	}
+
+	var conflicts []membershipConflict
+	for _, u := range users {
+		var matched []string
+		for i, t := range targets {
+			if !t.Accepts(u.Engine) || !t.Filter.Matches(u) {
+				continue
+			}
+			if !exclusive || len(matched) == 0 {
+				out[i].UserIDs = append(out[i].UserIDs, u.ID)
+			}
+			matched = append(matched, t.Name)
+		}
+		if exclusive && len(matched) > 1 {
+			conflicts = append(conflicts, membershipConflict{UserID: u.ID, Groups: matched})
+		}
+	}
+	return out, conflicts
+}
+
+// conflictsStatus returns the conflicts in the form written to the XR status,
+// keyed by user ID.
+func conflictsStatus(conflicts []membershipConflict) map[string]any {
+	out := make(map[string]any, len(conflicts))
+	for _, c := range conflicts {
+		groups := make([]any, len(c.Groups))
+		for i, g := range c.Groups {
+			groups[i] = g
+		}
+		out[c.UserID] = map[string]any{
+			"matched":    groups,
+			"assignedTo": c.Groups[0],
+		}
+	}
+	return out
+}
+
+// userGroupsStatus returns the memberships in the form written to the XR
+// status, keyed by user group name.
+func userGroupsStatus(groups []userGroupMembership) map[string]any {
+	out := make(map[string]any, len(groups))
+	for _, g := range groups {
+		out[g.Name] = map[string]any{
+			"engine":  g.Engine,
+			"users":   len(g.UserIDs),
+			"userIDs": g.UserIDs,
+		}
+	}
+	return out
+}
+
+// userGroupsContext returns the memberships in a form that can be written to
+// the pipeline context.
+func userGroupsContext(groups []userGroupMembership) []any {
+	out := make([]any, len(groups))
+	for i, g := range groups {
+		ids := make([]any, len(g.UserIDs))
+		for j, id := range g.UserIDs {
+			ids[j] = id
+		}
+		out[i] = map[string]any{
+			"name":    g.Name,
+			"engine":  g.Engine,
+			"userIDs": ids,
+		}
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/upbound/elasticache-users-v2/functions/usergroup-manager/discovery"
+)
+
+func TestAssignUserGroups(t *testing.T) {
+	users := []discovery.User{
+		{ID: "default", Name: "default", Engine: engineRedis},
+		{ID: "app-1", Name: "app-one", Engine: engineRedis},
+		{ID: "app-2", Name: "app-two", Engine: engineValkey},
+		{ID: "ops-1", Name: "ops-one", Engine: engineValkey},
+	}
+
+	type args struct {
+		targets   []userGroupTarget
+		users     []discovery.User
+		exclusive bool
+	}
+	type want struct {
+		groups    []userGroupMembership
+		conflicts []membershipConflict
+	}
+
+	cases := map[string]struct {
+		reason string
+		args   args
+		want   want
+	}{
+		"EmptyFilter": {
+			reason: "An empty filter should match every user of a compatible engine.",
+			args: args{
+				targets: []userGroupTarget{{Name: "all", Engine: engineRedis}},
+				users:   users,
+			},
+			want: want{groups: []userGroupMembership{{Name: "all", Engine: engineRedis, UserIDs: []string{"default", "app-1"}}}},
+		},
+		"ValkeyAcceptsRedis": {
+			reason: "Valkey user groups should accept both Valkey and Redis OSS users.",
+			args: args{
+				targets: []userGroupTarget{{Name: "all", Engine: engineValkey}},
+				users:   users,
+			},
+			want: want{groups: []userGroupMembership{{Name: "all", Engine: engineValkey, UserIDs: []string{"default", "app-1", "app-2", "ops-1"}}}},
+		},
+		"IndependentFilters": {
+			reason: "Each group should apply its own filter, every criterion of which must match.",
+			args: args{
+				targets: []userGroupTarget{
+					{Name: "app", Engine: engineValkey, Filter: userFilter{UserIDs: []string{"default"}}},
+					{Name: "ops", Engine: engineValkey, Filter: userFilter{UserIDPattern: "*-1", UserNamePattern: "ops-*"}},
+					{Name: "none", Engine: engineRedis, Filter: userFilter{UserIDPattern: "ops-*"}},
+				},
+				users: users,
+			},
+			want: want{groups: []userGroupMembership{
+				{Name: "app", Engine: engineValkey, UserIDs: []string{"default"}},
+				{Name: "ops", Engine: engineValkey, UserIDs: []string{"ops-1"}},
+				{Name: "none", Engine: engineRedis, UserIDs: []string{}},
+			}},
+		},
+		"Overlapping": {
+			reason: "Without exclusive membership a user should be added to every group it matches.",
+			args: args{
+				targets: []userGroupTarget{
+					{Name: "app", Engine: engineValkey, Filter: userFilter{UserIDPattern: "app-*"}},
+					{Name: "ones", Engine: engineValkey, Filter: userFilter{UserIDPattern: "*-1"}},
+				},
+				users: users,
+			},
+			want: want{groups: []userGroupMembership{
+				{Name: "app", Engine: engineValkey, UserIDs: []string{"app-1", "app-2"}},
+				{Name: "ones", Engine: engineValkey, UserIDs: []string{"app-1", "ops-1"}},
+			}},
+		},
+		"Exclusive": {
+			reason: "With exclusive membership a user should only be added to the first group it matches, and the conflict reported.",
+			args: args{
+				targets: []userGroupTarget{
+					{Name: "app", Engine: engineValkey, Filter: userFilter{UserIDPattern: "app-*"}},
+					{Name: "ones", Engine: engineValkey, Filter: userFilter{UserIDPattern: "*-1"}},
+				},
+				users:     users,
+				exclusive: true,
+			},
+			want: want{
+				groups: []userGroupMembership{
+					{Name: "app", Engine: engineValkey, UserIDs: []string{"app-1", "app-2"}},
+					{Name: "ones", Engine: engineValkey, UserIDs: []string{"ops-1"}},
+				},
+				conflicts: []membershipConflict{{UserID: "app-1", Groups: []string{"app", "ones"}}},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			groups, conflicts := assignUserGroups(tc.args.targets, tc.args.users, tc.args.exclusive)
+			if diff := cmp.Diff(tc.want.groups, groups); diff != "" {
+				t.Errorf("%s\nassignUserGroups(...): -want groups, +got groups:\n%s", tc.reason, diff)
+			}
+			if diff := cmp.Diff(tc.want.conflicts, conflicts); diff != "" {
+				t.Errorf("%s\nassignUserGroups(...): -want conflicts, +got conflicts:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// benchmarkUsers returns n Redis OSS users, named like app00042.
+func benchmarkUsers(n int) []discovery.User {
+	users := make([]discovery.User, n)
+	for i := range users {
+		id := fmt.Sprintf("app%05d", i)
+		users[i] = discovery.User{ID: id, Name: id, Engine: engineRedis, AuthenticationType: "password", Status: "active"}
+	}
+	return users
+}
+
+func BenchmarkAssignUserGroups(b *testing.B) {
+	users := benchmarkUsers(10000)
+	targets := []userGroupTarget{
+		{Name: "readers", Engine: engineRedis, Filter: userFilter{UserIDPattern: "app0*"}},
+		{Name: "writers", Engine: engineValkey, Filter: userFilter{UserNamePattern: "app1*"}},
+		{Name: "all", Engine: engineRedis},
+	}
+	b.ResetTimer()
+	for range b.N {
+		assignUserGroups(targets, users, true)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/crossplane/function-sdk-go/logging"
+)
+
+// maxGoroutineDump bounds how much of a goroutine dump is logged when the
+// goroutine threshold is exceeded.
+const maxGoroutineDump = 64 * 1024
+
+// A watchdog periodically samples goroutine count and heap usage and logs a
+// warning when either exceeds its threshold. A zero threshold disables that
+// check.
+type watchdog struct {
+	log           logging.Logger
+	interval      time.Duration
+	maxGoroutines int
+	maxHeapBytes  uint64
+}
+
+// Run samples until the supplied context is cancelled.
+func (w *watchdog) Run(ctx context.Context) {
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			w.sample()
+		}
+	}
+}
+
+func (w *watchdog) sample() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	w.check(runtime.NumGoroutine(), ms.HeapInuse)
+}
+
+// check logs a warning for, counts and returns each threshold the supplied
+// sample exceeds: heap, goroutines or both.
+func (w *watchdog) check(goroutines int, heapInuse uint64) []string {
+	w.log.Debug("Watchdog sample", "goroutines", goroutines, "heapInuseBytes", heapInuse)
+
+	var breached []string
+	if w.maxHeapBytes > 0 && heapInuse > w.maxHeapBytes {
+		watchdogBreaches.WithLabelValues("heap").Inc()
+		w.log.Info("Warning: heap usage exceeds watchdog threshold", "heapInuseBytes", heapInuse, "thresholdBytes", w.maxHeapBytes)
+		breached = append(breached, "heap")
+	}
+
+	if w.maxGoroutines > 0 && goroutines > w.maxGoroutines {
+		watchdogBreaches.WithLabelValues("goroutines").Inc()
+		w.log.Info("Warning: goroutine count exceeds watchdog threshold", "goroutines", goroutines, "threshold", w.maxGoroutines, "dump", goroutineDump())
+		breached = append(breached, "goroutines")
+	}
+	return breached
+}
+
+// goroutineDump returns the stacks of all goroutines, grouped by stack and
+// truncated to maxGoroutineDump bytes.
+func goroutineDump() string {
+	buf := &bytes.Buffer{}
+	if err := pprof.Lookup("goroutine").WriteTo(buf, 1); err != nil {
+		return "cannot dump goroutines: " + err.Error()
+	}
+	if buf.Len() > maxGoroutineDump {
+		return buf.String()[:maxGoroutineDump] + "\n... truncated"
+	}
+	return buf.String()
+}
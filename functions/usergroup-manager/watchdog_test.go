@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/crossplane/function-sdk-go/logging"
+)
+
+func TestWatchdogCheck(t *testing.T) {
+	type want struct {
+		breached []string
+		heap     float64
+		routines float64
+	}
+
+	cases := map[string]struct {
+		reason     string
+		w          *watchdog
+		goroutines int
+		heapInuse  uint64
+		want       want
+	}{
+		"WithinThresholds": {
+			reason:     "A sample at the thresholds shouldn't breach them.",
+			w:          &watchdog{maxGoroutines: 100, maxHeapBytes: 1 << 20},
+			goroutines: 100,
+			heapInuse:  1 << 20,
+		},
+		"HeapBreached": {
+			reason:     "Heap usage above its threshold should be counted.",
+			w:          &watchdog{maxGoroutines: 100, maxHeapBytes: 1 << 20},
+			goroutines: 10,
+			heapInuse:  1<<20 + 1,
+			want:       want{breached: []string{"heap"}, heap: 1},
+		},
+		"GoroutinesBreached": {
+			reason:     "A goroutine count above its threshold should be counted.",
+			w:          &watchdog{maxGoroutines: 100, maxHeapBytes: 1 << 20},
+			goroutines: 101,
+			heapInuse:  1024,
+			want:       want{breached: []string{"goroutines"}, routines: 1},
+		},
+		"BothBreached": {
+			reason:     "Each threshold a sample exceeds should be counted.",
+			w:          &watchdog{maxGoroutines: 100, maxHeapBytes: 1 << 20},
+			goroutines: 101,
+			heapInuse:  1 << 21,
+			want:       want{breached: []string{"heap", "goroutines"}, heap: 1, routines: 1},
+		},
+		"Disabled": {
+			reason:     "A zero threshold should disable its check.",
+			w:          &watchdog{},
+			goroutines: 1 << 20,
+			heapInuse:  1 << 40,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tc.w.log = logging.NewNopLogger()
+			heap, routines := counterValue(t, watchdogBreaches.WithLabelValues("heap")), counterValue(t, watchdogBreaches.WithLabelValues("goroutines"))
+			breached := tc.w.check(tc.goroutines, tc.heapInuse)
+			got := want{
+				breached: breached,
+				heap:     counterValue(t, watchdogBreaches.WithLabelValues("heap")) - heap,
+				routines: counterValue(t, watchdogBreaches.WithLabelValues("goroutines")) - routines,
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(want{}), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("%s\ncheck(...): -want, +got:\n%s", tc.reason, diff)
+			}
+		})
+	}
+}
+
+// counterValue returns the current value of c.
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatalf("Write(...): %v", err)
+	}
+	return m.GetCounter().GetValue()
+}